@@ -0,0 +1,180 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"crud-product/constant"
+	"crud-product/model"
+	"crud-product/repository"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
+	_ "modernc.org/sqlite"
+)
+
+// openDB opens a connection pool for the configured driver and applies the
+// pool limits from config.
+func openDB(cfg model.DatabaseConfig) (*sql.DB, error) {
+	driverName, dsn, err := dataSource(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return openPool(cfg, driverName, dsn)
+}
+
+// openReplicas opens a pool for every configured read replica.
+func openReplicas(cfg model.DatabaseConfig) ([]*sql.DB, error) {
+	driverName, _, err := dataSource(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	replicas := make([]*sql.DB, 0, len(cfg.Replicas))
+	for _, dsn := range cfg.Replicas {
+		db, err := openPool(cfg, driverName, dsn)
+		if err != nil {
+			for _, r := range replicas {
+				r.Close()
+			}
+			return nil, err
+		}
+		replicas = append(replicas, db)
+	}
+
+	return replicas, nil
+}
+
+func openPool(cfg model.DatabaseConfig, driverName, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime))
+	db.SetConnMaxIdleTime(time.Duration(cfg.ConnMaxIdleTime))
+
+	return db, nil
+}
+
+// dataSource returns the database/sql driver name and connection string.
+func dataSource(cfg model.DatabaseConfig) (string, string, error) {
+	switch cfg.Driver {
+	case constant.DriverMySQL:
+		mysqlInfo := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true", cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.Database)
+		return "mysql", mysqlInfo, nil
+	case constant.DriverPostgres:
+		sslMode := cfg.SSLMode
+		if sslMode == "" {
+			sslMode = "disable"
+		}
+
+		postgresInfo := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s", cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Database, sslMode)
+		return "postgres", postgresInfo, nil
+	case constant.DriverSQLite:
+		if err := os.MkdirAll(filepath.Dir(cfg.Path), 0755); err != nil {
+			return "", "", err
+		}
+
+		return "sqlite", repository.SQLiteDSN(cfg.Path), nil
+	default:
+		return "", "", fmt.Errorf("unsupported database driver %q", cfg.Driver)
+	}
+}
+
+// newCache returns the configured product cache, or nil when caching is off.
+func newCache(cfg model.CacheConfig) (repository.Cache, error) {
+	switch cfg.Driver {
+	case "":
+		return nil, nil
+	case constant.CacheMemory:
+		return repository.NewLRUCache(cfg.Size), nil
+	case constant.CacheRedis:
+		client := redis.NewClient(&redis.Options{
+			Addr:     cfg.Redis.Addr,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
+		return repository.NewRedisCache(client, cfg.Redis.Prefix), nil
+	default:
+		return nil, fmt.Errorf("unsupported cache driver %q", cfg.Driver)
+	}
+}
+
+// newRateLimitStore returns the configured rate limit store, or nil when rate
+// limiting is off.
+func newRateLimitStore(cfg model.RateLimitConfig) (repository.RateLimitStore, error) {
+	switch cfg.Driver {
+	case "":
+		return nil, nil
+	case constant.RateLimitMemory:
+		return repository.NewMemoryRateLimit(), nil
+	case constant.RateLimitRedis:
+		client := redis.NewClient(&redis.Options{
+			Addr:     cfg.Redis.Addr,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
+		return repository.NewRedisRateLimit(client, cfg.Redis.Prefix), nil
+	default:
+		return nil, fmt.Errorf("unsupported rate limit driver %q", cfg.Driver)
+	}
+}
+
+// repositories are the database-backed stores of the service.
+type repositories struct {
+	product     repository.ProductRepository
+	brand       repository.BrandRepository
+	user        repository.UserRepository
+	idempotency repository.IdempotencyRepository
+	importJob   repository.ImportJobRepository
+}
+
+// newRepositories builds the repository implementations for the configured driver.
+func newRepositories(cfg model.DatabaseConfig, db *sql.DB, replicas *repository.ReplicaSet) repositories {
+	timeouts := repository.Timeouts{
+		Default:    time.Duration(cfg.QueryTimeout),
+		Operations: map[string]time.Duration{},
+	}
+	for op, d := range cfg.OperationTimeouts {
+		timeouts.Operations[op] = time.Duration(d)
+	}
+
+	opts := []repository.Option{
+		repository.WithTimeouts(timeouts),
+		repository.WithReplicas(replicas),
+	}
+
+	switch cfg.Driver {
+	case constant.DriverPostgres:
+		return repositories{
+			product:     repository.NewPostgresProductRepository(db, opts...),
+			brand:       repository.NewPostgresBrandRepository(db, opts...),
+			user:        repository.NewPostgresUserRepository(db, opts...),
+			idempotency: repository.NewPostgresIdempotencyRepository(db, opts...),
+			importJob:   repository.NewPostgresImportJobRepository(db, opts...),
+		}
+	case constant.DriverSQLite:
+		return repositories{
+			product:     repository.NewSQLiteProductRepository(db, opts...),
+			brand:       repository.NewSQLiteBrandRepository(db, opts...),
+			user:        repository.NewSQLiteUserRepository(db, opts...),
+			idempotency: repository.NewSQLiteIdempotencyRepository(db, opts...),
+			importJob:   repository.NewSQLiteImportJobRepository(db, opts...),
+		}
+	default:
+		return repositories{
+			product:     repository.NewProductRepository(db, opts...),
+			brand:       repository.NewBrandRepository(db, opts...),
+			user:        repository.NewUserRepository(db, opts...),
+			idempotency: repository.NewIdempotencyRepository(db, opts...),
+			importJob:   repository.NewImportJobRepository(db, opts...),
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"crud-product/constant"
+	"crud-product/migration"
+	"crud-product/model"
+	"crud-product/repository"
+	"crud-product/repository/repotest"
+)
+
+func TestOpenDBSQLite(t *testing.T) {
+	cfg := model.DatabaseConfig{
+		Driver: constant.DriverSQLite,
+		// openDB creates missing directories, as for the default data/ path.
+		Path: filepath.Join(t.TempDir(), "data", "crud-product.db"),
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		t.Fatalf("openDB: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	migrator, err := migration.NewMigrator(db, cfg.Driver)
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+
+	if err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	assertVersion(t, migrator, migrator.Latest())
+
+	// Every down migration has to undo its up migration on SQLite too.
+	if err := migrator.To(ctx, 0); err != nil {
+		t.Fatalf("To(0): %v", err)
+	}
+	assertVersion(t, migrator, 0)
+
+	if err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up after rollback: %v", err)
+	}
+	assertVersion(t, migrator, migrator.Latest())
+
+	repos := newRepositories(cfg, db, nil)
+
+	t.Run("product", func(t *testing.T) {
+		repotest.ProductRepository(t, repos.product, repotest.SeedBrand(t, db, repository.SQLite, "Erigo"), repotest.SeedBrand(t, db, repository.SQLite, "Eiger"))
+	})
+
+	t.Run("user", func(t *testing.T) {
+		repotest.UserRepository(t, repos.user)
+	})
+}
+
+func TestOpenDBPool(t *testing.T) {
+	cfg := model.DatabaseConfig{
+		Driver:          constant.DriverSQLite,
+		Path:            filepath.Join(t.TempDir(), "pool.db"),
+		MaxOpenConns:    2,
+		MaxIdleConns:    1,
+		ConnMaxIdleTime: model.Duration(10 * time.Millisecond),
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		t.Fatalf("openDB: %v", err)
+	}
+	defer db.Close()
+
+	if got := db.Stats().MaxOpenConnections; got != 2 {
+		t.Fatalf("MaxOpenConnections = %d, want 2", got)
+	}
+
+	// Of the two connections handed back only one is kept idle.
+	ctx := context.Background()
+	conns := make([]*sql.Conn, 2)
+	for n := range conns {
+		if conns[n], err = db.Conn(ctx); err != nil {
+			t.Fatalf("Conn: %v", err)
+		}
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+	if stats := db.Stats(); stats.Idle != 1 || stats.MaxIdleClosed != 1 {
+		t.Fatalf("stats = %+v, want one idle connection and one closed", stats)
+	}
+
+	// The idle one is closed once it has been idle too long.
+	deadline := time.Now().Add(5 * time.Second)
+	for db.Stats().MaxIdleTimeClosed == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("stats = %+v, want the idle connection closed", db.Stats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNewRepositoriesTimeouts(t *testing.T) {
+	cfg := model.DatabaseConfig{
+		Driver:            constant.DriverSQLite,
+		QueryTimeout:      model.Duration(3 * time.Second),
+		OperationTimeouts: map[string]model.Duration{"product.export": model.Duration(time.Minute)},
+	}
+
+	repos := newRepositories(cfg, nil, nil)
+
+	timeouts := repos.user.(*repository.User).Timeouts
+	if timeouts.Default != 3*time.Second || timeouts.Operations["product.export"] != time.Minute {
+		t.Fatalf("user repository timeouts = %+v, want the configured ones", timeouts)
+	}
+	if got := repos.product.(*repository.Product).Timeouts; got.Default != 3*time.Second {
+		t.Fatalf("product repository timeouts = %+v, want the configured ones", got)
+	}
+}
+
+func TestDataSourceUnsupportedDriver(t *testing.T) {
+	if _, _, err := dataSource(model.DatabaseConfig{Driver: "oracle"}); err == nil {
+		t.Fatal("dataSource(oracle) succeeded, want error")
+	}
+}
+
+func assertVersion(t *testing.T, migrator *migration.Migrator, want int) {
+	t.Helper()
+
+	got, err := migrator.Version(context.Background())
+	if err != nil {
+		t.Fatalf("Version: %v", err)
+	}
+	if got != want {
+		t.Fatalf("Version = %d, want %d", got, want)
+	}
+}
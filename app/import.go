@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"crud-product/delivery/validate"
+	"crud-product/model"
+	"crud-product/tabular"
+	"crud-product/usecase"
+)
+
+var errImportUsage = errors.New("usage: main import [-key sku|external_id] [-dry-run] [-json] FILE")
+
+// runImport implements the `import` subcommand, which imports a CSV or XLSX
+// file like POST /api/v2/products/import but always in the foreground. It
+// prints the failed rows, or the whole report with -json, and fails when any
+// row failed.
+func runImport(ctx context.Context, imports usecase.ImportUsecase, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	key := flags.String("key", model.ImportKeySKU, "column that matches rows to products")
+	dryRun := flags.Bool("dry-run", false, "check every row without saving any")
+	asJSON := flags.Bool("json", false, "print the whole report as JSON")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return errImportUsage
+	}
+
+	name := flags.Arg(0)
+	format, err := tabular.FormatOf(name)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rows, err := tabular.ReadProducts(file, format, validate.New())
+	if err != nil {
+		return err
+	}
+
+	report, err := imports.Import(ctx, rows, model.ImportOptions{Key: *key, DryRun: *dryRun})
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else if err := printImportReport(report); err != nil {
+		return err
+	}
+
+	if report.Failed > 0 {
+		return fmt.Errorf("%d of %d rows failed", report.Failed, report.Total)
+	}
+	return nil
+}
+
+func printImportReport(report *model.ImportReport) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if report.Failed > 0 {
+		fmt.Fprintln(w, "LINE\tCODE\tMESSAGE")
+		for _, row := range report.Rows {
+			if row.Status != model.ImportRowFailed {
+				continue
+			}
+
+			message := row.Message
+			if len(row.Errors) > 0 {
+				fields := make([]string, 0, len(row.Errors))
+				for _, fe := range row.Errors {
+					fields = append(fields, fe.Message)
+				}
+				message = strings.Join(fields, "; ")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", row.Line, row.Code, message)
+		}
+		fmt.Fprintln(w)
+	}
+
+	verb := "imported"
+	if report.DryRun {
+		verb = "checked (dry run)"
+	}
+	fmt.Fprintf(w, "%d rows %s: %d created, %d updated, %d failed\n", report.Total, verb, report.Created, report.Updated, report.Failed)
+
+	return w.Flush()
+}
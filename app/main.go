@@ -1,72 +1,366 @@
 package main
 
 import (
+	"context"
 	"crud-product/config"
+	"crud-product/constant"
+	"crud-product/delivery/graphql"
+	grpcdelivery "crud-product/delivery/grpc"
 	"crud-product/delivery/rest"
+	"crud-product/delivery/validate"
+	_ "crud-product/docs"
+	"crud-product/logger"
+	"crud-product/metrics"
+	"crud-product/migration"
+	"crud-product/model"
 	"crud-product/repository"
+	"crud-product/tabular"
+	"crud-product/tracing"
 	"crud-product/usecase"
 	"database/sql"
 	"fmt"
-	_ "github.com/go-sql-driver/mysql"
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
 	echoSwagger "github.com/swaggo/echo-swagger"
-	"log"
+	"google.golang.org/grpc"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
-
-// @title Echo Swagger Example API
-// @version 1.0
-// @description This is a sample server server.
-// @termsOfService http://swagger.io/terms/
+// @title CRUD Product API
+// @version 2.0
+// @description Products, brands and users of the CRUD Product service. Errors are application/problem+json (RFC 7807).
 
 // @contact.name API Support
-// @contact.url http://www.swagger.io/support
-// @contact.email support@swagger.io
-
-// @license.name Apache 2.0
-// @license.url http://www.apache.org/licenses/LICENSE-2.0.html
+// @contact.url https://github.com/egaevan/crud-product
 
 // @host localhost:8080
 // @BasePath /
 // @schemes http
 
+// @securityDefinitions.apikey AccessToken
+// @in header
+// @name x-access-token
+// @description JWT returned by /login.
+
 func main() {
 	// Init config
 	cfg, err := config.GetConfig()
 	if err != nil {
-		log.Fatal(err)
+		log.WithError(err).Fatal("read config")
 	}
 
-	// Init echo framework
-	e := echo.New()
+	if err := logger.Setup(cfg.Log); err != nil {
+		log.WithError(err).Fatal("set up logging")
+	}
 
-	// Init DB
-	mysqlInfo := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", cfg.Database.User, cfg.Database.Password, cfg.Database.Host, cfg.Database.Port, cfg.Database.Database)
+	// Run subcommand
+	if len(os.Args) > 1 && os.Args[1] == "openapi" {
+		if err := runOpenAPI(cfg, os.Args[2:]); err != nil {
+			log.WithError(err).Fatal("openapi")
+		}
+		return
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.WithError(err).Fatal("set up tracing")
+	}
+
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.WithError(err).Error("flush traces")
+		}
+	}()
 
-	db, err := sql.Open("mysql", mysqlInfo)
+	// Init DB
+	db, err := openDB(cfg.Database)
 	if err != nil {
-		fmt.Println("Error connect to db")
-		log.Fatal(err)
+		log.WithError(err).WithField("driver", cfg.Database.Driver).Fatal("connect to database")
 	}
 
 	defer db.Close()
 
+	// Run subcommand
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(context.Background(), db, cfg.Database.Driver, os.Args[2:]); err != nil {
+			log.WithError(err).Fatal("migrate")
+		}
+		return
+	}
+
+	// Init schema
+	if cfg.Database.AutoMigrate || cfg.Database.Driver == constant.DriverSQLite {
+		migrator, err := migration.NewMigrator(db, cfg.Database.Driver)
+		if err != nil {
+			log.WithError(err).Fatal("load migrations")
+		}
+
+		if err := migrator.Up(context.Background()); err != nil {
+			log.WithError(err).Fatal("apply migrations")
+		}
+	}
+
+	replicaDBs, err := openReplicas(cfg.Database)
+	if err != nil {
+		log.WithError(err).Fatal("connect to read replicas")
+	}
+
+	replicas := repository.NewReplicaSet(db, replicaDBs, time.Duration(cfg.Database.ReplicaHealthInterval))
+	defer replicas.Close()
+
+	svc, err := newServices(cfg, db, replicaDBs, replicas)
+	if err != nil {
+		log.WithError(err).Fatal("set up services")
+	}
+
+	// Run subcommand
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := runImport(context.Background(), svc.imports, os.Args[2:]); err != nil {
+			log.WithError(err).Fatal("import")
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "user-role" {
+		if err := runUserRole(context.Background(), svc.user, os.Args[2:]); err != nil {
+			log.WithError(err).Fatal("user-role")
+		}
+		return
+	}
+
+	// Jobs left running by a crash of this instance will never finish.
+	if err := svc.imports.FailInterrupted(context.Background()); err != nil {
+		log.WithError(err).Fatal("fail interrupted import jobs")
+	}
+
+	e, err := newServer(cfg, db, svc)
+	if err != nil {
+		log.WithError(err).Fatal("set up server")
+	}
+
+	log.WithField("addr", cfg.Server.Addr).Info("server starting")
+	go func() {
+		if err := e.Start(cfg.Server.Addr); err != nil && err != http.ErrServerClosed {
+			log.WithError(err).Fatal("start server")
+		}
+	}()
+
+	var internal *echo.Echo
+	if cfg.Server.InternalAddr != "" {
+		internal = newInternalServer(cfg, db)
+
+		log.WithField("addr", cfg.Server.InternalAddr).Info("internal server starting")
+		go func() {
+			if err := internal.Start(cfg.Server.InternalAddr); err != nil && err != http.ErrServerClosed {
+				log.WithError(err).Fatal("start internal server")
+			}
+		}()
+	}
+
+	var grpcServer *grpc.Server
+	if cfg.GRPC.Addr != "" {
+		lis, err := net.Listen("tcp", cfg.GRPC.Addr)
+		if err != nil {
+			log.WithError(err).Fatal("listen for gRPC")
+		}
+
+		grpcServer = grpcdelivery.NewServer(svc.product, svc.brand, svc.user, svc.rateLimit, cfg.RateLimit, cfg.GRPC)
+
+		log.WithField("addr", cfg.GRPC.Addr).Info("gRPC server starting")
+		go func() {
+			if err := grpcServer.Serve(lis); err != nil {
+				log.WithError(err).Fatal("start gRPC server")
+			}
+		}()
+	}
+
+	// Stop on SIGINT or SIGTERM so the deferred cleanup, including flushing
+	// buffered spans, gets to run.
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		log.WithError(err).Error("shut down server")
+	}
+	if internal != nil {
+		if err := internal.Shutdown(ctx); err != nil {
+			log.WithError(err).Error("shut down internal server")
+		}
+	}
+
+	if grpcServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			grpcServer.Stop()
+		}
+	}
+
+	if err := svc.imports.Shutdown(ctx); err != nil {
+		log.WithError(err).Error("shut down import jobs")
+	}
+}
+
+// services are the usecases the REST and gRPC servers expose, and the stores
+// their middleware shares.
+type services struct {
+	product     usecase.ProductUsecase
+	brand       usecase.BrandUsecase
+	user        usecase.UserUsecase
+	imports     usecase.ImportUsecase
+	exports     usecase.ExportUsecase
+	idempotency repository.IdempotencyRepository
+	rateLimit   repository.RateLimitStore
+}
+
+// newServices sets up the repositories and usecases of the service.
+func newServices(cfg *model.Config, db *sql.DB, replicaDBs []*sql.DB, replicas *repository.ReplicaSet) (*services, error) {
+	rateLimitStore, err := newRateLimitStore(cfg.RateLimit)
+	if err != nil {
+		return nil, fmt.Errorf("set up rate limiting: %w", err)
+	}
+
 	// Init repository
-	productRepo := repository.NewProductRepository(db)
-	userRepo := repository.NewUserRepository(db)
+	repos := newRepositories(cfg.Database, db, replicas)
+	productRepo := repos.product
+
+	cache, err := newCache(cfg.Cache)
+	if err != nil {
+		return nil, fmt.Errorf("set up cache: %w", err)
+	}
+
+	if cache != nil {
+		productRepo = repository.NewCachedProductRepository(productRepo, cache, time.Duration(cfg.Cache.TTL))
+	}
+
+	if err := registerMetrics(db, replicaDBs, productRepo); err != nil {
+		return nil, fmt.Errorf("register metrics: %w", err)
+	}
+
+	transactor := repository.NewTransactor(db)
 
 	// Init usecase
-	productUsecae := usecase.NewProduct(productRepo)
-	userUsecase := usecase.NewUser(userRepo)
+	return &services{
+		product:     usecase.NewProduct(productRepo, transactor),
+		brand:       usecase.NewBrand(repos.brand, productRepo),
+		user:        usecase.NewUser(repos.user),
+		imports:     usecase.NewImport(productRepo, repos.brand, repos.importJob, transactor, cfg.Import),
+		exports:     usecase.NewExport(productRepo, repos.brand),
+		idempotency: repos.idempotency,
+		rateLimit:   rateLimitStore,
+	}, nil
+}
+
+// newServer sets up echo with the middleware and routes of the service.
+func newServer(cfg *model.Config, db *sql.DB, svc *services) (*echo.Echo, error) {
+	// Init echo framework
+	e := echo.New()
+	e.HTTPErrorHandler = rest.ErrorHandler
+	e.Validator = validate.New()
+	e.Binder = &rest.Binder{}
+	e.HideBanner = true
+	setTimeouts(e.Server, cfg.Server)
+	// Trust X-Forwarded-For only from loopback and private proxies, so clients
+	// cannot pick the IP their rate limit is keyed by.
+	e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	e.Use(middleware.RequestID())
+	e.Use(rest.AccessLog)
+	e.Use(rest.Tracing)
+	e.Use(rest.Metrics)
+	e.Use(rest.SecurityHeaders(cfg.Security))
+	if len(cfg.CORS.AllowOrigins) > 0 {
+		e.Use(rest.CORS(cfg.CORS))
+	}
+	if cfg.Session.Cookie {
+		e.Use(rest.Sessions(cfg.Session))
+	}
+	if svc.rateLimit != nil {
+		e.Use(rest.RateLimit(svc.rateLimit, cfg.RateLimit))
+	}
+	e.Use(rest.ReadYourWrites)
+
+	if _, err := tabular.Columns(cfg.Export.Columns); err != nil {
+		return nil, fmt.Errorf("export columns: %w", err)
+	}
 
 	// Init handler
-	rest.NewHandler(e, productUsecae, userUsecase)
+	idempotent := rest.Idempotency(svc.idempotency, time.Duration(cfg.Idempotency.TTL), cfg.Idempotency.MaxBodySize)
+	rest.NewHandler(e, svc.product, svc.brand, svc.user, idempotent, cfg.Session, cfg.Upload)
+	rest.NewImportHandler(e, svc.imports, cfg.Import, idempotent)
+	rest.NewExportHandler(e, svc.exports, cfg.Export)
+	graphql.NewHandler(e, svc.product, svc.brand, svc.user)
 
 	e.GET("/", HealthCheck)
+	if cfg.Server.InternalAddr == "" {
+		registerMonitoring(e, db, rest.JwtVerify, rest.AdminOnly)
+	}
 	e.GET("/swagger/*", echoSwagger.WrapHandler)
 
-	e.Logger.Fatal(e.Start(":8080"))
+	doc, err := rest.OpenAPI(cfg.Session.CookieName)
+	if err != nil {
+		return nil, err
+	}
+	e.GET("/openapi.json", rest.ServeOpenAPI(doc))
+
+	return e, nil
+}
+
+// newInternalServer serves the monitoring routes on the internal listener,
+// which is trusted and so needs no authentication.
+func newInternalServer(cfg *model.Config, db *sql.DB) *echo.Echo {
+	e := echo.New()
+	e.HTTPErrorHandler = rest.ErrorHandler
+	e.HideBanner = true
+	setTimeouts(e.Server, cfg.Server)
+
+	registerMonitoring(e, db)
+	return e
+}
+
+// registerMonitoring adds the metrics and pool statistics routes behind the
+// given middleware.
+func registerMonitoring(e *echo.Echo, db *sql.DB, m ...echo.MiddlewareFunc) {
+	e.GET("/stats/db", DBStats(db), m...)
+	e.GET("/metrics", Metrics(), m...)
+}
+
+// setTimeouts bounds how long a client may take to send a request and how long
+// an idle connection is kept.
+func setTimeouts(s *http.Server, cfg model.ServerConfig) {
+	s.ReadHeaderTimeout = time.Duration(cfg.ReadHeaderTimeout)
+	s.ReadTimeout = time.Duration(cfg.ReadTimeout)
+	s.WriteTimeout = time.Duration(cfg.WriteTimeout)
+	s.IdleTimeout = time.Duration(cfg.IdleTimeout)
+}
+
+// Metrics godoc
+// @Summary Show Prometheus metrics.
+// @Description metrics in the Prometheus text exposition format.
+// @Tags root
+// @Produce plain,json
+// @Security AccessToken
+// @Success 200 {string} string
+// @Failure 401 {object} rest.Problem
+// @Failure 403 {object} rest.Problem
+// @Router /metrics [get]
+func Metrics() echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
 }
 
 // HealthCheck godoc
@@ -81,4 +375,49 @@ func HealthCheck(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"data": "Server is up and running",
 	})
-}
\ No newline at end of file
+}
+
+// DBStats godoc
+// @Summary Show database connection pool statistics.
+// @Description get open, in-use and idle connections and how often callers waited for one.
+// @Tags root
+// @Accept */*
+// @Produce json
+// @Security AccessToken
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} rest.Problem
+// @Failure 403 {object} rest.Problem
+// @Router /stats/db [get]
+func DBStats(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		stats := db.Stats()
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"max_open_connections": stats.MaxOpenConnections,
+			"open_connections":     stats.OpenConnections,
+			"in_use":               stats.InUse,
+			"idle":                 stats.Idle,
+			"wait_count":           stats.WaitCount,
+			"wait_duration_ms":     stats.WaitDuration.Milliseconds(),
+			"max_idle_closed":      stats.MaxIdleClosed,
+			"max_idle_time_closed": stats.MaxIdleTimeClosed,
+			"max_lifetime_closed":  stats.MaxLifetimeClosed,
+		})
+	}
+}
+
+// registerMetrics exports the pool statistics of the primary and every replica
+// and the active product count per brand.
+func registerMetrics(db *sql.DB, replicas []*sql.DB, productRepo repository.ProductRepository) error {
+	if err := metrics.RegisterDB(db, "primary"); err != nil {
+		return err
+	}
+
+	for i, replica := range replicas {
+		if err := metrics.RegisterDB(replica, fmt.Sprintf("replica-%d", i)); err != nil {
+			return err
+		}
+	}
+
+	return metrics.RegisterCatalogue(productRepo.CountByBrand)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"crud-product/migration"
+)
+
+var errMigrateUsage = errors.New("usage: main migrate <up|down|status|to VERSION>")
+
+// runMigrate implements the `migrate` subcommand.
+func runMigrate(ctx context.Context, db *sql.DB, driver string, args []string) error {
+	migrator, err := migration.NewMigrator(db, driver)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+
+	switch args[0] {
+	case "up":
+		err = migrator.Up(ctx)
+	case "down":
+		err = migrator.Down(ctx)
+	case "to":
+		if len(args) < 2 {
+			return errMigrateUsage
+		}
+
+		version, errConv := strconv.Atoi(args[1])
+		if errConv != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+
+		err = migrator.To(ctx, version)
+	case "status":
+		return printMigrationStatus(ctx, migrator)
+	default:
+		return errMigrateUsage
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return printMigrationStatus(ctx, migrator)
+}
+
+func printMigrationStatus(ctx context.Context, migrator *migration.Migrator) error {
+	status, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, s := range status {
+		appliedAt := "pending"
+		if s.Applied {
+			appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+
+	"crud-product/delivery/rest"
+	"crud-product/model"
+)
+
+var errOpenAPIUsage = errors.New("usage: main openapi print")
+
+// runOpenAPI implements the `openapi` subcommand. `print` writes the OpenAPI 3
+// document to stdout. The document is checked against the routes by
+// TestOpenAPIContract.
+func runOpenAPI(cfg *model.Config, args []string) error {
+	if len(args) != 1 || args[0] != "print" {
+		return errOpenAPIUsage
+	}
+
+	doc, err := rest.OpenAPI(cfg.Session.CookieName)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
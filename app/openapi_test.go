@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"crud-product/config"
+	"crud-product/delivery/rest"
+	"crud-product/migration"
+	"crud-product/model"
+	"crud-product/repository"
+	"crud-product/tabular"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/labstack/echo/v4"
+)
+
+// contractStep is one request of the contract run. Header values and the path
+// may refer to {token}, {etag} and {location} from earlier responses. Requests
+// marked invalid break the document on purpose to provoke an error response,
+// so only that response is checked.
+type contractStep struct {
+	method  string
+	path    string
+	header  map[string]string
+	body    string
+	form    map[string]string
+	invalid bool
+	status  int
+}
+
+// contractSteps walk every documented route through success and the common
+// failures. They run in order against an empty database with one brand and
+// the admin@example.com admin.
+var contractSteps = []contractStep{
+	{method: http.MethodGet, path: "/", status: http.StatusOK},
+	{method: http.MethodPost, path: "/register", body: `{"name":"Budi","email":"budi@example.com","password":"secret123"}`, status: http.StatusCreated},
+	{method: http.MethodPost, path: "/register", body: `{"name":"Budi","email":"budi@example.com","password":"secret123"}`, status: http.StatusConflict},
+	{method: http.MethodPost, path: "/register", body: `{"email":"x"}`, invalid: true, status: http.StatusBadRequest},
+	{method: http.MethodPost, path: "/login", body: `{"email":"admin@example.com","password":"wrong-pass1"}`, status: http.StatusUnauthorized},
+	{method: http.MethodPost, path: "/login", body: `{"email":"admin@example.com","password":"secret123"}`, status: http.StatusOK},
+
+	{method: http.MethodGet, path: "/api/v2/products", header: map[string]string{"x-access-token": ""}, status: http.StatusUnauthorized},
+	{method: http.MethodGet, path: "/api/v2/brands", status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/v2/products", body: `{"name":"Kemeja","price":150000,"stock":10,"brand_id":1}`, status: http.StatusCreated},
+	{method: http.MethodPost, path: "/api/v2/products", body: `{"price":-1}`, invalid: true, status: http.StatusBadRequest},
+	{method: http.MethodGet, path: "/api/v2/products?brand_id=1&limit=10", status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/v2/products/1", status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/v2/products/1", header: map[string]string{"If-None-Match": "{etag}"}, status: http.StatusNotModified},
+	{method: http.MethodGet, path: "/api/v2/products/99", status: http.StatusNotFound},
+	{method: http.MethodPut, path: "/api/v2/products/1", body: `{"name":"Kemeja Batik","price":175000,"stock":8,"brand_id":1}`, invalid: true, status: http.StatusPreconditionRequired},
+	{method: http.MethodPut, path: "/api/v2/products/1", header: map[string]string{"If-Match": "{etag}"}, body: `{"name":"Kemeja Batik","price":175000,"stock":8,"brand_id":1}`, status: http.StatusOK},
+	{method: http.MethodPatch, path: "/api/v2/products/1", header: map[string]string{"If-Match": "{etag}", echo.HeaderContentType: "application/merge-patch+json"}, body: `{"stock":4}`, status: http.StatusOK},
+	{method: http.MethodPatch, path: "/api/v2/products/1", header: map[string]string{"If-Match": `"1"`, echo.HeaderContentType: "application/merge-patch+json"}, body: `{"stock":3}`, status: http.StatusPreconditionFailed},
+	{method: http.MethodPut, path: "/api/v2/products/1/image", header: map[string]string{"If-Match": "{etag}"}, form: map[string]string{"fileImage": "@kemeja.png"}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/v2/brands/1/products", status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/v2/brands/99/products", status: http.StatusNotFound},
+	{method: http.MethodPost, path: "/graphql", body: `{"query":"{ brands { id name products { id name brand { name } } } }"}`, status: http.StatusOK},
+	{method: http.MethodPost, path: "/graphql", body: `{"query":""}`, invalid: true, status: http.StatusBadRequest},
+	{method: http.MethodPost, path: "/api/v2/products/import?dry_run=true", form: map[string]string{"file": "@products.csv:sku,name,price,stock,brand_id\nTOPI-1,Topi,50000,3,1\nTOPI-2,,x,1,9\n"}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/v2/products/import?async=true", form: map[string]string{"file": "@products.csv:sku,name,price,stock,brand_id\nTOPI-1,Topi,50000,3,1\n"}, status: http.StatusAccepted},
+	{method: http.MethodGet, path: "{location}", status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/v2/products/import", form: map[string]string{"file": "@products.csv:sku,nama\n"}, status: http.StatusBadRequest},
+	{method: http.MethodGet, path: "/api/v2/imports/unknown", status: http.StatusNotFound},
+	{method: http.MethodGet, path: "/api/v2/products/export?status=all&columns=id,name,status", status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/v2/products/export?format=xlsx&brand_id=1&stock=in", status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/v2/products/export?format=ndjson", status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/v2/products/export?columns=id,nama", status: http.StatusBadRequest},
+	{method: http.MethodGet, path: "/api/v2/products/export?brand_id=99", status: http.StatusNotFound},
+	{method: http.MethodPut, path: "/api/v2/users/role", body: `{"email":"budi@example.com","role":1}`, status: http.StatusNoContent},
+	{method: http.MethodPut, path: "/api/v2/users/role", body: `{"email":"nobody@example.com","role":1}`, status: http.StatusNotFound},
+	{method: http.MethodPut, path: "/api/v2/users/role", body: `{"email":"budi@example.com","role":2}`, invalid: true, status: http.StatusBadRequest},
+
+	{method: http.MethodPost, path: "/product", form: map[string]string{"name": "Sepatu", "price": "500000", "stock": "3", "brand_id": "1", "fileImage": "@sepatu.png"}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/product?id=2", status: http.StatusOK},
+	{method: http.MethodGet, path: "/product/brand?id=1", status: http.StatusOK},
+	{method: http.MethodPatch, path: "/product?id=2", header: map[string]string{echo.HeaderContentType: "application/merge-patch+json"}, body: `{"price":450000}`, status: http.StatusOK},
+	{method: http.MethodPatch, path: "/product?id=2", form: map[string]string{"stock": "2"}, status: http.StatusOK},
+	{method: http.MethodDelete, path: "/product?id=2", status: http.StatusOK},
+	{method: http.MethodDelete, path: "/api/v2/products/1", header: map[string]string{"If-Match": "*"}, status: http.StatusNoContent},
+
+	{method: http.MethodGet, path: "/stats/db", status: http.StatusOK},
+	{method: http.MethodGet, path: "/stats/db", header: map[string]string{"x-access-token": ""}, status: http.StatusUnauthorized},
+	{method: http.MethodGet, path: "/metrics", status: http.StatusOK},
+	{method: http.MethodGet, path: "/metrics", header: map[string]string{"x-access-token": ""}, status: http.StatusUnauthorized},
+	{method: http.MethodGet, path: "/openapi.json", status: http.StatusOK},
+	{method: http.MethodPost, path: "/logout", status: http.StatusNoContent},
+}
+
+// TestOpenAPIContract builds the real server on a scratch SQLite database,
+// then checks that every route is documented and that every request and
+// response of contractSteps matches the document.
+func TestOpenAPIContract(t *testing.T) {
+	dir := t.TempDir()
+
+	cfg, err := config.Parse([]byte(fmt.Sprintf(`{
+		"database": {"driver": "sqlite", "path": %q},
+		"session": {"cookie": true, "csrf_secret": "contract-test-csrf-secret-0123456789"},
+		"upload": {"dir": %q}
+	}`, filepath.Join(dir, "contract.db"), dir)))
+	if err != nil {
+		t.Fatalf("parse config: %v", err)
+	}
+
+	db, err := openDB(cfg.Database)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	migrator, err := migration.NewMigrator(db, cfg.Database.Driver)
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if err := migrator.Up(ctx); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if _, err := db.ExecContext(ctx, "INSERT INTO brand (name) VALUES ('Nike')"); err != nil {
+		t.Fatalf("seed brand: %v", err)
+	}
+
+	replicas := repository.NewReplicaSet(db, nil, 0)
+	defer replicas.Close()
+
+	svc, err := newServices(cfg, db, nil, replicas)
+	if err != nil {
+		t.Fatalf("set up services: %v", err)
+	}
+
+	// Registration never grants admin rights, so the admin is made directly.
+	if err := svc.user.CreateUser(ctx, model.User{Name: "Admin", Email: "admin@example.com", Password: "secret123"}); err != nil {
+		t.Fatalf("create admin: %v", err)
+	}
+	if err := svc.user.SetUserRole(ctx, "admin@example.com", model.RoleAdmin); err != nil {
+		t.Fatalf("make admin: %v", err)
+	}
+
+	e, err := newServer(cfg, db, svc)
+	if err != nil {
+		t.Fatalf("set up server: %v", err)
+	}
+
+	doc, err := rest.OpenAPI(cfg.Session.CookieName)
+	if err != nil {
+		t.Fatalf("build document: %v", err)
+	}
+
+	for _, route := range rest.UndocumentedRoutes(e, doc) {
+		t.Errorf("undocumented route %s", route)
+	}
+
+	// The stock JSON decoder keeps numbers as json.Number, which never equals
+	// an enum value.
+	for _, contentType := range []string{echo.MIMEApplicationJSON, "application/merge-patch+json", "application/problem+json"} {
+		openapi3filter.RegisterBodyDecoder(contentType, decodeJSON)
+	}
+	for _, format := range []string{tabular.FormatXLSX, tabular.FormatNDJSON} {
+		openapi3filter.RegisterBodyDecoder(tabular.ContentType(format), decodeFile)
+	}
+
+	router, err := legacy.NewRouter(doc)
+	if err != nil {
+		t.Fatalf("route document: %v", err)
+	}
+
+	state := map[string]string{}
+	for _, step := range contractSteps {
+		if err := runContractStep(ctx, e, router, step, state); err != nil {
+			t.Errorf("%s %s: %v", step.method, step.path, err)
+		}
+	}
+}
+
+func runContractStep(ctx context.Context, e *echo.Echo, router routers.Router, step contractStep, state map[string]string) error {
+	fill := func(s string) string {
+		for k, v := range state {
+			s = strings.ReplaceAll(s, "{"+k+"}", v)
+		}
+		return s
+	}
+
+	body, contentType, err := contractBody(step)
+	if err != nil {
+		return err
+	}
+
+	req := httptest.NewRequest(step.method, "http://localhost:8080"+fill(step.path), bytes.NewReader(body))
+	if contentType != "" {
+		req.Header.Set(echo.HeaderContentType, contentType)
+	}
+	if token := state["token"]; token != "" {
+		req.Header.Set("x-access-token", token)
+	}
+	for k, v := range step.header {
+		req.Header.Set(k, fill(v))
+	}
+
+	route, params, err := router.FindRoute(req)
+	if err != nil {
+		return fmt.Errorf("not in the document: %w", err)
+	}
+
+	options := &openapi3filter.Options{
+		AuthenticationFunc:    openapi3filter.NoopAuthenticationFunc,
+		IncludeResponseStatus: true,
+	}
+	reqInput := &openapi3filter.RequestValidationInput{Request: req, PathParams: params, Route: route, Options: options}
+	if !step.invalid {
+		if err := openapi3filter.ValidateRequest(ctx, reqInput); err != nil {
+			return fmt.Errorf("request does not match: %w", err)
+		}
+	}
+
+	// Validation consumed the body; give the handler a fresh copy.
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != step.status {
+		return fmt.Errorf("status %d, want %d: %s", rec.Code, step.status, rec.Body.String())
+	}
+
+	resInput := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: reqInput,
+		Status:                 rec.Code,
+		Header:                 rec.Header(),
+		Options:                options,
+	}
+	resInput.SetBodyBytes(rec.Body.Bytes())
+	if err := openapi3filter.ValidateResponse(ctx, resInput); err != nil {
+		return fmt.Errorf("response does not match: %w", err)
+	}
+
+	if etag := rec.Header().Get("ETag"); etag != "" {
+		state["etag"] = etag
+	}
+	if location := rec.Header().Get(echo.HeaderLocation); location != "" {
+		state["location"] = location
+	}
+	if step.path == "/login" && rec.Code == http.StatusOK {
+		var res struct {
+			Token string `json:"token"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			return err
+		}
+		state["token"] = res.Token
+	}
+	return nil
+}
+
+// contractBody encodes the step's body: JSON unless form fields are given,
+// in which case a multipart form where "@name" values become files.
+func contractBody(step contractStep) ([]byte, string, error) {
+	if step.form == nil {
+		if step.body == "" {
+			return nil, "", nil
+		}
+		return []byte(step.body), echo.MIMEApplicationJSON, nil
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for name, value := range step.form {
+		if !strings.HasPrefix(value, "@") {
+			// The validator decodes each part by its Content-Type, so numbers
+			// are sent as JSON to be read as integers. Echo ignores it.
+			header := textproto.MIMEHeader{}
+			header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"`, name))
+			if _, err := strconv.Atoi(value); err == nil {
+				header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			}
+
+			part, err := w.CreatePart(header)
+			if err != nil {
+				return nil, "", err
+			}
+			if _, err := part.Write([]byte(value)); err != nil {
+				return nil, "", err
+			}
+			continue
+		}
+
+		// "@file.csv:content" sends content; other files get the PNG
+		// signature, which is enough for the upload's type sniffing.
+		filename, content := value[1:], "\x89PNG\r\n\x1a\n"
+		if i := strings.IndexByte(filename, ':'); i >= 0 {
+			filename, content = filename[:i], filename[i+1:]
+		}
+
+		part, err := w.CreateFormFile(name, filename)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := part.Write([]byte(content)); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), w.FormDataContentType(), nil
+}
+
+// decodeFile reads an export, which the document describes as a string.
+func decodeFile(body io.Reader, _ http.Header, _ *openapi3.SchemaRef, _ openapi3filter.EncodingFn) (interface{}, error) {
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func decodeJSON(body io.Reader, _ http.Header, _ *openapi3.SchemaRef, _ openapi3filter.EncodingFn) (interface{}, error) {
+	var value interface{}
+	if err := json.NewDecoder(body).Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"crud-product/config"
+	"crud-product/constant"
+	"crud-product/model"
+	"crud-product/repository"
+	"crud-product/usecase"
+	"github.com/labstack/echo/v4"
+)
+
+// newTestServer builds the server from cfg over memory repositories. Only the
+// pool statistics read the scratch SQLite database.
+func newTestServer(t *testing.T, cfg *model.Config) (*echo.Echo, *echo.Echo) {
+	t.Helper()
+
+	dir := t.TempDir()
+	cfg.Upload.Dir = dir
+
+	db, err := openDB(model.DatabaseConfig{Driver: constant.DriverSQLite, Path: filepath.Join(dir, "server.db")})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	brands := repository.NewMemoryBrandRepository()
+	products := repository.NewMemoryProductRepository(brands)
+	transactor := repository.NewMemoryTransactor(products)
+	svc := &services{
+		product:     usecase.NewProduct(products, transactor),
+		brand:       usecase.NewBrand(brands, products),
+		user:        usecase.NewUser(repository.NewMemoryUserRepository()),
+		imports:     usecase.NewImport(products, brands, repository.NewMemoryImportJobRepository(), transactor, cfg.Import),
+		exports:     usecase.NewExport(products, brands),
+		idempotency: repository.NewMemoryIdempotencyRepository(),
+	}
+
+	e, err := newServer(cfg, db, svc)
+	if err != nil {
+		t.Fatalf("set up server: %v", err)
+	}
+	return e, newInternalServer(cfg, db)
+}
+
+func get(e *echo.Echo, target string) int {
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	return rec.Code
+}
+
+func TestServerTimeouts(t *testing.T) {
+	cfg, err := config.Parse([]byte(`{"server": {"read_timeout": "30s", "write_timeout": "15m"}}`))
+	if err != nil {
+		t.Fatalf("parse config: %v", err)
+	}
+
+	e, internal := newTestServer(t, cfg)
+
+	// Unset timeouts get their defaults, and both listeners apply them.
+	want := map[string]time.Duration{"read_header": 10 * time.Second, "read": 30 * time.Second, "write": 15 * time.Minute, "idle": 2 * time.Minute}
+	for name, s := range map[string]*http.Server{"api": e.Server, "internal": internal.Server} {
+		got := map[string]time.Duration{"read_header": s.ReadHeaderTimeout, "read": s.ReadTimeout, "write": s.WriteTimeout, "idle": s.IdleTimeout}
+		for timeout, d := range want {
+			if got[timeout] != d {
+				t.Fatalf("%s server %s timeout = %s, want %s", name, timeout, got[timeout], d)
+			}
+		}
+	}
+	if cfg.Server.Addr != ":8080" {
+		t.Fatalf("addr = %q, want the default :8080", cfg.Server.Addr)
+	}
+}
+
+func TestMonitoringRoutes(t *testing.T) {
+	// Without an internal listener only admins can read the monitoring
+	// routes.
+	cfg, err := config.Parse([]byte(`{}`))
+	if err != nil {
+		t.Fatalf("parse config: %v", err)
+	}
+
+	e, _ := newTestServer(t, cfg)
+	for _, target := range []string{"/metrics", "/stats/db"} {
+		if code := get(e, target); code != http.StatusUnauthorized {
+			t.Fatalf("GET %s without a token = %d, want 401", target, code)
+		}
+	}
+
+	// With one they leave the API listener for the internal one, which needs
+	// no token.
+	cfg, err = config.Parse([]byte(`{"server": {"internal_addr": "127.0.0.1:9091"}}`))
+	if err != nil {
+		t.Fatalf("parse config: %v", err)
+	}
+
+	e, internal := newTestServer(t, cfg)
+	if code := get(internal, "/stats/db"); code != http.StatusOK {
+		t.Fatalf("GET /stats/db on the internal listener = %d, want 200", code)
+	}
+	for _, target := range []string{"/metrics", "/stats/db"} {
+		if code := get(e, target); code != http.StatusNotFound {
+			t.Fatalf("GET %s on the API listener = %d, want 404", target, code)
+		}
+		// The registry may hold collectors of databases other tests closed,
+		// so /metrics is only checked to be let through.
+		if code := get(internal, target); code == http.StatusUnauthorized || code == http.StatusNotFound {
+			t.Fatalf("GET %s on the internal listener = %d, want it served", target, code)
+		}
+	}
+}
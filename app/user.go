@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"crud-product/logger"
+	"crud-product/model"
+	"crud-product/usecase"
+	log "github.com/sirupsen/logrus"
+)
+
+var errUserRoleUsage = errors.New("usage: main user-role EMAIL 0|1")
+
+// runUserRole implements the `user-role` subcommand, which changes a user's
+// role like PUT /api/v2/users/role. It is how the first admin is made, since
+// registration never grants the role.
+func runUserRole(ctx context.Context, users usecase.UserUsecase, args []string) error {
+	if len(args) != 2 {
+		return errUserRoleUsage
+	}
+
+	role, err := strconv.Atoi(args[1])
+	if err != nil || (role != model.RoleUser && role != model.RoleAdmin) {
+		return errUserRoleUsage
+	}
+
+	if err := users.SetUserRole(ctx, args[0], role); err != nil {
+		return err
+	}
+
+	logger.FromContext(ctx).WithFields(log.Fields{"email": args[0], "role": role}).Info("user role changed")
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"crud-product/model"
+	"crud-product/repository"
+	"crud-product/usecase"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestRunUserRole(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	out := log.StandardLogger().Out
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(out)
+
+	ctx := context.Background()
+	users := repository.NewMemoryUserRepository()
+	if err := users.Store(ctx, model.User{Name: "Budi", Email: "budi@example.com", Password: "rahasia123"}); err != nil {
+		t.Fatalf("store user: %v", err)
+	}
+
+	if err := runUserRole(ctx, usecase.NewUser(users), []string{"budi@example.com", "1"}); err != nil {
+		t.Fatalf("runUserRole: %v", err)
+	}
+
+	// The change is logged like the rest of the service's output.
+	entry := hook.LastEntry()
+	if entry == nil || entry.Message != "user role changed" || entry.Data["email"] != "budi@example.com" || entry.Data["role"] != model.RoleAdmin {
+		t.Fatalf("last log entry = %+v, want the role change", entry)
+	}
+
+	if err := runUserRole(ctx, usecase.NewUser(users), []string{"budi@example.com", "2"}); !errors.Is(err, errUserRoleUsage) {
+		t.Fatalf("runUserRole with an unknown role = %v, want the usage", err)
+	}
+}
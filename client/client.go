@@ -0,0 +1,330 @@
+// Package client is a Go client for the product API. Its methods mirror the
+// usecases: products, brands and users.
+//
+//	c := client.New("http://localhost:8080", client.WithCredentials("admin@example.com", "secret123"))
+//	product, err := c.GetProduct(ctx, 1)
+//	if errors.Is(err, model.ErrNotFound) {
+//		...
+//	}
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	mrand "math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	headerToken          = "x-access-token"
+	headerIdempotencyKey = "Idempotency-Key"
+	headerIfMatch        = "If-Match"
+	headerRetryAfter     = "Retry-After"
+
+	mimeJSON       = "application/json"
+	mimeMergePatch = "application/merge-patch+json"
+)
+
+// Client calls the product API. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	retry      RetryPolicy
+
+	mu       sync.Mutex
+	token    string
+	email    string
+	password string
+}
+
+// RetryPolicy controls how requests that are safe to repeat are retried after
+// a network error, 429, 502, 503 or 504. The wait doubles from MinBackoff up to
+// MaxBackoff, with jitter, unless the server sends Retry-After.
+type RetryPolicy struct {
+	MaxAttempts int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+}
+
+// DefaultRetryPolicy makes up to three attempts.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	MinBackoff:  100 * time.Millisecond,
+	MaxBackoff:  2 * time.Second,
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the http.Client used for requests.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithToken authenticates with an existing token from /login.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithCredentials logs in on the first authenticated call, and again whenever
+// the token is rejected.
+func WithCredentials(email, password string) Option {
+	return func(c *Client) {
+		c.email = email
+		c.password = password
+	}
+}
+
+// WithRetry replaces DefaultRetryPolicy. MaxAttempts of 1 turns retries off.
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// New returns a client for the API at baseURL, e.g. "http://localhost:8080".
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		retry:      DefaultRetryPolicy,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.retry.MaxAttempts < 1 {
+		c.retry.MaxAttempts = 1
+	}
+	return c
+}
+
+// Token returns the token the client authenticates with.
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.token
+}
+
+// request describes one API call. Unsafe calls get an Idempotency-Key, which
+// makes them safe to retry as well.
+type request struct {
+	method      string
+	path        string
+	body        []byte
+	contentType string
+	header      http.Header
+	auth        bool
+	retry       bool
+}
+
+func jsonRequest(method, path string, body interface{}) (request, error) {
+	req := request{method: method, path: path, auth: true, retry: true}
+	if body == nil {
+		return req, nil
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return req, err
+	}
+	req.body = data
+	req.contentType = mimeJSON
+	return req, nil
+}
+
+// do sends req and decodes a successful response into out, if not nil. A
+// rejected token is refreshed once when the client has credentials.
+func (c *Client) do(ctx context.Context, req request, out interface{}) (*http.Response, error) {
+	if req.method != http.MethodGet && req.method != http.MethodHead {
+		if req.header == nil {
+			req.header = http.Header{}
+		}
+		if req.header.Get(headerIdempotencyKey) == "" {
+			req.header.Set(headerIdempotencyKey, newIdempotencyKey())
+		}
+	}
+
+	res, body, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusUnauthorized && req.auth && c.hasCredentials() {
+		if err := c.refresh(ctx); err != nil {
+			return nil, err
+		}
+		if res, body, err = c.send(ctx, req); err != nil {
+			return nil, err
+		}
+	}
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return res, newError(res, body)
+	}
+
+	if out != nil && len(body) > 0 {
+		if err := json.Unmarshal(body, out); err != nil {
+			return res, fmt.Errorf("decode %s %s response: %w", req.method, req.path, err)
+		}
+	}
+	return res, nil
+}
+
+// send makes the attempts allowed by the retry policy and returns the last
+// response with its body read.
+func (c *Client) send(ctx context.Context, req request) (*http.Response, []byte, error) {
+	attempts := 1
+	if req.retry {
+		attempts = c.retry.MaxAttempts
+	}
+
+	for attempt := 1; ; attempt++ {
+		res, body, err := c.sendOnce(ctx, req)
+
+		if attempt == attempts || !retryable(res, err) || ctx.Err() != nil {
+			return res, body, err
+		}
+
+		timer := time.NewTimer(c.backoff(attempt, res))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) sendOnce(ctx context.Context, req request) (*http.Response, []byte, error) {
+	if req.auth {
+		if err := c.ensureToken(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var body io.Reader
+	if req.body != nil {
+		body = bytes.NewReader(req.body)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, c.baseURL+req.path, body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for k, v := range req.header {
+		httpReq.Header[k] = v
+	}
+	if req.contentType != "" {
+		httpReq.Header.Set("Content-Type", req.contentType)
+	}
+	httpReq.Header.Set("Accept", mimeJSON)
+	if req.auth {
+		httpReq.Header.Set(headerToken, c.Token())
+	}
+
+	res, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, data, nil
+}
+
+func retryable(res *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// backoff is the wait before attempt+1: Retry-After when the server sent one,
+// otherwise exponential with full jitter.
+func (c *Client) backoff(attempt int, res *http.Response) time.Duration {
+	if res != nil {
+		if seconds, err := strconv.Atoi(res.Header.Get(headerRetryAfter)); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+
+	limit := float64(c.retry.MinBackoff) * math.Pow(2, float64(attempt-1))
+	if max := float64(c.retry.MaxBackoff); limit > max {
+		limit = max
+	}
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(mrand.Int63n(int64(limit)) + 1)
+}
+
+func (c *Client) hasCredentials() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.email != ""
+}
+
+// ensureToken logs in if the client has credentials but no token yet.
+func (c *Client) ensureToken(ctx context.Context) error {
+	if c.Token() != "" || !c.hasCredentials() {
+		return nil
+	}
+	return c.refresh(ctx)
+}
+
+func (c *Client) refresh(ctx context.Context) error {
+	c.mu.Lock()
+	email, password := c.email, c.password
+	c.mu.Unlock()
+
+	_, err := c.Login(ctx, email, password)
+	return err
+}
+
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// ifMatch is the If-Match header for version. Without a version the header is
+// left out, so the server refuses the write with 428 rather than overwrite
+// changes the caller never saw.
+func ifMatch(version int) http.Header {
+	if version <= 0 {
+		return http.Header{}
+	}
+	return http.Header{headerIfMatch: {strconv.Quote(strconv.Itoa(version))}}
+}
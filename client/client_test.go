@@ -0,0 +1,358 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"crud-product/client"
+	"crud-product/constant"
+	"crud-product/delivery/rest"
+	"crud-product/delivery/validate"
+	"crud-product/model"
+	"crud-product/repository"
+	"crud-product/usecase"
+	"github.com/labstack/echo/v4"
+)
+
+// sentRequest is a request as the server received it.
+type sentRequest struct {
+	method string
+	uri    string
+	header http.Header
+	body   []byte
+}
+
+type testServer struct {
+	url   string
+	users repository.UserRepository
+
+	mu   sync.Mutex
+	sent []sentRequest
+}
+
+// newTestServer serves the REST API over memory repositories with one brand
+// and an admin, admin@example.com, and records every request it receives.
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	brands := repository.NewMemoryBrandRepository(model.Brand{ID: 1, Name: "Eiger"})
+	products := repository.NewMemoryProductRepository(brands)
+	s := &testServer{users: repository.NewMemoryUserRepository()}
+
+	e := echo.New()
+	e.HTTPErrorHandler = rest.ErrorHandler
+	e.Validator = validate.New()
+	e.Binder = &rest.Binder{}
+	e.Use(rest.ReadYourWrites)
+
+	rest.NewHandler(e,
+		usecase.NewProduct(products, repository.NewMemoryTransactor(products)),
+		usecase.NewBrand(brands, products),
+		usecase.NewUser(s.users),
+		rest.Idempotency(repository.NewMemoryIdempotencyRepository(), time.Hour, constant.DefaultIdempotencyMaxBodySize),
+		model.SessionConfig{}, model.UploadConfig{Dir: t.TempDir()})
+
+	ctx := context.Background()
+	if err := s.users.Store(ctx, model.User{Name: "Admin", Email: "admin@example.com", Password: "secret123"}); err != nil {
+		t.Fatalf("store admin: %v", err)
+	}
+	if err := s.users.SetRole(ctx, "admin@example.com", model.RoleAdmin); err != nil {
+		t.Fatalf("promote admin: %v", err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		s.mu.Lock()
+		s.sent = append(s.sent, sentRequest{method: r.Method, uri: r.URL.RequestURI(), header: r.Header.Clone(), body: body})
+		s.mu.Unlock()
+
+		e.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	s.url = srv.URL
+	return s
+}
+
+// last returns the last request the server received.
+func (s *testServer) last(t *testing.T) sentRequest {
+	t.Helper()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.sent) == 0 {
+		t.Fatal("no request was sent")
+	}
+	return s.sent[len(s.sent)-1]
+}
+
+func (s *testServer) admin(opts ...client.Option) *client.Client {
+	opts = append([]client.Option{
+		client.WithCredentials("admin@example.com", "secret123"),
+		client.WithRetry(client.RetryPolicy{MaxAttempts: 1}),
+	}, opts...)
+	return client.New(s.url+"/", opts...)
+}
+
+func expectJSON(t *testing.T, req sentRequest, contentType string, want map[string]interface{}) {
+	t.Helper()
+
+	if ct := req.header.Get("Content-Type"); ct != contentType {
+		t.Fatalf("%s %s Content-Type = %q, want %q", req.method, req.uri, ct, contentType)
+	}
+
+	got := map[string]interface{}{}
+	if err := json.Unmarshal(req.body, &got); err != nil {
+		t.Fatalf("decode %s %s body %s: %v", req.method, req.uri, req.body, err)
+	}
+
+	wantJSON, _ := json.Marshal(want)
+	gotJSON, _ := json.Marshal(got)
+	if !bytes.Equal(gotJSON, wantJSON) {
+		t.Fatalf("%s %s body = %s, want %s", req.method, req.uri, gotJSON, wantJSON)
+	}
+}
+
+// expectError checks that err is a *client.Error decoded from a problem
+// response and matching kind.
+func expectError(t *testing.T, err error, kind error, status int, code string) *client.Error {
+	t.Helper()
+
+	if !errors.Is(err, kind) {
+		t.Fatalf("err = %v, want %v", err, kind)
+	}
+
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %#v, want a *client.Error", err)
+	}
+	if apiErr.Status != status || apiErr.Code != code || apiErr.Title == "" || apiErr.Detail == "" {
+		t.Fatalf("err = %+v, want status %d and code %s with title and detail", apiErr, status, code)
+	}
+	return apiErr
+}
+
+func TestProductRoundTrip(t *testing.T) {
+	s := newTestServer(t)
+	c := s.admin()
+	ctx := context.Background()
+
+	created, err := c.SendProduct(ctx, model.Product{Name: "Kemeja", Price: 150000, Stock: 5, BrandID: 1, SKU: "KMJ-1"})
+	if err != nil {
+		t.Fatalf("SendProduct: %v", err)
+	}
+	if created.ID == 0 || created.Version != 1 {
+		t.Fatalf("created = %+v, want an ID and version 1", created)
+	}
+	if c.Token() == "" {
+		t.Fatal("client did not log in with its credentials")
+	}
+
+	req := s.last(t)
+	if req.method != http.MethodPost || req.uri != "/api/v2/products" {
+		t.Fatalf("SendProduct sent %s %s", req.method, req.uri)
+	}
+	if req.header.Get("Idempotency-Key") == "" || req.header.Get("x-access-token") != c.Token() {
+		t.Fatalf("SendProduct headers = %v, want an Idempotency-Key and the token", req.header)
+	}
+	expectJSON(t, req, "application/json", map[string]interface{}{
+		"name": "Kemeja", "price": 150000, "stock": 5, "brand_id": 1, "sku": "KMJ-1",
+	})
+
+	got, err := c.GetProduct(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("GetProduct: %v", err)
+	}
+	if got.Name != "Kemeja" || got.SKU != "KMJ-1" || got.Version != 1 {
+		t.Fatalf("GetProduct = %+v, want the created product", got)
+	}
+	if req := s.last(t); req.header.Get("Idempotency-Key") != "" {
+		t.Fatalf("GET sent an Idempotency-Key: %v", req.header)
+	}
+
+	// The version read back goes out as If-Match and comes back bumped.
+	got.Name = "Kemeja Flanel"
+	updated, err := c.UpdateProduct(ctx, got, got.ID)
+	if err != nil {
+		t.Fatalf("UpdateProduct: %v", err)
+	}
+	if updated.Name != "Kemeja Flanel" || updated.Version != 2 {
+		t.Fatalf("UpdateProduct = %+v, want the new name at version 2", updated)
+	}
+	if req := s.last(t); req.method != http.MethodPut || req.header.Get("If-Match") != `"1"` {
+		t.Fatalf("UpdateProduct sent %s with If-Match %q, want PUT with \"1\"", req.method, req.header.Get("If-Match"))
+	}
+
+	stock := 9
+	_, err = c.PatchProduct(ctx, model.ProductPatch{Stock: &stock, Version: got.Version}, got.ID)
+	expectError(t, err, model.ErrPreconditionFailed, http.StatusPreconditionFailed, "version_mismatch")
+
+	req = s.last(t)
+	if req.header.Get("If-Match") != `"1"` {
+		t.Fatalf("PatchProduct If-Match = %q, want \"1\"", req.header.Get("If-Match"))
+	}
+	expectJSON(t, req, "application/merge-patch+json", map[string]interface{}{"stock": 9})
+
+	patched, err := c.PatchProduct(ctx, model.ProductPatch{Stock: &stock, Version: updated.Version}, got.ID)
+	if err != nil {
+		t.Fatalf("PatchProduct: %v", err)
+	}
+	if patched.Stock != 9 || patched.Name != "Kemeja Flanel" || patched.Version != 3 {
+		t.Fatalf("PatchProduct = %+v, want only the stock changed, at version 3", patched)
+	}
+
+	withImage, err := c.UploadImage(ctx, got.ID, patched.Version, "flanel.png", strings.NewReader("png bytes"))
+	if err != nil {
+		t.Fatalf("UploadImage: %v", err)
+	}
+	if withImage.Version != 4 {
+		t.Fatalf("UploadImage = %+v, want version 4", withImage)
+	}
+
+	req = s.last(t)
+	mediaType, params, _ := mime.ParseMediaType(req.header.Get("Content-Type"))
+	if req.uri != "/api/v2/products/1/image" || mediaType != "multipart/form-data" || req.header.Get("If-Match") != `"3"` {
+		t.Fatalf("UploadImage sent %s as %s with If-Match %q", req.uri, mediaType, req.header.Get("If-Match"))
+	}
+	if !bytes.Contains(req.body, []byte(`name="fileImage"; filename="flanel.png"`)) || !strings.Contains(string(req.body), params["boundary"]) {
+		t.Fatalf("UploadImage body = %q, want the fileImage part", req.body)
+	}
+
+	// Without a version nothing is overwritten blindly: If-Match is left out
+	// and the server asks for it.
+	err = c.DeleteProduct(ctx, got.ID, 0)
+	expectError(t, err, model.ErrPreconditionFailed, http.StatusPreconditionRequired, "precondition_required")
+	if req := s.last(t); req.method != http.MethodDelete || len(req.header.Values("If-Match")) != 0 {
+		t.Fatalf("DeleteProduct sent %s with If-Match %q, want DELETE without it", req.method, req.header.Values("If-Match"))
+	}
+
+	if err := c.DeleteProduct(ctx, got.ID, withImage.Version); err != nil {
+		t.Fatalf("DeleteProduct: %v", err)
+	}
+	if req := s.last(t); req.header.Get("If-Match") != `"4"` {
+		t.Fatalf("DeleteProduct If-Match = %q, want \"4\"", req.header.Get("If-Match"))
+	}
+
+	_, err = c.GetProduct(ctx, got.ID)
+	expectError(t, err, model.ErrNotFound, http.StatusNotFound, "product_not_found")
+}
+
+func TestListing(t *testing.T) {
+	s := newTestServer(t)
+	c := s.admin()
+	ctx := context.Background()
+
+	for _, name := range []string{"Kemeja", "Celana", "Topi"} {
+		if _, err := c.SendProduct(ctx, model.Product{Name: name, BrandID: 1}); err != nil {
+			t.Fatalf("SendProduct %s: %v", name, err)
+		}
+	}
+
+	page, err := c.ListProducts(ctx, model.ProductFilter{BrandID: 1, Limit: 2, Offset: 1})
+	if err != nil {
+		t.Fatalf("ListProducts: %v", err)
+	}
+	if req := s.last(t); req.uri != "/api/v2/products?brand_id=1&limit=2&offset=1" {
+		t.Fatalf("ListProducts sent %s", req.uri)
+	}
+	if len(page.Data) != 2 || page.Data[0].Name != "Celana" || page.Limit != 2 || page.Offset != 1 {
+		t.Fatalf("ListProducts = %+v, want Celana and Topi", page)
+	}
+
+	all, err := c.GetProductAll(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetProductAll: %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("GetProductAll = %+v, want all three products", all)
+	}
+
+	brands, err := c.GetBrands(ctx)
+	if err != nil {
+		t.Fatalf("GetBrands: %v", err)
+	}
+	if len(brands) != 1 || brands[0].Name != "Eiger" {
+		t.Fatalf("GetBrands = %+v, want Eiger", brands)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	s := newTestServer(t)
+	c := s.admin()
+	ctx := context.Background()
+
+	_, err := c.SendProduct(ctx, model.Product{Name: " ", BrandID: 1})
+	apiErr := expectError(t, err, model.ErrValidation, http.StatusBadRequest, "validation_failed")
+	if len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != "name" || apiErr.Fields[0].Rule != "notblank" {
+		t.Fatalf("invalid fields = %+v, want name failing notblank", apiErr.Fields)
+	}
+	if apiErr.Retryable() {
+		t.Fatal("a validation error is retryable")
+	}
+
+	user := model.User{Name: "Budi", Email: "budi@example.com", Password: "rahasia123"}
+	if err := c.CreateUser(ctx, user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	sent := model.User{}
+	if err := json.Unmarshal(s.last(t).body, &sent); err != nil || sent.Name != user.Name || sent.Email != user.Email || sent.Password != user.Password {
+		t.Fatalf("CreateUser sent %s, want the user", s.last(t).body)
+	}
+
+	err = c.CreateUser(ctx, user)
+	expectError(t, err, model.ErrConflict, http.StatusConflict, "email_taken")
+
+	_, err = client.New(s.url).Login(ctx, "budi@example.com", "salah12345")
+	expectError(t, err, model.ErrUnauthorized, http.StatusUnauthorized, "invalid_credentials")
+
+	budi := client.New(s.url, client.WithCredentials("budi@example.com", "rahasia123"))
+	err = budi.SetUserRole(ctx, "budi@example.com", model.RoleAdmin)
+	expectError(t, err, model.ErrForbidden, http.StatusForbidden, "admin_required")
+
+	if err := c.SetUserRole(ctx, "budi@example.com", model.RoleAdmin); err != nil {
+		t.Fatalf("SetUserRole: %v", err)
+	}
+	expectJSON(t, s.last(t), "application/json", map[string]interface{}{"email": "budi@example.com", "role": 1})
+
+	err = c.SetUserRole(ctx, "siapa@example.com", model.RoleAdmin)
+	expectError(t, err, model.ErrNotFound, http.StatusNotFound, "user_not_found")
+}
+
+func TestTokenRefresh(t *testing.T) {
+	s := newTestServer(t)
+	c := s.admin(client.WithToken("expired"))
+
+	if _, err := c.GetBrands(context.Background()); err != nil {
+		t.Fatalf("GetBrands: %v", err)
+	}
+	if c.Token() == "expired" {
+		t.Fatal("client kept the rejected token")
+	}
+
+	var uris []string
+	s.mu.Lock()
+	for _, req := range s.sent {
+		uris = append(uris, req.method+" "+req.uri)
+	}
+	s.mu.Unlock()
+	if want := "GET /api/v2/brands,POST /login,GET /api/v2/brands"; strings.Join(uris, ",") != want {
+		t.Fatalf("requests = %v, want %s", uris, want)
+	}
+
+	// Without credentials the rejection is returned.
+	_, err := client.New(s.url, client.WithToken("expired")).GetBrands(context.Background())
+	expectError(t, err, model.ErrUnauthorized, http.StatusUnauthorized, "invalid_token")
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"crud-product/model"
+)
+
+// Error is an error response from the API. Match it against the model error
+// kinds with errors.Is, e.g. errors.Is(err, model.ErrNotFound), or use errors.As
+// to read Code and Fields.
+type Error struct {
+	Status    int                `json:"status"`
+	Code      string             `json:"code"`
+	Title     string             `json:"title"`
+	Detail    string             `json:"detail"`
+	RequestID string             `json:"request_id"`
+	Fields    []model.FieldError `json:"errors"`
+}
+
+func (e *Error) Error() string {
+	msg := e.Detail
+	if msg == "" {
+		msg = e.Title
+	}
+	if e.Code != "" {
+		return fmt.Sprintf("%d %s: %s", e.Status, e.Code, msg)
+	}
+	return fmt.Sprintf("%d: %s", e.Status, msg)
+}
+
+// Is reports whether the error's status is the one the API uses for target.
+func (e *Error) Is(target error) bool {
+	return target == kindOf(e.Status)
+}
+
+// Retryable reports whether repeating the request may succeed.
+func (e *Error) Retryable() bool {
+	return retryable(&http.Response{StatusCode: e.Status}, nil)
+}
+
+func kindOf(status int) error {
+	switch status {
+	case http.StatusNotFound:
+		return model.ErrNotFound
+	case http.StatusBadRequest:
+		return model.ErrValidation
+	case http.StatusConflict:
+		return model.ErrConflict
+	case http.StatusForbidden:
+		return model.ErrForbidden
+	case http.StatusUnauthorized:
+		return model.ErrUnauthorized
+	case http.StatusPreconditionFailed, http.StatusPreconditionRequired:
+		return model.ErrPreconditionFailed
+	case http.StatusUnprocessableEntity:
+		return model.ErrUnprocessable
+	case http.StatusTooManyRequests:
+		return model.ErrTooManyRequests
+	default:
+		return nil
+	}
+}
+
+// newError reads the problem details body of res. Bodies that are not problem
+// details, e.g. from a proxy, still give an Error with the status.
+func newError(res *http.Response, body []byte) *Error {
+	e := &Error{}
+	if err := json.Unmarshal(body, e); err != nil {
+		e = &Error{}
+	}
+
+	e.Status = res.StatusCode
+	if e.Title == "" {
+		e.Title = http.StatusText(res.StatusCode)
+	}
+	if e.RequestID == "" {
+		e.RequestID = res.Header.Get("X-Request-Id")
+	}
+	return e
+}
@@ -0,0 +1,227 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"crud-product/model"
+)
+
+// ProductPage is one page of a product listing.
+type ProductPage struct {
+	Data   []model.Product `json:"data"`
+	Limit  int             `json:"limit"`
+	Offset int             `json:"offset"`
+}
+
+type productRequest struct {
+	Name    string `json:"name"`
+	Price   int    `json:"price"`
+	Stock   int    `json:"stock"`
+	BrandID int    `json:"brand_id"`
+	// The API ignores SKU and ExternalID on update.
+	SKU        string `json:"sku,omitempty"`
+	ExternalID string `json:"external_id,omitempty"`
+}
+
+func newProductRequest(product model.Product) productRequest {
+	return productRequest{
+		Name:    product.Name,
+		Price:   product.Price,
+		Stock:   product.Stock,
+		BrandID: product.BrandID,
+
+		SKU:        product.SKU,
+		ExternalID: product.ExternalID,
+	}
+}
+
+// GetProduct returns the product with productID.
+func (c *Client) GetProduct(ctx context.Context, productID int) (model.Product, error) {
+	res := model.Product{}
+	_, err := c.do(ctx, request{method: http.MethodGet, path: productPath(productID), auth: true, retry: true}, &res)
+	return res, err
+}
+
+// GetProductAll returns every product of a brand, following the pages.
+func (c *Client) GetProductAll(ctx context.Context, brandID int) ([]model.Product, error) {
+	filter := model.ProductFilter{}
+
+	var products []model.Product
+	for {
+		page, err := c.GetBrandProducts(ctx, brandID, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		products = append(products, page.Data...)
+		if len(page.Data) == 0 || len(page.Data) < page.Limit {
+			return products, nil
+		}
+		filter.Limit = page.Limit
+		filter.Offset = page.Offset + len(page.Data)
+	}
+}
+
+// ListProducts returns one page of products. A zero Limit is the server's
+// default page size.
+func (c *Client) ListProducts(ctx context.Context, filter model.ProductFilter) (ProductPage, error) {
+	return c.listProducts(ctx, "/api/v2/products", filter)
+}
+
+// SendProduct creates a product and returns it with its ID and version.
+func (c *Client) SendProduct(ctx context.Context, product model.Product) (model.Product, error) {
+	req, err := jsonRequest(http.MethodPost, "/api/v2/products", newProductRequest(product))
+	if err != nil {
+		return model.Product{}, err
+	}
+
+	res := model.Product{}
+	_, err = c.do(ctx, req, &res)
+	return res, err
+}
+
+// UpdateProduct replaces every field of a product but its image. It fails
+// with model.ErrPreconditionFailed if the product has changed since
+// product.Version, or if product.Version is zero.
+func (c *Client) UpdateProduct(ctx context.Context, product model.Product, productID int) (model.Product, error) {
+	req, err := jsonRequest(http.MethodPut, productPath(productID), newProductRequest(product))
+	if err != nil {
+		return model.Product{}, err
+	}
+	req.header = ifMatch(product.Version)
+
+	res := model.Product{}
+	_, err = c.do(ctx, req, &res)
+	return res, err
+}
+
+// PatchProduct changes the non-nil fields of patch, conditional on
+// patch.Version like UpdateProduct.
+func (c *Client) PatchProduct(ctx context.Context, patch model.ProductPatch, productID int) (model.Product, error) {
+	req, err := jsonRequest(http.MethodPatch, productPath(productID), mergePatch(patch))
+	if err != nil {
+		return model.Product{}, err
+	}
+	req.contentType = mimeMergePatch
+	req.header = ifMatch(patch.Version)
+
+	res := model.Product{}
+	_, err = c.do(ctx, req, &res)
+	return res, err
+}
+
+// DeleteProduct deletes a product, conditional on version like UpdateProduct.
+func (c *Client) DeleteProduct(ctx context.Context, productID, version int) error {
+	req := request{
+		method: http.MethodDelete,
+		path:   productPath(productID),
+		header: ifMatch(version),
+		auth:   true,
+		retry:  true,
+	}
+
+	_, err := c.do(ctx, req, nil)
+	return err
+}
+
+// UploadImage replaces the image of a product, conditional on version like
+// UpdateProduct. The image is read into memory so the upload can be retried.
+func (c *Client) UploadImage(ctx context.Context, productID, version int, filename string, image io.Reader) (model.Product, error) {
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+
+	part, err := form.CreateFormFile("fileImage", filename)
+	if err != nil {
+		return model.Product{}, err
+	}
+	if _, err := io.Copy(part, image); err != nil {
+		return model.Product{}, err
+	}
+	if err := form.Close(); err != nil {
+		return model.Product{}, err
+	}
+
+	req := request{
+		method:      http.MethodPut,
+		path:        productPath(productID) + "/image",
+		body:        body.Bytes(),
+		contentType: form.FormDataContentType(),
+		header:      ifMatch(version),
+		auth:        true,
+		retry:       true,
+	}
+
+	res := model.Product{}
+	_, err = c.do(ctx, req, &res)
+	return res, err
+}
+
+// GetBrands returns every brand.
+func (c *Client) GetBrands(ctx context.Context) ([]model.Brand, error) {
+	var res []model.Brand
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/api/v2/brands", auth: true, retry: true}, &res)
+	return res, err
+}
+
+// GetBrandProducts returns one page of a brand's products. filter.BrandID is
+// ignored.
+func (c *Client) GetBrandProducts(ctx context.Context, brandID int, filter model.ProductFilter) (ProductPage, error) {
+	filter.BrandID = 0
+	return c.listProducts(ctx, fmt.Sprintf("/api/v2/brands/%d/products", brandID), filter)
+}
+
+func (c *Client) listProducts(ctx context.Context, path string, filter model.ProductFilter) (ProductPage, error) {
+	query := url.Values{}
+	if filter.BrandID > 0 {
+		query.Set("brand_id", strconv.Itoa(filter.BrandID))
+	}
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+	if filter.Offset > 0 {
+		query.Set("offset", strconv.Itoa(filter.Offset))
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	res := ProductPage{}
+	_, err := c.do(ctx, request{method: http.MethodGet, path: path, auth: true, retry: true}, &res)
+	return res, err
+}
+
+// mergePatch leaves nil fields out of the patch; a null member would ask the
+// API to remove the field.
+func mergePatch(patch model.ProductPatch) map[string]interface{} {
+	body := map[string]interface{}{}
+	if patch.Name != nil {
+		body["name"] = *patch.Name
+	}
+	if patch.Price != nil {
+		body["price"] = *patch.Price
+	}
+	if patch.Stock != nil {
+		body["stock"] = *patch.Stock
+	}
+	if patch.BrandID != nil {
+		body["brand_id"] = *patch.BrandID
+	}
+	if patch.SKU != nil {
+		body["sku"] = *patch.SKU
+	}
+	if patch.ExternalID != nil {
+		body["external_id"] = *patch.ExternalID
+	}
+	return body
+}
+
+func productPath(productID int) string {
+	return fmt.Sprintf("/api/v2/products/%d", productID)
+}
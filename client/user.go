@@ -0,0 +1,58 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"crud-product/model"
+)
+
+type loginResponse struct {
+	Message string `json:"message"`
+	Token   string `json:"token"`
+}
+
+// Login exchanges credentials for a token, which the client then sends with
+// every request.
+func (c *Client) Login(ctx context.Context, email, password string) (string, error) {
+	req, err := jsonRequest(http.MethodPost, "/login", model.Credentials{Email: email, Password: password})
+	if err != nil {
+		return "", err
+	}
+	req.auth = false
+
+	res := loginResponse{}
+	if _, err := c.do(ctx, req, &res); err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.token = res.Token
+	c.mu.Unlock()
+	return res.Token, nil
+}
+
+// CreateUser registers a user. The server ignores user.Role: new users always
+// get model.RoleUser.
+func (c *Client) CreateUser(ctx context.Context, user model.User) error {
+	req, err := jsonRequest(http.MethodPost, "/register", user)
+	if err != nil {
+		return err
+	}
+	req.auth = false
+
+	_, err = c.do(ctx, req, nil)
+	return err
+}
+
+// SetUserRole changes the role of a user. The client must be logged in as an
+// admin.
+func (c *Client) SetUserRole(ctx context.Context, email string, role int) error {
+	req, err := jsonRequest(http.MethodPut, "/api/v2/users/role", model.RoleChange{Email: email, Role: &role})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.do(ctx, req, nil)
+	return err
+}
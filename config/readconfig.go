@@ -4,18 +4,207 @@ import (
 	"crud-product/constant"
 	"crud-product/model"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"os"
 )
 
 func GetConfig() (*model.Config, error) {
+	jsonFile, err := ioutil.ReadFile(constant.ConfigProjectFilepath)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(jsonFile)
+}
+
+// Parse reads a configuration in the format of config.json and fills in the
+// defaults.
+func Parse(data []byte) (*model.Config, error) {
 	cfg := &model.Config{}
 
-	jsonFile, err := ioutil.ReadFile(constant.ConfigProjectFilepath)
+	err := json.Unmarshal(data, &cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	err = json.Unmarshal(jsonFile, &cfg)
+	if cfg.Server.Addr == "" {
+		cfg.Server.Addr = constant.DefaultServerAddr
+	}
+
+	if cfg.Server.ReadHeaderTimeout == 0 {
+		cfg.Server.ReadHeaderTimeout = model.Duration(constant.DefaultReadHeaderTimeout)
+	}
+
+	if cfg.Server.ReadTimeout == 0 {
+		cfg.Server.ReadTimeout = model.Duration(constant.DefaultReadTimeout)
+	}
+
+	if cfg.Server.IdleTimeout == 0 {
+		cfg.Server.IdleTimeout = model.Duration(constant.DefaultIdleTimeout)
+	}
+
+	if cfg.Database.Driver == "" {
+		cfg.Database.Driver = constant.DriverMySQL
+	}
+
+	if cfg.Database.MaxOpenConns == 0 {
+		cfg.Database.MaxOpenConns = constant.DefaultMaxOpenConns
+	}
+
+	if cfg.Database.MaxIdleConns == 0 {
+		cfg.Database.MaxIdleConns = constant.DefaultMaxIdleConns
+	}
+
+	if cfg.Database.ConnMaxLifetime == 0 {
+		cfg.Database.ConnMaxLifetime = model.Duration(constant.DefaultConnMaxLifetime)
+	}
+
+	if cfg.Database.QueryTimeout == 0 {
+		cfg.Database.QueryTimeout = model.Duration(constant.DefaultQueryTimeout)
+	}
+
+	// An export streams the whole catalogue through a single query, which
+	// would rarely finish within query_timeout.
+	if _, ok := cfg.Database.OperationTimeouts["product.export"]; !ok {
+		if cfg.Database.OperationTimeouts == nil {
+			cfg.Database.OperationTimeouts = map[string]model.Duration{}
+		}
+		cfg.Database.OperationTimeouts["product.export"] = model.Duration(constant.DefaultExportTimeout)
+	}
+
+	if cfg.Database.ReplicaHealthInterval == 0 {
+		cfg.Database.ReplicaHealthInterval = model.Duration(constant.DefaultReplicaHealthInterval)
+	}
+
+	if cfg.Cache.Size == 0 {
+		cfg.Cache.Size = constant.DefaultCacheSize
+	}
+
+	if cfg.Cache.TTL == 0 {
+		cfg.Cache.TTL = model.Duration(constant.DefaultCacheTTL)
+	}
+
+	if cfg.Cache.Redis.Prefix == "" {
+		cfg.Cache.Redis.Prefix = constant.DefaultCachePrefix
+	}
+
+	if cfg.Idempotency.TTL == 0 {
+		cfg.Idempotency.TTL = model.Duration(constant.DefaultIdempotencyTTL)
+	}
+
+	if cfg.Idempotency.MaxBodySize == 0 {
+		cfg.Idempotency.MaxBodySize = constant.DefaultIdempotencyMaxBodySize
+	}
+
+	if cfg.Log.Level == "" {
+		cfg.Log.Level = constant.DefaultLogLevel
+	}
+
+	if cfg.Log.Format == "" {
+		cfg.Log.Format = constant.LogFormatJSON
+	}
+
+	if cfg.Tracing.ServiceName == "" {
+		cfg.Tracing.ServiceName = constant.DefaultServiceName
+	}
+
+	if cfg.Tracing.SampleRatio == 0 {
+		cfg.Tracing.SampleRatio = constant.DefaultSampleRatio
+	}
+
+	if cfg.RateLimit.Redis.Prefix == "" {
+		cfg.RateLimit.Redis.Prefix = constant.DefaultCachePrefix
+	}
+
+	for group, limit := range cfg.RateLimit.Groups {
+		if limit.Period == 0 {
+			limit.Period = model.Duration(constant.DefaultRateLimitPeriod)
+		}
+		if limit.Burst == 0 {
+			limit.Burst = limit.Rate
+		}
+		cfg.RateLimit.Groups[group] = limit
+	}
+
+	if cfg.Security.HSTSMaxAge == nil {
+		maxAge := model.Duration(constant.DefaultHSTSMaxAge)
+		cfg.Security.HSTSMaxAge = &maxAge
+	}
+
+	if cfg.Security.FrameOptions == "" {
+		cfg.Security.FrameOptions = constant.DefaultFrameOptions
+	}
+
+	if cfg.Security.ReferrerPolicy == "" {
+		cfg.Security.ReferrerPolicy = constant.DefaultReferrerPolicy
+	}
+
+	if cfg.Security.CSP == "" {
+		cfg.Security.CSP = constant.DefaultCSP
+	}
+
+	if cfg.Security.SwaggerCSP == "" {
+		cfg.Security.SwaggerCSP = constant.DefaultSwaggerCSP
+	}
+
+	if cfg.Session.CookieName == "" {
+		cfg.Session.CookieName = constant.DefaultSessionCookie
+	}
+
+	if cfg.Session.Secure == nil {
+		secure := true
+		cfg.Session.Secure = &secure
+	}
+
+	if cfg.Session.SameSite == "" {
+		cfg.Session.SameSite = constant.DefaultSameSite
+	}
+
+	// Without a secret anyone who sees a session token could derive its CSRF
+	// token.
+	if cfg.Session.Cookie && len(cfg.Session.CSRFSecret) < constant.MinCSRFSecretLength {
+		return nil, fmt.Errorf("session: csrf_secret of at least %d characters is required with cookie sessions", constant.MinCSRFSecretLength)
+	}
+
+	if cfg.Upload.Dir == "" {
+		cfg.Upload.Dir = constant.DefaultUploadDir
+	}
+
+	if cfg.Import.ChunkSize == 0 {
+		cfg.Import.ChunkSize = constant.DefaultImportChunkSize
+	}
+
+	if cfg.Import.AsyncRows == 0 {
+		cfg.Import.AsyncRows = constant.DefaultImportAsyncRows
+	}
+
+	if cfg.Import.MaxFileSize == 0 {
+		cfg.Import.MaxFileSize = constant.DefaultImportMaxFileSize
+	}
+
+	if cfg.Import.JobTTL == 0 {
+		cfg.Import.JobTTL = model.Duration(constant.DefaultImportJobTTL)
+	}
+
+	if cfg.Import.QueueSize == 0 {
+		cfg.Import.QueueSize = constant.DefaultImportQueueSize
+	}
+
+	if cfg.Import.Instance == "" {
+		cfg.Import.Instance, _ = os.Hostname()
+	}
+
+	// Echo answers a wildcard origin with the caller's own origin when
+	// credentials are allowed, which would let any site use the session.
+	if cfg.CORS.AllowCredentials {
+		for _, origin := range cfg.CORS.AllowOrigins {
+			if origin == "*" {
+				return nil, errors.New(`cors: allow_credentials cannot be combined with the "*" origin`)
+			}
+		}
+	}
 
 	return cfg, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,10 @@
+package constant
+
+const (
+	// V1Sunset is the RFC 1123 date after which the query-parameter routes
+	// under /product may be removed.
+	V1Sunset = "Wed, 30 Jun 2027 00:00:00 GMT"
+
+	DefaultPageLimit = 50
+	MaxPageLimit     = 500
+)
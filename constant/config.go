@@ -1,5 +1,95 @@
 package constant
 
+import "time"
+
 const (
 	ConfigProjectFilepath = "config/config.json"
-)
\ No newline at end of file
+)
+
+const (
+	DefaultServerAddr        = ":8080"
+	DefaultReadHeaderTimeout = 10 * time.Second
+	DefaultReadTimeout       = time.Minute
+	DefaultIdleTimeout       = 2 * time.Minute
+)
+
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+const (
+	DefaultMaxOpenConns    = 25
+	DefaultMaxIdleConns    = 10
+	DefaultConnMaxLifetime = 5 * time.Minute
+	DefaultQueryTimeout    = 5 * time.Second
+	DefaultExportTimeout   = 10 * time.Minute
+
+	DefaultReplicaHealthInterval = 10 * time.Second
+)
+
+const (
+	CacheMemory = "memory"
+	CacheRedis  = "redis"
+
+	DefaultCacheSize   = 1000
+	DefaultCacheTTL    = time.Minute
+	DefaultCachePrefix = "crud-product:"
+)
+
+const (
+	DefaultIdempotencyTTL         = 24 * time.Hour
+	DefaultIdempotencyMaxBodySize = 32 << 20
+)
+
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+
+	DefaultLogLevel = "info"
+)
+
+const (
+	TracingNone   = "none"
+	TracingStdout = "stdout"
+	TracingOTLP   = "otlp"
+
+	DefaultServiceName = "crud-product"
+	DefaultSampleRatio = 1.0
+)
+
+const (
+	RateLimitMemory = "memory"
+	RateLimitRedis  = "redis"
+
+	RateLimitGroupAuth    = "auth"
+	RateLimitGroupAPI     = "api"
+	RateLimitGroupDefault = "default"
+
+	DefaultRateLimitPeriod = time.Minute
+)
+
+const (
+	DefaultHSTSMaxAge     = 365 * 24 * time.Hour
+	DefaultFrameOptions   = "DENY"
+	DefaultReferrerPolicy = "no-referrer"
+	DefaultCSP            = "default-src 'none'; frame-ancestors 'none'"
+	DefaultSwaggerCSP     = "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; img-src 'self' data:; frame-ancestors 'none'"
+
+	DefaultSessionCookie = "session"
+	DefaultSameSite      = "lax"
+	MinCSRFSecretLength  = 32
+)
+
+const (
+	DefaultUploadDir = "upload"
+)
+
+const (
+	DefaultImportChunkSize   = 500
+	DefaultImportAsyncRows   = 1000
+	DefaultImportMaxFileSize = 32 << 20
+	DefaultImportJobTTL      = time.Hour
+	DefaultImportQueueSize   = 10
+)
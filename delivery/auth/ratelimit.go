@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"crud-product/logger"
+	"crud-product/metrics"
+	"crud-product/model"
+	"crud-product/repository"
+)
+
+// LimitStatus is the policy closest to running out: the RateLimit-* headers
+// report it. RetryAfter is set when the request was rejected.
+type LimitStatus struct {
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Limiter gives every client a token bucket per route group, configured in
+// cfg.Groups, and counts requests made with an API key against its daily
+// quota. If the store fails, requests are let through.
+type Limiter struct {
+	store repository.RateLimitStore
+	cfg   model.RateLimitConfig
+}
+
+func NewLimiter(store repository.RateLimitStore, cfg model.RateLimitConfig) *Limiter {
+	return &Limiter{store: store, cfg: cfg}
+}
+
+// Allow takes a request of client from the bucket of group and, if apiKey is
+// not nil, from its quota. It returns a too many requests error when either
+// is used up. The status is nil when no policy applies.
+func (l *Limiter) Allow(ctx context.Context, group, client string, apiKey *model.APIKeyConfig) (*LimitStatus, error) {
+	entry := logger.FromContext(ctx).WithField("client", client)
+
+	var status *LimitStatus
+	if limit, ok := l.cfg.Groups[group]; ok && limit.Rate > 0 {
+		allowed, tokens, err := l.store.Take(ctx, fmt.Sprintf("ratelimit:%s:%s", group, client), limit)
+		if err != nil {
+			entry.Warnf("rate limit %s: %v", group, err)
+		} else {
+			status = &LimitStatus{
+				Limit:     limit.Burst,
+				Remaining: int(math.Max(0, math.Floor(tokens))),
+				Reset:     refillTime(float64(limit.Burst)-tokens, limit),
+			}
+
+			if !allowed {
+				metrics.RateLimited.WithLabelValues(group, "rate").Inc()
+				status.RetryAfter = refillTime(1-tokens, limit)
+				return status, model.NewTooManyRequestsError("rate_limited", "too many requests, retry later")
+			}
+		}
+	}
+
+	if apiKey != nil && apiKey.DailyQuota > 0 {
+		now := time.Now().UTC()
+		midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+
+		used, err := l.store.Incr(ctx, fmt.Sprintf("quota:%s:%s", apiKey.Name, now.Format("2006-01-02")), midnight)
+		if err != nil {
+			entry.Warnf("quota: %v", err)
+			return status, nil
+		}
+
+		quota := &LimitStatus{
+			Limit:     apiKey.DailyQuota,
+			Remaining: int(math.Max(0, float64(int64(apiKey.DailyQuota)-used))),
+			Reset:     midnight.Sub(now),
+		}
+		if used > int64(apiKey.DailyQuota) {
+			metrics.RateLimited.WithLabelValues(group, "quota").Inc()
+			quota.RetryAfter = quota.Reset
+			return quota, model.NewTooManyRequestsError("quota_exceeded", "daily quota of this API key is used up")
+		}
+		if status == nil || quota.Remaining < status.Remaining {
+			status = quota
+		}
+	}
+
+	return status, nil
+}
+
+type chargeKey struct{}
+
+// WithCharge returns a context through which Charge takes requests with fn.
+// Rate limiting middleware sets it for endpoints, such as GraphQL, whose
+// operations belong to other route groups than the endpoint itself.
+func WithCharge(ctx context.Context, fn func(ctx context.Context, group string) error) context.Context {
+	return context.WithValue(ctx, chargeKey{}, fn)
+}
+
+// Charge takes a request from the bucket of group for the client of ctx, on
+// top of the request the middleware already counted. It does nothing when
+// rate limiting is off.
+func Charge(ctx context.Context, group string) error {
+	fn, ok := ctx.Value(chargeKey{}).(func(context.Context, string) error)
+	if !ok {
+		return nil
+	}
+	return fn(ctx, group)
+}
+
+// refillTime is how long limit takes to add tokens to a bucket.
+func refillTime(tokens float64, limit model.RateLimit) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / float64(limit.Rate) * float64(limit.Period))
+}
@@ -0,0 +1,180 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"crud-product/delivery/auth"
+	"crud-product/model"
+	"crud-product/repository"
+)
+
+// recordingStore remembers the counters Incr was asked for.
+type recordingStore struct {
+	repository.RateLimitStore
+	keys      []string
+	expiresAt []time.Time
+}
+
+func (r *recordingStore) Incr(ctx context.Context, key string, expiresAt time.Time) (int64, error) {
+	r.keys = append(r.keys, key)
+	r.expiresAt = append(r.expiresAt, expiresAt)
+	return r.RateLimitStore.Incr(ctx, key, expiresAt)
+}
+
+// failingStore is a store that is down.
+type failingStore struct{}
+
+var errStoreDown = errors.New("connection refused")
+
+func (failingStore) Take(context.Context, string, model.RateLimit) (bool, float64, error) {
+	return false, 0, errStoreDown
+}
+
+func (failingStore) Incr(context.Context, string, time.Time) (int64, error) {
+	return 0, errStoreDown
+}
+
+func expectCode(t *testing.T, err error, kind error, code string) {
+	t.Helper()
+
+	var domainErr *model.Error
+	if !errors.Is(err, kind) || !errors.As(err, &domainErr) || domainErr.Code != code {
+		t.Fatalf("err = %v, want %s", err, code)
+	}
+}
+
+func TestLimiterRate(t *testing.T) {
+	limiter := auth.NewLimiter(repository.NewMemoryRateLimit(), model.RateLimitConfig{
+		Groups: map[string]model.RateLimit{
+			"api": {Rate: 1, Period: model.Duration(10 * time.Second), Burst: 2},
+		},
+	})
+	ctx := context.Background()
+
+	st, err := limiter.Allow(ctx, "api", "ip:10.0.0.1", nil)
+	if err != nil || st == nil || st.Limit != 2 || st.Remaining != 1 || st.RetryAfter != 0 {
+		t.Fatalf("first Allow = %+v, %v, want 1 of 2 left", st, err)
+	}
+	if st.Reset <= 9*time.Second || st.Reset > 10*time.Second {
+		t.Fatalf("Reset = %v, want the time to refill one token", st.Reset)
+	}
+
+	if st, err = limiter.Allow(ctx, "api", "ip:10.0.0.1", nil); err != nil || st.Remaining != 0 {
+		t.Fatalf("second Allow = %+v, %v, want none left", st, err)
+	}
+
+	st, err = limiter.Allow(ctx, "api", "ip:10.0.0.1", nil)
+	expectCode(t, err, model.ErrTooManyRequests, "rate_limited")
+	if st == nil || st.Remaining != 0 || st.RetryAfter <= 9*time.Second || st.RetryAfter > 10*time.Second {
+		t.Fatalf("rejected status = %+v, want RetryAfter until the next token", st)
+	}
+
+	// Each client and each group has a bucket of its own; groups without a
+	// policy are not limited.
+	if _, err := limiter.Allow(ctx, "api", "ip:10.0.0.2", nil); err != nil {
+		t.Fatalf("Allow for another client: %v", err)
+	}
+	if st, err := limiter.Allow(ctx, "default", "ip:10.0.0.1", nil); err != nil || st != nil {
+		t.Fatalf("Allow in a group without a policy = %+v, %v, want no status", st, err)
+	}
+}
+
+func TestLimiterQuota(t *testing.T) {
+	store := &recordingStore{RateLimitStore: repository.NewMemoryRateLimit()}
+	limiter := auth.NewLimiter(store, model.RateLimitConfig{
+		Groups: map[string]model.RateLimit{
+			"api": {Rate: 100, Period: model.Duration(time.Second), Burst: 100},
+		},
+	})
+	key := &model.APIKeyConfig{Name: "partner", DailyQuota: 2}
+	ctx := context.Background()
+
+	// The quota is closer to running out than the bucket, so it is reported.
+	st, err := limiter.Allow(ctx, "api", "key:partner", key)
+	if err != nil || st.Limit != 2 || st.Remaining != 1 {
+		t.Fatalf("first Allow = %+v, %v, want 1 of the quota of 2 left", st, err)
+	}
+	if _, err := limiter.Allow(ctx, "api", "key:partner", key); err != nil {
+		t.Fatalf("second Allow: %v", err)
+	}
+
+	st, err = limiter.Allow(ctx, "api", "key:partner", key)
+	expectCode(t, err, model.ErrTooManyRequests, "quota_exceeded")
+	if st.Remaining != 0 || st.RetryAfter != st.Reset || st.Reset > 24*time.Hour {
+		t.Fatalf("rejected status = %+v, want RetryAfter at the reset", st)
+	}
+
+	// The quota is counted per UTC day and resets at the next midnight.
+	now := time.Now().UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	if want := "quota:partner:" + now.Format("2006-01-02"); store.keys[0] != want {
+		t.Fatalf("quota key = %s, want %s", store.keys[0], want)
+	}
+	if !store.expiresAt[0].Equal(midnight) {
+		t.Fatalf("quota expires at %v, want %v", store.expiresAt[0], midnight)
+	}
+
+	// Keys without a quota are only rate limited.
+	for i := 0; i < 3; i++ {
+		if _, err := limiter.Allow(ctx, "api", "key:internal", &model.APIKeyConfig{Name: "internal"}); err != nil {
+			t.Fatalf("Allow without a quota: %v", err)
+		}
+	}
+}
+
+// A store that is down must not take the API down with it.
+func TestLimiterStoreDown(t *testing.T) {
+	limiter := auth.NewLimiter(failingStore{}, model.RateLimitConfig{
+		Groups: map[string]model.RateLimit{
+			"api": {Rate: 1, Period: model.Duration(time.Hour), Burst: 1},
+		},
+	})
+
+	for i := 0; i < 3; i++ {
+		st, err := limiter.Allow(context.Background(), "api", "ip:10.0.0.1", &model.APIKeyConfig{Name: "partner", DailyQuota: 1})
+		if err != nil || st != nil {
+			t.Fatalf("Allow %d = %+v, %v, want let through", i, st, err)
+		}
+	}
+}
+
+func TestLookupAPIKey(t *testing.T) {
+	keys := map[string]model.APIKeyConfig{
+		"k-partner": {Name: "partner", DailyQuota: 10},
+		"k-unnamed": {},
+	}
+
+	key, err := auth.LookupAPIKey("k-partner", keys)
+	if err != nil || key.Name != "partner" || key.DailyQuota != 10 {
+		t.Fatalf("LookupAPIKey = %+v, %v, want partner", key, err)
+	}
+
+	// Unnamed keys are named by a hash, never by the key itself.
+	key, err = auth.LookupAPIKey("k-unnamed", keys)
+	if err != nil || len(key.Name) != 8 || strings.Contains(key.Name, "unnamed") {
+		t.Fatalf("LookupAPIKey of an unnamed key = %+v, %v, want a hash name", key, err)
+	}
+
+	_, err = auth.LookupAPIKey("k-invented", keys)
+	expectCode(t, err, model.ErrUnauthorized, "invalid_api_key")
+}
+
+func TestCharge(t *testing.T) {
+	// Without rate limiting there is nothing to charge.
+	if err := auth.Charge(context.Background(), "auth"); err != nil {
+		t.Fatalf("Charge without a limiter: %v", err)
+	}
+
+	var groups []string
+	ctx := auth.WithCharge(context.Background(), func(ctx context.Context, group string) error {
+		groups = append(groups, group)
+		return nil
+	})
+	if err := auth.Charge(ctx, "auth"); err != nil || len(groups) != 1 || groups[0] != "auth" {
+		t.Fatalf("Charge = %v, charged %v, want auth", err, groups)
+	}
+}
@@ -0,0 +1,160 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"crud-product/delivery/auth"
+	"crud-product/delivery/validate"
+	"crud-product/logger"
+	"crud-product/model"
+	"crud-product/usecase"
+	gql "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/trace/otel"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxDepth bounds query nesting, e.g. brands { products { brand { ... } } }.
+const maxDepth = 8
+
+type Handler struct {
+	Schema         *gql.Schema
+	ProductUsecase usecase.ProductUsecase
+	BrandUsecase   usecase.BrandUsecase
+}
+
+// request is a GraphQL request in the usual POST body.
+type request struct {
+	Query         string                 `json:"query" validate:"required"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// response is a GraphQL response. Errors carry a code in extensions, like
+// the code of the REST problem bodies, and validation errors also the invalid
+// fields.
+type response struct {
+	Data   json.RawMessage `json:"data,omitempty" swaggertype:"object"`
+	Errors []responseError `json:"errors,omitempty"`
+}
+
+type responseError struct {
+	Message    string                 `json:"message"`
+	Locations  []location             `json:"locations,omitempty"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+type location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// NewHandler registers POST /graphql, which serves the product, brand and user
+// usecases with the same rules as the REST routes.
+func NewHandler(e *echo.Echo, productUsecase usecase.ProductUsecase, brandUsecase usecase.BrandUsecase, userUsecase usecase.UserUsecase) {
+	res := &resolver{
+		productUsecase: productUsecase,
+		brandUsecase:   brandUsecase,
+		userUsecase:    userUsecase,
+		validator:      validate.New(),
+	}
+
+	handler := &Handler{
+		Schema:         gql.MustParseSchema(schema, res, gql.MaxDepth(maxDepth), gql.Tracer(otel.DefaultTracer())),
+		ProductUsecase: productUsecase,
+		BrandUsecase:   brandUsecase,
+	}
+
+	e.POST("/graphql", handler.Query)
+}
+
+// Query godoc
+// @Summary Run a GraphQL query.
+// @Description runs a GraphQL query or mutation, see the schema in delivery/graphql. The token is optional; fields that need one fail with code missing_token. Field errors are reported in errors with their code in extensions and the status stays 200.
+// @Tags GraphQL
+// @Accept json
+// @Produce json
+// @Param x-access-token header string false "Auth token"
+// @Param request body request true "GraphQL request"
+// @Success 200 {object} response
+// @Failure 400 {object} rest.Problem
+// @Failure 401 {object} rest.Problem
+// @Router /graphql [post]
+func (h *Handler) Query(c echo.Context) error {
+	var req request
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+	if header := strings.TrimSpace(c.Request().Header.Get("x-access-token")); header != "" {
+		tk, err := auth.ParseToken(header)
+		if err != nil {
+			return model.NewUnauthorizedError("invalid_token", err.Error())
+		}
+
+		ctx = context.WithValue(ctx, userKey{}, tk)
+		ctx = logger.WithFields(ctx, log.Fields{"user_id": tk.UserID})
+	}
+	ctx = context.WithValue(ctx, loadersKey{}, newLoaders(h.ProductUsecase, h.BrandUsecase))
+
+	res := h.Schema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+
+	body := response{Data: res.Data, Errors: make([]responseError, 0, len(res.Errors))}
+	for _, qe := range res.Errors {
+		re := responseError{Message: qe.Message, Path: qe.Path}
+		for _, l := range qe.Locations {
+			re.Locations = append(re.Locations, location{Line: l.Line, Column: l.Column})
+		}
+
+		var domainErr *model.Error
+		switch {
+		case qe.ResolverError == nil:
+			re.Extensions = map[string]interface{}{"code": "invalid_query"}
+		case errors.As(qe.ResolverError, &domainErr):
+			re.Message = domainErr.Message
+			re.Extensions = map[string]interface{}{"code": domainErr.Code}
+			if len(domainErr.Fields) > 0 {
+				re.Extensions["fields"] = fieldErrors(domainErr.Fields)
+			}
+		default:
+			logger.FromContext(ctx).WithField("path", qe.Path).Error(qe.ResolverError)
+			re.Message = "internal error"
+			re.Extensions = map[string]interface{}{"code": "internal_error"}
+		}
+		body.Errors = append(body.Errors, re)
+	}
+
+	return c.JSON(http.StatusOK, body)
+}
+
+// fieldErrors renames the fields to the names of the schema.
+func fieldErrors(fields []model.FieldError) []model.FieldError {
+	res := make([]model.FieldError, 0, len(fields))
+	for _, f := range fields {
+		name := camelCase(f.Field)
+		res = append(res, model.FieldError{
+			Field:   name,
+			Rule:    f.Rule,
+			Message: strings.Replace(f.Message, f.Field, name, 1),
+		})
+	}
+	return res
+}
+
+// camelCase turns the JSON field names of the models, e.g. "brand_id", into
+// the names of the schema, e.g. "brandId".
+func camelCase(name string) string {
+	parts := strings.Split(name, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
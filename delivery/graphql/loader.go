@@ -0,0 +1,151 @@
+package graphql
+
+import (
+	"context"
+	"sync"
+
+	"crud-product/model"
+	"crud-product/usecase"
+)
+
+// loader batches lookups by ID within one request, like a dataloader. Keys
+// are queued with prime, typically by the resolver of a list for the items'
+// children, and the first load fetches every queued key with one call.
+// Results are kept for the rest of the request.
+type loader struct {
+	fetch func(context.Context, []int) (map[int]interface{}, error)
+
+	mu      sync.Mutex
+	pending map[int]bool
+	results map[int]*loadResult
+}
+
+type loadResult struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+func newLoader(fetch func(context.Context, []int) (map[int]interface{}, error)) *loader {
+	return &loader{
+		fetch:   fetch,
+		pending: map[int]bool{},
+		results: map[int]*loadResult{},
+	}
+}
+
+// prime queues keys for the next fetch.
+func (l *loader) prime(keys ...int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, key := range keys {
+		if _, ok := l.results[key]; !ok {
+			l.pending[key] = true
+		}
+	}
+}
+
+// set stores a value that is already known, so loading it fetches nothing.
+func (l *loader) set(key int, value interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.results[key]; ok {
+		return
+	}
+
+	res := &loadResult{done: make(chan struct{}), value: value}
+	close(res.done)
+	l.results[key] = res
+	delete(l.pending, key)
+}
+
+// load returns the value for key, or nil when the fetch did not return one.
+func (l *loader) load(ctx context.Context, key int) (interface{}, error) {
+	l.mu.Lock()
+	if res, ok := l.results[key]; ok {
+		l.mu.Unlock()
+		<-res.done
+		return res.value, res.err
+	}
+
+	l.pending[key] = true
+	batch := make(map[int]*loadResult, len(l.pending))
+	keys := make([]int, 0, len(l.pending))
+	for k := range l.pending {
+		res := &loadResult{done: make(chan struct{})}
+		batch[k] = res
+		l.results[k] = res
+		keys = append(keys, k)
+	}
+	l.pending = map[int]bool{}
+	l.mu.Unlock()
+
+	values, err := l.fetch(ctx, keys)
+	for k, res := range batch {
+		res.value, res.err = values[k], err
+		close(res.done)
+	}
+
+	return batch[key].value, batch[key].err
+}
+
+// loaders are the loaders of one request.
+type loaders struct {
+	brands        *loader
+	brandProducts *loader
+}
+
+type loadersKey struct{}
+
+func newLoaders(productUsecase usecase.ProductUsecase, brandUsecase usecase.BrandUsecase) *loaders {
+	return &loaders{
+		brands: newLoader(func(ctx context.Context, ids []int) (map[int]interface{}, error) {
+			brands, err := brandUsecase.GetBrandsByIDs(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+
+			values := make(map[int]interface{}, len(brands))
+			for id, brand := range brands {
+				values[id] = brand
+			}
+			return values, nil
+		}),
+		brandProducts: newLoader(func(ctx context.Context, ids []int) (map[int]interface{}, error) {
+			products, err := productUsecase.GetProductsByBrands(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+
+			values := make(map[int]interface{}, len(products))
+			for id, list := range products {
+				values[id] = list
+			}
+			return values, nil
+		}),
+	}
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+func (l *loaders) brand(ctx context.Context, id int) (*model.Brand, error) {
+	v, err := l.brands.load(ctx, id)
+	if err != nil || v == nil {
+		return nil, err
+	}
+
+	brand := v.(model.Brand)
+	return &brand, nil
+}
+
+func (l *loaders) productsOf(ctx context.Context, brandID int) ([]model.Product, error) {
+	v, err := l.brandProducts.load(ctx, brandID)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	return v.([]model.Product), nil
+}
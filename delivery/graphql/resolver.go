@@ -0,0 +1,464 @@
+package graphql
+
+import (
+	"context"
+	"strconv"
+
+	"crud-product/constant"
+	"crud-product/delivery/auth"
+	"crud-product/delivery/validate"
+	"crud-product/model"
+	"crud-product/usecase"
+	gql "github.com/graph-gophers/graphql-go"
+)
+
+type resolver struct {
+	productUsecase usecase.ProductUsecase
+	brandUsecase   usecase.BrandUsecase
+	userUsecase    usecase.UserUsecase
+	validator      *validate.Validator
+}
+
+type userKey struct{}
+
+// user returns the claims of the request's token, or nil without one.
+func user(ctx context.Context) *model.Token {
+	tk, _ := ctx.Value(userKey{}).(*model.Token)
+	return tk
+}
+
+// requireUser applies the rule of the REST routes behind JwtVerify.
+func requireUser(ctx context.Context) (*model.Token, error) {
+	tk := user(ctx)
+	if tk == nil {
+		return nil, model.NewUnauthorizedError("missing_token", "Missing auth token")
+	}
+	return tk, nil
+}
+
+func requireAdmin(ctx context.Context) error {
+	tk, err := requireUser(ctx)
+	if err != nil {
+		return err
+	}
+	return auth.RequireAdmin(tk)
+}
+
+func parseID(id gql.ID) (int, error) {
+	n, err := strconv.Atoi(string(id))
+	if err != nil {
+		return 0, model.NewValidationError("invalid_parameter", "id must be an integer")
+	}
+	return n, nil
+}
+
+func formatID(id int) gql.ID {
+	return gql.ID(strconv.Itoa(id))
+}
+
+func (r *resolver) Product(ctx context.Context, args struct{ ID gql.ID }) (*productResolver, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	product, err := r.productUsecase.GetProduct(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &productResolver{product: *product}, nil
+}
+
+type productFilterInput struct {
+	BrandID *gql.ID
+	Name    *string
+	InStock *bool
+}
+
+// pageRequest validates paging like the REST query string.
+type pageRequest struct {
+	Limit  int `json:"limit" validate:"gte=0,lte=500"`
+	Offset int `json:"offset" validate:"gte=0"`
+}
+
+func (r *resolver) Products(ctx context.Context, args struct {
+	Filter *productFilterInput
+	Limit  int32
+	Offset int32
+}) (*productPageResolver, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	page := pageRequest{Limit: int(args.Limit), Offset: int(args.Offset)}
+	if err := r.validator.Validate(page); err != nil {
+		return nil, err
+	}
+	if page.Limit == 0 {
+		page.Limit = constant.DefaultPageLimit
+	}
+
+	filter := model.ProductFilter{Limit: page.Limit, Offset: page.Offset}
+	if f := args.Filter; f != nil {
+		if f.BrandID != nil {
+			id, err := parseID(*f.BrandID)
+			if err != nil {
+				return nil, err
+			}
+			filter.BrandID = id
+		}
+		if f.Name != nil {
+			filter.Name = *f.Name
+		}
+		if f.InStock != nil {
+			filter.InStock = *f.InStock
+		}
+	}
+
+	products, err := r.productUsecase.ListProducts(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &productPageResolver{items: productResolvers(ctx, products), limit: filter.Limit, offset: filter.Offset}, nil
+}
+
+func (r *resolver) Brand(ctx context.Context, args struct{ ID gql.ID }) (*brandResolver, error) {
+	if _, err := requireUser(ctx); err != nil {
+		return nil, err
+	}
+
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	brand, err := r.brandUsecase.GetBrand(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return brandResolvers(ctx, []model.Brand{*brand})[0], nil
+}
+
+func (r *resolver) Brands(ctx context.Context) ([]*brandResolver, error) {
+	if _, err := requireUser(ctx); err != nil {
+		return nil, err
+	}
+
+	brands, err := r.brandUsecase.GetBrands(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return brandResolvers(ctx, brands), nil
+}
+
+func (r *resolver) Me(ctx context.Context) *userResolver {
+	tk := user(ctx)
+	if tk == nil {
+		return nil
+	}
+	return &userResolver{token: tk}
+}
+
+// Login and Register are charged to the auth rate limit group, like their
+// REST routes, on top of the api request /graphql counts as.
+func (r *resolver) Login(ctx context.Context, args struct{ Email, Password string }) (string, error) {
+	if err := auth.Charge(ctx, constant.RateLimitGroupAuth); err != nil {
+		return "", err
+	}
+
+	credentials := model.Credentials{Email: args.Email, Password: args.Password}
+	if err := r.validator.Validate(credentials); err != nil {
+		return "", err
+	}
+
+	user, err := r.userUsecase.Login(ctx, model.User{Email: credentials.Email, Password: credentials.Password})
+	if err != nil {
+		return "", err
+	}
+	return user.Token, nil
+}
+
+type registerInput struct {
+	Name     string
+	Email    string
+	Password string
+	Gender   *string
+}
+
+func (r *resolver) Register(ctx context.Context, args struct{ Input registerInput }) (bool, error) {
+	if err := auth.Charge(ctx, constant.RateLimitGroupAuth); err != nil {
+		return false, err
+	}
+
+	user := model.User{
+		Name:     args.Input.Name,
+		Email:    args.Input.Email,
+		Password: args.Input.Password,
+	}
+	if args.Input.Gender != nil {
+		user.Gender = *args.Input.Gender
+	}
+
+	if err := r.validator.Validate(user); err != nil {
+		return false, err
+	}
+
+	if err := r.userUsecase.CreateUser(ctx, user); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+type productInput struct {
+	Name    string
+	Price   int32
+	Stock   int32
+	BrandID gql.ID
+}
+
+func (r *resolver) CreateProduct(ctx context.Context, args struct{ Input productInput }) (*productResolver, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	brandID, err := parseID(args.Input.BrandID)
+	if err != nil {
+		return nil, err
+	}
+
+	product := model.Product{
+		Name:    args.Input.Name,
+		Price:   int(args.Input.Price),
+		Stock:   int(args.Input.Stock),
+		BrandID: brandID,
+	}
+	if err := r.validator.Validate(product); err != nil {
+		return nil, err
+	}
+
+	res, err := r.productUsecase.SendProduct(ctx, product)
+	if err != nil {
+		return nil, err
+	}
+
+	return &productResolver{product: *res}, nil
+}
+
+type productPatchInput struct {
+	Name    *string
+	Price   *int32
+	Stock   *int32
+	BrandID *gql.ID
+}
+
+// requireVersion rejects writes that do not name the version they change, as
+// REST v2 does with 428, so a client cannot overwrite a change it never saw.
+func requireVersion(version int32) error {
+	if version <= 0 {
+		return model.NewPreconditionFailedError("precondition_required", "version of the product is required")
+	}
+	return nil
+}
+
+func (r *resolver) UpdateProduct(ctx context.Context, args struct {
+	ID      gql.ID
+	Version int32
+	Input   productPatchInput
+}) (*productResolver, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireVersion(args.Version); err != nil {
+		return nil, err
+	}
+
+	patch := model.ProductPatch{Name: args.Input.Name}
+	if args.Input.Price != nil {
+		price := int(*args.Input.Price)
+		patch.Price = &price
+	}
+	if args.Input.Stock != nil {
+		stock := int(*args.Input.Stock)
+		patch.Stock = &stock
+	}
+	if args.Input.BrandID != nil {
+		brandID, err := parseID(*args.Input.BrandID)
+		if err != nil {
+			return nil, err
+		}
+		patch.BrandID = &brandID
+	}
+
+	if err := r.validator.Validate(patch); err != nil {
+		return nil, err
+	}
+	patch.Version = int(args.Version)
+
+	res, err := r.productUsecase.PatchProduct(ctx, patch, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &productResolver{product: *res}, nil
+}
+
+func (r *resolver) DeleteProduct(ctx context.Context, args struct {
+	ID      gql.ID
+	Version int32
+}) (bool, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return false, err
+	}
+
+	id, err := parseID(args.ID)
+	if err != nil {
+		return false, err
+	}
+	if err := requireVersion(args.Version); err != nil {
+		return false, err
+	}
+
+	if err := r.productUsecase.DeleteProduct(ctx, id, int(args.Version)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+type productPageResolver struct {
+	items  []*productResolver
+	limit  int
+	offset int
+}
+
+func (p *productPageResolver) Items() []*productResolver {
+	return p.items
+}
+
+func (p *productPageResolver) Limit() int32 {
+	return int32(p.limit)
+}
+
+func (p *productPageResolver) Offset() int32 {
+	return int32(p.offset)
+}
+
+type productResolver struct {
+	product model.Product
+}
+
+// productResolvers wraps products and queues their brands, so resolving
+// brand on every product reads the brands once.
+func productResolvers(ctx context.Context, products []model.Product) []*productResolver {
+	brandIDs := make([]int, 0, len(products))
+	res := make([]*productResolver, 0, len(products))
+	for _, p := range products {
+		brandIDs = append(brandIDs, p.BrandID)
+		res = append(res, &productResolver{product: p})
+	}
+
+	loadersFrom(ctx).brands.prime(brandIDs...)
+	return res
+}
+
+func (p *productResolver) ID() gql.ID {
+	return formatID(p.product.ID)
+}
+
+func (p *productResolver) Name() string {
+	return p.product.Name
+}
+
+func (p *productResolver) Price() int32 {
+	return int32(p.product.Price)
+}
+
+func (p *productResolver) Stock() int32 {
+	return int32(p.product.Stock)
+}
+
+func (p *productResolver) Version() int32 {
+	return int32(p.product.Version)
+}
+
+func (p *productResolver) Brand(ctx context.Context) (*brandResolver, error) {
+	brand, err := loadersFrom(ctx).brand(ctx, p.product.BrandID)
+	if err != nil || brand == nil {
+		return nil, err
+	}
+	return &brandResolver{brand: *brand}, nil
+}
+
+type brandResolver struct {
+	brand model.Brand
+}
+
+// brandResolvers wraps brands, remembers them for Product.brand and queues
+// their products, so resolving products on every brand is one query.
+func brandResolvers(ctx context.Context, brands []model.Brand) []*brandResolver {
+	l := loadersFrom(ctx)
+
+	ids := make([]int, 0, len(brands))
+	res := make([]*brandResolver, 0, len(brands))
+	for _, b := range brands {
+		l.brands.set(b.ID, b)
+		ids = append(ids, b.ID)
+		res = append(res, &brandResolver{brand: b})
+	}
+
+	l.brandProducts.prime(ids...)
+	return res
+}
+
+func (b *brandResolver) ID() gql.ID {
+	return formatID(b.brand.ID)
+}
+
+func (b *brandResolver) Name() string {
+	return b.brand.Name
+}
+
+func (b *brandResolver) Products(ctx context.Context) ([]*productResolver, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	products, err := loadersFrom(ctx).productsOf(ctx, b.brand.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return productResolvers(ctx, products), nil
+}
+
+type userResolver struct {
+	token *model.Token
+}
+
+func (u *userResolver) ID() gql.ID {
+	return formatID(u.token.UserID)
+}
+
+func (u *userResolver) Name() string {
+	return u.token.Name
+}
+
+func (u *userResolver) Email() string {
+	return u.token.Email
+}
+
+func (u *userResolver) Role() int32 {
+	return int32(u.token.Role)
+}
@@ -0,0 +1,239 @@
+package graphql_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"crud-product/constant"
+	"crud-product/delivery/graphql"
+	"crud-product/delivery/rest"
+	"crud-product/delivery/validate"
+	"crud-product/model"
+	"crud-product/repository"
+	"crud-product/usecase"
+	"github.com/labstack/echo/v4"
+)
+
+// countingBrands counts the reads that reach the brand repository.
+type countingBrands struct {
+	repository.BrandRepository
+
+	mu    sync.Mutex
+	fetch int
+	find  int
+}
+
+func (b *countingBrands) Fetch(ctx context.Context) ([]model.Brand, error) {
+	b.mu.Lock()
+	b.fetch++
+	b.mu.Unlock()
+	return b.BrandRepository.Fetch(ctx)
+}
+
+func (b *countingBrands) Find(ctx context.Context, brandID int) (*model.Brand, error) {
+	b.mu.Lock()
+	b.find++
+	b.mu.Unlock()
+	return b.BrandRepository.Find(ctx, brandID)
+}
+
+type testServer struct {
+	echo   *echo.Echo
+	brands *countingBrands
+	token  string
+}
+
+// newTestServer serves /graphql over memory repositories holding three
+// brands, and returns it with an admin token.
+func newTestServer(t *testing.T, rateLimit *model.RateLimitConfig) *testServer {
+	t.Helper()
+
+	brands := &countingBrands{BrandRepository: repository.NewMemoryBrandRepository(
+		model.Brand{ID: 1, Name: "Eiger"},
+		model.Brand{ID: 2, Name: "Erigo"},
+		model.Brand{ID: 3, Name: "Nike"},
+	)}
+	products := repository.NewMemoryProductRepository(brands.BrandRepository)
+	users := repository.NewMemoryUserRepository()
+
+	e := echo.New()
+	e.HTTPErrorHandler = rest.ErrorHandler
+	e.Validator = validate.New()
+	e.Binder = &rest.Binder{}
+	if rateLimit != nil {
+		e.Use(rest.RateLimit(repository.NewMemoryRateLimit(), *rateLimit))
+	}
+
+	graphql.NewHandler(e,
+		usecase.NewProduct(products, repository.NewMemoryTransactor(products)),
+		usecase.NewBrand(brands, products),
+		usecase.NewUser(users))
+
+	ctx := context.Background()
+	admin := model.User{Name: "Admin", Email: "admin@example.com", Password: "secret123", Role: model.RoleAdmin}
+	if err := users.Store(ctx, admin); err != nil {
+		t.Fatalf("store admin: %v", err)
+	}
+	logged, err := users.FindOne(ctx, admin.Email, admin.Password)
+	if err != nil {
+		t.Fatalf("log in admin: %v", err)
+	}
+
+	return &testServer{echo: e, brands: brands, token: logged.Token}
+}
+
+type gqlResponse struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Path       []interface{}          `json:"path"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+func (s *testServer) query(t *testing.T, token, query string) (*httptest.ResponseRecorder, gqlResponse) {
+	t.Helper()
+
+	body, _ := json.Marshal(map[string]string{"query": query})
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if token != "" {
+		req.Header.Set("x-access-token", token)
+	}
+
+	rec := httptest.NewRecorder()
+	s.echo.ServeHTTP(rec, req)
+
+	var res gqlResponse
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatalf("decode %s: %v", rec.Body.String(), err)
+		}
+	}
+	return rec, res
+}
+
+func TestProductsLoadBrandsInOneBatch(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	const n = 9
+	for i := 0; i < n; i++ {
+		q := `mutation { createProduct(input: {name: "Kaos", price: 1000, stock: 1, brandId: "` + strconv.Itoa(i%3+1) + `"}) { id } }`
+		if _, res := s.query(t, s.token, q); len(res.Errors) > 0 {
+			t.Fatalf("createProduct: %+v", res.Errors)
+		}
+	}
+
+	s.brands.fetch, s.brands.find = 0, 0
+
+	_, res := s.query(t, s.token, `{ products { items { id brand { id name } } } }`)
+	if len(res.Errors) > 0 {
+		t.Fatalf("products: %+v", res.Errors)
+	}
+
+	var page struct {
+		Items []struct {
+			ID    string
+			Brand struct{ ID, Name string }
+		}
+	}
+	if err := json.Unmarshal(res.Data["products"], &page); err != nil {
+		t.Fatalf("decode products: %v", err)
+	}
+	if len(page.Items) != n {
+		t.Fatalf("products returned %d items, want %d", len(page.Items), n)
+	}
+	for _, item := range page.Items {
+		if item.Brand.Name == "" {
+			t.Fatalf("product %s has no brand: %+v", item.ID, item)
+		}
+	}
+
+	if s.brands.fetch != 1 || s.brands.find != 0 {
+		t.Fatalf("brand repository got %d Fetch and %d Find calls, want one Fetch", s.brands.fetch, s.brands.find)
+	}
+}
+
+func TestLoginAndRegisterUseAuthRateLimit(t *testing.T) {
+	s := newTestServer(t, &model.RateLimitConfig{
+		Driver: constant.RateLimitMemory,
+		Groups: map[string]model.RateLimit{
+			constant.RateLimitGroupAuth: {Rate: 2, Burst: 2, Period: model.Duration(time.Hour)},
+			constant.RateLimitGroupAPI:  {Rate: 100, Burst: 100, Period: model.Duration(time.Hour)},
+		},
+	})
+
+	// Brands are not auth operations and leave the auth bucket alone.
+	for i := 0; i < 3; i++ {
+		if _, res := s.query(t, s.token, `{ brands { id } }`); len(res.Errors) > 0 {
+			t.Fatalf("brands: %+v", res.Errors)
+		}
+	}
+
+	// Aliases cannot dodge the limit: each mutation field is charged.
+	rec, res := s.query(t, "", `mutation {
+		a: login(email: "admin@example.com", password: "secret123")
+		b: register(input: {name: "Budi", email: "budi@example.com", password: "rahasia123"})
+		c: login(email: "admin@example.com", password: "secret123")
+	}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != "rate_limited" {
+		t.Fatalf("errors = %+v, want the third mutation rate limited", res.Errors)
+	}
+	if path := res.Errors[0].Path; len(path) != 1 || path[0] != "c" {
+		t.Fatalf("rate limited path = %v, want [c]", path)
+	}
+	if rec.Header().Get("Retry-After") == "" || rec.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("headers = %v, want the auth bucket reported with Retry-After", rec.Header())
+	}
+}
+
+func TestWritesRequireVersion(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	_, res := s.query(t, s.token, `mutation { createProduct(input: {name: "Kaos", price: 1000, stock: 1, brandId: "1"}) { id version } }`)
+	if len(res.Errors) > 0 {
+		t.Fatalf("createProduct: %+v", res.Errors)
+	}
+	var product struct {
+		ID      string
+		Version int
+	}
+	if err := json.Unmarshal(res.Data["createProduct"], &product); err != nil {
+		t.Fatalf("decode createProduct: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		code  string
+	}{
+		{"update without version", `mutation { updateProduct(id: "` + product.ID + `", input: {stock: 2}) { id } }`, "invalid_query"},
+		{"delete without version", `mutation { deleteProduct(id: "` + product.ID + `") }`, "invalid_query"},
+		{"update at version 0", `mutation { updateProduct(id: "` + product.ID + `", version: 0, input: {stock: 2}) { id } }`, "precondition_required"},
+		{"delete at version 0", `mutation { deleteProduct(id: "` + product.ID + `", version: 0) }`, "precondition_required"},
+		{"stale update", `mutation { updateProduct(id: "` + product.ID + `", version: 9, input: {stock: 2}) { id } }`, "version_mismatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, res := s.query(t, s.token, tt.query)
+			if len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != tt.code {
+				t.Fatalf("errors = %+v, want code %s", res.Errors, tt.code)
+			}
+		})
+	}
+
+	q := `mutation { updateProduct(id: "` + product.ID + `", version: ` + strconv.Itoa(product.Version) + `, input: {stock: 2}) { stock version } }`
+	if _, res := s.query(t, s.token, q); len(res.Errors) > 0 {
+		t.Fatalf("updateProduct at the current version: %+v", res.Errors)
+	}
+}
@@ -0,0 +1,94 @@
+package graphql
+
+// schema is the GraphQL schema served at /graphql. IDs are the numeric IDs of
+// the REST API, as strings.
+const schema = `
+schema {
+	query: Query
+	mutation: Mutation
+}
+
+type Query {
+	# A product by ID. Requires an admin token.
+	product(id: ID!): Product
+	# Active products ordered by ID. limit is at most 500. Requires an admin token.
+	products(filter: ProductFilter, limit: Int = 50, offset: Int = 0): ProductPage!
+	# A brand by ID. Requires a token.
+	brand(id: ID!): Brand
+	# Every brand. Requires a token.
+	brands: [Brand!]!
+	# The user the token belongs to, or null without a token.
+	me: User
+}
+
+type Mutation {
+	# Exchanges credentials for a token to send as x-access-token.
+	login(email: String!, password: String!): String!
+	register(input: RegisterInput!): Boolean!
+	# Requires an admin token.
+	createProduct(input: ProductInput!): Product!
+	# Changes the fields that are set. Fails with code version_mismatch if
+	# the product changed since version. Requires an admin token.
+	updateProduct(id: ID!, version: Int!, input: ProductPatchInput!): Product!
+	# Fails with code version_mismatch if the product changed since version.
+	# Requires an admin token.
+	deleteProduct(id: ID!, version: Int!): Boolean!
+}
+
+input ProductFilter {
+	brandId: ID
+	# Matches names containing it, ignoring case.
+	name: String
+	inStock: Boolean
+}
+
+input ProductInput {
+	name: String!
+	price: Int!
+	stock: Int!
+	brandId: ID!
+}
+
+input ProductPatchInput {
+	name: String
+	price: Int
+	stock: Int
+	brandId: ID
+}
+
+input RegisterInput {
+	name: String!
+	email: String!
+	password: String!
+	gender: String
+}
+
+type ProductPage {
+	items: [Product!]!
+	limit: Int!
+	offset: Int!
+}
+
+type Product {
+	id: ID!
+	name: String!
+	price: Int!
+	stock: Int!
+	version: Int!
+	brand: Brand
+}
+
+type Brand {
+	id: ID!
+	name: String!
+	# Every active product of the brand. Requires an admin token.
+	products: [Product!]!
+}
+
+type User {
+	id: ID!
+	name: String!
+	email: String!
+	role: Int!
+}
+`
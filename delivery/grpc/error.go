@@ -0,0 +1,82 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+
+	"crud-product/logger"
+	"crud-product/model"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorDomain is the ErrorInfo domain of the codes this service returns.
+const errorDomain = "crud-product"
+
+// toStatus converts an error from the usecases to a gRPC status. The REST
+// problem code, e.g. "product_not_found", goes in an ErrorInfo reason and
+// invalid fields in a BadRequest, so clients of either API can handle errors
+// alike. Anything unrecognised becomes an opaque INTERNAL.
+func toStatus(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	var domainErr *model.Error
+	if !errors.As(err, &domainErr) {
+		switch {
+		case errors.Is(err, context.Canceled):
+			return status.Error(codes.Canceled, err.Error())
+		case errors.Is(err, context.DeadlineExceeded):
+			return status.Error(codes.DeadlineExceeded, err.Error())
+		}
+
+		logger.FromContext(ctx).Error(err)
+		domainErr = &model.Error{Code: "internal_error", Message: "internal error"}
+	}
+
+	st := status.New(codeOf(domainErr.Kind), domainErr.Message)
+
+	info := &errdetails.ErrorInfo{Reason: domainErr.Code, Domain: errorDomain}
+	badRequest := &errdetails.BadRequest{}
+	for _, f := range domainErr.Fields {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       f.Field,
+			Description: f.Message,
+		})
+	}
+
+	withDetails, detailErr := st.WithDetails(info)
+	if len(badRequest.FieldViolations) > 0 {
+		withDetails, detailErr = st.WithDetails(info, badRequest)
+	}
+	if detailErr != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
+
+func codeOf(kind error) codes.Code {
+	switch kind {
+	case model.ErrNotFound:
+		return codes.NotFound
+	case model.ErrValidation, model.ErrUnprocessable:
+		return codes.InvalidArgument
+	case model.ErrConflict:
+		return codes.AlreadyExists
+	case model.ErrForbidden:
+		return codes.PermissionDenied
+	case model.ErrUnauthorized:
+		return codes.Unauthenticated
+	case model.ErrPreconditionFailed:
+		return codes.FailedPrecondition
+	case model.ErrTooManyRequests:
+		return codes.ResourceExhausted
+	default:
+		return codes.Internal
+	}
+}
@@ -0,0 +1,78 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"crud-product/model"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestToStatus(t *testing.T) {
+	existing := status.Error(codes.Aborted, "aborted")
+
+	tests := []struct {
+		name    string
+		err     error
+		code    codes.Code
+		message string
+		reason  string
+	}{
+		{"not found", model.NewNotFoundError("product_not_found", "product not found"), codes.NotFound, "product not found", "product_not_found"},
+		{"wrapped", fmt.Errorf("get: %w", model.NewNotFoundError("brand_not_found", "brand not found")), codes.NotFound, "brand not found", "brand_not_found"},
+		{"validation", model.NewValidationError("validation_failed", "request has invalid fields"), codes.InvalidArgument, "request has invalid fields", "validation_failed"},
+		{"unprocessable", model.NewUnprocessableError("unknown_brand", "unknown brand"), codes.InvalidArgument, "unknown brand", "unknown_brand"},
+		{"conflict", model.NewConflictError("sku_taken", "sku taken"), codes.AlreadyExists, "sku taken", "sku_taken"},
+		{"forbidden", model.NewForbiddenError("admin_required", "admins only"), codes.PermissionDenied, "admins only", "admin_required"},
+		{"unauthorized", model.NewUnauthorizedError("missing_token", "Missing auth token"), codes.Unauthenticated, "Missing auth token", "missing_token"},
+		{"precondition", model.NewPreconditionFailedError("version_mismatch", "stale"), codes.FailedPrecondition, "stale", "version_mismatch"},
+		{"too many requests", model.NewTooManyRequestsError("rate_limited", "slow down"), codes.ResourceExhausted, "slow down", "rate_limited"},
+		// Unrecognised errors do not leak their message.
+		{"internal", errors.New("dial tcp: connection refused"), codes.Internal, "internal error", "internal_error"},
+		{"canceled", fmt.Errorf("query: %w", context.Canceled), codes.Canceled, "query: context canceled", ""},
+		{"deadline", context.DeadlineExceeded, codes.DeadlineExceeded, "context deadline exceeded", ""},
+		{"status", existing, codes.Aborted, "aborted", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := status.Convert(toStatus(context.Background(), tt.err))
+			if st.Code() != tt.code || st.Message() != tt.message {
+				t.Fatalf("status = %s %q, want %s %q", st.Code(), st.Message(), tt.code, tt.message)
+			}
+
+			var reason string
+			for _, d := range st.Details() {
+				if info, ok := d.(*errdetails.ErrorInfo); ok {
+					reason = info.Reason
+				}
+			}
+			if reason != tt.reason {
+				t.Fatalf("ErrorInfo reason = %q, want %q", reason, tt.reason)
+			}
+		})
+	}
+
+	if toStatus(context.Background(), nil) != nil {
+		t.Fatal("toStatus(nil) != nil")
+	}
+}
+
+func TestToStatusFields(t *testing.T) {
+	err := model.NewValidationError("validation_failed", "request has invalid fields")
+	err.Fields = []model.FieldError{{Field: "name", Rule: "required", Message: "name is required"}}
+
+	var violations []*errdetails.BadRequest_FieldViolation
+	for _, d := range status.Convert(toStatus(context.Background(), err)).Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			violations = br.FieldViolations
+		}
+	}
+	if len(violations) != 1 || violations[0].Field != "name" || violations[0].Description != "name is required" {
+		t.Fatalf("field violations = %v, want name is required", violations)
+	}
+}
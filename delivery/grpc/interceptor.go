@@ -0,0 +1,315 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"crud-product/constant"
+	"crud-product/delivery/auth"
+	"crud-product/delivery/grpc/productpb"
+	"crud-product/logger"
+	"crud-product/metrics"
+	"crud-product/model"
+	"crud-product/repository"
+	"crud-product/tracing"
+	"github.com/labstack/gommon/random"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	metadataToken     = "x-access-token"
+	metadataAPIKey    = "x-api-key"
+	metadataRequestID = "x-request-id"
+)
+
+// guard checks a call before its handler runs and may add to its context.
+// Errors may be domain errors; observe converts them.
+type guard func(ctx context.Context, method string) (context.Context, error)
+
+func unaryGuard(g guard) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := g(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func streamGuard(g guard) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := g(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// serverStream replaces the context of a stream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func unaryObserve(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, finish := observe(ctx, info.FullMethod)
+	res, err := handler(ctx, req)
+	return res, finish(err)
+}
+
+func streamObserve(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, finish := observe(ss.Context(), info.FullMethod)
+	return finish(handler(srv, &serverStream{ServerStream: ss, ctx: ctx}))
+}
+
+// observe does for a call what the REST middleware does for a request: it
+// propagates or assigns x-request-id, continues the trace named by the
+// traceparent metadata, puts a logger carrying both into the context, and
+// scopes repository reads to the call. The returned finish converts the
+// handler's error to a status, then records the span status, an access log
+// line and the metrics.
+func observe(ctx context.Context, method string) (context.Context, func(error) error) {
+	start := time.Now()
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	requestID := firstValue(md, metadataRequestID)
+	if requestID == "" {
+		requestID = random.String(32)
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(metadataRequestID, requestID))
+
+	service, name := splitMethod(method)
+	ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+	ctx, span := tracing.StartServer(ctx, service+"/"+name,
+		semconv.RPCSystemKey.String("grpc"),
+		semconv.RPCServiceKey.String(service),
+		semconv.RPCMethodKey.String(name),
+	)
+
+	fields := log.Fields{"request_id": requestID, "method": method}
+	if sc := span.SpanContext(); sc.IsValid() {
+		fields["trace_id"] = sc.TraceID().String()
+	}
+	ctx = logger.WithFields(ctx, fields)
+	ctx = repository.WithSession(ctx)
+
+	return ctx, func(err error) error {
+		defer span.End()
+
+		err = toStatus(ctx, err)
+		code := status.Code(err)
+
+		span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(code)))
+		if serverFault(code) {
+			span.SetStatus(otelcodes.Error, code.String())
+		}
+
+		metrics.GRPCRequests.WithLabelValues(method, code.String()).Inc()
+		metrics.GRPCDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+
+		entry := logger.FromContext(ctx).WithFields(log.Fields{
+			"code":       code.String(),
+			"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"remote_ip":  peerIP(ctx),
+		})
+		switch {
+		case serverFault(code):
+			entry.Error("rpc")
+		case code != codes.OK:
+			entry.Warn("rpc")
+		default:
+			entry.Info("rpc")
+		}
+		return err
+	}
+}
+
+// serverFault reports whether code is the server's fault, like a 5xx status.
+func serverFault(code codes.Code) bool {
+	switch code {
+	case codes.Unknown, codes.Internal, codes.Unavailable, codes.DataLoss, codes.Unimplemented:
+		return true
+	default:
+		return false
+	}
+}
+
+// infrastructure lists the services that load balancers and tools call,
+// which are neither authenticated nor rate limited.
+var infrastructure = map[string]bool{
+	healthpb.Health_ServiceDesc.ServiceName:               true,
+	reflectionpb.ServerReflection_ServiceDesc.ServiceName: true,
+}
+
+type userKey struct{}
+
+// authenticate requires a valid token in the x-access-token metadata, like
+// the REST JwtVerify middleware, on every method but those of UserService
+// and the infrastructure services.
+func authenticate(ctx context.Context, method string) (context.Context, error) {
+	if service, _ := splitMethod(method); service == productpb.UserService_ServiceDesc.ServiceName || infrastructure[service] {
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	header := strings.TrimSpace(firstValue(md, metadataToken))
+	if header == "" {
+		return ctx, model.NewUnauthorizedError("missing_token", "Missing auth token")
+	}
+
+	_, span := tracing.Start(ctx, "JwtVerify")
+	tk, err := auth.ParseToken(header)
+	span.End()
+
+	if err != nil {
+		return ctx, model.NewUnauthorizedError("invalid_token", err.Error())
+	}
+
+	ctx = context.WithValue(ctx, userKey{}, tk)
+	return logger.WithFields(ctx, log.Fields{"user_id": tk.UserID}), nil
+}
+
+// requireAdmin rejects calls made with the token of a user who is not an
+// administrator.
+func requireAdmin(ctx context.Context) error {
+	tk, ok := ctx.Value(userKey{}).(*model.Token)
+	if !ok {
+		return model.NewUnauthorizedError("missing_token", "Missing auth token")
+	}
+	return auth.RequireAdmin(tk)
+}
+
+// rateLimit applies the same limits as the REST RateLimit middleware, with
+// UserService in the auth group and ProductService in the api group. Clients
+// are told apart by their x-api-key metadata, then by the user of a valid
+// token, then by IP address. The RateLimit-* values, and retry-after when the
+// call is rejected, are sent as response metadata. Infrastructure services
+// are not limited, so health probes never use up a client's budget.
+func rateLimit(store repository.RateLimitStore, cfg model.RateLimitConfig) guard {
+	limiter := auth.NewLimiter(store, cfg)
+
+	return func(ctx context.Context, method string) (context.Context, error) {
+		service, _ := splitMethod(method)
+		if infrastructure[service] {
+			return ctx, nil
+		}
+
+		ctx, client, apiKey, err := clientOf(ctx, cfg.APIKeys)
+		if err != nil {
+			return ctx, err
+		}
+
+		group := constant.RateLimitGroupAPI
+		if service == productpb.UserService_ServiceDesc.ServiceName {
+			group = constant.RateLimitGroupAuth
+		}
+
+		st, err := limiter.Allow(ctx, group, client, apiKey)
+		if st != nil {
+			md := metadata.Pairs(
+				"ratelimit-limit", strconv.Itoa(st.Limit),
+				"ratelimit-remaining", strconv.Itoa(st.Remaining),
+				"ratelimit-reset", strconv.Itoa(seconds(st.Reset)),
+			)
+			if err != nil {
+				md.Set("retry-after", strconv.Itoa(seconds(st.RetryAfter)))
+			}
+			grpc.SetHeader(ctx, md)
+		}
+		return ctx, err
+	}
+}
+
+func clientOf(ctx context.Context, apiKeys map[string]model.APIKeyConfig) (context.Context, string, *model.APIKeyConfig, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if key := strings.TrimSpace(firstValue(md, metadataAPIKey)); key != "" {
+		apiKey, err := auth.LookupAPIKey(key, apiKeys)
+		if err != nil {
+			return ctx, "", nil, err
+		}
+
+		ctx = logger.WithFields(ctx, log.Fields{"api_key": apiKey.Name})
+		return ctx, "key:" + apiKey.Name, apiKey, nil
+	}
+
+	if header := strings.TrimSpace(firstValue(md, metadataToken)); header != "" {
+		if tk, err := auth.ParseToken(header); err == nil {
+			return ctx, fmt.Sprintf("user:%d", tk.UserID), nil, nil
+		}
+	}
+
+	return ctx, "ip:" + peerIP(ctx), nil, nil
+}
+
+// seconds rounds d up to whole seconds.
+func seconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+		return host
+	}
+	return p.Addr.String()
+}
+
+// splitMethod splits "/crudproduct.v1.ProductService/GetProduct" into its
+// service and method names.
+func splitMethod(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", fullMethod
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// metadataCarrier lets the OpenTelemetry propagator read traceparent and
+// tracestate from incoming metadata.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	return firstValue(metadata.MD(c), key)
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,273 @@
+package grpc
+
+import (
+	"context"
+
+	"crud-product/constant"
+	"crud-product/delivery/grpc/productpb"
+	"crud-product/delivery/validate"
+	"crud-product/model"
+	"crud-product/usecase"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+type productServer struct {
+	productpb.UnimplementedProductServiceServer
+
+	productUsecase usecase.ProductUsecase
+	brandUsecase   usecase.BrandUsecase
+	validator      *validate.Validator
+}
+
+// pageRequest validates the paging fields of list requests like the REST
+// query string.
+type pageRequest struct {
+	BrandID int `json:"brand_id" validate:"gte=0"`
+	Limit   int `json:"limit" validate:"gte=0,lte=500"`
+	Offset  int `json:"offset" validate:"gte=0"`
+}
+
+// requireVersion rejects writes that do not name the version they change, as
+// REST v2 does with 428, so a client cannot overwrite a change it never saw.
+func requireVersion(version int64) error {
+	if version <= 0 {
+		return model.NewPreconditionFailedError("precondition_required", "version of the product is required")
+	}
+	return nil
+}
+
+func (s *productServer) filter(brandID int64, limit, offset int32) (model.ProductFilter, error) {
+	page := pageRequest{BrandID: int(brandID), Limit: int(limit), Offset: int(offset)}
+	if err := s.validator.Validate(page); err != nil {
+		return model.ProductFilter{}, err
+	}
+
+	if page.Limit == 0 {
+		page.Limit = constant.DefaultPageLimit
+	}
+	return model.ProductFilter{BrandID: page.BrandID, Limit: page.Limit, Offset: page.Offset}, nil
+}
+
+func (s *productServer) GetProduct(ctx context.Context, req *productpb.GetProductRequest) (*productpb.Product, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	res, err := s.productUsecase.GetProduct(ctx, int(req.Id))
+	if err != nil {
+		return nil, err
+	}
+
+	return toProduct(*res), nil
+}
+
+func (s *productServer) ListProducts(ctx context.Context, req *productpb.ListProductsRequest) (*productpb.ListProductsResponse, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	filter, err := s.filter(req.BrandId, req.Limit, req.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.productUsecase.ListProducts(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return toProductPage(res, filter), nil
+}
+
+func (s *productServer) CreateProduct(ctx context.Context, req *productpb.CreateProductRequest) (*productpb.Product, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	product := fromProductInput(req.Product)
+	if err := s.validator.Validate(product); err != nil {
+		return nil, err
+	}
+
+	res, err := s.productUsecase.SendProduct(ctx, product)
+	if err != nil {
+		return nil, err
+	}
+
+	return toProduct(*res), nil
+}
+
+func (s *productServer) UpdateProduct(ctx context.Context, req *productpb.UpdateProductRequest) (*productpb.Product, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := requireVersion(req.Version); err != nil {
+		return nil, err
+	}
+
+	product := fromProductInput(req.Product)
+	if err := s.validator.Validate(product); err != nil {
+		return nil, err
+	}
+	product.Version = int(req.Version)
+
+	res, err := s.productUsecase.UpdateProduct(ctx, product, int(req.Id))
+	if err != nil {
+		return nil, err
+	}
+
+	return toProduct(*res), nil
+}
+
+func (s *productServer) PatchProduct(ctx context.Context, req *productpb.PatchProductRequest) (*productpb.Product, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := requireVersion(req.Version); err != nil {
+		return nil, err
+	}
+
+	patch := fromProductPatch(req.Patch)
+	if err := s.validator.Validate(patch); err != nil {
+		return nil, err
+	}
+	patch.Version = int(req.Version)
+
+	res, err := s.productUsecase.PatchProduct(ctx, patch, int(req.Id))
+	if err != nil {
+		return nil, err
+	}
+
+	return toProduct(*res), nil
+}
+
+func (s *productServer) DeleteProduct(ctx context.Context, req *productpb.DeleteProductRequest) (*emptypb.Empty, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := requireVersion(req.Version); err != nil {
+		return nil, err
+	}
+
+	if err := s.productUsecase.DeleteProduct(ctx, int(req.Id), int(req.Version)); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *productServer) ListBrands(ctx context.Context, _ *emptypb.Empty) (*productpb.ListBrandsResponse, error) {
+	brands, err := s.brandUsecase.GetBrands(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &productpb.ListBrandsResponse{Data: make([]*productpb.Brand, 0, len(brands))}
+	for _, b := range brands {
+		res.Data = append(res.Data, &productpb.Brand{Id: int64(b.ID), Name: b.Name})
+	}
+	return res, nil
+}
+
+func (s *productServer) ListBrandProducts(ctx context.Context, req *productpb.ListBrandProductsRequest) (*productpb.ListProductsResponse, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	filter, err := s.filter(0, req.Limit, req.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.brandUsecase.GetBrandProducts(ctx, int(req.BrandId), filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return toProductPage(res, filter), nil
+}
+
+func (s *productServer) StreamBrandProducts(req *productpb.StreamBrandProductsRequest, stream productpb.ProductService_StreamBrandProductsServer) error {
+	ctx := stream.Context()
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+
+	filter := model.ProductFilter{Limit: constant.MaxPageLimit}
+	for {
+		page, err := s.brandUsecase.GetBrandProducts(ctx, int(req.BrandId), filter)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range page {
+			if err := stream.Send(toProduct(p)); err != nil {
+				return err
+			}
+		}
+
+		if len(page) < filter.Limit {
+			return nil
+		}
+		filter.Offset += len(page)
+	}
+}
+
+func toProduct(p model.Product) *productpb.Product {
+	return &productpb.Product{
+		Id:      int64(p.ID),
+		Name:    p.Name,
+		Price:   int64(p.Price),
+		Stock:   int64(p.Stock),
+		BrandId: int64(p.BrandID),
+		Version: int64(p.Version),
+	}
+}
+
+func toProductPage(products []model.Product, filter model.ProductFilter) *productpb.ListProductsResponse {
+	res := &productpb.ListProductsResponse{
+		Data:   make([]*productpb.Product, 0, len(products)),
+		Limit:  int32(filter.Limit),
+		Offset: int32(filter.Offset),
+	}
+	for _, p := range products {
+		res.Data = append(res.Data, toProduct(p))
+	}
+	return res
+}
+
+func fromProductInput(in *productpb.ProductInput) model.Product {
+	return model.Product{
+		Name:    in.GetName(),
+		Price:   int(in.GetPrice()),
+		Stock:   int(in.GetStock()),
+		BrandID: int(in.GetBrandId()),
+	}
+}
+
+func fromProductPatch(in *productpb.ProductPatch) model.ProductPatch {
+	patch := model.ProductPatch{}
+	if in == nil {
+		return patch
+	}
+
+	if in.Name != nil {
+		patch.Name = in.Name
+	}
+	if in.Price != nil {
+		price := int(*in.Price)
+		patch.Price = &price
+	}
+	if in.Stock != nil {
+		stock := int(*in.Stock)
+		patch.Stock = &stock
+	}
+	if in.BrandId != nil {
+		brandID := int(*in.BrandId)
+		patch.BrandID = &brandID
+	}
+	return patch
+}
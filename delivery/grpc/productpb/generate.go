@@ -0,0 +1,8 @@
+package productpb
+
+// The code is generated with goprotoc, a protoc written in Go, so that
+// regenerating needs nothing but the Go toolchain. The plugins are installed
+// into GOBIN, which must be on PATH.
+//go:generate go install google.golang.org/protobuf/cmd/protoc-gen-go@v1.28.1
+//go:generate go install google.golang.org/grpc/cmd/protoc-gen-go-grpc@v1.2.0
+//go:generate go run github.com/jhump/goprotoc/cmd/goprotoc@v0.5.0 -I ../../.. -I ../../../third_party/googleapis --go_out=paths=source_relative:../../.. --go-grpc_out=paths=source_relative:../../.. delivery/grpc/productpb/product.proto
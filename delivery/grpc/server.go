@@ -0,0 +1,53 @@
+// Package grpc serves the product and user usecases over gRPC, next to the
+// REST API. The services are defined in productpb/product.proto.
+package grpc
+
+import (
+	"crud-product/delivery/grpc/productpb"
+	"crud-product/delivery/validate"
+	"crud-product/model"
+	"crud-product/repository"
+	"crud-product/usecase"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+// NewServer returns a gRPC server with ProductService, UserService, the
+// standard health service and, when cfg.Reflection is set, server
+// reflection. Calls are authenticated like REST requests; with a nil store
+// they are not rate limited.
+func NewServer(productUsecase usecase.ProductUsecase, brandUsecase usecase.BrandUsecase, userUsecase usecase.UserUsecase, store repository.RateLimitStore, rateLimitCfg model.RateLimitConfig, cfg model.GRPCConfig) *grpc.Server {
+	unary := []grpc.UnaryServerInterceptor{unaryObserve}
+	stream := []grpc.StreamServerInterceptor{streamObserve}
+	if store != nil {
+		unary = append(unary, unaryGuard(rateLimit(store, rateLimitCfg)))
+		stream = append(stream, streamGuard(rateLimit(store, rateLimitCfg)))
+	}
+	unary = append(unary, unaryGuard(authenticate))
+	stream = append(stream, streamGuard(authenticate))
+
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	)
+
+	validator := validate.New()
+	productpb.RegisterProductServiceServer(server, &productServer{
+		productUsecase: productUsecase,
+		brandUsecase:   brandUsecase,
+		validator:      validator,
+	})
+	productpb.RegisterUserServiceServer(server, &userServer{
+		userUsecase: userUsecase,
+		validator:   validator,
+	})
+
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	if cfg.Reflection {
+		reflection.Register(server)
+	}
+
+	return server
+}
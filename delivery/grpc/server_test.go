@@ -0,0 +1,387 @@
+package grpc_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	grpcdelivery "crud-product/delivery/grpc"
+	"crud-product/delivery/grpc/productpb"
+	"crud-product/model"
+	"crud-product/repository"
+	"crud-product/usecase"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+type testServer struct {
+	conn     *grpc.ClientConn
+	products productpb.ProductServiceClient
+	users    productpb.UserServiceClient
+	repo     repository.ProductRepository
+	pages    *pageCounter
+	admin    context.Context
+	user     context.Context
+}
+
+// pageCounter records the offsets of the brand product pages read.
+type pageCounter struct {
+	usecase.BrandUsecase
+	offsets []int
+}
+
+func (p *pageCounter) GetBrandProducts(ctx context.Context, brandID int, filter model.ProductFilter) ([]model.Product, error) {
+	p.offsets = append(p.offsets, filter.Offset)
+	return p.BrandUsecase.GetBrandProducts(ctx, brandID, filter)
+}
+
+// newTestServer serves gRPC over an in-memory listener, backed by memory
+// repositories holding two brands, and signs in an admin and a regular user
+// through UserService. With a nil store calls are not rate limited.
+func newTestServer(t *testing.T, store repository.RateLimitStore, rateLimitCfg model.RateLimitConfig, cfg model.GRPCConfig) *testServer {
+	t.Helper()
+
+	brands := repository.NewMemoryBrandRepository(
+		model.Brand{ID: 1, Name: "Eiger"},
+		model.Brand{ID: 2, Name: "Erigo"},
+	)
+	products := repository.NewMemoryProductRepository(brands)
+	users := repository.NewMemoryUserRepository()
+	pages := &pageCounter{BrandUsecase: usecase.NewBrand(brands, products)}
+
+	server := grpcdelivery.NewServer(
+		usecase.NewProduct(products, repository.NewMemoryTransactor(products)),
+		pages,
+		usecase.NewUser(users),
+		store, rateLimitCfg, cfg)
+
+	lis := bufconn.Listen(1 << 20)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	s := &testServer{
+		conn:     conn,
+		products: productpb.NewProductServiceClient(conn),
+		users:    productpb.NewUserServiceClient(conn),
+		repo:     products,
+		pages:    pages,
+	}
+
+	s.register(t, "admin@example.com")
+	if err := users.SetRole(context.Background(), "admin@example.com", model.RoleAdmin); err != nil {
+		t.Fatalf("promote admin: %v", err)
+	}
+	s.admin = withToken(s.login(t, "admin@example.com"))
+
+	s.register(t, "budi@example.com")
+	s.user = withToken(s.login(t, "budi@example.com"))
+
+	return s
+}
+
+func (s *testServer) register(t *testing.T, email string) {
+	t.Helper()
+
+	_, err := s.users.CreateUser(context.Background(), &productpb.CreateUserRequest{
+		Name: "Budi", Email: email, Gender: "male", Password: "rahasia123",
+	})
+	if err != nil {
+		t.Fatalf("CreateUser(%s): %v", email, err)
+	}
+}
+
+func (s *testServer) login(t *testing.T, email string) string {
+	t.Helper()
+
+	res, err := s.users.Login(context.Background(), &productpb.LoginRequest{Email: email, Password: "rahasia123"})
+	if err != nil {
+		t.Fatalf("Login(%s): %v", email, err)
+	}
+	return res.Token
+}
+
+func (s *testServer) createProduct(t *testing.T, name string, brandID int64) *productpb.Product {
+	t.Helper()
+
+	res, err := s.products.CreateProduct(s.admin, &productpb.CreateProductRequest{
+		Product: &productpb.ProductInput{Name: name, Price: 150000, Stock: 5, BrandId: brandID},
+	})
+	if err != nil {
+		t.Fatalf("CreateProduct(%s): %v", name, err)
+	}
+	return res
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "x-access-token", token)
+}
+
+// expectStatus checks the code of err and the reason of its ErrorInfo, and
+// returns the status.
+func expectStatus(t *testing.T, err error, code codes.Code, reason string) *status.Status {
+	t.Helper()
+
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != code {
+		t.Fatalf("error = %v, want %s", err, code)
+	}
+
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			if info.Reason != reason || info.Domain != "crud-product" {
+				t.Fatalf("ErrorInfo = %s/%s, want crud-product/%s", info.Domain, info.Reason, reason)
+			}
+			return st
+		}
+	}
+	t.Fatalf("%s error %q has no ErrorInfo, want reason %s", code, st.Message(), reason)
+	return nil
+}
+
+func TestAuthentication(t *testing.T) {
+	s := newTestServer(t, nil, model.RateLimitConfig{}, model.GRPCConfig{})
+
+	_, err := s.products.ListBrands(context.Background(), &emptypb.Empty{})
+	expectStatus(t, err, codes.Unauthenticated, "missing_token")
+
+	_, err = s.products.ListBrands(withToken("not-a-token"), &emptypb.Empty{})
+	expectStatus(t, err, codes.Unauthenticated, "invalid_token")
+
+	res, err := s.products.ListBrands(s.user, &emptypb.Empty{})
+	if err != nil || len(res.Data) != 2 {
+		t.Fatalf("ListBrands = %v, %v, want both brands", res, err)
+	}
+
+	// Load balancers probe health without a token.
+	health, err := healthpb.NewHealthClient(s.conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil || health.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("health Check = %v, %v, want SERVING", health, err)
+	}
+
+	// Reflection is off unless configured.
+	stream, err := reflectionpb.NewServerReflectionClient(s.conn).ServerReflectionInfo(context.Background())
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unimplemented {
+		t.Fatalf("reflection without grpc.reflection = %v, want Unimplemented", err)
+	}
+}
+
+func TestReflection(t *testing.T) {
+	s := newTestServer(t, nil, model.RateLimitConfig{}, model.GRPCConfig{Reflection: true})
+
+	stream, err := reflectionpb.NewServerReflectionClient(s.conn).ServerReflectionInfo(context.Background())
+	if err != nil {
+		t.Fatalf("ServerReflectionInfo: %v", err)
+	}
+	err = stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	res, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("list services without a token = %v, want the services", err)
+	}
+
+	services := map[string]bool{}
+	for _, svc := range res.GetListServicesResponse().GetService() {
+		services[svc.Name] = true
+	}
+	if !services[productpb.ProductService_ServiceDesc.ServiceName] || !services[productpb.UserService_ServiceDesc.ServiceName] {
+		t.Fatalf("services = %v, want ProductService and UserService", services)
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	s := newTestServer(t, nil, model.RateLimitConfig{}, model.GRPCConfig{})
+	product := s.createProduct(t, "Kemeja", 1)
+
+	_, err := s.products.GetProduct(s.user, &productpb.GetProductRequest{Id: product.Id})
+	expectStatus(t, err, codes.PermissionDenied, "admin_required")
+
+	_, err = s.products.DeleteProduct(s.user, &productpb.DeleteProductRequest{Id: product.Id, Version: product.Version})
+	expectStatus(t, err, codes.PermissionDenied, "admin_required")
+
+	stream, err := s.products.StreamBrandProducts(s.user, &productpb.StreamBrandProductsRequest{BrandId: 1})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	expectStatus(t, err, codes.PermissionDenied, "admin_required")
+
+	got, err := s.products.GetProduct(s.admin, &productpb.GetProductRequest{Id: product.Id})
+	if err != nil || got.Name != "Kemeja" {
+		t.Fatalf("GetProduct as admin = %v, %v, want Kemeja", got, err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	s := newTestServer(t, nil, model.RateLimitConfig{}, model.GRPCConfig{})
+	product := s.createProduct(t, "Kemeja", 1)
+
+	_, err := s.products.GetProduct(s.admin, &productpb.GetProductRequest{Id: 999})
+	expectStatus(t, err, codes.NotFound, "product_not_found")
+
+	_, err = s.products.CreateProduct(s.admin, &productpb.CreateProductRequest{
+		Product: &productpb.ProductInput{Price: 1000, BrandId: 1},
+	})
+	st := expectStatus(t, err, codes.InvalidArgument, "validation_failed")
+
+	var fields []string
+	for _, d := range st.Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			for _, v := range br.FieldViolations {
+				fields = append(fields, v.Field)
+			}
+		}
+	}
+	if len(fields) != 1 || fields[0] != "name" {
+		t.Fatalf("field violations = %v, want name", fields)
+	}
+
+	_, err = s.products.UpdateProduct(s.admin, &productpb.UpdateProductRequest{
+		Id:      product.Id,
+		Version: product.Version + 1,
+		Product: &productpb.ProductInput{Name: "Kemeja Flanel", Price: 1000, BrandId: 1},
+	})
+	expectStatus(t, err, codes.FailedPrecondition, "version_mismatch")
+
+	// Writes without a version are refused rather than left unchecked.
+	_, err = s.products.UpdateProduct(s.admin, &productpb.UpdateProductRequest{
+		Id:      product.Id,
+		Product: &productpb.ProductInput{Name: "Kemeja Flanel", Price: 1000, BrandId: 1},
+	})
+	expectStatus(t, err, codes.FailedPrecondition, "precondition_required")
+
+	name := "Kemeja Flanel"
+	_, err = s.products.PatchProduct(s.admin, &productpb.PatchProductRequest{Id: product.Id, Patch: &productpb.ProductPatch{Name: &name}})
+	expectStatus(t, err, codes.FailedPrecondition, "precondition_required")
+
+	_, err = s.products.DeleteProduct(s.admin, &productpb.DeleteProductRequest{Id: product.Id})
+	expectStatus(t, err, codes.FailedPrecondition, "precondition_required")
+
+	got, err := s.products.GetProduct(s.admin, &productpb.GetProductRequest{Id: product.Id})
+	if err != nil || got.Name != "Kemeja" || got.Version != product.Version {
+		t.Fatalf("GetProduct = %v, %v, want Kemeja unchanged", got, err)
+	}
+
+	_, err = s.users.CreateUser(context.Background(), &productpb.CreateUserRequest{
+		Name: "Budi", Email: "budi@example.com", Gender: "male", Password: "rahasia123",
+	})
+	expectStatus(t, err, codes.AlreadyExists, "email_taken")
+
+	_, err = s.users.Login(context.Background(), &productpb.LoginRequest{Email: "budi@example.com", Password: "salah12345"})
+	expectStatus(t, err, codes.Unauthenticated, "invalid_credentials")
+}
+
+func TestStreamBrandProducts(t *testing.T) {
+	s := newTestServer(t, nil, model.RateLimitConfig{}, model.GRPCConfig{})
+
+	// More than a page, plus products that must be left out.
+	const count = 505
+	ctx := context.Background()
+	for i := 0; i < count; i++ {
+		if _, err := s.repo.Store(ctx, model.Product{Name: "Kemeja", Price: 1000, BrandID: 1}); err != nil {
+			t.Fatalf("Store: %v", err)
+		}
+	}
+	if _, err := s.repo.Store(ctx, model.Product{Name: "Celana", Price: 1000, BrandID: 2}); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	deleted := s.createProduct(t, "Jaket", 1)
+	if _, err := s.products.DeleteProduct(s.admin, &productpb.DeleteProductRequest{Id: deleted.Id, Version: deleted.Version}); err != nil {
+		t.Fatalf("DeleteProduct: %v", err)
+	}
+
+	stream, err := s.products.StreamBrandProducts(s.admin, &productpb.StreamBrandProductsRequest{BrandId: 1})
+	if err != nil {
+		t.Fatalf("StreamBrandProducts: %v", err)
+	}
+
+	seen := map[int64]bool{}
+	for {
+		p, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv after %d products: %v", len(seen), err)
+		}
+		if p.BrandId != 1 || p.Id == deleted.Id || seen[p.Id] {
+			t.Fatalf("streamed %v, want each active product of brand 1 once", p)
+		}
+		seen[p.Id] = true
+	}
+
+	if len(seen) != count {
+		t.Fatalf("streamed %d products, want %d", len(seen), count)
+	}
+	if len(s.pages.offsets) != 2 || s.pages.offsets[0] != 0 || s.pages.offsets[1] != 500 {
+		t.Fatalf("read pages at offsets %v, want 0 and 500", s.pages.offsets)
+	}
+
+	stream, err = s.products.StreamBrandProducts(s.admin, &productpb.StreamBrandProductsRequest{BrandId: 9})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	expectStatus(t, err, codes.NotFound, "brand_not_found")
+}
+
+func TestRateLimit(t *testing.T) {
+	limit := model.RateLimit{Rate: 1, Period: model.Duration(time.Hour), Burst: 1}
+	s := newTestServer(t, repository.NewMemoryRateLimit(), model.RateLimitConfig{
+		Groups: map[string]model.RateLimit{"api": limit, "auth": {Rate: 10, Period: model.Duration(time.Minute), Burst: 10}},
+	}, model.GRPCConfig{})
+
+	// Health probes do not take from the api bucket.
+	health := healthpb.NewHealthClient(s.conn)
+	for i := 0; i < 3; i++ {
+		if _, err := health.Check(s.user, &healthpb.HealthCheckRequest{}); err != nil {
+			t.Fatalf("health Check %d: %v", i, err)
+		}
+	}
+
+	var header metadata.MD
+	if _, err := s.products.ListBrands(s.user, &emptypb.Empty{}, grpc.Header(&header)); err != nil {
+		t.Fatalf("ListBrands: %v", err)
+	}
+	if got := header.Get("ratelimit-remaining"); len(got) != 1 || got[0] != "0" {
+		t.Fatalf("ratelimit-remaining = %v, want 0", got)
+	}
+
+	_, err := s.products.ListBrands(s.user, &emptypb.Empty{}, grpc.Header(&header))
+	expectStatus(t, err, codes.ResourceExhausted, "rate_limited")
+	if got := header.Get("retry-after"); len(got) != 1 || got[0] != "3600" {
+		t.Fatalf("retry-after = %v, want 3600", got)
+	}
+
+	// Other clients have buckets of their own.
+	if _, err := s.products.ListBrands(s.admin, &emptypb.Empty{}); err != nil {
+		t.Fatalf("ListBrands as another user: %v", err)
+	}
+}
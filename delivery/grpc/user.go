@@ -0,0 +1,50 @@
+package grpc
+
+import (
+	"context"
+
+	"crud-product/delivery/grpc/productpb"
+	"crud-product/delivery/validate"
+	"crud-product/model"
+	"crud-product/usecase"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+type userServer struct {
+	productpb.UnimplementedUserServiceServer
+
+	userUsecase usecase.UserUsecase
+	validator   *validate.Validator
+}
+
+func (s *userServer) Login(ctx context.Context, req *productpb.LoginRequest) (*productpb.LoginResponse, error) {
+	credentials := model.Credentials{Email: req.Email, Password: req.Password}
+	if err := s.validator.Validate(credentials); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userUsecase.Login(ctx, model.User{Email: credentials.Email, Password: credentials.Password})
+	if err != nil {
+		return nil, err
+	}
+
+	return &productpb.LoginResponse{Token: user.Token}, nil
+}
+
+func (s *userServer) CreateUser(ctx context.Context, req *productpb.CreateUserRequest) (*emptypb.Empty, error) {
+	user := model.User{
+		Name:     req.Name,
+		Email:    req.Email,
+		Gender:   req.Gender,
+		Password: req.Password,
+	}
+	if err := s.validator.Validate(user); err != nil {
+		return nil, err
+	}
+
+	if err := s.userUsecase.CreateUser(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
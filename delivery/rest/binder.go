@@ -0,0 +1,23 @@
+package rest
+
+import (
+	"crud-product/model"
+	"github.com/labstack/echo/v4"
+)
+
+// Binder binds the request with Echo's default binder and then validates the
+// result, so every handler that calls c.Bind gets validated input.
+type Binder struct {
+	echo.DefaultBinder
+}
+
+func (b *Binder) Bind(i interface{}, c echo.Context) error {
+	if err := b.DefaultBinder.Bind(i, c); err != nil {
+		return model.NewValidationError("invalid_request", "invalid data request")
+	}
+
+	if c.Echo().Validator == nil {
+		return nil
+	}
+	return c.Validate(i)
+}
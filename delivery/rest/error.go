@@ -0,0 +1,143 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"crud-product/logger"
+	"crud-product/model"
+	"github.com/labstack/echo/v4"
+)
+
+const mimeProblemJSON = "application/problem+json"
+
+// Problem is an RFC 7807 problem details body. Code is stable and meant for
+// programs; Title and Detail are for people.
+type Problem struct {
+	Type      string             `json:"type"`
+	Title     string             `json:"title"`
+	Status    int                `json:"status"`
+	Detail    string             `json:"detail,omitempty"`
+	Instance  string             `json:"instance,omitempty"`
+	Code      string             `json:"code"`
+	RequestID string             `json:"request_id,omitempty"`
+	Errors    []model.FieldError `json:"errors,omitempty"`
+}
+
+// ErrorHandler is the echo.HTTPErrorHandler for the service. Handlers return
+// errors instead of writing error bodies themselves; domain errors are mapped
+// to their status and anything unrecognised becomes an opaque 500.
+func ErrorHandler(err error, c echo.Context) {
+	var aborted *abortError
+	if errors.As(err, &aborted) {
+		panic(http.ErrAbortHandler)
+	}
+
+	if c.Response().Committed {
+		return
+	}
+
+	problem := toProblem(err)
+	problem.Instance = c.Request().URL.Path
+	problem.RequestID = c.Response().Header().Get(echo.HeaderXRequestID)
+
+	entry := logger.FromContext(c.Request().Context())
+	if problem.Status >= http.StatusInternalServerError {
+		entry.WithField("request_id", problem.RequestID).Error(err)
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(problem.Status)
+	} else {
+		c.Response().Header().Set(echo.HeaderContentType, mimeProblemJSON)
+		err = c.JSON(problem.Status, problem)
+	}
+	if err != nil {
+		entry.Error(err)
+	}
+}
+
+// abortError breaks off a response whose status line has already been sent,
+// the only way left to tell the client that the body is incomplete. The
+// middleware record the request as a server error, then ErrorHandler aborts
+// the connection.
+type abortError struct {
+	err error
+}
+
+func (e *abortError) Error() string {
+	return e.err.Error()
+}
+
+func (e *abortError) Unwrap() error {
+	return e.err
+}
+
+func toProblem(err error) Problem {
+	var domainErr *model.Error
+	if errors.As(err, &domainErr) {
+		status := statusOf(domainErr.Kind)
+		return Problem{
+			Type:   "about:blank",
+			Title:  http.StatusText(status),
+			Status: status,
+			Detail: domainErr.Message,
+			Code:   domainErr.Code,
+			Errors: domainErr.Fields,
+		}
+	}
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		problem := Problem{
+			Type:   "about:blank",
+			Title:  http.StatusText(httpErr.Code),
+			Status: httpErr.Code,
+			Code:   codeOf(httpErr.Code),
+		}
+		if msg, ok := httpErr.Message.(string); ok && msg != problem.Title {
+			problem.Detail = msg
+		}
+		return problem
+	}
+
+	return Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(http.StatusInternalServerError),
+		Status: http.StatusInternalServerError,
+		Code:   "internal_error",
+	}
+}
+
+func statusOf(kind error) int {
+	switch kind {
+	case model.ErrNotFound:
+		return http.StatusNotFound
+	case model.ErrValidation:
+		return http.StatusBadRequest
+	case model.ErrConflict:
+		return http.StatusConflict
+	case model.ErrForbidden:
+		return http.StatusForbidden
+	case model.ErrUnauthorized:
+		return http.StatusUnauthorized
+	case model.ErrPreconditionFailed:
+		return http.StatusPreconditionFailed
+	case model.ErrUnprocessable:
+		return http.StatusUnprocessableEntity
+	case model.ErrTooManyRequests:
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// codeOf derives a code for errors raised by Echo itself, e.g. 405 becomes
+// "method_not_allowed".
+func codeOf(status int) string {
+	if status == http.StatusInternalServerError {
+		return "internal_error"
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
@@ -0,0 +1,60 @@
+package rest
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"crud-product/metrics"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+// A response broken off after its status line is logged and counted as a
+// server error before the connection is aborted.
+func TestAbortedResponse(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	out := log.StandardLogger().Out
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(out)
+
+	e := echo.New()
+	e.HTTPErrorHandler = ErrorHandler
+	e.Use(AccessLog, Tracing, Metrics)
+
+	errStopped := errors.New("export stopped")
+	e.GET("/aborted", func(c echo.Context) error {
+		c.Response().WriteHeader(http.StatusOK)
+		c.Response().Write([]byte("id,name\n1,"))
+		return &abortError{err: errStopped}
+	})
+
+	count := func() float64 {
+		return testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/aborted", "500"))
+	}
+	before := count()
+
+	func() {
+		defer func() {
+			if p := recover(); p != http.ErrAbortHandler {
+				t.Fatalf("recovered %v, want http.ErrAbortHandler", p)
+			}
+		}()
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/aborted", nil))
+	}()
+
+	if got := count() - before; got != 1 {
+		t.Fatalf("aborted requests counted = %v, want 1 with status 500", got)
+	}
+
+	entry := hook.LastEntry()
+	if entry == nil || entry.Message != "request" || entry.Level != log.ErrorLevel ||
+		entry.Data["status"] != http.StatusInternalServerError || entry.Data[log.ErrorKey] != errStopped {
+		t.Fatalf("last log entry = %+v, want the request logged as a 500 with its error", entry)
+	}
+}
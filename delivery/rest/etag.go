@@ -0,0 +1,75 @@
+package rest
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"crud-product/model"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	headerETag        = "ETag"
+	headerIfMatch     = "If-Match"
+	headerIfNoneMatch = "If-None-Match"
+)
+
+// etag is the strong entity tag of a product version, e.g. "3".
+func etag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// entityTags splits an If-Match or If-None-Match header into its tags.
+func entityTags(header string) []string {
+	tags := []string{}
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// ifMatch returns the product version named by If-Match, or 0 for "*". Without
+// the header the result is 0 as well, unless required, in which case the
+// request fails with 428. Tags that cannot name a version, including weak ones,
+// fail the precondition.
+func ifMatch(c echo.Context, required bool) (int, error) {
+	tags := entityTags(c.Request().Header.Get(headerIfMatch))
+
+	switch {
+	case len(tags) == 0 && required:
+		return 0, echo.NewHTTPError(http.StatusPreconditionRequired, "If-Match header with the product ETag is required")
+	case len(tags) == 0, len(tags) == 1 && tags[0] == "*":
+		return 0, nil
+	case len(tags) > 1:
+		return 0, model.NewValidationError("invalid_precondition", "If-Match must name a single ETag")
+	}
+
+	version, err := strconv.Unquote(tags[0])
+	if err == nil {
+		if v, err := strconv.Atoi(version); err == nil && v > 0 {
+			return v, nil
+		}
+	}
+	return 0, model.NewPreconditionFailedError("version_mismatch", "If-Match does not name a version of this product")
+}
+
+// writeProduct sends the product with its ETag, or 304 Not Modified when
+// If-None-Match already names that version. Weak tags match too, as RFC 9110
+// requires for If-None-Match.
+func writeProduct(c echo.Context, status int, product *model.Product) error {
+	tag := etag(product.Version)
+	c.Response().Header().Set(headerETag, tag)
+
+	if status == http.StatusOK {
+		for _, t := range entityTags(c.Request().Header.Get(headerIfNoneMatch)) {
+			if t == "*" || strings.TrimPrefix(t, "W/") == tag {
+				return c.NoContent(http.StatusNotModified)
+			}
+		}
+	}
+
+	return c.JSON(status, product)
+}
@@ -0,0 +1,136 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"crud-product/metrics"
+	"crud-product/model"
+	"crud-product/tabular"
+	"crud-product/usecase"
+	"github.com/labstack/echo/v4"
+)
+
+type ExportHandler struct {
+	ExportUsecase usecase.ExportUsecase
+	Config        model.ExportConfig
+}
+
+// exportQuery is the query string of GET /api/v2/products/export.
+type exportQuery struct {
+	Format  string `query:"format" validate:"omitempty,oneof=csv xlsx ndjson"`
+	BrandID int    `query:"brand_id" validate:"gte=0"`
+	Stock   string `query:"stock" validate:"omitempty,oneof=in out"`
+	Status  string `query:"status" validate:"omitempty,oneof=active deleted all"`
+	Columns string `query:"columns"`
+}
+
+// NewExportHandler registers the catalogue export route. cfg.Columns are the
+// columns of exports whose request names none.
+func NewExportHandler(e *echo.Echo, exportUsecase usecase.ExportUsecase, cfg model.ExportConfig) {
+	handler := &ExportHandler{
+		ExportUsecase: exportUsecase,
+		Config:        cfg,
+	}
+
+	v2 := e.Group("/api/v2", JwtVerify)
+
+	v2.GET("/products/export", handler.ExportProducts)
+}
+
+// ExportProducts godoc
+// @Summary Export Products.
+// @Description download the products matching the filters, ordered by ID, as CSV, XLSX or JSON Lines. CSV and XLSX files start with a header row naming the columns; by default they are those of an import file. Products are streamed from the database, so a failure after the download has started breaks off the connection. Requires an admin token.
+// @Tags Export
+// @Produce text/csv,application/vnd.openxmlformats-officedocument.spreadsheetml.sheet,application/x-ndjson,json
+// @Security AccessToken
+// @Param format query string false "File format" Enums(csv, xlsx, ndjson) default(csv)
+// @Param brand_id query int false "Only products of this brand"
+// @Param stock query string false "Only products in stock or out of stock" Enums(in, out)
+// @Param status query string false "Active products, deleted ones or both" Enums(active, deleted, all) default(active)
+// @Param columns query string false "Comma-separated columns: id, sku, external_id, name, price, stock, brand_id, version, status"
+// @Success 200 {string} string "CSV, XLSX or NDJSON file"
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 422 {object} Problem
+// @Router /api/v2/products/export [get]
+func (h *ExportHandler) ExportProducts(c echo.Context) error {
+	if err := requireAdmin(c); err != nil {
+		return err
+	}
+
+	query := exportQuery{}
+	if err := c.Bind(&query); err != nil {
+		return err
+	}
+
+	format := query.Format
+	if format == "" {
+		format = tabular.FormatCSV
+	}
+
+	names := h.Config.Columns
+	if query.Columns != "" {
+		names = strings.Split(query.Columns, ",")
+	}
+
+	columns, err := tabular.Columns(names)
+	if err != nil {
+		return err
+	}
+
+	out := &attachment{c: c, format: format}
+	w, err := tabular.NewWriter(out, format, columns)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	ctx := c.Request().Context()
+	filter := model.ExportFilter{BrandID: query.BrandID, Stock: query.Stock, Status: query.Status}
+
+	n, err := h.ExportUsecase.Export(ctx, filter, w.Write)
+	if err == nil {
+		err = w.Flush()
+	}
+
+	if err != nil {
+		if !c.Response().Committed {
+			return err
+		}
+
+		// The status line is out, so breaking off the response is the only
+		// way left to tell the client its file is incomplete.
+		return &abortError{err: err}
+	}
+
+	out.start()
+	metrics.ExportedRows.WithLabelValues(format).Add(float64(n))
+	return nil
+}
+
+// attachment sends the download headers with the first bytes of an export, so
+// that errors before then still get a problem response.
+type attachment struct {
+	c      echo.Context
+	format string
+}
+
+func (a *attachment) start() {
+	res := a.c.Response()
+	if res.Committed {
+		return
+	}
+
+	res.Header().Set(echo.HeaderContentType, tabular.ContentType(a.format))
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", "products."+a.format))
+	res.WriteHeader(http.StatusOK)
+}
+
+func (a *attachment) Write(p []byte) (int, error) {
+	a.start()
+	return a.c.Response().Write(p)
+}
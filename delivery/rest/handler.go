@@ -7,6 +7,8 @@ import (
 	"os"
 	"strconv"
 
+	"crud-product/delivery/auth"
+	"crud-product/metrics"
 	"crud-product/model"
 	"crud-product/usecase"
 	"github.com/labstack/echo/v4"
@@ -14,34 +16,51 @@ import (
 
 type Handler struct {
 	ProductUsecase usecase.ProductUsecase
+	BrandUsecase   usecase.BrandUsecase
 	UserUsecase    usecase.UserUsecase
+	Session        model.SessionConfig
+	Upload         model.UploadConfig
 }
 
 type responseError struct {
 	Message string `json:"message"`
 }
 
-const (
-	isAdmin int = 1
-	imageLoc = "upload"
-)
+// loginResponse carries the token for the x-access-token header. CSRFToken is
+// only set with cookie sessions.
+type loginResponse struct {
+	Message   string `json:"message"`
+	Token     string `json:"token"`
+	CSRFToken string `json:"csrf_token,omitempty"`
+}
 
-func NewHandler(e *echo.Echo, productUsecase usecase.ProductUsecase, userUsecase usecase.UserUsecase) {
+// NewHandler registers the routes. idempotent guards the unsafe routes, see
+// Idempotency, session says whether /login also sets a session cookie and
+// upload where images are stored.
+func NewHandler(e *echo.Echo, productUsecase usecase.ProductUsecase, brandUsecase usecase.BrandUsecase, userUsecase usecase.UserUsecase, idempotent echo.MiddlewareFunc, session model.SessionConfig, upload model.UploadConfig) {
 	handler := &Handler{
 		ProductUsecase: productUsecase,
+		BrandUsecase:   brandUsecase,
 		UserUsecase:    userUsecase,
+		Session:        session,
+		Upload:         upload,
 	}
 
-	// Routing Product
-	e.GET("/product", handler.GetProduct, JwtVerify)
-	e.GET("/product/brand", handler.GetProductAll, JwtVerify)
-	e.POST("/product", handler.SendProduct, JwtVerify)
-	e.PATCH("/product", handler.UpdateProduct, JwtVerify)
-	e.DELETE("/product", handler.DeleteProduct, JwtVerify)
+	// Routing Product (deprecated, see /api/v2)
+	e.GET("/product", handler.GetProduct, Deprecated("/api/v2/products/{id}"), JwtVerify)
+	e.GET("/product/brand", handler.GetProductAll, Deprecated("/api/v2/brands/{id}/products"), JwtVerify)
+	e.POST("/product", handler.SendProduct, Deprecated("/api/v2/products"), JwtVerify, idempotent)
+	e.PATCH("/product", handler.UpdateProduct, Deprecated("/api/v2/products/{id}"), JwtVerify, idempotent)
+	e.DELETE("/product", handler.DeleteProduct, Deprecated("/api/v2/products/{id}"), JwtVerify, idempotent)
+
+	newHandlerV2(e, handler, idempotent)
 
 	// Routing User
 	e.POST("/login", handler.Login)
-	e.POST("/register", handler.Register)
+	e.POST("/register", handler.Register, idempotent)
+	if session.Cookie {
+		e.POST("/logout", handler.Logout)
+	}
 }
 
 // GetProduct godoc
@@ -50,238 +69,228 @@ func NewHandler(e *echo.Echo, productUsecase usecase.ProductUsecase, userUsecase
 // @Tags Product
 // @Accept */*
 // @Produce json
-// @Param id path string true "Product ID"
-// @Success 200 {object} map[string]interface{}
+// @Security AccessToken
+// @Param id query int true "Product ID"
+// @Param If-None-Match header string false "ETag of a cached copy"
+// @Success 200 {object} model.Product
+// @Success 304
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
 // @Router /product [get]
-
 func (h *Handler) GetProduct(c echo.Context) error {
 	ctx := c.Request().Context()
-	productIDParam := c.QueryParam("id")
-
-	userInfo := c.Get("user").(*model.Token)
-
-	if userInfo.Role != isAdmin {
-		return echo.ErrUnauthorized
-	}
 
-	if productIDParam == "" {
-		c.JSON(http.StatusBadRequest, responseError{
-			Message: "invalid parameter",
-		})
-
-		return echo.ErrBadRequest
+	if err := requireAdmin(c); err != nil {
+		return err
 	}
 
-	productID, err := strconv.Atoi(productIDParam)
+	productID, err := queryID(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, responseError{
-			Message: "invalid parameter",
-		})
-
-		return echo.ErrBadRequest
+		return err
 	}
 
 	res, err := h.ProductUsecase.GetProduct(ctx, productID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, responseError{
-			Message: fmt.Sprint(err),
-		})
-
-		return echo.ErrInternalServerError
+		return err
 	}
 
-	return c.JSON(http.StatusOK, res)
+	return writeProduct(c, http.StatusOK, res)
 }
 
+// GetProductAll godoc
+// @Summary List a brand's products.
+// @Description list the active products of a brand. Requires an admin token.
+// @Tags Product
+// @Produce json
+// @Security AccessToken
+// @Param id query int true "Brand ID"
+// @Success 200 {array} model.Product
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Router /product/brand [get]
 func (h *Handler) GetProductAll(c echo.Context) error {
 	ctx := c.Request().Context()
-	brandIDParam := c.QueryParam("id")
-
-	userInfo := c.Get("user").(*model.Token)
-
-	if userInfo.Role != isAdmin {
-		return echo.ErrUnauthorized
-	}
-
-	if brandIDParam == "" {
-		c.JSON(http.StatusBadRequest, responseError{
-			Message: "invalid parameter",
-		})
 
-		return echo.ErrBadRequest
+	if err := requireAdmin(c); err != nil {
+		return err
 	}
 
-	brandID, err := strconv.Atoi(brandIDParam)
+	brandID, err := queryID(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, responseError{
-			Message: "invalid parameter",
-		})
-		return echo.ErrBadRequest
+		return err
 	}
 
 	res, err := h.ProductUsecase.GetProductAll(ctx, brandID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, responseError{
-			Message: "internal error",
-		})
-		return echo.ErrInternalServerError
+		return err
 	}
 	return c.JSON(http.StatusOK, res)
 }
 
+// SendProduct godoc
+// @Summary Create Product.
+// @Description create a product with its image. Requires an admin token.
+// @Tags Product
+// @Accept multipart/form-data
+// @Produce json
+// @Security AccessToken
+// @Param name formData string true "Product name" maxLength(255)
+// @Param price formData int false "Price" minimum(0)
+// @Param stock formData int false "Stock" minimum(0)
+// @Param brand_id formData int true "Brand ID" minimum(1)
+// @Param fileImage formData file true "Product image"
+// @Param Idempotency-Key header string false "Unique key that makes retries safe"
+// @Success 201 {object} responseError
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 422 {object} Problem
+// @Router /product [post]
 func (h *Handler) SendProduct(c echo.Context) error {
 	ctx := c.Request().Context()
 	dataReq := model.Product{}
 
-	userInfo := c.Get("user").(*model.Token)
-
-	if userInfo.Role != isAdmin {
-		return echo.ErrUnauthorized
+	if err := requireAdmin(c); err != nil {
+		return err
 	}
 
-	dataReq.UrlImage, _ = c.FormFile("fileImage")
-
-	uploadedFile, err := dataReq.UrlImage.Open()
-	if err != nil {
+	if err := c.Bind(&dataReq); err != nil {
 		return err
 	}
-	defer uploadedFile.Close()
 
-	tempFile, err := os.CreateTemp(imageLoc, fmt.Sprintf("%v", dataReq.ID))
+	path, err := h.saveImage(c, &dataReq)
 	if err != nil {
-		fmt.Println(err)
-	}
-	defer tempFile.Close()
-
-	dataReq.Path = tempFile.Name()
-
-	if _, err = io.Copy(tempFile, uploadedFile); err != nil {
 		return err
 	}
 
-	if err := c.Bind(&dataReq); err != nil {
-		c.JSON(http.StatusBadRequest, responseError{
-			Message: "invalid data request",
-		})
-		return echo.ErrBadRequest
-	}
+	dataReq.Path = path
 
 	_, err = h.ProductUsecase.SendProduct(ctx, dataReq)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, responseError{
-			Message: "internal error",
-		})
-
-		return echo.ErrInternalServerError
+		os.Remove(path)
+		return err
 	}
 	return c.JSON(http.StatusCreated, responseError{
 		Message: "success create",
 	})
 }
 
+// UpdateProduct godoc
+// @Summary Update Product.
+// @Description change a product's name, price, stock or image. Only the fields sent are changed; the image is optional. Send application/merge-patch+json to change fields without an upload. Requires an admin token.
+// @Tags Product
+// @Accept multipart/form-data
+// @Accept application/merge-patch+json
+// @Produce json
+// @Security AccessToken
+// @Param id query int true "Product ID"
+// @Param If-Match header string false "ETag from GET; the update fails with 412 if the product changed since. Optional on this deprecated route only: without it the last write wins. /api/v2 requires it"
+// @Param name formData string false "Product name" maxLength(255)
+// @Param price formData int false "Price" minimum(0)
+// @Param stock formData int false "Stock" minimum(0)
+// @Param fileImage formData file false "Product image"
+// @Success 200 {object} responseError
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 412 {object} Problem
+// @Router /product [patch]
 func (h *Handler) UpdateProduct(c echo.Context) error {
 	ctx := c.Request().Context()
-	dataReq := model.Product{}
-	productIDParam := c.QueryParam("id")
-
-	userInfo := c.Get("user").(*model.Token)
 
-	if userInfo.Role != isAdmin {
-		return echo.ErrUnauthorized
+	if err := requireAdmin(c); err != nil {
+		return err
 	}
 
-	dataReq.UrlImage, _ = c.FormFile("fileImage")
-
-	uploadedFile, err := dataReq.UrlImage.Open()
+	productID, err := queryID(c)
 	if err != nil {
 		return err
 	}
-	defer uploadedFile.Close()
 
-	tempFile, err := os.CreateTemp(imageLoc, fmt.Sprintf("%v", dataReq.ID))
+	// v1 predates If-Match and keeps it optional for its existing clients.
+	version, err := ifMatch(c, false)
 	if err != nil {
-		fmt.Println(err)
+		return err
 	}
-	defer tempFile.Close()
-
-	dataReq.Path = tempFile.Name()
 
-	if _, err = io.Copy(tempFile, uploadedFile); err != nil {
+	patch := model.ProductPatch{}
+	if isMergePatch(c, false) {
+		if err := bindMergePatch(c, &patch); err != nil {
+			return err
+		}
+		// The brand of a product cannot be changed through v1.
+		patch.BrandID = nil
+	} else if err := bindFormPatch(c, &patch); err != nil {
 		return err
 	}
 
-	if productIDParam == "" {
-		c.JSON(http.StatusBadRequest, responseError{
-			Message: "invalid parameter",
-		})
+	patch.Version = version
 
-		return echo.ErrBadRequest
+	var path string
+	if hasImage(c) {
+		path, err = h.saveImage(c, &model.Product{ID: productID})
+		if err != nil {
+			return err
+		}
+		patch.Path = &path
 	}
 
-	productID, err := strconv.Atoi(productIDParam)
+	res, err := h.ProductUsecase.PatchProduct(ctx, patch, productID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, responseError{
-			Message: "invalid parameter",
-		})
-
-		return echo.ErrBadRequest
-	}
-
-	if err := c.Bind(&dataReq); err != nil {
-		c.JSON(http.StatusBadRequest, responseError{
-			Message: "invalid data request",
-		})
-		return echo.ErrBadRequest
+		if path != "" {
+			os.Remove(path)
+		}
+		return err
 	}
 
-	_, err = h.ProductUsecase.UpdateProduct(ctx, dataReq, productID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, responseError{
-			Message: "internal error",
-		})
-		fmt.Println(err)
-		return echo.ErrInternalServerError
-	}
+	c.Response().Header().Set(headerETag, etag(res.Version))
 
 	return c.JSON(http.StatusOK, responseError{
 		Message: "update has been successful",
 	})
 }
 
+// DeleteProduct godoc
+// @Summary Delete Product.
+// @Description delete a product. Requires an admin token.
+// @Tags Product
+// @Produce json
+// @Security AccessToken
+// @Param id query int true "Product ID"
+// @Param If-Match header string false "ETag from GET; the delete fails with 412 if the product changed since. Optional on this deprecated route only: without it the last write wins. /api/v2 requires it"
+// @Param Idempotency-Key header string false "Unique key that makes retries safe"
+// @Success 200 {object} responseError
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 412 {object} Problem
+// @Failure 422 {object} Problem
+// @Router /product [delete]
 func (h *Handler) DeleteProduct(c echo.Context) error {
 	ctx := c.Request().Context()
-	productIDParam := c.QueryParam("id")
 
-	userInfo := c.Get("user").(*model.Token)
-
-	if userInfo.Role != isAdmin {
-		return echo.ErrUnauthorized
+	if err := requireAdmin(c); err != nil {
+		return err
 	}
 
-	if productIDParam == "" {
-		c.JSON(http.StatusBadRequest, responseError{
-			Message: "invalid parameter",
-		})
-
-		return echo.ErrBadRequest
+	productID, err := queryID(c)
+	if err != nil {
+		return err
 	}
 
-	productID, err := strconv.Atoi(productIDParam)
+	// v1 predates If-Match and keeps it optional for its existing clients.
+	version, err := ifMatch(c, false)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, responseError{
-			Message: "invalid parameter",
-		})
-
-		return echo.ErrBadRequest
+		return err
 	}
 
-	err = h.ProductUsecase.DeleteProduct(ctx, productID)
+	err = h.ProductUsecase.DeleteProduct(ctx, productID, version)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, responseError{
-			Message: "internal error",
-		})
-
-		return echo.ErrInternalServerError
+		return err
 	}
 
 	return c.JSON(http.StatusOK, responseError{
@@ -289,46 +298,135 @@ func (h *Handler) DeleteProduct(c echo.Context) error {
 	})
 }
 
+// Login godoc
+// @Summary Log in.
+// @Description exchange email and password for a JWT. With cookie sessions enabled the token is also set as a cookie and a csrf_token is returned.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param credentials body model.Credentials true "Credentials"
+// @Success 200 {object} loginResponse
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Router /login [post]
 func (h *Handler) Login(c echo.Context) error {
-	dataReq := model.User{}
-	if err := c.Bind(&dataReq); err != nil {
-		c.JSON(http.StatusBadRequest, responseError{
-			Message: "invalid data request",
-		})
-		return echo.ErrBadRequest
+	credentials := model.Credentials{}
+	if err := c.Bind(&credentials); err != nil {
+		return err
+	}
+
+	dataReq := model.User{
+		Email:    credentials.Email,
+		Password: credentials.Password,
 	}
 
 	user, err := h.UserUsecase.Login(c.Request().Context(), dataReq)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, responseError{
-			Message: err.Error(),
-		})
-		return echo.ErrInternalServerError
+		return err
 	}
 
-	return c.JSON(http.StatusOK, map[string]interface{}{
-		"message": "logged in",
-		"token":   user.Token,
-	})
+	res := loginResponse{
+		Message: "logged in",
+		Token:   user.Token,
+	}
+	if h.Session.Cookie {
+		res.CSRFToken = setSession(c, h.Session, user.Token)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// Logout godoc
+// @Summary Log out.
+// @Description clear the session cookies. Only registered when cookie sessions are enabled.
+// @Tags User
+// @Param X-CSRF-Token header string false "CSRF token from /login, required with a session cookie"
+// @Success 204
+// @Failure 403 {object} Problem
+// @Router /logout [post]
+func (h *Handler) Logout(c echo.Context) error {
+	clearSession(c, h.Session)
+	return c.NoContent(http.StatusNoContent)
 }
 
+// Register godoc
+// @Summary Register User.
+// @Description create a user account. New users always get the default role; admins change it with PUT /api/v2/users/role.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param user body model.User true "User"
+// @Param Idempotency-Key header string false "Unique key that makes retries safe"
+// @Success 201 {string} string
+// @Failure 400 {object} Problem
+// @Failure 409 {object} Problem
+// @Failure 422 {object} Problem
+// @Router /register [post]
 func (h *Handler) Register(c echo.Context) error {
 	dataReq := model.User{}
 	if err := c.Bind(&dataReq); err != nil {
-		c.JSON(http.StatusBadRequest, responseError{
-			Message: "invalid data request",
-		})
-
-		return echo.ErrBadRequest
+		return err
 	}
 
 	err := h.UserUsecase.CreateUser(c.Request().Context(), dataReq)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, responseError{
-			Message: err.Error(),
-		})
-		return echo.ErrInternalServerError
+		return err
 	}
 
 	return c.JSON(http.StatusCreated, "success")
-}
\ No newline at end of file
+}
+
+func requireAdmin(c echo.Context) error {
+	return auth.RequireAdmin(c.Get("user").(*model.Token))
+}
+
+// queryID reads the numeric id query parameter.
+func queryID(c echo.Context) (int, error) {
+	idParam := c.QueryParam("id")
+	if idParam == "" {
+		return 0, model.NewValidationError("invalid_parameter", "id is required")
+	}
+
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return 0, model.NewValidationError("invalid_parameter", "id must be an integer")
+	}
+	return id, nil
+}
+
+func hasImage(c echo.Context) bool {
+	_, err := c.FormFile("fileImage")
+	return err == nil
+}
+
+// saveImage copies the fileImage upload into the upload directory and returns
+// where it was stored.
+func (h *Handler) saveImage(c echo.Context, dataReq *model.Product) (string, error) {
+	var err error
+	dataReq.UrlImage, err = c.FormFile("fileImage")
+	if err != nil {
+		return "", model.NewValidationError("missing_image", "fileImage is required")
+	}
+
+	uploadedFile, err := dataReq.UrlImage.Open()
+	if err != nil {
+		return "", err
+	}
+	defer uploadedFile.Close()
+
+	tempFile, err := os.CreateTemp(h.Upload.Dir, fmt.Sprintf("%v", dataReq.ID))
+	if err != nil {
+		return "", err
+	}
+	defer tempFile.Close()
+
+	n, err := io.Copy(tempFile, uploadedFile)
+	if err != nil {
+		return "", err
+	}
+
+	metrics.Uploads.Inc()
+	metrics.UploadBytes.Observe(float64(n))
+
+	return tempFile.Name(), nil
+}
@@ -0,0 +1,503 @@
+package rest_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"crud-product/constant"
+	"crud-product/delivery/rest"
+	"crud-product/delivery/validate"
+	"crud-product/model"
+	"crud-product/repository"
+	"crud-product/usecase"
+	"github.com/labstack/echo/v4"
+)
+
+type testAPI struct {
+	echo      *echo.Echo
+	users     repository.UserRepository
+	uploadDir string
+	token     string
+}
+
+// newTestAPI wires the REST handlers the way the server does, over memory
+// repositories holding two brands, and logs in an admin through /login.
+func newTestAPI(t *testing.T) *testAPI {
+	t.Helper()
+
+	brands := repository.NewMemoryBrandRepository(
+		model.Brand{ID: 1, Name: "Eiger"},
+		model.Brand{ID: 2, Name: "Erigo"},
+	)
+	products := repository.NewMemoryProductRepository(brands)
+	transactor := repository.NewMemoryTransactor(products)
+
+	api := &testAPI{
+		echo:      echo.New(),
+		users:     repository.NewMemoryUserRepository(),
+		uploadDir: t.TempDir(),
+	}
+
+	e := api.echo
+	e.HTTPErrorHandler = rest.ErrorHandler
+	e.Validator = validate.New()
+	e.Binder = &rest.Binder{}
+	e.Use(rest.ReadYourWrites)
+
+	idempotent := rest.Idempotency(repository.NewMemoryIdempotencyRepository(), time.Hour, constant.DefaultIdempotencyMaxBodySize)
+	importCfg := model.ImportConfig{ChunkSize: 100, AsyncRows: 1000, MaxFileSize: 1 << 20, JobTTL: model.Duration(time.Hour), QueueSize: 1}
+
+	rest.NewHandler(e,
+		usecase.NewProduct(products, transactor),
+		usecase.NewBrand(brands, products),
+		usecase.NewUser(api.users),
+		idempotent, model.SessionConfig{}, model.UploadConfig{Dir: api.uploadDir})
+	rest.NewImportHandler(e, usecase.NewImport(products, brands, repository.NewMemoryImportJobRepository(), transactor, importCfg), importCfg, idempotent)
+	rest.NewExportHandler(e, usecase.NewExport(products, brands), model.ExportConfig{})
+
+	api.register(t, "admin@example.com")
+	if err := api.users.SetRole(context.Background(), "admin@example.com", model.RoleAdmin); err != nil {
+		t.Fatalf("promote admin: %v", err)
+	}
+	api.token = api.login(t, "admin@example.com")
+
+	return api
+}
+
+func (a *testAPI) register(t *testing.T, email string) {
+	t.Helper()
+
+	body := fmt.Sprintf(`{"name":"Budi","email":%q,"password":"rahasia123"}`, email)
+	rec := a.do(jsonRequest(http.MethodPost, "/register", body), "")
+	expectStatus(t, rec, http.StatusCreated)
+}
+
+func (a *testAPI) login(t *testing.T, email string) string {
+	t.Helper()
+
+	body := fmt.Sprintf(`{"email":%q,"password":"rahasia123"}`, email)
+	rec := a.do(jsonRequest(http.MethodPost, "/login", body), "")
+	expectStatus(t, rec, http.StatusOK)
+
+	var res struct{ Token string }
+	decode(t, rec, &res)
+	if res.Token == "" {
+		t.Fatalf("login returned no token: %s", rec.Body)
+	}
+	return res.Token
+}
+
+func (a *testAPI) do(req *http.Request, token string) *httptest.ResponseRecorder {
+	if token != "" {
+		req.Header.Set("x-access-token", token)
+	}
+
+	rec := httptest.NewRecorder()
+	a.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+// createProduct creates a product through v2 and returns it.
+func (a *testAPI) createProduct(t *testing.T, body string) model.Product {
+	t.Helper()
+
+	rec := a.do(jsonRequest(http.MethodPost, "/api/v2/products", body), a.token)
+	expectStatus(t, rec, http.StatusCreated)
+
+	var prod model.Product
+	decode(t, rec, &prod)
+	return prod
+}
+
+func jsonRequest(method, target, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	return req
+}
+
+// uploadRequest sends fields and, under fileField, a file named filename.
+func uploadRequest(t *testing.T, method, target string, fields map[string]string, fileField, filename, content string) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for name, value := range fields {
+		if err := w.WriteField(name, value); err != nil {
+			t.Fatalf("write field %s: %v", name, err)
+		}
+	}
+	if fileField != "" {
+		fw, err := w.CreateFormFile(fileField, filename)
+		if err == nil {
+			_, err = io.WriteString(fw, content)
+		}
+		if err != nil {
+			t.Fatalf("write file %s: %v", fileField, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close multipart writer: %v", err)
+	}
+
+	req := httptest.NewRequest(method, target, &body)
+	req.Header.Set(echo.HeaderContentType, w.FormDataContentType())
+	return req
+}
+
+func withHeader(req *http.Request, name, value string) *http.Request {
+	req.Header.Set(name, value)
+	return req
+}
+
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, status int) {
+	t.Helper()
+
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, status, rec.Body)
+	}
+}
+
+// expectProblem checks that rec is a problem+json body with status and code.
+func expectProblem(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) rest.Problem {
+	t.Helper()
+
+	expectStatus(t, rec, status)
+	if ct := rec.Header().Get(echo.HeaderContentType); ct != "application/problem+json" {
+		t.Fatalf("Content-Type = %q, want application/problem+json", ct)
+	}
+
+	var problem rest.Problem
+	decode(t, rec, &problem)
+	if problem.Status != status || problem.Code != code || problem.Title == "" {
+		t.Fatalf("problem = %+v, want status %d and code %s", problem, status, code)
+	}
+	return problem
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder, dst interface{}) {
+	t.Helper()
+
+	if err := json.Unmarshal(rec.Body.Bytes(), dst); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	api := newTestAPI(t)
+
+	rec := api.do(jsonRequest(http.MethodPost, "/login", `{"email":"admin@example.com","password":"salah12345"}`), "")
+	expectProblem(t, rec, http.StatusUnauthorized, "invalid_credentials")
+
+	rec = api.do(httptest.NewRequest(http.MethodGet, "/api/v2/brands", nil), "")
+	expectProblem(t, rec, http.StatusUnauthorized, "missing_token")
+
+	rec = api.do(httptest.NewRequest(http.MethodGet, "/api/v2/brands", nil), "not-a-jwt")
+	expectProblem(t, rec, http.StatusUnauthorized, "invalid_token")
+
+	rec = api.do(httptest.NewRequest(http.MethodGet, "/api/v2/brands", nil), api.token)
+	expectStatus(t, rec, http.StatusOK)
+
+	// Registration ignores the role it is sent.
+	rec = api.do(jsonRequest(http.MethodPost, "/register", `{"name":"Budi","email":"budi@example.com","password":"rahasia123","role":1}`), "")
+	expectStatus(t, rec, http.StatusCreated)
+	user := api.login(t, "budi@example.com")
+
+	rec = api.do(httptest.NewRequest(http.MethodGet, "/api/v2/products", nil), user)
+	expectProblem(t, rec, http.StatusForbidden, "admin_required")
+
+	rec = api.do(jsonRequest(http.MethodPost, "/register", `{"name":"Budi","email":"budi@example.com","password":"rahasia123"}`), "")
+	expectProblem(t, rec, http.StatusConflict, "email_taken")
+
+	rec = api.do(jsonRequest(http.MethodPost, "/register", `{"name":"Budi","email":"budi","password":"rahasia123"}`), "")
+	problem := expectProblem(t, rec, http.StatusBadRequest, "validation_failed")
+	if len(problem.Errors) != 1 || problem.Errors[0].Field != "email" {
+		t.Fatalf("invalid fields = %+v, want email", problem.Errors)
+	}
+}
+
+func TestProductRoutesV1(t *testing.T) {
+	api := newTestAPI(t)
+
+	fields := map[string]string{"name": "Kemeja", "price": "150000", "stock": "5", "brand_id": "1"}
+
+	rec := api.do(uploadRequest(t, http.MethodPost, "/product", fields, "", "", ""), api.token)
+	expectProblem(t, rec, http.StatusBadRequest, "missing_image")
+
+	rec = api.do(uploadRequest(t, http.MethodPost, "/product", fields, "fileImage", "kemeja.png", "png bytes"), api.token)
+	expectStatus(t, rec, http.StatusCreated)
+	if rec.Header().Get("Deprecation") == "" {
+		t.Fatalf("v1 response has no Deprecation header: %v", rec.Header())
+	}
+
+	rec = api.do(httptest.NewRequest(http.MethodGet, "/product/brand?id=1", nil), api.token)
+	expectStatus(t, rec, http.StatusOK)
+	var listed []model.Product
+	decode(t, rec, &listed)
+	if len(listed) != 1 || listed[0].Name != "Kemeja" {
+		t.Fatalf("brand products = %+v, want the new product", listed)
+	}
+	id := listed[0].ID
+
+	rec = api.do(httptest.NewRequest(http.MethodGet, fmt.Sprintf("/product?id=%d", id), nil), api.token)
+	expectStatus(t, rec, http.StatusOK)
+	if etag := rec.Header().Get("ETag"); etag != `"1"` {
+		t.Fatalf("ETag = %q, want \"1\"", etag)
+	}
+
+	rec = api.do(httptest.NewRequest(http.MethodGet, "/product?id=x", nil), api.token)
+	expectProblem(t, rec, http.StatusBadRequest, "invalid_parameter")
+
+	// An upload without If-Match replaces the image; v1 lets the last write win.
+	target := fmt.Sprintf("/product?id=%d", id)
+	rec = api.do(uploadRequest(t, http.MethodPatch, target, map[string]string{"name": "Kemeja Flanel"}, "fileImage", "flanel.png", "new png bytes"), api.token)
+	expectStatus(t, rec, http.StatusOK)
+	if etag := rec.Header().Get("ETag"); etag != `"2"` {
+		t.Fatalf("ETag after update = %q, want \"2\"", etag)
+	}
+
+	rec = api.do(withHeader(withHeader(jsonRequest(http.MethodPatch, target, `{"stock":9}`), echo.HeaderContentType, "application/merge-patch+json"), "If-Match", `"1"`), api.token)
+	expectProblem(t, rec, http.StatusPreconditionFailed, "version_mismatch")
+
+	rec = api.do(withHeader(withHeader(jsonRequest(http.MethodPatch, target, `{"stock":9}`), echo.HeaderContentType, "application/merge-patch+json"), "If-Match", `"2"`), api.token)
+	expectStatus(t, rec, http.StatusOK)
+
+	entries, err := os.ReadDir(api.uploadDir)
+	if err != nil {
+		t.Fatalf("read upload dir: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("upload dir holds %d files, want both images", len(entries))
+	}
+
+	rec = api.do(httptest.NewRequest(http.MethodDelete, target, nil), api.token)
+	expectStatus(t, rec, http.StatusOK)
+
+	rec = api.do(httptest.NewRequest(http.MethodGet, target, nil), api.token)
+	expectProblem(t, rec, http.StatusNotFound, "product_not_found")
+
+	rec = api.do(httptest.NewRequest(http.MethodDelete, target, nil), api.token)
+	expectProblem(t, rec, http.StatusNotFound, "product_not_found")
+}
+
+func TestProductRoutesV2(t *testing.T) {
+	api := newTestAPI(t)
+
+	rec := api.do(jsonRequest(http.MethodPost, "/api/v2/products", `{"name":"Kemeja","price":150000,"stock":5,"brand_id":1,"sku":"KMJ-1"}`), api.token)
+	expectStatus(t, rec, http.StatusCreated)
+	var prod model.Product
+	decode(t, rec, &prod)
+	target := fmt.Sprintf("/api/v2/products/%d", prod.ID)
+	if loc := rec.Header().Get(echo.HeaderLocation); loc != target {
+		t.Fatalf("Location = %q, want %q", loc, target)
+	}
+
+	api.createProduct(t, `{"name":"Celana","price":200000,"stock":0,"brand_id":2}`)
+
+	rec = api.do(jsonRequest(http.MethodPost, "/api/v2/products", `{"name":"Topi","brand_id":1,"sku":"KMJ-1"}`), api.token)
+	expectProblem(t, rec, http.StatusConflict, "sku_taken")
+
+	rec = api.do(jsonRequest(http.MethodPost, "/api/v2/products", `{"name":" ","brand_id":0}`), api.token)
+	if problem := expectProblem(t, rec, http.StatusBadRequest, "validation_failed"); len(problem.Errors) != 2 {
+		t.Fatalf("invalid fields = %+v, want name and brand_id", problem.Errors)
+	}
+
+	rec = api.do(httptest.NewRequest(http.MethodGet, "/api/v2/products?brand_id=1&limit=10", nil), api.token)
+	expectStatus(t, rec, http.StatusOK)
+	var page rest.ProductPage
+	decode(t, rec, &page)
+	if len(page.Data) != 1 || page.Data[0].ID != prod.ID || page.Limit != 10 {
+		t.Fatalf("page = %+v, want the brand 1 product with limit 10", page)
+	}
+
+	rec = api.do(httptest.NewRequest(http.MethodGet, target, nil), api.token)
+	expectStatus(t, rec, http.StatusOK)
+	etag := rec.Header().Get("ETag")
+
+	rec = api.do(withHeader(httptest.NewRequest(http.MethodGet, target, nil), "If-None-Match", etag), api.token)
+	expectStatus(t, rec, http.StatusNotModified)
+
+	rec = api.do(httptest.NewRequest(http.MethodGet, "/api/v2/products/999", nil), api.token)
+	expectProblem(t, rec, http.StatusNotFound, "product_not_found")
+
+	replace := `{"name":"Kemeja Flanel","price":175000,"stock":3,"brand_id":1}`
+	rec = api.do(jsonRequest(http.MethodPut, target, replace), api.token)
+	expectProblem(t, rec, http.StatusPreconditionRequired, "precondition_required")
+
+	rec = api.do(withHeader(jsonRequest(http.MethodPut, target, replace), "If-Match", etag), api.token)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &prod)
+	if prod.Name != "Kemeja Flanel" || prod.SKU != "KMJ-1" {
+		t.Fatalf("replaced product = %+v, want the new name and the stored SKU", prod)
+	}
+
+	// The first ETag is stale now.
+	patch := withHeader(jsonRequest(http.MethodPatch, target, `{"stock":7}`), echo.HeaderContentType, "application/merge-patch+json")
+	rec = api.do(withHeader(patch, "If-Match", etag), api.token)
+	expectProblem(t, rec, http.StatusPreconditionFailed, "version_mismatch")
+
+	etag = fmt.Sprintf(`"%d"`, prod.Version)
+
+	patch = withHeader(jsonRequest(http.MethodPatch, target, `{"stock":7}`), echo.HeaderContentType, echo.MIMETextPlain)
+	rec = api.do(withHeader(patch, "If-Match", etag), api.token)
+	expectProblem(t, rec, http.StatusUnsupportedMediaType, "unsupported_media_type")
+
+	patch = withHeader(jsonRequest(http.MethodPatch, target, `{"stock":7}`), echo.HeaderContentType, "application/merge-patch+json")
+	rec = api.do(withHeader(patch, "If-Match", etag), api.token)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &prod)
+	if prod.Stock != 7 || prod.Name != "Kemeja Flanel" {
+		t.Fatalf("patched product = %+v, want only the stock changed", prod)
+	}
+
+	image := uploadRequest(t, http.MethodPut, target+"/image", nil, "fileImage", "flanel.png", "png bytes")
+	rec = api.do(withHeader(image, "If-Match", rec.Header().Get("ETag")), api.token)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &prod)
+	if entries, err := os.ReadDir(api.uploadDir); err != nil || len(entries) != 1 {
+		t.Fatalf("upload dir = %v, %v, want the image", entries, err)
+	}
+
+	rec = api.do(httptest.NewRequest(http.MethodGet, "/api/v2/brands", nil), api.token)
+	expectStatus(t, rec, http.StatusOK)
+	var brands []model.Brand
+	decode(t, rec, &brands)
+	if len(brands) != 2 {
+		t.Fatalf("brands = %+v, want both", brands)
+	}
+
+	rec = api.do(httptest.NewRequest(http.MethodGet, "/api/v2/brands/2/products", nil), api.token)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &page)
+	if len(page.Data) != 1 || page.Data[0].Name != "Celana" {
+		t.Fatalf("brand 2 page = %+v, want Celana", page)
+	}
+
+	rec = api.do(httptest.NewRequest(http.MethodGet, "/api/v2/brands/9/products", nil), api.token)
+	expectProblem(t, rec, http.StatusNotFound, "brand_not_found")
+
+	rec = api.do(withHeader(httptest.NewRequest(http.MethodDelete, target, nil), "If-Match", etag), api.token)
+	expectProblem(t, rec, http.StatusPreconditionFailed, "version_mismatch")
+
+	rec = api.do(withHeader(httptest.NewRequest(http.MethodDelete, target, nil), "If-Match", fmt.Sprintf(`"%d"`, prod.Version)), api.token)
+	expectStatus(t, rec, http.StatusNoContent)
+
+	rec = api.do(httptest.NewRequest(http.MethodGet, target, nil), api.token)
+	expectProblem(t, rec, http.StatusNotFound, "product_not_found")
+}
+
+func TestSetUserRole(t *testing.T) {
+	api := newTestAPI(t)
+	api.register(t, "budi@example.com")
+
+	rec := api.do(jsonRequest(http.MethodPut, "/api/v2/users/role", `{"email":"budi@example.com","role":1}`), api.login(t, "budi@example.com"))
+	expectProblem(t, rec, http.StatusForbidden, "admin_required")
+
+	rec = api.do(jsonRequest(http.MethodPut, "/api/v2/users/role", `{"email":"budi@example.com","role":1}`), api.token)
+	expectStatus(t, rec, http.StatusNoContent)
+
+	// The role is read when the token is issued.
+	rec = api.do(httptest.NewRequest(http.MethodGet, "/api/v2/products", nil), api.login(t, "budi@example.com"))
+	expectStatus(t, rec, http.StatusOK)
+
+	rec = api.do(jsonRequest(http.MethodPut, "/api/v2/users/role", `{"email":"siapa@example.com","role":1}`), api.token)
+	expectProblem(t, rec, http.StatusNotFound, "user_not_found")
+
+	rec = api.do(jsonRequest(http.MethodPut, "/api/v2/users/role", `{"email":"budi@example.com","role":7}`), api.token)
+	expectProblem(t, rec, http.StatusBadRequest, "validation_failed")
+}
+
+func TestImportAndExport(t *testing.T) {
+	api := newTestAPI(t)
+
+	csv := "sku,name,price,stock,brand_id\nKMJ-1,Kemeja,150000,5,1\nCLN-1,Celana,200000,0,9\n"
+
+	rec := api.do(uploadRequest(t, http.MethodPost, "/api/v2/products/import", nil, "file", "products.csv", csv), api.token)
+	expectStatus(t, rec, http.StatusOK)
+	var report model.ImportReport
+	decode(t, rec, &report)
+	if report.Created != 1 || report.Failed != 1 || report.Rows[1].Code != "unknown_brand" {
+		t.Fatalf("report = %+v, want one row created and the unknown brand failed", report)
+	}
+
+	rec = api.do(uploadRequest(t, http.MethodPost, "/api/v2/products/import?async=true", nil, "file", "products.csv", csv), api.token)
+	expectStatus(t, rec, http.StatusAccepted)
+	var job model.ImportJob
+	decode(t, rec, &job)
+	location := rec.Header().Get(echo.HeaderLocation)
+	if location != "/api/v2/imports/"+job.ID {
+		t.Fatalf("Location = %q, want the job", location)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status != model.ImportJobSucceeded {
+		if job.Status == model.ImportJobFailed || time.Now().After(deadline) {
+			t.Fatalf("job = %+v, want it to succeed", job)
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		rec = api.do(httptest.NewRequest(http.MethodGet, location, nil), api.token)
+		expectStatus(t, rec, http.StatusOK)
+		decode(t, rec, &job)
+	}
+	if job.Report == nil || job.Report.Updated != 1 {
+		t.Fatalf("job report = %+v, want the existing row updated", job.Report)
+	}
+
+	rec = api.do(httptest.NewRequest(http.MethodGet, "/api/v2/imports/unknown", nil), api.token)
+	expectProblem(t, rec, http.StatusNotFound, "import_job_not_found")
+
+	rec = api.do(uploadRequest(t, http.MethodPost, "/api/v2/products/import", nil, "file", "products.txt", csv), api.token)
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	rec = api.do(httptest.NewRequest(http.MethodGet, "/api/v2/products/export?columns=sku,name", nil), api.token)
+	expectStatus(t, rec, http.StatusOK)
+	if body := rec.Body.String(); body != "sku,name\nKMJ-1,Kemeja\n" {
+		t.Fatalf("export = %q, want the imported product", body)
+	}
+	if cd := rec.Header().Get(echo.HeaderContentDisposition); !strings.Contains(cd, "products.csv") {
+		t.Fatalf("Content-Disposition = %q, want products.csv", cd)
+	}
+
+	rec = api.do(httptest.NewRequest(http.MethodGet, "/api/v2/products/export?columns=nope", nil), api.token)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestIdempotentReplay(t *testing.T) {
+	api := newTestAPI(t)
+
+	create := func(body string) *httptest.ResponseRecorder {
+		req := withHeader(jsonRequest(http.MethodPost, "/api/v2/products", body), "Idempotency-Key", "create-kemeja")
+		return api.do(req, api.token)
+	}
+
+	first := create(`{"name":"Kemeja","brand_id":1}`)
+	expectStatus(t, first, http.StatusCreated)
+
+	replay := create(`{"name":"Kemeja","brand_id":1}`)
+	expectStatus(t, replay, http.StatusCreated)
+	if replay.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("headers = %v, want Idempotent-Replayed", replay.Header())
+	}
+	if replay.Body.String() != first.Body.String() || replay.Header().Get(echo.HeaderLocation) != first.Header().Get(echo.HeaderLocation) {
+		t.Fatalf("replay = %s, want the first response %s", replay.Body, first.Body)
+	}
+
+	expectProblem(t, create(`{"name":"Celana","brand_id":1}`), http.StatusUnprocessableEntity, "idempotency_key_reused")
+
+	rec := api.do(httptest.NewRequest(http.MethodGet, "/api/v2/products", nil), api.token)
+	var page rest.ProductPage
+	decode(t, rec, &page)
+	if len(page.Data) != 1 {
+		t.Fatalf("products = %+v, want one created", page.Data)
+	}
+}
@@ -0,0 +1,455 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"crud-product/constant"
+	"crud-product/model"
+	"github.com/labstack/echo/v4"
+)
+
+// productRequest is the JSON body of POST and PUT /api/v2/products.
+type productRequest struct {
+	Name    string `json:"name" validate:"required,notblank,max=255" maxLength:"255"`
+	Price   int    `json:"price" validate:"gte=0" minimum:"0"`
+	Stock   int    `json:"stock" validate:"gte=0" minimum:"0"`
+	BrandID int    `json:"brand_id" validate:"required,gt=0" minimum:"1"`
+	// SKU and ExternalID are only set on create; PUT keeps the stored ones.
+	SKU        string `json:"sku" validate:"omitempty,notblank,max=64" maxLength:"64"`
+	ExternalID string `json:"external_id" validate:"omitempty,notblank,max=64" maxLength:"64"`
+}
+
+func (r productRequest) product() model.Product {
+	return model.Product{
+		Name:       r.Name,
+		Price:      r.Price,
+		Stock:      r.Stock,
+		BrandID:    r.BrandID,
+		SKU:        r.SKU,
+		ExternalID: r.ExternalID,
+	}
+}
+
+// pageQuery is the paging query string of the v2 list endpoints. A zero limit
+// means constant.DefaultPageLimit.
+type pageQuery struct {
+	BrandID int `query:"brand_id" validate:"gte=0"`
+	Limit   int `query:"limit" validate:"gte=0,lte=500"`
+	Offset  int `query:"offset" validate:"gte=0"`
+}
+
+func (q pageQuery) filter() model.ProductFilter {
+	if q.Limit == 0 {
+		q.Limit = constant.DefaultPageLimit
+	}
+	return model.ProductFilter{BrandID: q.BrandID, Limit: q.Limit, Offset: q.Offset}
+}
+
+// ProductPage is one page of a v2 product listing.
+type ProductPage struct {
+	Data   []model.Product `json:"data"`
+	Limit  int             `json:"limit"`
+	Offset int             `json:"offset"`
+}
+
+func newHandlerV2(e *echo.Echo, handler *Handler, idempotent echo.MiddlewareFunc) {
+	v2 := e.Group("/api/v2", JwtVerify)
+
+	v2.GET("/products", handler.ListProductsV2)
+	v2.POST("/products", handler.CreateProductV2, idempotent)
+	v2.GET("/products/:id", handler.GetProductV2)
+	v2.PUT("/products/:id", handler.ReplaceProductV2, idempotent)
+	v2.PATCH("/products/:id", handler.PatchProductV2, idempotent)
+	v2.PUT("/products/:id/image", handler.ReplaceProductImageV2, idempotent)
+	v2.DELETE("/products/:id", handler.DeleteProductV2, idempotent)
+
+	v2.GET("/brands", handler.ListBrandsV2)
+	v2.GET("/brands/:id/products", handler.ListBrandProductsV2)
+
+	v2.PUT("/users/role", handler.SetUserRoleV2, idempotent)
+}
+
+// ListProductsV2 godoc
+// @Summary List Products.
+// @Description list active products ordered by ID. Requires an admin token.
+// @Tags Product v2
+// @Produce json
+// @Security AccessToken
+// @Param brand_id query int false "Only products of this brand"
+// @Param limit query int false "Page size" default(50) maximum(500)
+// @Param offset query int false "Products to skip" default(0)
+// @Success 200 {object} ProductPage
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Router /api/v2/products [get]
+func (h *Handler) ListProductsV2(c echo.Context) error {
+	if err := requireAdmin(c); err != nil {
+		return err
+	}
+
+	query := pageQuery{}
+	if err := c.Bind(&query); err != nil {
+		return err
+	}
+
+	filter := query.filter()
+	res, err := h.ProductUsecase.ListProducts(c.Request().Context(), filter)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, ProductPage{Data: res, Limit: filter.Limit, Offset: filter.Offset})
+}
+
+// CreateProductV2 godoc
+// @Summary Create Product.
+// @Description create a product. The Location header points at the new product. Requires an admin token.
+// @Tags Product v2
+// @Accept json
+// @Produce json
+// @Security AccessToken
+// @Param product body productRequest true "Product"
+// @Param Idempotency-Key header string false "Unique key that makes retries safe"
+// @Success 201 {object} model.Product
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 409 {object} Problem
+// @Failure 422 {object} Problem
+// @Router /api/v2/products [post]
+func (h *Handler) CreateProductV2(c echo.Context) error {
+	if err := requireAdmin(c); err != nil {
+		return err
+	}
+
+	req := productRequest{}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	res, err := h.ProductUsecase.SendProduct(c.Request().Context(), req.product())
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("/api/v2/products/%d", res.ID))
+	return writeProduct(c, http.StatusCreated, res)
+}
+
+// GetProductV2 godoc
+// @Summary Get Product.
+// @Description get a product by ID. Requires an admin token.
+// @Tags Product v2
+// @Produce json
+// @Security AccessToken
+// @Param id path int true "Product ID"
+// @Param If-None-Match header string false "ETag of a cached copy"
+// @Success 200 {object} model.Product
+// @Success 304
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Router /api/v2/products/{id} [get]
+func (h *Handler) GetProductV2(c echo.Context) error {
+	if err := requireAdmin(c); err != nil {
+		return err
+	}
+
+	productID, err := pathID(c)
+	if err != nil {
+		return err
+	}
+
+	res, err := h.ProductUsecase.GetProduct(c.Request().Context(), productID)
+	if err != nil {
+		return err
+	}
+
+	return writeProduct(c, http.StatusOK, res)
+}
+
+// ReplaceProductV2 godoc
+// @Summary Replace Product.
+// @Description replace every field of a product; the image is kept. Requires an admin token.
+// @Tags Product v2
+// @Accept json
+// @Produce json
+// @Security AccessToken
+// @Param id path int true "Product ID"
+// @Param If-Match header string true "ETag from GET"
+// @Param product body productRequest true "Product"
+// @Success 200 {object} model.Product
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 412 {object} Problem
+// @Failure 428 {object} Problem
+// @Router /api/v2/products/{id} [put]
+func (h *Handler) ReplaceProductV2(c echo.Context) error {
+	if err := requireAdmin(c); err != nil {
+		return err
+	}
+
+	productID, err := pathID(c)
+	if err != nil {
+		return err
+	}
+
+	version, err := ifMatch(c, true)
+	if err != nil {
+		return err
+	}
+
+	req := productRequest{}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	product := req.product()
+	product.Version = version
+
+	res, err := h.ProductUsecase.UpdateProduct(c.Request().Context(), product, productID)
+	if err != nil {
+		return err
+	}
+
+	return writeProduct(c, http.StatusOK, res)
+}
+
+// PatchProductV2 godoc
+// @Summary Patch Product.
+// @Description change only the members present in the JSON Merge Patch (RFC 7396). null is rejected since no field can be removed. Requires an admin token.
+// @Tags Product v2
+// @Accept application/merge-patch+json
+// @Accept json
+// @Produce json
+// @Security AccessToken
+// @Param id path int true "Product ID"
+// @Param If-Match header string true "ETag from GET"
+// @Param patch body model.ProductPatch true "Fields to change"
+// @Success 200 {object} model.Product
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 409 {object} Problem
+// @Failure 412 {object} Problem
+// @Failure 428 {object} Problem
+// @Router /api/v2/products/{id} [patch]
+func (h *Handler) PatchProductV2(c echo.Context) error {
+	if err := requireAdmin(c); err != nil {
+		return err
+	}
+
+	productID, err := pathID(c)
+	if err != nil {
+		return err
+	}
+
+	version, err := ifMatch(c, true)
+	if err != nil {
+		return err
+	}
+
+	if !isMergePatch(c, true) {
+		return echo.ErrUnsupportedMediaType
+	}
+
+	patch := model.ProductPatch{}
+	if err := bindMergePatch(c, &patch); err != nil {
+		return err
+	}
+	patch.Version = version
+
+	res, err := h.ProductUsecase.PatchProduct(c.Request().Context(), patch, productID)
+	if err != nil {
+		return err
+	}
+
+	return writeProduct(c, http.StatusOK, res)
+}
+
+// ReplaceProductImageV2 godoc
+// @Summary Replace Product Image.
+// @Description upload a new image for a product; other fields are unchanged. Requires an admin token.
+// @Tags Product v2
+// @Accept multipart/form-data
+// @Produce json
+// @Security AccessToken
+// @Param id path int true "Product ID"
+// @Param If-Match header string true "ETag from GET"
+// @Param fileImage formData file true "Product image"
+// @Success 200 {object} model.Product
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 412 {object} Problem
+// @Failure 428 {object} Problem
+// @Router /api/v2/products/{id}/image [put]
+func (h *Handler) ReplaceProductImageV2(c echo.Context) error {
+	if err := requireAdmin(c); err != nil {
+		return err
+	}
+
+	productID, err := pathID(c)
+	if err != nil {
+		return err
+	}
+
+	version, err := ifMatch(c, true)
+	if err != nil {
+		return err
+	}
+
+	path, err := h.saveImage(c, &model.Product{ID: productID})
+	if err != nil {
+		return err
+	}
+
+	res, err := h.ProductUsecase.PatchProduct(c.Request().Context(), model.ProductPatch{Path: &path, Version: version}, productID)
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	return writeProduct(c, http.StatusOK, res)
+}
+
+// DeleteProductV2 godoc
+// @Summary Delete Product.
+// @Description delete a product. Requires an admin token.
+// @Tags Product v2
+// @Security AccessToken
+// @Param id path int true "Product ID"
+// @Param If-Match header string true "ETag from GET"
+// @Success 204
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 412 {object} Problem
+// @Failure 428 {object} Problem
+// @Router /api/v2/products/{id} [delete]
+func (h *Handler) DeleteProductV2(c echo.Context) error {
+	if err := requireAdmin(c); err != nil {
+		return err
+	}
+
+	productID, err := pathID(c)
+	if err != nil {
+		return err
+	}
+
+	version, err := ifMatch(c, true)
+	if err != nil {
+		return err
+	}
+
+	if err := h.ProductUsecase.DeleteProduct(c.Request().Context(), productID, version); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ListBrandsV2 godoc
+// @Summary List Brands.
+// @Description list every brand.
+// @Tags Brand v2
+// @Produce json
+// @Security AccessToken
+// @Success 200 {array} model.Brand
+// @Failure 401 {object} Problem
+// @Router /api/v2/brands [get]
+func (h *Handler) ListBrandsV2(c echo.Context) error {
+	res, err := h.BrandUsecase.GetBrands(c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// ListBrandProductsV2 godoc
+// @Summary List Brand Products.
+// @Description list a brand's active products. Requires an admin token.
+// @Tags Brand v2
+// @Produce json
+// @Security AccessToken
+// @Param id path int true "Brand ID"
+// @Param limit query int false "Page size" default(50) maximum(500)
+// @Param offset query int false "Products to skip" default(0)
+// @Success 200 {object} ProductPage
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Router /api/v2/brands/{id}/products [get]
+func (h *Handler) ListBrandProductsV2(c echo.Context) error {
+	if err := requireAdmin(c); err != nil {
+		return err
+	}
+
+	brandID, err := pathID(c)
+	if err != nil {
+		return err
+	}
+
+	query := pageQuery{}
+	if err := c.Bind(&query); err != nil {
+		return err
+	}
+
+	filter := query.filter()
+	res, err := h.BrandUsecase.GetBrandProducts(c.Request().Context(), brandID, filter)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, ProductPage{Data: res, Limit: filter.Limit, Offset: filter.Offset})
+}
+
+// SetUserRoleV2 godoc
+// @Summary Set User Role.
+// @Description change the role of the user with the given email; 1 makes the user an admin. Registration always gives role 0, so this and the user-role command are the only ways to grant admin rights. The new role applies to tokens issued after the change. Requires an admin token.
+// @Tags User v2
+// @Accept json
+// @Security AccessToken
+// @Param role body model.RoleChange true "User and role"
+// @Param Idempotency-Key header string false "Unique key that makes retries safe"
+// @Success 204
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 422 {object} Problem
+// @Router /api/v2/users/role [put]
+func (h *Handler) SetUserRoleV2(c echo.Context) error {
+	if err := requireAdmin(c); err != nil {
+		return err
+	}
+
+	req := model.RoleChange{}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	if err := h.UserUsecase.SetUserRole(c.Request().Context(), req.Email, *req.Role); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// pathID reads the numeric :id path parameter.
+func pathID(c echo.Context) (int, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return 0, model.NewValidationError("invalid_parameter", "id must be an integer")
+	}
+	return id, nil
+}
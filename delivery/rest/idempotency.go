@@ -0,0 +1,214 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"crud-product/logger"
+	"crud-product/model"
+	"crud-product/repository"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	headerIdempotencyKey     = "Idempotency-Key"
+	headerIdempotentReplayed = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 200
+)
+
+// idempotentHeaders are the response headers stored and replayed with the
+// body.
+var idempotentHeaders = []string{echo.HeaderContentType, echo.HeaderLocation, headerETag}
+
+// Idempotency makes an unsafe route safe to retry when the client sends an
+// Idempotency-Key header. The first request with a key runs normally and its
+// response is kept for ttl; a retry with the same key and an identical request
+// gets that response again with Idempotent-Replayed: true. Reusing a key for a
+// different request is rejected with 422, and a retry that arrives while the
+// first request is still running gets 409. Keys are scoped to the signed-in
+// user, or to the client IP for anonymous requests, so one client cannot
+// replay another's response. Requests that fail or panic are not recorded,
+// so they can be retried. Bodies larger than maxBodySize are rejected with
+// 413.
+func Idempotency(repo repository.IdempotencyRepository, ttl time.Duration, maxBodySize int64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := strings.TrimSpace(c.Request().Header.Get(headerIdempotencyKey))
+			if key == "" {
+				return next(c)
+			}
+
+			if len(key) > maxIdempotencyKeyLength {
+				return model.NewValidationError("invalid_idempotency_key",
+					fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength))
+			}
+
+			fingerprint, err := requestFingerprint(c, maxBodySize)
+			if err != nil {
+				return err
+			}
+
+			scope := "ip:" + c.RealIP()
+			if user, ok := c.Get("user").(*model.Token); ok {
+				scope = fmt.Sprintf("user:%d", user.UserID)
+			}
+
+			ctx := c.Request().Context()
+			record := model.IdempotencyRecord{
+				Key:         scope + ":" + key,
+				Fingerprint: fingerprint,
+				ExpiresAt:   time.Now().Add(ttl),
+			}
+
+			existing, err := repo.Reserve(ctx, record)
+			if err != nil {
+				return err
+			}
+
+			if existing != nil {
+				switch {
+				case existing.Fingerprint != fingerprint:
+					return model.NewUnprocessableError("idempotency_key_reused", "Idempotency-Key was already used for a different request")
+				case !existing.Completed():
+					return model.NewConflictError("idempotency_key_in_progress", "a request with this Idempotency-Key is still being processed")
+				}
+				return replay(c, existing)
+			}
+
+			recorder := &bodyRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+
+			// A panicking handler must not leave the key reserved until it
+			// expires, answering every retry with 409.
+			defer func() {
+				if r := recover(); r != nil {
+					release(ctx, repo, record.Key)
+					panic(r)
+				}
+			}()
+
+			err = next(c)
+			if err != nil || c.Response().Status >= http.StatusInternalServerError {
+				release(ctx, repo, record.Key)
+				return err
+			}
+
+			record.Status = c.Response().Status
+			record.Body = recorder.body.Bytes()
+			record.Header = map[string]string{}
+			for _, name := range idempotentHeaders {
+				if value := c.Response().Header().Get(name); value != "" {
+					record.Header[name] = value
+				}
+			}
+
+			if err := repo.Complete(ctx, record); err != nil {
+				logger.FromContext(ctx).Warnf("store idempotent response: %v", err)
+			}
+			return nil
+		}
+	}
+}
+
+// release frees a reserved key so the request can be retried.
+func release(ctx context.Context, repo repository.IdempotencyRepository, key string) {
+	if err := repo.Release(ctx, key); err != nil {
+		logger.FromContext(ctx).Warnf("release idempotency key: %v", err)
+	}
+}
+
+// requestFingerprint hashes what makes two requests the same: method, path,
+// query and body. The body, at most maxBodySize bytes, is read and put back
+// for the handler.
+func requestFingerprint(c echo.Context, maxBodySize int64) (string, error) {
+	req := c.Request()
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Response().Writer, req.Body, maxBodySize))
+	if err != nil {
+		if errors.As(err, new(*http.MaxBytesError)) {
+			return "", echo.ErrStatusRequestEntityTooLarge
+		}
+		return "", err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n", req.Method, req.URL.Path, req.URL.RawQuery)
+
+	if parts, ok := multipartDigests(req.Header.Get(echo.HeaderContentType), body); ok {
+		for _, part := range parts {
+			fmt.Fprintln(h, part)
+		}
+	} else {
+		h.Write(body)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// multipartDigests describes a multipart/form-data body by its fields and
+// files, sorted, with a digest of each value. Unlike the raw body this does
+// not depend on the boundary, which clients pick at random for every attempt,
+// nor on the order of the parts. ok is false for other bodies and for
+// malformed ones, which are then fingerprinted as they are.
+func multipartDigests(contentType string, body []byte) (parts []string, ok bool) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != echo.MIMEMultipartForm || params["boundary"] == "" {
+		return nil, false
+	}
+
+	r := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false
+		}
+
+		digest := sha256.New()
+		if _, err := io.Copy(digest, part); err != nil {
+			return nil, false
+		}
+		parts = append(parts, fmt.Sprintf("%q %q %x", part.FormName(), part.FileName(), digest.Sum(nil)))
+	}
+
+	sort.Strings(parts)
+	return parts, true
+}
+
+func replay(c echo.Context, record *model.IdempotencyRecord) error {
+	header := c.Response().Header()
+	for name, value := range record.Header {
+		header.Set(name, value)
+	}
+	header.Set(headerIdempotentReplayed, "true")
+
+	c.Response().WriteHeader(record.Status)
+	_, err := c.Response().Write(record.Body)
+	return err
+}
+
+// bodyRecorder copies everything written to the response.
+type bodyRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *bodyRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
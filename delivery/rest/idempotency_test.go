@@ -0,0 +1,199 @@
+package rest
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"crud-product/repository"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+type formPart struct {
+	name, filename, value string
+}
+
+func multipartRequest(t *testing.T, parts ...formPart) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, p := range parts {
+		var err error
+		if p.filename != "" {
+			var fw io.Writer
+			fw, err = w.CreateFormFile(p.name, p.filename)
+			if err == nil {
+				_, err = io.WriteString(fw, p.value)
+			}
+		} else {
+			err = w.WriteField(p.name, p.value)
+		}
+		if err != nil {
+			t.Fatalf("write part %s: %v", p.name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close multipart writer: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/product", &body)
+	req.Header.Set(echo.HeaderContentType, w.FormDataContentType())
+	return req
+}
+
+func fingerprint(t *testing.T, req *http.Request, maxBodySize int64) (string, error) {
+	t.Helper()
+
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	return requestFingerprint(c, maxBodySize)
+}
+
+func TestRequestFingerprintMultipart(t *testing.T) {
+	image := formPart{name: "fileImage", filename: "kemeja.png", value: "png bytes"}
+	name := formPart{name: "name", value: "Kemeja"}
+
+	first, err := fingerprint(t, multipartRequest(t, name, image), 1<<20)
+	if err != nil {
+		t.Fatalf("fingerprint: %v", err)
+	}
+
+	tests := []struct {
+		desc  string
+		parts []formPart
+		same  bool
+	}{
+		{desc: "new boundary", parts: []formPart{name, image}, same: true},
+		{desc: "parts reordered", parts: []formPart{image, name}, same: true},
+		{desc: "field changed", parts: []formPart{{name: "name", value: "Celana"}, image}},
+		{desc: "file changed", parts: []formPart{name, {name: "fileImage", filename: "kemeja.png", value: "other bytes"}}},
+		{desc: "file renamed", parts: []formPart{name, {name: "fileImage", filename: "celana.png", value: "png bytes"}}},
+		{desc: "field missing", parts: []formPart{image}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			got, err := fingerprint(t, multipartRequest(t, tt.parts...), 1<<20)
+			if err != nil {
+				t.Fatalf("fingerprint: %v", err)
+			}
+			if (got == first) != tt.same {
+				t.Fatalf("fingerprint equal = %v, want %v", got == first, tt.same)
+			}
+		})
+	}
+}
+
+func TestRequestFingerprintKeepsBody(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(`{"email":"budi@example.com"}`))
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+
+	if _, err := requestFingerprint(c, 1<<20); err != nil {
+		t.Fatalf("fingerprint: %v", err)
+	}
+
+	var body bytes.Buffer
+	if _, err := body.ReadFrom(c.Request().Body); err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	if body.String() != `{"email":"budi@example.com"}` {
+		t.Fatalf("body after fingerprint = %q, want it unchanged", body.String())
+	}
+}
+
+func TestIdempotencyBodyLimit(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = ErrorHandler
+
+	calls := 0
+	e.POST("/register", func(c echo.Context) error {
+		calls++
+		return c.NoContent(http.StatusCreated)
+	}, Idempotency(repository.NewMemoryIdempotencyRepository(), time.Hour, 16))
+
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body))
+		req.Header.Set(headerIdempotencyKey, "k-"+body)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send(strings.Repeat("x", 17)); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status for a body over the limit = %d, want 413", rec.Code)
+	}
+	if rec := send(strings.Repeat("x", 16)); rec.Code != http.StatusCreated {
+		t.Fatalf("status for a body at the limit = %d, want 201", rec.Code)
+	}
+	if calls != 1 {
+		t.Fatalf("handler ran %d times, want once", calls)
+	}
+}
+
+func TestIdempotencyAnonymousScope(t *testing.T) {
+	e := echo.New()
+
+	calls := 0
+	e.POST("/register", func(c echo.Context) error {
+		calls++
+		return c.String(http.StatusCreated, c.RealIP())
+	}, Idempotency(repository.NewMemoryIdempotencyRepository(), time.Hour, 1024))
+
+	send := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(`{}`))
+		req.RemoteAddr = ip + ":5000"
+		req.Header.Set(headerIdempotencyKey, "k-1")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	send("10.0.0.1")
+	if rec := send("10.0.0.1"); rec.Header().Get(headerIdempotentReplayed) != "true" {
+		t.Fatalf("retry from the same client was not replayed")
+	}
+
+	// Another anonymous client guessing the key does not get the response.
+	rec := send("10.0.0.2")
+	if rec.Header().Get(headerIdempotentReplayed) != "" || rec.Body.String() != "10.0.0.2" {
+		t.Fatalf("another client got %q replayed=%q, want its own response", rec.Body, rec.Header().Get(headerIdempotentReplayed))
+	}
+	if calls != 2 {
+		t.Fatalf("handler ran %d times, want once per client", calls)
+	}
+}
+
+func TestIdempotencyPanicReleases(t *testing.T) {
+	e := echo.New()
+	e.Use(middleware.Recover())
+
+	calls := 0
+	e.POST("/product", func(c echo.Context) error {
+		calls++
+		if calls == 1 {
+			panic("boom")
+		}
+		return c.NoContent(http.StatusCreated)
+	}, Idempotency(repository.NewMemoryIdempotencyRepository(), time.Hour, 1024))
+
+	send := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/product", strings.NewReader(`{}`))
+		req.Header.Set(headerIdempotencyKey, "k-1")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := send(); code != http.StatusInternalServerError {
+		t.Fatalf("status of the panicking request = %d, want 500", code)
+	}
+	if code := send(); code != http.StatusCreated {
+		t.Fatalf("status of the retry = %d, want 201 rather than the key left reserved", code)
+	}
+}
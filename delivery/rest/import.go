@@ -0,0 +1,139 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"crud-product/model"
+	"crud-product/tabular"
+	"crud-product/usecase"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+type ImportHandler struct {
+	ImportUsecase usecase.ImportUsecase
+	Config        model.ImportConfig
+}
+
+// importQuery is the query string of POST /api/v2/products/import.
+type importQuery struct {
+	Key    string `query:"key" validate:"omitempty,oneof=sku external_id"`
+	DryRun bool   `query:"dry_run"`
+	Async  bool   `query:"async"`
+}
+
+// NewImportHandler registers the bulk import routes. Uploads larger than
+// cfg.MaxFileSize are rejected with 413.
+func NewImportHandler(e *echo.Echo, importUsecase usecase.ImportUsecase, cfg model.ImportConfig, idempotent echo.MiddlewareFunc) {
+	handler := &ImportHandler{
+		ImportUsecase: importUsecase,
+		Config:        cfg,
+	}
+
+	v2 := e.Group("/api/v2", JwtVerify)
+
+	v2.POST("/products/import", handler.ImportProducts, middleware.BodyLimit(strconv.FormatInt(cfg.MaxFileSize, 10)+"B"), idempotent)
+	v2.GET("/imports/:id", handler.GetImportJob)
+}
+
+// ImportProducts godoc
+// @Summary Import Products.
+// @Description create and update products from a CSV or XLSX file. The first row names the columns: name, price, stock and brand_id, plus sku and external_id. Rows are matched to existing products by key and every row is reported as created, updated or failed. Large files, or any file with async, are imported in the background: the response is then 202 with the job, which the Location header points at, or 429 while too many imports are waiting. Requires an admin token.
+// @Tags Import
+// @Accept multipart/form-data
+// @Produce json
+// @Security AccessToken
+// @Param file formData file true "CSV or XLSX file"
+// @Param key query string false "Column that matches rows to products" Enums(sku, external_id) default(sku)
+// @Param dry_run query bool false "Check every row without saving any"
+// @Param async query bool false "Import in the background regardless of size"
+// @Param Idempotency-Key header string false "Unique key that makes retries safe"
+// @Success 200 {object} model.ImportReport
+// @Success 202 {object} model.ImportJob
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 413 {object} Problem
+// @Failure 429 {object} Problem
+// @Router /api/v2/products/import [post]
+func (h *ImportHandler) ImportProducts(c echo.Context) error {
+	if err := requireAdmin(c); err != nil {
+		return err
+	}
+
+	query := importQuery{}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, &query); err != nil {
+		return model.NewValidationError("invalid_request", "invalid query string")
+	}
+	if err := c.Validate(query); err != nil {
+		return err
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return model.NewValidationError("missing_file", "file is required")
+	}
+
+	format, err := tabular.FormatOf(fileHeader.Filename)
+	if err != nil {
+		return err
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rows, err := tabular.ReadProducts(file, format, c.Echo().Validator)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+	opts := model.ImportOptions{Key: query.Key, DryRun: query.DryRun}
+
+	if query.Async || len(rows) >= h.Config.AsyncRows {
+		job, err := h.ImportUsecase.StartImport(ctx, rows, opts)
+		if err != nil {
+			return err
+		}
+
+		c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("/api/v2/imports/%s", job.ID))
+		return c.JSON(http.StatusAccepted, job)
+	}
+
+	report, err := h.ImportUsecase.Import(ctx, rows, opts)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// GetImportJob godoc
+// @Summary Get Import Job.
+// @Description get the status of a background import, with the report once it has succeeded. Jobs are kept for an hour by default after they last changed. Requires an admin token.
+// @Tags Import
+// @Produce json
+// @Security AccessToken
+// @Param id path string true "Job ID"
+// @Success 200 {object} model.ImportJob
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Router /api/v2/imports/{id} [get]
+func (h *ImportHandler) GetImportJob(c echo.Context) error {
+	if err := requireAdmin(c); err != nil {
+		return err
+	}
+
+	job, err := h.ImportUsecase.GetImportJob(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, job)
+}
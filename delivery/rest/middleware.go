@@ -1,18 +1,29 @@
 package rest
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"reflect"
+	"strconv"
 	"strings"
+	"time"
 
+	"crud-product/constant"
+	"crud-product/delivery/auth"
+	"crud-product/logger"
+	"crud-product/metrics"
 	"crud-product/model"
-	jwt "github.com/dgrijalva/jwt-go"
+	"crud-product/repository"
+	"crud-product/tracing"
 	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
 )
 
-type Exception struct {
-	Message string `json:"message"`
-}
-
 func JwtVerify(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 
@@ -21,26 +32,190 @@ func JwtVerify(next echo.HandlerFunc) echo.HandlerFunc {
 		header = strings.TrimSpace(header)
 
 		if header == "" {
-			// Token is missing, returns with error code 403 Unauthorized
-			return c.JSON(http.StatusForbidden, Exception{
-				Message: "Missing auth token"},
-			)
+			// Token is missing, returns with error code 401 Unauthorized
+			return model.NewUnauthorizedError("missing_token", "Missing auth token")
 		}
 
-		tk := &model.Token{}
-
-		_, err := jwt.ParseWithClaims(header, tk, func(token *jwt.Token) (interface{}, error) {
-			return []byte("secret"), nil
-		})
+		_, span := tracing.Start(c.Request().Context(), "JwtVerify")
+		tk, err := auth.ParseToken(header)
+		span.End()
 
 		if err != nil {
-			return c.JSON(http.StatusForbidden, Exception{
-				Message: err.Error()},
-			)
+			return model.NewUnauthorizedError("invalid_token", err.Error())
 		}
 
 		c.Set("user", tk)
 
+		req := c.Request()
+		c.SetRequest(req.WithContext(logger.WithFields(req.Context(), log.Fields{"user_id": tk.UserID})))
+
+		return next(c)
+	}
+}
+
+// AdminOnly lets only administrators through. It runs after JwtVerify.
+func AdminOnly(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if err := requireAdmin(c); err != nil {
+			return err
+		}
 		return next(c)
 	}
-}
\ No newline at end of file
+}
+
+// ReadYourWrites scopes repository reads to the request, so that once the
+// request has written, its later reads skip the read replicas.
+func ReadYourWrites(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		c.SetRequest(req.WithContext(repository.WithSession(req.Context())))
+
+		return next(c)
+	}
+}
+
+// Deprecated marks a legacy route with the Deprecation and Sunset headers and
+// a Link to the route that replaces it. The headers are set before the handler
+// runs so error responses carry them too.
+func Deprecated(successor string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Response().Header()
+			header.Set("Deprecation", "true")
+			header.Set("Sunset", constant.V1Sunset)
+			header.Set("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor))
+
+			return next(c)
+		}
+	}
+}
+
+// Tracing continues the trace named by the W3C traceparent header, or starts a
+// new one, with a server span per request named after its route template. The
+// trace ID is added to the request logger so log lines can be matched to
+// traces. Errors are left to AccessLog to handle.
+func Tracing(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		route := routeTemplate(c)
+
+		ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		ctx, span := tracing.StartServer(ctx, req.Method+" "+route,
+			semconv.HTTPMethodKey.String(req.Method),
+			semconv.HTTPRouteKey.String(route),
+			semconv.HTTPTargetKey.String(req.URL.RequestURI()),
+		)
+		defer span.End()
+
+		if sc := span.SpanContext(); sc.IsValid() {
+			ctx = logger.WithFields(ctx, log.Fields{"trace_id": sc.TraceID().String()})
+		}
+		c.SetRequest(req.WithContext(ctx))
+
+		err := next(c)
+
+		status := responseStatus(c, err)
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		return err
+	}
+}
+
+// AccessLog puts a logger carrying the request ID, method and route template
+// into the request context, for the usecases and repositories to log with, and
+// writes one access log line per request. It must run after
+// middleware.RequestID, which assigns or propagates X-Request-ID, and before
+// Tracing and Metrics: it hands errors to the error handler, once, so the
+// status and size it logs are those sent.
+func AccessLog(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		req := c.Request()
+		res := c.Response()
+
+		ctx := logger.WithFields(req.Context(), log.Fields{
+			"request_id": res.Header().Get(echo.HeaderXRequestID),
+			"method":     req.Method,
+			"route":      routeTemplate(c),
+		})
+		c.SetRequest(req.WithContext(ctx))
+
+		err := next(c)
+
+		var aborted *abortError
+		if errors.As(err, &aborted) {
+			// Aborting unwinds the stack, so the request is logged first.
+			defer c.Error(err)
+		} else if err != nil {
+			c.Error(err)
+		}
+
+		status := responseStatus(c, err)
+		entry := logger.FromContext(c.Request().Context()).WithFields(log.Fields{
+			"path":       req.URL.Path,
+			"status":     status,
+			"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"bytes_in":   req.ContentLength,
+			"bytes_out":  res.Size,
+			"remote_ip":  c.RealIP(),
+		})
+
+		if aborted != nil {
+			entry = entry.WithError(aborted.err)
+		}
+
+		switch {
+		case status >= http.StatusInternalServerError:
+			entry.Error("request")
+		case status >= http.StatusBadRequest:
+			entry.Warn("request")
+		default:
+			entry.Info("request")
+		}
+		return nil
+	}
+}
+
+// Metrics counts requests and observes their latency by route template.
+// Errors are left to AccessLog to handle; their status is the one the error
+// handler will send.
+func Metrics(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+
+		err := next(c)
+
+		route := routeTemplate(c)
+		method := c.Request().Method
+		metrics.HTTPRequests.WithLabelValues(method, route, strconv.Itoa(responseStatus(c, err))).Inc()
+		metrics.HTTPDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// routeTemplate returns the template of the matched route, e.g.
+// "/api/v2/products/:id". Echo reports the raw path for requests that match no
+// route; those share "unmatched" so scanners cannot blow up metric labels.
+func routeTemplate(c echo.Context) string {
+	path := c.Path()
+	if path == "" || reflect.ValueOf(c.Handler()).Pointer() == reflect.ValueOf(echo.NotFoundHandler).Pointer() {
+		return "unmatched"
+	}
+	return path
+}
+
+// responseStatus is the status of the response once err, if any, has been
+// handled by ErrorHandler. A response broken off midway counts as a server
+// error, whatever status line went out before.
+func responseStatus(c echo.Context, err error) int {
+	var aborted *abortError
+	if errors.As(err, &aborted) {
+		return http.StatusInternalServerError
+	}
+	if err == nil || c.Response().Committed {
+		return c.Response().Status
+	}
+	return toProblem(err).Status
+}
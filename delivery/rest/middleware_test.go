@@ -0,0 +1,221 @@
+package rest_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"crud-product/delivery/rest"
+	"crud-product/metrics"
+	"crud-product/model"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newObserved stacks the observability middleware the way the server does
+// over a route that succeeds, fails with a domain error or fails outright
+// depending on its id. handled counts the calls of the error handler.
+func newObserved(handled *int) *echo.Echo {
+	e := echo.New()
+	e.HTTPErrorHandler = func(err error, c echo.Context) {
+		*handled++
+		rest.ErrorHandler(err, c)
+	}
+	e.Use(middleware.RequestID())
+	e.Use(rest.AccessLog)
+	e.Use(rest.Tracing)
+	e.Use(rest.Metrics)
+
+	e.GET("/observed/:id", func(c echo.Context) error {
+		switch c.Param("id") {
+		case "missing":
+			return model.NewNotFoundError("product_not_found", "product not found")
+		case "broken":
+			return errors.New("dial tcp: connection refused")
+		}
+		return c.String(http.StatusOK, "ok")
+	})
+	return e
+}
+
+func TestAccessLog(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	out, level := log.StandardLogger().Out, log.GetLevel()
+	log.SetOutput(io.Discard)
+	log.SetLevel(log.DebugLevel)
+	defer func() {
+		log.SetOutput(out)
+		log.SetLevel(level)
+	}()
+
+	var handled int
+	e := newObserved(&handled)
+
+	tests := []struct {
+		target string
+		status int
+		level  log.Level
+		route  string
+	}{
+		{"/observed/1", http.StatusOK, log.InfoLevel, "/observed/:id"},
+		{"/observed/missing", http.StatusNotFound, log.WarnLevel, "/observed/:id"},
+		{"/observed/broken", http.StatusInternalServerError, log.ErrorLevel, "/observed/:id"},
+		{"/nowhere/1", http.StatusNotFound, log.WarnLevel, "unmatched"},
+	}
+
+	for _, tt := range tests {
+		hook.Reset()
+		handled = 0
+
+		req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		req.Header.Set(echo.HeaderXRequestID, "req-1")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		expectStatus(t, rec, tt.status)
+
+		if tt.status != http.StatusOK && handled != 1 {
+			t.Fatalf("%s: error handler ran %d times, want once", tt.target, handled)
+		}
+
+		var line *log.Entry
+		for _, entry := range hook.AllEntries() {
+			if entry.Message == "request" {
+				if line != nil {
+					t.Fatalf("%s: more than one access log line", tt.target)
+				}
+				line = entry
+			}
+		}
+		if line == nil {
+			t.Fatalf("%s: no access log line", tt.target)
+		}
+
+		if line.Level != tt.level || line.Data["status"] != tt.status || line.Data["route"] != tt.route ||
+			line.Data["request_id"] != "req-1" || line.Data["path"] != req.URL.Path {
+			t.Fatalf("%s: access log = %s %v, want %s with status %d on %s", tt.target, line.Level, line.Data, tt.level, tt.status, tt.route)
+		}
+		// The size logged is that of the body sent, error bodies included.
+		if line.Data["bytes_out"] != int64(rec.Body.Len()) {
+			t.Fatalf("%s: bytes_out = %v, want %d", tt.target, line.Data["bytes_out"], rec.Body.Len())
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	var handled int
+	e := newObserved(&handled)
+
+	count := func(route, status string) float64 {
+		return testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, route, status))
+	}
+	before := map[string]float64{
+		"200":       count("/observed/:id", "200"),
+		"404":       count("/observed/:id", "404"),
+		"500":       count("/observed/:id", "500"),
+		"unmatched": count("unmatched", "404"),
+	}
+
+	for _, target := range []string{"/observed/1", "/observed/2", "/observed/missing", "/observed/broken", "/scan/a", "/scan/b"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	// Requests are counted by route template with the status sent, error
+	// statuses included, and every unmatched path shares one label.
+	for status, want := range map[string]float64{"200": 2, "404": 1, "500": 1} {
+		if got := count("/observed/:id", status) - before[status]; got != want {
+			t.Fatalf("requests with status %s = %v, want %v", status, got, want)
+		}
+	}
+	if got := count("unmatched", "404") - before["unmatched"]; got != 2 {
+		t.Fatalf("unmatched requests = %v, want 2", got)
+	}
+	if n := testutil.CollectAndCount(metrics.HTTPDuration); n == 0 {
+		t.Fatal("no request latency observed")
+	}
+	if handled != 4 {
+		t.Fatalf("error handler ran %d times, want once per failed request", handled)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	}()
+
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	out := log.StandardLogger().Out
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(out)
+
+	var handled int
+	e := newObserved(&handled)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	for _, target := range []string{"/observed/1", "/observed/missing", "/observed/broken"} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+		e.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("ended %d spans, want one per request", len(spans))
+	}
+
+	// Server spans continue the caller's trace, are named after the route
+	// template and fail only on server errors.
+	for i, want := range []struct {
+		status int
+		code   codes.Code
+	}{{http.StatusOK, codes.Unset}, {http.StatusNotFound, codes.Unset}, {http.StatusInternalServerError, codes.Error}} {
+		span := spans[i]
+		if span.Name() != "GET /observed/:id" || span.SpanKind() != trace.SpanKindServer {
+			t.Fatalf("span %d = %s %s, want the server span GET /observed/:id", i, span.SpanKind(), span.Name())
+		}
+		if span.SpanContext().TraceID().String() != traceID || span.Parent().SpanID().String() != "00f067aa0ba902b7" {
+			t.Fatalf("span %d is not a child of the traceparent: %v", i, span.SpanContext())
+		}
+		if span.Status().Code != want.code {
+			t.Fatalf("span %d status = %v, want %v", i, span.Status().Code, want.code)
+		}
+
+		var status int64
+		for _, attr := range span.Attributes() {
+			if attr.Key == semconv.HTTPStatusCodeKey {
+				status = attr.Value.AsInt64()
+			}
+		}
+		if status != int64(want.status) {
+			t.Fatalf("span %d http.status_code = %d, want %d", i, status, want.status)
+		}
+	}
+
+	// Log lines written while serving the request carry the trace ID.
+	if len(hook.AllEntries()) == 0 {
+		t.Fatal("nothing logged")
+	}
+	for _, entry := range hook.AllEntries() {
+		if entry.Data["trace_id"] != traceID {
+			t.Fatalf("log line %q without the trace ID: %v", entry.Message, entry.Data)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi2"
+	"github.com/getkin/kin-openapi/openapi2conv"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/labstack/echo/v4"
+	"github.com/swaggo/swag"
+)
+
+// securityAccessToken is the scheme the annotations name with @Security.
+// Browsers can use the session cookie in its place.
+const (
+	securityAccessToken = "AccessToken"
+	securitySession     = "Session"
+)
+
+// OpenAPI builds the OpenAPI 3 description of the API from the Swagger 2.0
+// document generated by swag, so both come from the same annotations. Swag
+// cannot express a few things, which are filled in here: error responses are
+// application/problem+json, and every operation that takes a token also
+// accepts the session cookie.
+func OpenAPI(session string) (*openapi3.T, error) {
+	raw, err := swag.ReadDoc()
+	if err != nil {
+		return nil, err
+	}
+
+	var v2 openapi2.T
+	if err := json.Unmarshal([]byte(raw), &v2); err != nil {
+		return nil, err
+	}
+
+	doc, err := openapi2conv.ToV3(&v2)
+	if err != nil {
+		return nil, err
+	}
+
+	if doc.Components.SecuritySchemes == nil {
+		doc.Components.SecuritySchemes = openapi3.SecuritySchemes{}
+	}
+	doc.Components.SecuritySchemes[securitySession] = &openapi3.SecuritySchemeRef{
+		Value: openapi3.NewSecurityScheme().WithType("apiKey").WithIn("cookie").WithName(session).
+			WithDescription("Session cookie set by /login when cookie sessions are enabled. Unsafe requests also need X-CSRF-Token."),
+	}
+
+	for _, item := range doc.Paths {
+		for _, op := range item.Operations() {
+			if op.Security != nil {
+				for _, req := range *op.Security {
+					if _, ok := req[securityAccessToken]; ok {
+						op.Security.With(openapi3.NewSecurityRequirement().Authenticate(securitySession))
+						break
+					}
+				}
+			}
+
+			for status, res := range op.Responses {
+				code, err := strconv.Atoi(status)
+				if err != nil || code < http.StatusBadRequest || res.Value == nil {
+					continue
+				}
+				if media := res.Value.Content.Get(echo.MIMEApplicationJSON); media != nil {
+					res.Value.Content = openapi3.Content{mimeProblemJSON: media}
+				}
+			}
+		}
+	}
+
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+	return doc, nil
+}
+
+// ServeOpenAPI godoc
+// @Summary Get the OpenAPI 3 document.
+// @Description the OpenAPI 3 description of this API, generated from the same annotations as the Swagger UI.
+// @Tags root
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /openapi.json [get]
+func ServeOpenAPI(doc *openapi3.T) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, doc)
+	}
+}
+
+var routeParam = regexp.MustCompile(`:([A-Za-z0-9_]+)`)
+
+// UndocumentedRoutes lists the routes registered on e, as "METHOD /path", that
+// doc does not describe. Wildcard routes such as /swagger/* serve files, and
+// the not-found routes Echo adds for groups with middleware serve nothing, so
+// neither is expected to be documented.
+func UndocumentedRoutes(e *echo.Echo, doc *openapi3.T) []string {
+	notFound := runtime.FuncForPC(reflect.ValueOf(echo.NotFoundHandler).Pointer()).Name()
+
+	var missing []string
+	for _, r := range e.Routes() {
+		if strings.HasSuffix(r.Path, "*") || r.Name == notFound {
+			continue
+		}
+
+		path := routeParam.ReplaceAllString(r.Path, "{$1}")
+		if item := doc.Paths.Find(path); item == nil || item.GetOperation(r.Method) == nil {
+			missing = append(missing, r.Method+" "+r.Path)
+		}
+	}
+
+	sort.Strings(missing)
+	return missing
+}
@@ -0,0 +1,119 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"crud-product/model"
+	"github.com/labstack/echo/v4"
+)
+
+const mimeMergePatchJSON = "application/merge-patch+json"
+
+// isMergePatch reports whether the request body is a JSON Merge Patch. Plain
+// application/json is accepted as one too when allowJSON is set.
+func isMergePatch(c echo.Context, allowJSON bool) bool {
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	return mediaType == mimeMergePatchJSON || (allowJSON && mediaType == echo.MIMEApplicationJSON)
+}
+
+// bindMergePatch decodes an RFC 7396 JSON Merge Patch into dst, a struct of
+// pointer fields, and validates it. Absent members stay nil. null would remove
+// a member, which no product field allows, so it is rejected along with
+// members the struct does not know.
+func bindMergePatch(c echo.Context, dst interface{}) error {
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return err
+	}
+
+	members := map[string]json.RawMessage{}
+	if err := json.Unmarshal(body, &members); err != nil {
+		return model.NewValidationError("invalid_request", "merge patch must be a JSON object")
+	}
+
+	known := jsonFields(dst)
+	fields := []model.FieldError{}
+	for name, raw := range members {
+		switch {
+		case !known[name]:
+			fields = append(fields, model.FieldError{Field: name, Rule: "unknown", Message: fmt.Sprintf("%s is not a known field", name)})
+		case bytes.Equal(bytes.TrimSpace(raw), []byte("null")):
+			fields = append(fields, model.FieldError{Field: name, Rule: "nonnull", Message: fmt.Sprintf("%s cannot be removed", name)})
+		}
+	}
+
+	if len(fields) > 0 {
+		sort.Slice(fields, func(i, j int) bool {
+			return fields[i].Field < fields[j].Field
+		})
+
+		verr := model.NewValidationError("validation_failed", "request has invalid fields")
+		verr.Fields = fields
+		return verr
+	}
+
+	if err := json.Unmarshal(body, dst); err != nil {
+		return model.NewValidationError("invalid_request", "invalid data request")
+	}
+
+	if c.Echo().Validator == nil {
+		return nil
+	}
+	return c.Validate(dst)
+}
+
+func jsonFields(v interface{}) map[string]bool {
+	fields := map[string]bool{}
+
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}
+
+// bindFormPatch fills patch from the name, price and stock form fields that are
+// present in the request, so omitted fields keep their value.
+func bindFormPatch(c echo.Context, patch *model.ProductPatch) error {
+	form, err := c.FormParams()
+	if err != nil {
+		return model.NewValidationError("invalid_request", "invalid data request")
+	}
+
+	if v, ok := form["name"]; ok {
+		patch.Name = &v[0]
+	}
+
+	for name, dst := range map[string]**int{"price": &patch.Price, "stock": &patch.Stock} {
+		v, ok := form[name]
+		if !ok {
+			continue
+		}
+
+		n, err := strconv.Atoi(v[0])
+		if err != nil {
+			return model.NewValidationError("invalid_request", fmt.Sprintf("%s must be an integer", name))
+		}
+		*dst = &n
+	}
+
+	if c.Echo().Validator == nil {
+		return nil
+	}
+	return c.Validate(patch)
+}
@@ -0,0 +1,131 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"crud-product/constant"
+	"crud-product/delivery/auth"
+	"crud-product/logger"
+	"crud-product/model"
+	"crud-product/repository"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	headerAPIKey             = "X-API-Key"
+	headerRateLimitLimit     = "RateLimit-Limit"
+	headerRateLimitRemaining = "RateLimit-Remaining"
+	headerRateLimitReset     = "RateLimit-Reset"
+	headerRetryAfter         = "Retry-After"
+)
+
+// RateLimit applies the limits of cfg, see auth.Limiter. Clients are told
+// apart by their X-API-Key, then by the user of a valid token, then by IP
+// address. Responses carry RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset; rejected requests get 429 with Retry-After.
+//
+// Handlers can charge the client to another group as well with auth.Charge,
+// as GraphQL does for its login and register mutations. Such charges do not
+// count against API key quotas, which count HTTP requests.
+func RateLimit(store repository.RateLimitStore, cfg model.RateLimitConfig) echo.MiddlewareFunc {
+	limiter := auth.NewLimiter(store, cfg)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			client, apiKey, err := clientOf(c, cfg.APIKeys)
+			if err != nil {
+				return err
+			}
+
+			status, err := limiter.Allow(c.Request().Context(), routeGroup(routeTemplate(c)), client, apiKey)
+			setLimitHeaders(c, status, err)
+			if err != nil {
+				return err
+			}
+
+			req := c.Request()
+			c.SetRequest(req.WithContext(auth.WithCharge(req.Context(), func(ctx context.Context, group string) error {
+				status, err := limiter.Allow(ctx, group, client, nil)
+				if err != nil || closerToLimit(c, status) {
+					setLimitHeaders(c, status, err)
+				}
+				return err
+			})))
+
+			return next(c)
+		}
+	}
+}
+
+// setLimitHeaders reports status, with Retry-After when err rejected the
+// request.
+func setLimitHeaders(c echo.Context, status *auth.LimitStatus, err error) {
+	if status == nil {
+		return
+	}
+
+	header := c.Response().Header()
+	header.Set(headerRateLimitLimit, strconv.Itoa(status.Limit))
+	header.Set(headerRateLimitRemaining, strconv.Itoa(status.Remaining))
+	header.Set(headerRateLimitReset, strconv.Itoa(seconds(status.Reset)))
+	if err != nil {
+		header.Set(headerRetryAfter, strconv.Itoa(seconds(status.RetryAfter)))
+	}
+}
+
+// clientOf identifies the caller for rate limiting.
+func clientOf(c echo.Context, apiKeys map[string]model.APIKeyConfig) (string, *model.APIKeyConfig, error) {
+	if key := strings.TrimSpace(c.Request().Header.Get(headerAPIKey)); key != "" {
+		apiKey, err := auth.LookupAPIKey(key, apiKeys)
+		if err != nil {
+			return "", nil, err
+		}
+
+		req := c.Request()
+		c.SetRequest(req.WithContext(logger.WithFields(req.Context(), log.Fields{"api_key": apiKey.Name})))
+		return "key:" + apiKey.Name, apiKey, nil
+	}
+
+	if header := strings.TrimSpace(c.Request().Header.Get("x-access-token")); header != "" {
+		if tk, err := auth.ParseToken(header); err == nil {
+			return fmt.Sprintf("user:%d", tk.UserID), nil, nil
+		}
+	}
+
+	return "ip:" + c.RealIP(), nil, nil
+}
+
+// routeGroup returns the rate limit group of a route template. /graphql counts
+// as api; its resolvers charge login and register to auth themselves.
+func routeGroup(route string) string {
+	switch {
+	case route == "/login" || route == "/register":
+		return constant.RateLimitGroupAuth
+	case strings.HasPrefix(route, "/api/") || strings.HasPrefix(route, "/product") || route == "/graphql":
+		return constant.RateLimitGroupAPI
+	default:
+		return constant.RateLimitGroupDefault
+	}
+}
+
+// closerToLimit reports whether status has fewer requests left than the
+// policy the headers already report, which they should then report instead.
+func closerToLimit(c echo.Context, status *auth.LimitStatus) bool {
+	if status == nil {
+		return false
+	}
+
+	remaining, err := strconv.Atoi(c.Response().Header().Get(headerRateLimitRemaining))
+	return err != nil || status.Remaining < remaining
+}
+
+// seconds rounds d up to whole seconds, as the headers require.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
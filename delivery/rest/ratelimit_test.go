@@ -0,0 +1,164 @@
+package rest_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"crud-product/constant"
+	"crud-product/delivery/auth"
+	"crud-product/delivery/rest"
+	"crud-product/model"
+	"crud-product/repository"
+	"github.com/labstack/echo/v4"
+)
+
+// newRateLimited serves stub routes of each group behind RateLimit.
+func newRateLimited(cfg model.RateLimitConfig) *echo.Echo {
+	e := echo.New()
+	e.HTTPErrorHandler = rest.ErrorHandler
+	e.Use(rest.RateLimit(repository.NewMemoryRateLimit(), cfg))
+
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusNoContent) }
+	e.POST("/login", ok)
+	e.POST("/register", ok)
+	e.GET("/api/v2/products/:id", ok)
+	e.GET("/health", ok)
+	e.POST("/charged", func(c echo.Context) error {
+		if err := auth.Charge(c.Request().Context(), constant.RateLimitGroupAuth); err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusNoContent)
+	})
+	return e
+}
+
+func rateLimitConfig() model.RateLimitConfig {
+	return model.RateLimitConfig{
+		Groups: map[string]model.RateLimit{
+			constant.RateLimitGroupAuth: {Rate: 1, Period: model.Duration(time.Minute), Burst: 2},
+			constant.RateLimitGroupAPI:  {Rate: 1, Period: model.Duration(time.Second), Burst: 3},
+		},
+		APIKeys: map[string]model.APIKeyConfig{
+			"k-partner": {Name: "partner", DailyQuota: 100},
+		},
+	}
+}
+
+func serve(e *echo.Echo, method, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req.RemoteAddr = "10.0.0.1:5000"
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func expectLimitHeaders(t *testing.T, rec *httptest.ResponseRecorder, limit, remaining, reset string) {
+	t.Helper()
+
+	h := rec.Header()
+	if h.Get("RateLimit-Limit") != limit || h.Get("RateLimit-Remaining") != remaining || h.Get("RateLimit-Reset") != reset {
+		t.Fatalf("RateLimit headers = %s/%s/%s, want %s/%s/%s",
+			h.Get("RateLimit-Limit"), h.Get("RateLimit-Remaining"), h.Get("RateLimit-Reset"), limit, remaining, reset)
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	e := newRateLimited(rateLimitConfig())
+
+	for i, remaining := range []string{"2", "1", "0"} {
+		rec := serve(e, http.MethodGet, "/api/v2/products/1", nil)
+		expectStatus(t, rec, http.StatusNoContent)
+		expectLimitHeaders(t, rec, "3", remaining, strconv.Itoa(i+1))
+		if rec.Header().Get("Retry-After") != "" {
+			t.Fatalf("Retry-After sent with an allowed request")
+		}
+	}
+
+	rec := serve(e, http.MethodGet, "/api/v2/products/2", nil)
+	expectProblem(t, rec, http.StatusTooManyRequests, "rate_limited")
+	expectLimitHeaders(t, rec, "3", "0", "3")
+	if rec.Header().Get("Retry-After") != "1" {
+		t.Fatalf("Retry-After = %q, want 1", rec.Header().Get("Retry-After"))
+	}
+
+	// Routes outside the configured groups are not limited.
+	rec = serve(e, http.MethodGet, "/health", nil)
+	expectStatus(t, rec, http.StatusNoContent)
+	if rec.Header().Get("RateLimit-Limit") != "" {
+		t.Fatalf("RateLimit headers sent for an unlimited route: %v", rec.Header())
+	}
+}
+
+func TestRateLimitAuthGroup(t *testing.T) {
+	e := newRateLimited(rateLimitConfig())
+
+	// Login and register share the auth bucket, apart from the api one.
+	expectStatus(t, serve(e, http.MethodPost, "/login", nil), http.StatusNoContent)
+	rec := serve(e, http.MethodPost, "/register", nil)
+	expectStatus(t, rec, http.StatusNoContent)
+	expectLimitHeaders(t, rec, "2", "0", "120")
+
+	rec = serve(e, http.MethodPost, "/login", nil)
+	expectProblem(t, rec, http.StatusTooManyRequests, "rate_limited")
+	if rec.Header().Get("Retry-After") != "60" {
+		t.Fatalf("Retry-After = %q, want 60", rec.Header().Get("Retry-After"))
+	}
+
+	expectStatus(t, serve(e, http.MethodGet, "/api/v2/products/1", nil), http.StatusNoContent)
+
+	// Handlers charging the auth group are refused once it is used up, and
+	// report the bucket closest to its limit.
+	rec = serve(e, http.MethodPost, "/charged", nil)
+	expectProblem(t, rec, http.StatusTooManyRequests, "rate_limited")
+	expectLimitHeaders(t, rec, "2", "0", "120")
+}
+
+func TestRateLimitClients(t *testing.T) {
+	e := newRateLimited(rateLimitConfig())
+
+	for i := 0; i < 3; i++ {
+		serve(e, http.MethodGet, "/api/v2/products/1", nil)
+	}
+	expectProblem(t, serve(e, http.MethodGet, "/api/v2/products/1", nil), http.StatusTooManyRequests, "rate_limited")
+
+	// An API key has a bucket of its own.
+	key := http.Header{"X-Api-Key": {"k-partner"}}
+	rec := serve(e, http.MethodGet, "/api/v2/products/1", key)
+	expectStatus(t, rec, http.StatusNoContent)
+	expectLimitHeaders(t, rec, "3", "2", "1")
+
+	// So has a user, even one calling from the same address.
+	admin := newTestAPI(t)
+	user := http.Header{"X-Access-Token": {admin.token}}
+	expectStatus(t, serve(e, http.MethodGet, "/api/v2/products/1", user), http.StatusNoContent)
+
+	// Invented keys are refused rather than given a fresh bucket.
+	rec = serve(e, http.MethodGet, "/api/v2/products/1", http.Header{"X-Api-Key": {"k-invented"}})
+	expectProblem(t, rec, http.StatusUnauthorized, "invalid_api_key")
+}
+
+func TestRateLimitQuota(t *testing.T) {
+	cfg := rateLimitConfig()
+	cfg.APIKeys["k-trial"] = model.APIKeyConfig{Name: "trial", DailyQuota: 1}
+	e := newRateLimited(cfg)
+	key := http.Header{"X-Api-Key": {"k-trial"}}
+
+	rec := serve(e, http.MethodGet, "/api/v2/products/1", key)
+	expectStatus(t, rec, http.StatusNoContent)
+	if rec.Header().Get("RateLimit-Limit") != "1" || rec.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("RateLimit headers = %v, want the quota of 1 reported", rec.Header())
+	}
+
+	rec = serve(e, http.MethodGet, "/api/v2/products/1", key)
+	expectProblem(t, rec, http.StatusTooManyRequests, "quota_exceeded")
+	if rec.Header().Get("Retry-After") != rec.Header().Get("RateLimit-Reset") {
+		t.Fatalf("Retry-After = %q, want the quota reset %q", rec.Header().Get("Retry-After"), rec.Header().Get("RateLimit-Reset"))
+	}
+}
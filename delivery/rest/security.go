@@ -0,0 +1,104 @@
+package rest
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"crud-product/model"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// corsHeaders are the request headers browsers may send when the config does
+// not list its own.
+var corsHeaders = []string{
+	echo.HeaderContentType,
+	"x-access-token",
+	headerIfMatch,
+	headerIfNoneMatch,
+	headerIdempotencyKey,
+	headerAPIKey,
+	headerCSRFToken,
+	echo.HeaderXRequestID,
+	"traceparent",
+	"tracestate",
+}
+
+// corsMethods are the methods allowed when the config does not list its own.
+var corsMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+// corsExposed are the response headers scripts on other origins may read.
+var corsExposed = []string{
+	headerETag,
+	echo.HeaderLocation,
+	headerIdempotentReplayed,
+	headerRateLimitLimit,
+	headerRateLimitRemaining,
+	headerRateLimitReset,
+	headerRetryAfter,
+	echo.HeaderXRequestID,
+	"Deprecation",
+	"Sunset",
+	"Link",
+}
+
+// CORS lets browsers on the configured origins call the API, answering
+// preflight requests itself.
+func CORS(cfg model.CORSConfig) echo.MiddlewareFunc {
+	methods := cfg.AllowMethods
+	if len(methods) == 0 {
+		methods = corsMethods
+	}
+
+	headers := cfg.AllowHeaders
+	if len(headers) == 0 {
+		headers = corsHeaders
+	}
+
+	return middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins:     cfg.AllowOrigins,
+		AllowMethods:     methods,
+		AllowHeaders:     headers,
+		AllowCredentials: cfg.AllowCredentials,
+		ExposeHeaders:    corsExposed,
+		MaxAge:           int(time.Duration(cfg.MaxAge).Seconds()),
+	})
+}
+
+// SecurityHeaders sets HSTS on HTTPS requests, X-Content-Type-Options,
+// X-Frame-Options, Referrer-Policy and a Content-Security-Policy. The Swagger
+// UI gets its own, looser policy so its inline scripts and styles run.
+func SecurityHeaders(cfg model.SecurityConfig) echo.MiddlewareFunc {
+	secure := func(csp string) echo.MiddlewareFunc {
+		return middleware.SecureWithConfig(middleware.SecureConfig{
+			ContentTypeNosniff:    "nosniff",
+			XFrameOptions:         cfg.FrameOptions,
+			HSTSMaxAge:            int(time.Duration(*cfg.HSTSMaxAge).Seconds()),
+			HSTSExcludeSubdomains: !cfg.HSTSIncludeSubdomains,
+			HSTSPreloadEnabled:    cfg.HSTSPreload,
+			ContentSecurityPolicy: csp,
+			ReferrerPolicy:        cfg.ReferrerPolicy,
+		})
+	}
+	api := secure(cfg.CSP)
+	swagger := secure(cfg.SwaggerCSP)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		apiNext, swaggerNext := api(next), swagger(next)
+
+		return func(c echo.Context) error {
+			if strings.HasPrefix(c.Path(), "/swagger/") {
+				return swaggerNext(c)
+			}
+			return apiNext(c)
+		}
+	}
+}
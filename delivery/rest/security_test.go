@@ -0,0 +1,193 @@
+package rest_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"crud-product/config"
+	"crud-product/constant"
+	"crud-product/delivery/rest"
+	"crud-product/delivery/validate"
+	"crud-product/model"
+	"crud-product/repository"
+	"crud-product/usecase"
+	"github.com/labstack/echo/v4"
+)
+
+const testCSRFSecret = "test-csrf-secret-0123456789abcdef"
+
+// newSessionAPI serves the REST handlers with cookie sessions on and returns
+// the cookies and CSRF token of a logged in admin.
+func newSessionAPI(t *testing.T) (*echo.Echo, []*http.Cookie, string) {
+	t.Helper()
+
+	secure := false
+	cfg := model.SessionConfig{Cookie: true, CookieName: constant.DefaultSessionCookie, Secure: &secure, CSRFSecret: testCSRFSecret}
+
+	e := echo.New()
+	e.HTTPErrorHandler = rest.ErrorHandler
+	e.Validator = validate.New()
+	e.Binder = &rest.Binder{}
+	e.Use(rest.Sessions(cfg))
+
+	brands := repository.NewMemoryBrandRepository(model.Brand{ID: 1, Name: "Eiger"})
+	products := repository.NewMemoryProductRepository(brands)
+	users := repository.NewMemoryUserRepository()
+	rest.NewHandler(e,
+		usecase.NewProduct(products, repository.NewMemoryTransactor(products)),
+		usecase.NewBrand(brands, products),
+		usecase.NewUser(users),
+		rest.Idempotency(repository.NewMemoryIdempotencyRepository(), time.Hour, constant.DefaultIdempotencyMaxBodySize),
+		cfg, model.UploadConfig{Dir: t.TempDir()})
+
+	serveJSON := func(method, target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, jsonRequest(method, target, body))
+		return rec
+	}
+	expectStatus(t, serveJSON(http.MethodPost, "/register", `{"name":"Budi","email":"budi@example.com","password":"rahasia123"}`), http.StatusCreated)
+	if err := users.SetRole(context.Background(), "budi@example.com", model.RoleAdmin); err != nil {
+		t.Fatalf("promote admin: %v", err)
+	}
+	rec := serveJSON(http.MethodPost, "/login", `{"email":"budi@example.com","password":"rahasia123"}`)
+	expectStatus(t, rec, http.StatusOK)
+
+	var res struct {
+		CSRFToken string `json:"csrf_token"`
+	}
+	decode(t, rec, &res)
+	if res.CSRFToken == "" {
+		t.Fatalf("login returned no CSRF token: %s", rec.Body)
+	}
+	return e, rec.Result().Cookies(), res.CSRFToken
+}
+
+func TestSessionCSRF(t *testing.T) {
+	e, cookies, csrf := newSessionAPI(t)
+
+	var session string
+	for _, cookie := range cookies {
+		if cookie.Name == constant.DefaultSessionCookie {
+			session = cookie.Value
+		}
+	}
+
+	post := func(token string) *httptest.ResponseRecorder {
+		req := jsonRequest(http.MethodPost, "/api/v2/products", `{"name":"Tas","price":1000,"stock":1,"brand_id":1}`)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		if token != "" {
+			req.Header.Set("X-CSRF-Token", token)
+		}
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	expectProblem(t, post(""), http.StatusForbidden, "invalid_csrf_token")
+
+	// A token derived from the session alone, without the secret, is forged.
+	sum := sha256.Sum256([]byte("csrf:" + session))
+	expectProblem(t, post(hex.EncodeToString(sum[:])), http.StatusForbidden, "invalid_csrf_token")
+
+	// So is one keyed with another secret.
+	mac := hmac.New(sha256.New, []byte("another-csrf-secret-0123456789abcdef"))
+	mac.Write([]byte(session))
+	expectProblem(t, post(hex.EncodeToString(mac.Sum(nil))), http.StatusForbidden, "invalid_csrf_token")
+
+	expectStatus(t, post(csrf), http.StatusCreated)
+
+	// Safe methods need no token.
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/products", nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	expectStatus(t, rec, http.StatusOK)
+}
+
+func TestCORSPreflight(t *testing.T) {
+	e := echo.New()
+	e.Use(rest.CORS(model.CORSConfig{
+		AllowOrigins:     []string{"https://admin.example.com"},
+		AllowCredentials: true,
+		MaxAge:           model.Duration(time.Hour),
+	}))
+	e.DELETE("/api/v2/products/:id", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
+
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodOptions, "/api/v2/products/1", nil)
+		req.Header.Set(echo.HeaderOrigin, origin)
+		req.Header.Set(echo.HeaderAccessControlRequestMethod, http.MethodDelete)
+		req.Header.Set(echo.HeaderAccessControlRequestHeaders, "x-access-token, if-match")
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := preflight("https://admin.example.com")
+	expectStatus(t, rec, http.StatusNoContent)
+	h := rec.Header()
+	if h.Get(echo.HeaderAccessControlAllowOrigin) != "https://admin.example.com" ||
+		h.Get(echo.HeaderAccessControlAllowCredentials) != "true" ||
+		h.Get(echo.HeaderAccessControlMaxAge) != "3600" {
+		t.Fatalf("preflight headers = %v, want the origin allowed with credentials for an hour", h)
+	}
+	if h.Get(echo.HeaderAccessControlAllowMethods) == "" || h.Get(echo.HeaderAccessControlAllowHeaders) == "" {
+		t.Fatalf("preflight headers = %v, want the allowed methods and headers", h)
+	}
+
+	rec = preflight("https://evil.example.net")
+	if origin := rec.Header().Get(echo.HeaderAccessControlAllowOrigin); origin != "" {
+		t.Fatalf("Access-Control-Allow-Origin = %q for an origin not allowed", origin)
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	cfg, err := config.Parse([]byte(`{}`))
+	if err != nil {
+		t.Fatalf("parse config: %v", err)
+	}
+
+	e := echo.New()
+	e.Use(rest.SecurityHeaders(cfg.Security))
+	e.GET("/health", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
+
+	get := func(setup func(req *http.Request)) http.Header {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		setup(req)
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Header()
+	}
+
+	h := get(func(*http.Request) {})
+	if hsts := h.Get(echo.HeaderStrictTransportSecurity); hsts != "" {
+		t.Fatalf("Strict-Transport-Security = %q over plain HTTP", hsts)
+	}
+	if h.Get(echo.HeaderXContentTypeOptions) != "nosniff" || h.Get(echo.HeaderContentSecurityPolicy) == "" {
+		t.Fatalf("headers = %v, want nosniff and a Content-Security-Policy", h)
+	}
+
+	// HTTPS is seen directly or through a proxy's X-Forwarded-Proto.
+	for name, setup := range map[string]func(req *http.Request){
+		"tls":   func(req *http.Request) { req.TLS = &tls.ConnectionState{} },
+		"proxy": func(req *http.Request) { req.Header.Set(echo.HeaderXForwardedProto, "https") },
+	} {
+		if hsts := get(setup).Get(echo.HeaderStrictTransportSecurity); hsts == "" {
+			t.Fatalf("%s: no Strict-Transport-Security over HTTPS", name)
+		}
+	}
+}
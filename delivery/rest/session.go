@@ -0,0 +1,107 @@
+package rest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"crud-product/model"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	headerCSRFToken = "X-CSRF-Token"
+	csrfCookie      = "csrf_token"
+)
+
+// Sessions lets browsers authenticate with the session cookie set by /login
+// instead of the x-access-token header. Browsers send cookies with requests
+// other sites make too, so unsafe requests authenticated by the cookie must
+// carry the session's CSRF token in X-CSRF-Token. Requests that send
+// x-access-token themselves are left alone.
+func Sessions(cfg model.SessionConfig) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if strings.TrimSpace(req.Header.Get("x-access-token")) != "" {
+				return next(c)
+			}
+
+			session, err := req.Cookie(cfg.CookieName)
+			if err != nil || session.Value == "" {
+				return next(c)
+			}
+
+			switch req.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+			default:
+				token := req.Header.Get(headerCSRFToken)
+				if subtle.ConstantTimeCompare([]byte(token), []byte(csrfToken(cfg, session.Value))) != 1 {
+					return model.NewForbiddenError("invalid_csrf_token", "missing or invalid X-CSRF-Token header")
+				}
+			}
+
+			req.Header.Set("x-access-token", session.Value)
+			return next(c)
+		}
+	}
+}
+
+// csrfToken derives the CSRF token of a session. It is bound to the session,
+// so a token planted by another site, or by a sibling subdomain through a
+// cookie, does not match, and keyed with the server's secret, so seeing the
+// session token is not enough to forge it.
+func csrfToken(cfg model.SessionConfig, session string) string {
+	mac := hmac.New(sha256.New, []byte(cfg.CSRFSecret))
+	mac.Write([]byte(session))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// setSession stores token in the HttpOnly session cookie and its CSRF token in
+// a cookie scripts can read, and returns the CSRF token.
+func setSession(c echo.Context, cfg model.SessionConfig, token string) string {
+	csrf := csrfToken(cfg, token)
+	c.SetCookie(sessionCookie(cfg, cfg.CookieName, token, true))
+	c.SetCookie(sessionCookie(cfg, csrfCookie, csrf, false))
+	return csrf
+}
+
+// clearSession expires both session cookies.
+func clearSession(c echo.Context, cfg model.SessionConfig) {
+	c.SetCookie(sessionCookie(cfg, cfg.CookieName, "", true))
+	c.SetCookie(sessionCookie(cfg, csrfCookie, "", false))
+}
+
+func sessionCookie(cfg model.SessionConfig, name, value string, httpOnly bool) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: httpOnly,
+		Secure:   *cfg.Secure,
+		SameSite: sameSite(cfg.SameSite),
+	}
+
+	switch {
+	case value == "":
+		cookie.MaxAge = -1
+	case cfg.MaxAge > 0:
+		cookie.MaxAge = int(time.Duration(cfg.MaxAge).Seconds())
+	}
+	return cookie
+}
+
+func sameSite(mode string) http.SameSite {
+	switch strings.ToLower(mode) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
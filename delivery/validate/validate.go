@@ -0,0 +1,108 @@
+// Package validate checks request structs for every delivery: REST, gRPC,
+// GraphQL and the command line report invalid input the same way.
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"crud-product/model"
+	"github.com/go-playground/validator/v10"
+)
+
+// Validator checks request structs against their `validate` tags. Besides the
+// built-in rules it knows "notblank" (not only whitespace) and "password"
+// (at least 8 characters with a letter and a digit).
+type Validator struct {
+	validate *validator.Validate
+}
+
+func New() *Validator {
+	v := validator.New()
+
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		for _, tag := range []string{"json", "form", "param", "query"} {
+			name := strings.Split(field.Tag.Get(tag), ",")[0]
+			if name == "-" {
+				return ""
+			}
+			if name != "" {
+				return name
+			}
+		}
+		return field.Name
+	})
+
+	v.RegisterValidation("notblank", func(fl validator.FieldLevel) bool {
+		return strings.TrimSpace(fl.Field().String()) != ""
+	})
+
+	v.RegisterValidation("password", func(fl validator.FieldLevel) bool {
+		var letter, digit bool
+		password := fl.Field().String()
+		for _, r := range password {
+			letter = letter || unicode.IsLetter(r)
+			digit = digit || unicode.IsDigit(r)
+		}
+		return len([]rune(password)) >= 8 && letter && digit
+	})
+
+	return &Validator{validate: v}
+}
+
+// Validate implements echo.Validator. Failures are returned as a validation
+// error listing every invalid field.
+func (v *Validator) Validate(i interface{}) error {
+	err := v.validate.Struct(i)
+	if err == nil {
+		return nil
+	}
+
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		return err
+	}
+
+	fields := make([]model.FieldError, 0, len(invalid))
+	for _, fe := range invalid {
+		fields = append(fields, model.FieldError{
+			Field:   fe.Field(),
+			Rule:    fe.Tag(),
+			Message: fieldMessage(fe),
+		})
+	}
+
+	verr := model.NewValidationError("validation_failed", "request has invalid fields")
+	verr.Fields = fields
+	return verr
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", fe.Field())
+	case "notblank":
+		return fmt.Sprintf("%s must not be blank", fe.Field())
+	case "email":
+		return fmt.Sprintf("%s must be a valid email address", fe.Field())
+	case "password":
+		return fmt.Sprintf("%s must be at least 8 characters and contain a letter and a digit", fe.Field())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", fe.Field(), fe.Param())
+	case "gt":
+		return fmt.Sprintf("%s must be greater than %s", fe.Field(), fe.Param())
+	case "gte":
+		return fmt.Sprintf("%s must be at least %s", fe.Field(), fe.Param())
+	case "lte":
+		return fmt.Sprintf("%s must be at most %s", fe.Field(), fe.Param())
+	case "max":
+		return fmt.Sprintf("%s must be at most %s characters", fe.Field(), fe.Param())
+	case "min":
+		return fmt.Sprintf("%s must be at least %s characters", fe.Field(), fe.Param())
+	default:
+		return fmt.Sprintf("%s is invalid", fe.Field())
+	}
+}
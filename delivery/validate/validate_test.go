@@ -0,0 +1,47 @@
+package validate
+
+import (
+	"errors"
+	"testing"
+
+	"crud-product/model"
+)
+
+func TestValidate(t *testing.T) {
+	v := New()
+
+	valid := model.User{Name: "Budi", Email: "budi@example.com", Password: "rahasia123"}
+	if err := v.Validate(valid); err != nil {
+		t.Fatalf("Validate(%+v) = %v, want nil", valid, err)
+	}
+
+	tests := []struct {
+		desc  string
+		user  model.User
+		field string
+		rule  string
+	}{
+		{desc: "blank name", user: model.User{Name: "  ", Email: valid.Email, Password: valid.Password}, field: "name", rule: "notblank"},
+		{desc: "bad email", user: model.User{Name: "Budi", Email: "budi", Password: valid.Password}, field: "email", rule: "email"},
+		{desc: "short password", user: model.User{Name: "Budi", Email: valid.Email, Password: "rah4"}, field: "password", rule: "password"},
+		{desc: "password without digit", user: model.User{Name: "Budi", Email: valid.Email, Password: "rahasiaku"}, field: "password", rule: "password"},
+		{desc: "unknown gender", user: model.User{Name: "Budi", Email: valid.Email, Password: valid.Password, Gender: "x"}, field: "gender", rule: "oneof"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			err := v.Validate(tt.user)
+			if !errors.Is(err, model.ErrValidation) {
+				t.Fatalf("Validate = %v, want a validation error", err)
+			}
+
+			var verr *model.Error
+			if !errors.As(err, &verr) || len(verr.Fields) != 1 {
+				t.Fatalf("Validate = %#v, want one invalid field", err)
+			}
+			if got := verr.Fields[0]; got.Field != tt.field || got.Rule != tt.rule || got.Message == "" {
+				t.Fatalf("invalid field = %+v, want %s failing %s with a message", got, tt.field, tt.rule)
+			}
+		})
+	}
+}
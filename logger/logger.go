@@ -0,0 +1,68 @@
+// Package logger carries a request-scoped logrus entry in the context, so
+// every line logged while serving a request shares its request ID, route and
+// user.
+package logger
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"crud-product/constant"
+	"crud-product/model"
+	log "github.com/sirupsen/logrus"
+)
+
+type entryKey struct{}
+
+// Setup configures the standard logrus logger: JSON or text lines on stdout at
+// the configured level.
+func Setup(cfg model.LogConfig) error {
+	level, err := log.ParseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+
+	log.SetLevel(level)
+	log.SetOutput(os.Stdout)
+
+	if cfg.Format == constant.LogFormatText {
+		log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+	} else {
+		log.SetFormatter(&log.JSONFormatter{})
+	}
+	return nil
+}
+
+// FromContext returns the entry stored in ctx, or one on the standard logger.
+func FromContext(ctx context.Context) *log.Entry {
+	if ctx != nil {
+		if entry, ok := ctx.Value(entryKey{}).(*log.Entry); ok {
+			return entry
+		}
+	}
+	return log.NewEntry(log.StandardLogger())
+}
+
+// WithEntry returns a copy of ctx carrying entry.
+func WithEntry(ctx context.Context, entry *log.Entry) context.Context {
+	return context.WithValue(ctx, entryKey{}, entry)
+}
+
+// WithFields adds fields to the entry carried by ctx.
+func WithFields(ctx context.Context, fields log.Fields) context.Context {
+	return WithEntry(ctx, FromContext(ctx).WithFields(fields))
+}
+
+// Error logs err with the entry carried by ctx. Domain errors, such as a
+// product that does not exist or a request that fails validation, are the
+// client's to fix and are only logged at debug level; anything else is an
+// error of the service.
+func Error(ctx context.Context, err error) {
+	var domainErr *model.Error
+	if errors.As(err, &domainErr) && domainErr.Kind != nil {
+		FromContext(ctx).Debug(err)
+		return
+	}
+	FromContext(ctx).Error(err)
+}
@@ -0,0 +1,38 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"crud-product/model"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestError(t *testing.T) {
+	l, hook := test.NewNullLogger()
+	l.SetOutput(io.Discard)
+	l.SetLevel(log.DebugLevel)
+	ctx := WithEntry(context.Background(), log.NewEntry(l))
+
+	tests := []struct {
+		err   error
+		level log.Level
+	}{
+		{model.NewNotFoundError("product_not_found", "product not found"), log.DebugLevel},
+		{fmt.Errorf("update: %w", model.NewPreconditionFailedError("version_mismatch", "stale")), log.DebugLevel},
+		{errors.New("dial tcp: connection refused"), log.ErrorLevel},
+		{&model.Error{Code: "unknown", Message: "no kind"}, log.ErrorLevel},
+	}
+
+	for _, tt := range tests {
+		hook.Reset()
+		Error(ctx, tt.err)
+		if entry := hook.LastEntry(); entry == nil || entry.Level != tt.level {
+			t.Fatalf("Error(%v) logged %v, want level %s", tt.err, entry, tt.level)
+		}
+	}
+}
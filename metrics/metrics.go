@@ -0,0 +1,161 @@
+// Package metrics defines the Prometheus collectors of the service and the
+// registry they are served from at /metrics.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "crud_product"
+
+// Registry holds every collector below plus the Go runtime and process
+// collectors.
+var Registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route template and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route template.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	GRPCRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_requests_total",
+		Help:      "gRPC calls by full method name and status code.",
+	}, []string{"method", "code"})
+
+	GRPCDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "grpc_request_duration_seconds",
+		Help:      "gRPC call latency by full method name. Streams are timed until they end.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	QueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "repository_query_duration_seconds",
+		Help:      "Repository call latency by operation, e.g. product.fetch.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"operation"})
+
+	Uploads = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "image_uploads_total",
+		Help:      "Product images stored.",
+	})
+
+	UploadBytes = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "image_upload_bytes",
+		Help:      "Size of stored product images.",
+		Buckets:   prometheus.ExponentialBuckets(16*1024, 4, 8),
+	})
+
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Login attempts by result: success or failure.",
+	}, []string{"result"})
+
+	ImportedRows = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "imported_rows_total",
+		Help:      "Rows of product imports by status: created, updated or failed. Dry runs are not counted.",
+	}, []string{"status"})
+
+	ExportedRows = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "exported_rows_total",
+		Help:      "Products written by catalogue exports, by format: csv, xlsx or ndjson.",
+	}, []string{"format"})
+
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Requests rejected by rate limit group and reason: rate or quota.",
+	}, []string{"group", "reason"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		GRPCRequests,
+		GRPCDuration,
+		QueryDuration,
+		Uploads,
+		UploadBytes,
+		Logins,
+		ImportedRows,
+		ExportedRows,
+		RateLimited,
+	)
+}
+
+// RegisterDB exports the connection pool statistics of db, labeled with name,
+// e.g. "primary" or "replica-0".
+func RegisterDB(db *sql.DB, name string) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// ObserveQuery records the latency of a repository call that started at start.
+func ObserveQuery(operation string, start time.Time) {
+	QueryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// catalogue reports the number of active products per brand, computed when
+// Prometheus scrapes.
+type catalogue struct {
+	count   func(context.Context) (map[int]int, error)
+	desc    *prometheus.Desc
+	timeout time.Duration
+}
+
+// RegisterCatalogue exports the crud_product_active_products gauge using count,
+// which returns the number of active products per brand ID.
+func RegisterCatalogue(count func(context.Context) (map[int]int, error)) error {
+	return Registry.Register(&catalogue{
+		count:   count,
+		timeout: 5 * time.Second,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "active_products"),
+			"Active products per brand.",
+			[]string{"brand_id"}, nil,
+		),
+	})
+}
+
+func (c *catalogue) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *catalogue) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	counts, err := c.count(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+
+	for brandID, n := range counts {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n), strconv.Itoa(brandID))
+	}
+}
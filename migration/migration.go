@@ -0,0 +1,331 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed mysql/*.sql postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+const migrationTable = "schema_migrations"
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	DB         *sql.DB
+	Driver     string
+	Migrations []Migration
+}
+
+// NewMigrator loads the migrations embedded for the given driver, sorted by version.
+func NewMigrator(db *sql.DB, driver string) (*Migrator, error) {
+	migrations, err := load(driver)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		DB:         db,
+		Driver:     driver,
+		Migrations: migrations,
+	}, nil
+}
+
+func load(driver string) ([]Migration, error) {
+	dir, err := fs.Sub(files, driver)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := fs.ReadDir(dir, ".")
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for driver %q: %w", driver, err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(dir, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s is missing its up or down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Latest returns the highest known migration version, or 0 when there are none.
+func (m *Migrator) Latest() int {
+	if len(m.Migrations) == 0 {
+		return 0
+	}
+	return m.Migrations[len(m.Migrations)-1].Version
+}
+
+// Version returns the highest applied migration version, or 0 on a fresh database.
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	version := 0
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	return version, nil
+}
+
+// Up applies every pending migration.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.Latest())
+}
+
+// Down rolls back the most recently applied migration.
+func (m *Migrator) Down(ctx context.Context) error {
+	current, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	if current == 0 {
+		return nil
+	}
+
+	target := 0
+	for _, mig := range m.Migrations {
+		if mig.Version < current {
+			target = mig.Version
+		}
+	}
+
+	return m.To(ctx, target)
+}
+
+// To migrates up or down until the database is at the given version.
+func (m *Migrator) To(ctx context.Context, version int) error {
+	if version != 0 && m.find(version) == nil {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, mig := range m.Migrations {
+		if mig.Version > version {
+			break
+		}
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		if err := m.apply(ctx, mig, true); err != nil {
+			return err
+		}
+	}
+
+	for i := len(m.Migrations) - 1; i >= 0; i-- {
+		mig := m.Migrations[i]
+		if mig.Version <= version {
+			break
+		}
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		if err := m.apply(ctx, mig, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Status lists every known migration and whether it has been applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Status, 0, len(m.Migrations))
+	for _, mig := range m.Migrations {
+		appliedAt, ok := applied[mig.Version]
+		result = append(result, Status{
+			Version:   mig.Version,
+			Name:      mig.Name,
+			Applied:   ok,
+			AppliedAt: appliedAt,
+		})
+	}
+
+	return result, nil
+}
+
+func (m *Migrator) find(version int) *Migration {
+	for i := range m.Migrations {
+		if m.Migrations[i].Version == version {
+			return &m.Migrations[i]
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	query := `
+			CREATE TABLE IF NOT EXISTS ` + migrationTable + ` (
+				version    BIGINT NOT NULL PRIMARY KEY,
+				name       VARCHAR(255) NOT NULL,
+				applied_at TIMESTAMP NOT NULL
+			)`
+
+	_, err := m.DB.ExecContext(ctx, query)
+	return err
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]time.Time, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT version, applied_at FROM `+migrationTable)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := map[int]time.Time{}
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		result[version] = appliedAt
+	}
+
+	return result, rows.Err()
+}
+
+func (m *Migrator) apply(ctx context.Context, mig Migration, up bool) error {
+	script, direction := mig.Up, "up"
+	if !up {
+		script, direction = mig.Down, "down"
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range splitStatements(script) {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("migration %04d_%s %s: %w", mig.Version, mig.Name, direction, err)
+		}
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO `+migrationTable+` (version, name, applied_at) VALUES (`+m.placeholders(3)+`)`,
+			mig.Version, mig.Name, time.Now().UTC())
+	} else {
+		_, err = tx.ExecContext(ctx,
+			`DELETE FROM `+migrationTable+` WHERE version = `+m.placeholders(1),
+			mig.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *Migrator) placeholders(n int) string {
+	marks := make([]string, n)
+	for i := range marks {
+		if m.Driver == "postgres" {
+			marks[i] = "$" + strconv.Itoa(i+1)
+		} else {
+			marks[i] = "?"
+		}
+	}
+	return strings.Join(marks, ", ")
+}
+
+// splitStatements breaks a script into individual statements, since not every
+// driver accepts several statements in a single Exec.
+func splitStatements(script string) []string {
+	var statements []string
+	for _, part := range strings.Split(script, ";") {
+		var lines []string
+		for _, line := range strings.Split(part, "\n") {
+			if strings.HasPrefix(strings.TrimSpace(line), "--") {
+				continue
+			}
+			lines = append(lines, line)
+		}
+
+		stmt := strings.TrimSpace(strings.Join(lines, "\n"))
+		if stmt != "" {
+			statements = append(statements, stmt)
+		}
+	}
+	return statements
+}
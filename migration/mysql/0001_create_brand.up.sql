@@ -0,0 +1,5 @@
+CREATE TABLE brand (
+    brand_id INT NOT NULL AUTO_INCREMENT,
+    name     VARCHAR(255) NOT NULL,
+    PRIMARY KEY (brand_id)
+);
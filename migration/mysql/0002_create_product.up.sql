@@ -0,0 +1,12 @@
+CREATE TABLE product (
+    product_id  INT NOT NULL AUTO_INCREMENT,
+    name        VARCHAR(255) NOT NULL,
+    path        VARCHAR(255) NOT NULL DEFAULT '',
+    price       INT NOT NULL DEFAULT 0,
+    stock       INT NOT NULL DEFAULT 0,
+    brand_id    INT NOT NULL,
+    flag_active TINYINT(1) NOT NULL DEFAULT 1,
+    PRIMARY KEY (product_id),
+    KEY idx_product_brand_active (brand_id, flag_active),
+    CONSTRAINT fk_product_brand FOREIGN KEY (brand_id) REFERENCES brand (brand_id)
+);
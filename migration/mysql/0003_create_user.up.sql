@@ -0,0 +1,10 @@
+CREATE TABLE user (
+    user_id  INT NOT NULL AUTO_INCREMENT,
+    name     VARCHAR(255) NOT NULL,
+    email    VARCHAR(255) NOT NULL,
+    password VARCHAR(255) NOT NULL,
+    gender   VARCHAR(16) NOT NULL DEFAULT '',
+    role     INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id),
+    UNIQUE KEY uq_user_email (email)
+);
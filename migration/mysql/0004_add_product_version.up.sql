@@ -0,0 +1 @@
+ALTER TABLE product ADD COLUMN version INT NOT NULL DEFAULT 1;
@@ -0,0 +1,10 @@
+CREATE TABLE idempotency_key (
+    idempotency_key VARCHAR(255) NOT NULL,
+    fingerprint     CHAR(64) NOT NULL,
+    status          INT NOT NULL DEFAULT 0,
+    headers         TEXT NOT NULL,
+    body            MEDIUMBLOB NOT NULL,
+    expires_at      BIGINT NOT NULL,
+    PRIMARY KEY (idempotency_key),
+    KEY idx_idempotency_key_expires (expires_at)
+);
@@ -0,0 +1,5 @@
+ALTER TABLE product
+    DROP INDEX idx_product_external_id,
+    DROP INDEX idx_product_sku,
+    DROP COLUMN external_id,
+    DROP COLUMN sku;
@@ -0,0 +1,5 @@
+ALTER TABLE product
+    ADD COLUMN sku VARCHAR(64) NULL,
+    ADD COLUMN external_id VARCHAR(64) NULL,
+    ADD UNIQUE KEY idx_product_sku (sku),
+    ADD UNIQUE KEY idx_product_external_id (external_id);
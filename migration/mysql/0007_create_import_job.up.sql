@@ -0,0 +1,7 @@
+CREATE TABLE import_job (
+    id         VARCHAR(64) NOT NULL,
+    job        LONGTEXT NOT NULL,
+    expires_at BIGINT NOT NULL,
+    PRIMARY KEY (id),
+    KEY idx_import_job_expires (expires_at)
+);
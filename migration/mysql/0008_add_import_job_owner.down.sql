@@ -0,0 +1,3 @@
+ALTER TABLE import_job
+    DROP INDEX idx_import_job_owner,
+    DROP COLUMN owner;
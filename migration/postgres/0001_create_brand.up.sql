@@ -0,0 +1,4 @@
+CREATE TABLE brand (
+    brand_id SERIAL PRIMARY KEY,
+    name     VARCHAR(255) NOT NULL
+);
@@ -0,0 +1,11 @@
+CREATE TABLE product (
+    product_id  SERIAL PRIMARY KEY,
+    name        VARCHAR(255) NOT NULL,
+    path        VARCHAR(255) NOT NULL DEFAULT '',
+    price       INTEGER NOT NULL DEFAULT 0,
+    stock       INTEGER NOT NULL DEFAULT 0,
+    brand_id    INTEGER NOT NULL REFERENCES brand (brand_id),
+    flag_active SMALLINT NOT NULL DEFAULT 1
+);
+
+CREATE INDEX idx_product_brand_active ON product (brand_id, flag_active);
@@ -0,0 +1,8 @@
+CREATE TABLE "user" (
+    user_id  SERIAL PRIMARY KEY,
+    name     VARCHAR(255) NOT NULL,
+    email    VARCHAR(255) NOT NULL UNIQUE,
+    password VARCHAR(255) NOT NULL,
+    gender   VARCHAR(16) NOT NULL DEFAULT '',
+    role     INTEGER NOT NULL DEFAULT 0
+);
@@ -0,0 +1 @@
+ALTER TABLE product ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
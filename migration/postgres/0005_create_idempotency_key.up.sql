@@ -0,0 +1,10 @@
+CREATE TABLE idempotency_key (
+    idempotency_key VARCHAR(255) PRIMARY KEY,
+    fingerprint     CHAR(64) NOT NULL,
+    status          INTEGER NOT NULL DEFAULT 0,
+    headers         TEXT NOT NULL,
+    body            BYTEA NOT NULL,
+    expires_at      BIGINT NOT NULL
+);
+
+CREATE INDEX idx_idempotency_key_expires ON idempotency_key (expires_at);
@@ -0,0 +1,5 @@
+ALTER TABLE product ADD COLUMN sku VARCHAR(64);
+ALTER TABLE product ADD COLUMN external_id VARCHAR(64);
+
+CREATE UNIQUE INDEX idx_product_sku ON product (sku);
+CREATE UNIQUE INDEX idx_product_external_id ON product (external_id);
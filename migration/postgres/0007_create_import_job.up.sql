@@ -0,0 +1,7 @@
+CREATE TABLE import_job (
+    id         VARCHAR(64) PRIMARY KEY,
+    job        TEXT NOT NULL,
+    expires_at BIGINT NOT NULL
+);
+
+CREATE INDEX idx_import_job_expires ON import_job (expires_at);
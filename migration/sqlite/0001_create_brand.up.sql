@@ -0,0 +1,4 @@
+CREATE TABLE brand (
+    brand_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name     TEXT NOT NULL
+);
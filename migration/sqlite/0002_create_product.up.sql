@@ -0,0 +1,11 @@
+CREATE TABLE product (
+    product_id  INTEGER PRIMARY KEY AUTOINCREMENT,
+    name        TEXT NOT NULL,
+    path        TEXT NOT NULL DEFAULT '',
+    price       INTEGER NOT NULL DEFAULT 0,
+    stock       INTEGER NOT NULL DEFAULT 0,
+    brand_id    INTEGER NOT NULL REFERENCES brand (brand_id),
+    flag_active INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE INDEX idx_product_brand_active ON product (brand_id, flag_active);
@@ -0,0 +1,8 @@
+CREATE TABLE "user" (
+    user_id  INTEGER PRIMARY KEY AUTOINCREMENT,
+    name     TEXT NOT NULL,
+    email    TEXT NOT NULL UNIQUE,
+    password TEXT NOT NULL,
+    gender   TEXT NOT NULL DEFAULT '',
+    role     INTEGER NOT NULL DEFAULT 0
+);
@@ -0,0 +1,10 @@
+CREATE TABLE idempotency_key (
+    idempotency_key TEXT PRIMARY KEY,
+    fingerprint     TEXT NOT NULL,
+    status          INTEGER NOT NULL DEFAULT 0,
+    headers         TEXT NOT NULL,
+    body            BLOB NOT NULL,
+    expires_at      INTEGER NOT NULL
+);
+
+CREATE INDEX idx_idempotency_key_expires ON idempotency_key (expires_at);
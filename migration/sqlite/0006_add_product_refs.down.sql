@@ -0,0 +1,5 @@
+DROP INDEX idx_product_external_id;
+DROP INDEX idx_product_sku;
+
+ALTER TABLE product DROP COLUMN external_id;
+ALTER TABLE product DROP COLUMN sku;
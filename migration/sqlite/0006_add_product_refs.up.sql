@@ -0,0 +1,5 @@
+ALTER TABLE product ADD COLUMN sku TEXT;
+ALTER TABLE product ADD COLUMN external_id TEXT;
+
+CREATE UNIQUE INDEX idx_product_sku ON product (sku);
+CREATE UNIQUE INDEX idx_product_external_id ON product (external_id);
@@ -0,0 +1,7 @@
+CREATE TABLE import_job (
+    id         TEXT PRIMARY KEY,
+    job        TEXT NOT NULL,
+    expires_at INTEGER NOT NULL
+);
+
+CREATE INDEX idx_import_job_expires ON import_job (expires_at);
@@ -0,0 +1,3 @@
+DROP INDEX idx_import_job_owner;
+
+ALTER TABLE import_job DROP COLUMN owner;
@@ -0,0 +1,3 @@
+ALTER TABLE import_job ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX idx_import_job_owner ON import_job (owner);
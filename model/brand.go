@@ -3,4 +3,4 @@ package model
 type Brand struct {
 	ID   int    `json:"id"`
 	Name string `json:"name"`
-}
\ No newline at end of file
+}
@@ -1,14 +1,259 @@
 package model
 
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
 type Config struct {
-	Database DatabaseConfig `json:"database"`
+	Server      ServerConfig      `json:"server"`
+	Database    DatabaseConfig    `json:"database"`
+	Cache       CacheConfig       `json:"cache"`
+	Idempotency IdempotencyConfig `json:"idempotency"`
+	Log         LogConfig         `json:"log"`
+	Tracing     TracingConfig     `json:"tracing"`
+	RateLimit   RateLimitConfig   `json:"rate_limit"`
+	CORS        CORSConfig        `json:"cors"`
+	Security    SecurityConfig    `json:"security"`
+	Session     SessionConfig     `json:"session"`
+	GRPC        GRPCConfig        `json:"grpc"`
+	Upload      UploadConfig      `json:"upload"`
+	Import      ImportConfig      `json:"import"`
+	Export      ExportConfig      `json:"export"`
+}
+
+// ServerConfig controls the HTTP listeners.
+type ServerConfig struct {
+	// Addr is the address the API listens on.
+	Addr string `json:"addr"`
+	// InternalAddr, when set, serves /metrics and /stats/db on a listener of
+	// their own without authentication. Otherwise they are served on Addr to
+	// admins only.
+	InternalAddr string `json:"internal_addr"`
+
+	ReadHeaderTimeout Duration `json:"read_header_timeout"`
+	ReadTimeout       Duration `json:"read_timeout"`
+	// WriteTimeout is off by default, as exports stream for as long as the
+	// catalogue takes.
+	WriteTimeout Duration `json:"write_timeout"`
+	IdleTimeout  Duration `json:"idle_timeout"`
 }
 
 type DatabaseConfig struct {
+	// Driver selects the database backend: "mysql" (default), "postgres" or "sqlite".
+	Driver   string `json:"driver"`
 	Host     string `json:"host"`
 	Port     int    `json:"port"`
 	Name     string `json:"name"`
 	User     string `json:"user"`
 	Database string `json:"database"`
 	Password string `json:"password"`
-}
\ No newline at end of file
+	SSLMode  string `json:"ssl_mode"`
+
+	// Path is the database file used by the sqlite driver.
+	Path string `json:"path"`
+
+	// AutoMigrate applies pending schema migrations when the server starts.
+	// It is always on for sqlite.
+	AutoMigrate bool `json:"auto_migrate"`
+
+	MaxOpenConns    int      `json:"max_open_conns"`
+	MaxIdleConns    int      `json:"max_idle_conns"`
+	ConnMaxLifetime Duration `json:"conn_max_lifetime"`
+	ConnMaxIdleTime Duration `json:"conn_max_idle_time"`
+
+	// QueryTimeout is the deadline applied to every repository call.
+	// OperationTimeouts overrides it per operation, e.g. "product.fetch".
+	QueryTimeout      Duration            `json:"query_timeout"`
+	OperationTimeouts map[string]Duration `json:"operation_timeouts"`
+
+	// Replicas are connection strings, in the driver's own DSN format, of
+	// read replicas that serve product reads. They are pinged every
+	// ReplicaHealthInterval and skipped while unreachable.
+	Replicas              []string `json:"replicas"`
+	ReplicaHealthInterval Duration `json:"replica_health_interval"`
+}
+
+// CacheConfig controls the product read cache.
+type CacheConfig struct {
+	// Driver is "memory" for an in-process LRU, "redis", or empty to disable caching.
+	Driver string   `json:"driver"`
+	Size   int      `json:"size"`
+	TTL    Duration `json:"ttl"`
+
+	Redis RedisConfig `json:"redis"`
+}
+
+type RedisConfig struct {
+	Addr     string `json:"addr"`
+	Password string `json:"password"`
+	DB       int    `json:"db"`
+	Prefix   string `json:"prefix"`
+}
+
+// IdempotencyConfig controls how long responses to requests sent with an
+// Idempotency-Key are kept for replay.
+type IdempotencyConfig struct {
+	TTL Duration `json:"ttl"`
+	// MaxBodySize limits the body of requests sent with a key, in bytes,
+	// since it is read into memory to fingerprint the request.
+	MaxBodySize int64 `json:"max_body_size"`
+}
+
+// LogConfig controls application logging.
+type LogConfig struct {
+	// Level is a logrus level such as "debug", "info" or "warn".
+	Level string `json:"level"`
+	// Format is "json" (default) or "text".
+	Format string `json:"format"`
+}
+
+// TracingConfig controls OpenTelemetry tracing.
+type TracingConfig struct {
+	// Exporter is "otlp" (OTLP over HTTP), "stdout", or "none"/empty to
+	// disable recording.
+	Exporter string `json:"exporter"`
+	// Endpoint is the OTLP collector host:port; empty uses the
+	// OTEL_EXPORTER_OTLP_ENDPOINT environment variable or localhost:4318.
+	Endpoint string `json:"endpoint"`
+	Insecure bool   `json:"insecure"`
+
+	ServiceName string `json:"service_name"`
+	// SampleRatio is the fraction of new traces recorded, between 0 and 1.
+	SampleRatio float64 `json:"sample_ratio"`
+}
+
+// RateLimitConfig controls per-client rate limiting. Groups are keyed by route
+// group: "auth" for /login and /register, "api" for the product and brand
+// routes and "default" for everything else. A group without limits is not
+// limited.
+type RateLimitConfig struct {
+	// Driver is "memory" for limits per process, "redis" for limits shared by
+	// every replica, or empty to turn rate limiting off.
+	Driver  string                  `json:"driver"`
+	Redis   RedisConfig             `json:"redis"`
+	Groups  map[string]RateLimit    `json:"groups"`
+	APIKeys map[string]APIKeyConfig `json:"api_keys"`
+}
+
+// RateLimit is a token bucket: Rate tokens are added every Period, up to
+// Burst, and each request takes one.
+type RateLimit struct {
+	Rate   int      `json:"rate"`
+	Period Duration `json:"period"`
+	Burst  int      `json:"burst"`
+}
+
+// APIKeyConfig describes the integration behind an X-API-Key. Name identifies
+// it in rate limit buckets and logs; a zero DailyQuota means no quota.
+type APIKeyConfig struct {
+	Name       string `json:"name"`
+	DailyQuota int    `json:"daily_quota"`
+}
+
+// CORSConfig controls cross-origin access from browsers. CORS is off while
+// AllowOrigins is empty.
+type CORSConfig struct {
+	// AllowOrigins lists origins such as "https://admin.example.com";
+	// "https://*.example.com" matches subdomains.
+	AllowOrigins     []string `json:"allow_origins"`
+	AllowMethods     []string `json:"allow_methods"`
+	AllowHeaders     []string `json:"allow_headers"`
+	AllowCredentials bool     `json:"allow_credentials"`
+	MaxAge           Duration `json:"max_age"`
+}
+
+// SecurityConfig controls the security headers sent with every response.
+type SecurityConfig struct {
+	// HSTSMaxAge is sent in Strict-Transport-Security on HTTPS requests;
+	// "0s" turns HSTS off.
+	HSTSMaxAge            *Duration `json:"hsts_max_age"`
+	HSTSIncludeSubdomains bool      `json:"hsts_include_subdomains"`
+	HSTSPreload           bool      `json:"hsts_preload"`
+	FrameOptions          string    `json:"frame_options"`
+	ReferrerPolicy        string    `json:"referrer_policy"`
+	// CSP is the Content-Security-Policy of API responses and SwaggerCSP
+	// that of the Swagger UI, which needs inline scripts and styles.
+	CSP        string `json:"csp"`
+	SwaggerCSP string `json:"swagger_csp"`
+}
+
+// SessionConfig controls cookie sessions for browser clients. When Cookie is
+// set, /login also stores the token in an HttpOnly cookie and requests
+// authenticated by that cookie need a CSRF token.
+type SessionConfig struct {
+	Cookie     bool   `json:"cookie"`
+	CookieName string `json:"cookie_name"`
+	// Secure limits the cookies to HTTPS; turn it off only for local
+	// development over HTTP.
+	Secure *bool `json:"secure"`
+	// SameSite is "lax" (default), "strict" or "none".
+	SameSite string   `json:"same_site"`
+	MaxAge   Duration `json:"max_age"`
+	// CSRFSecret keys the CSRF tokens derived from sessions. It is required
+	// with Cookie and must be the same on every replica.
+	CSRFSecret string `json:"csrf_secret"`
+}
+
+// GRPCConfig controls the gRPC server that runs next to the REST API.
+type GRPCConfig struct {
+	// Addr is the address to listen on, e.g. ":9090". Empty disables gRPC.
+	Addr string `json:"addr"`
+	// Reflection registers server reflection, for tools like grpcurl.
+	Reflection bool `json:"reflection"`
+}
+
+// ImportConfig controls bulk product imports.
+type ImportConfig struct {
+	// ChunkSize is the number of rows written per transaction.
+	ChunkSize int `json:"chunk_size"`
+	// AsyncRows is the row count from which imports run as background jobs.
+	AsyncRows int `json:"async_rows"`
+	// MaxFileSize limits uploaded import files, in bytes.
+	MaxFileSize int64 `json:"max_file_size"`
+	// JobTTL is how long jobs can still be polled after they last changed.
+	JobTTL Duration `json:"job_ttl"`
+	// QueueSize is the number of background jobs a replica accepts at once,
+	// counting the one it is running.
+	QueueSize int `json:"queue_size"`
+	// Instance names this server in the jobs it runs, so that on start it can
+	// fail the ones it left unfinished. It defaults to the host name and must
+	// differ between replicas.
+	Instance string `json:"instance"`
+}
+
+// UploadConfig controls where product images are stored.
+type UploadConfig struct {
+	// Dir is the directory images are written to. It must exist.
+	Dir string `json:"dir"`
+}
+
+// ExportConfig controls catalogue exports.
+type ExportConfig struct {
+	// Columns are the columns exported when a request names none; empty
+	// exports the columns of an import file.
+	Columns []string `json:"columns"`
+}
+
+// Duration is a time.Duration written in config as a string such as "30s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\": %w", err)
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
@@ -0,0 +1,82 @@
+package model
+
+import "errors"
+
+// Error kinds. Match them with errors.Is; the delivery layer maps each kind to
+// an HTTP status.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrValidation   = errors.New("validation failed")
+	ErrConflict     = errors.New("conflict")
+	ErrForbidden    = errors.New("forbidden")
+	ErrUnauthorized = errors.New("unauthorized")
+
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrUnprocessable      = errors.New("unprocessable")
+	ErrTooManyRequests    = errors.New("too many requests")
+)
+
+// Error is a domain error with a stable, machine-readable Code such as
+// "product_not_found" and a Message that is safe to show to clients.
+type Error struct {
+	Kind    error
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+// FieldError describes one invalid input field. Field uses the request's
+// field name, e.g. "brand_id", and Rule the violated rule, e.g. "required".
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func NewNotFoundError(code, message string) *Error {
+	return &Error{Kind: ErrNotFound, Code: code, Message: message}
+}
+
+func NewValidationError(code, message string) *Error {
+	return &Error{Kind: ErrValidation, Code: code, Message: message}
+}
+
+func NewConflictError(code, message string) *Error {
+	return &Error{Kind: ErrConflict, Code: code, Message: message}
+}
+
+func NewForbiddenError(code, message string) *Error {
+	return &Error{Kind: ErrForbidden, Code: code, Message: message}
+}
+
+func NewUnauthorizedError(code, message string) *Error {
+	return &Error{Kind: ErrUnauthorized, Code: code, Message: message}
+}
+
+func NewPreconditionFailedError(code, message string) *Error {
+	return &Error{Kind: ErrPreconditionFailed, Code: code, Message: message}
+}
+
+func NewUnprocessableError(code, message string) *Error {
+	return &Error{Kind: ErrUnprocessable, Code: code, Message: message}
+}
+
+func NewTooManyRequestsError(code, message string) *Error {
+	return &Error{Kind: ErrTooManyRequests, Code: code, Message: message}
+}
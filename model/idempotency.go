@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// IdempotencyRecord is the stored outcome of a request sent with an
+// Idempotency-Key header. Status is 0 while the first request is still running.
+type IdempotencyRecord struct {
+	Key         string
+	Fingerprint string
+	Status      int
+	Header      map[string]string
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+// Completed reports whether the response has been stored.
+func (r IdempotencyRecord) Completed() bool {
+	return r.Status != 0
+}
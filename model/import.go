@@ -0,0 +1,88 @@
+package model
+
+import "time"
+
+// The columns an import can match existing products by.
+const (
+	ImportKeySKU        = "sku"
+	ImportKeyExternalID = "external_id"
+)
+
+// Statuses of an imported row.
+const (
+	ImportRowCreated = "created"
+	ImportRowUpdated = "updated"
+	ImportRowFailed  = "failed"
+)
+
+// Statuses of an import job.
+const (
+	ImportJobQueued    = "queued"
+	ImportJobRunning   = "running"
+	ImportJobSucceeded = "succeeded"
+	ImportJobFailed    = "failed"
+)
+
+// Ref returns the product's value of the import key.
+func (p Product) Ref(key string) string {
+	if key == ImportKeyExternalID {
+		return p.ExternalID
+	}
+	return p.SKU
+}
+
+// ImportRow is one row of an import file. Err is set when the row could not
+// be read or is invalid; the row is then reported as failed.
+type ImportRow struct {
+	Line    int
+	Product Product
+	Err     error
+}
+
+// ImportOptions control an import. Key is the column that matches rows to
+// existing products, and a dry run checks every row without saving any.
+type ImportOptions struct {
+	Key    string
+	DryRun bool
+}
+
+// ImportReport is the outcome of an import, with one result per row in file
+// order.
+type ImportReport struct {
+	Key     string            `json:"key"`
+	DryRun  bool              `json:"dry_run"`
+	Total   int               `json:"total"`
+	Created int               `json:"created"`
+	Updated int               `json:"updated"`
+	Failed  int               `json:"failed"`
+	Rows    []ImportRowResult `json:"rows"`
+}
+
+// ImportRowResult is the outcome of one row. Failed rows carry the code and
+// message of the error, and the invalid fields when there are any. Dry runs
+// leave ProductID unset for rows that would be created.
+type ImportRowResult struct {
+	Line       int          `json:"line"`
+	Status     string       `json:"status" enums:"created,updated,failed"`
+	ProductID  int          `json:"product_id,omitempty"`
+	SKU        string       `json:"sku,omitempty"`
+	ExternalID string       `json:"external_id,omitempty"`
+	Code       string       `json:"code,omitempty"`
+	Message    string       `json:"message,omitempty"`
+	Errors     []FieldError `json:"errors,omitempty"`
+}
+
+// ImportJob is an import running in the background. Processed counts the rows
+// done so far and Report is set once the job has succeeded. Owner is the
+// ImportConfig.Instance of the server running the job.
+type ImportJob struct {
+	ID         string        `json:"id"`
+	Status     string        `json:"status" enums:"queued,running,succeeded,failed"`
+	Total      int           `json:"total"`
+	Processed  int           `json:"processed"`
+	CreatedAt  time.Time     `json:"created_at"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+	Report     *ImportReport `json:"report,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Owner      string        `json:"-"`
+}
@@ -3,11 +3,88 @@ package model
 import "mime/multipart"
 
 type Product struct {
-	ID   int    `json:"id"`
-	Name string `json:"name" form:"name" `
-	Path string `json:"-"`
-	UrlImage *multipart.FileHeader `json:"url_image" form:"url_image"`
-	Price   int `json:"price" form:"price"`
-	Stock   int `json:"stock" form:"stock"`
-	BrandID int `json:"brand_id" form:"brand_id"`
-}
\ No newline at end of file
+	ID       int                   `json:"id"`
+	Name     string                `json:"name" form:"name" validate:"required,notblank,max=255" maxLength:"255"`
+	Path     string                `json:"-"`
+	UrlImage *multipart.FileHeader `json:"url_image" form:"url_image" swaggerignore:"true"`
+	Price    int                   `json:"price" form:"price" validate:"gte=0" minimum:"0"`
+	Stock    int                   `json:"stock" form:"stock" validate:"gte=0" minimum:"0"`
+	BrandID  int                   `json:"brand_id" form:"brand_id" validate:"required,gt=0" minimum:"1"`
+	// SKU and ExternalID are optional references that are unique among
+	// products. Imports match existing products by either.
+	SKU        string `json:"sku,omitempty" form:"-" validate:"omitempty,notblank,max=64" maxLength:"64"`
+	ExternalID string `json:"external_id,omitempty" form:"-" validate:"omitempty,notblank,max=64" maxLength:"64"`
+	Version    int    `json:"version" form:"-"`
+	// Deleted is only ever set by exports, the one read that can return
+	// deleted products.
+	Deleted bool `json:"-" form:"-"`
+}
+
+// ProductFilter narrows a product listing. A zero BrandID matches every brand
+// and a zero Limit returns every match. Name matches products whose name
+// contains it, ignoring case, and InStock those with stock left.
+type ProductFilter struct {
+	BrandID int
+	Name    string
+	InStock bool
+	Limit   int
+	Offset  int
+}
+
+// The statuses and stock levels an export can be narrowed to.
+const (
+	StatusActive  = "active"
+	StatusDeleted = "deleted"
+	StatusAll     = "all"
+
+	StockIn  = "in"
+	StockOut = "out"
+)
+
+// ExportFilter narrows a catalogue export. A zero BrandID matches every brand
+// and an empty Stock any stock. Status is StatusActive when empty.
+type ExportFilter struct {
+	BrandID int
+	Stock   string
+	Status  string
+}
+
+// ProductPatch is a partial product update; nil fields keep their value. Path
+// is set by image uploads and never read from a request body. A non-zero
+// Version makes the update conditional on the product still being at that
+// version.
+type ProductPatch struct {
+	Name       *string `json:"name" validate:"omitempty,notblank,max=255" maxLength:"255"`
+	Price      *int    `json:"price" validate:"omitempty,gte=0" minimum:"0"`
+	Stock      *int    `json:"stock" validate:"omitempty,gte=0" minimum:"0"`
+	BrandID    *int    `json:"brand_id" validate:"omitempty,gt=0" minimum:"1"`
+	SKU        *string `json:"sku" validate:"omitempty,notblank,max=64" maxLength:"64"`
+	ExternalID *string `json:"external_id" validate:"omitempty,notblank,max=64" maxLength:"64"`
+	Path       *string `json:"-"`
+	Version    int     `json:"-"`
+}
+
+// Apply copies the non-nil fields of the patch onto product.
+func (p ProductPatch) Apply(product *Product) {
+	if p.Name != nil {
+		product.Name = *p.Name
+	}
+	if p.Price != nil {
+		product.Price = *p.Price
+	}
+	if p.Stock != nil {
+		product.Stock = *p.Stock
+	}
+	if p.BrandID != nil {
+		product.BrandID = *p.BrandID
+	}
+	if p.SKU != nil {
+		product.SKU = *p.SKU
+	}
+	if p.ExternalID != nil {
+		product.ExternalID = *p.ExternalID
+	}
+	if p.Path != nil {
+		product.Path = *p.Path
+	}
+}
@@ -1,11 +1,30 @@
 package model
 
+// The roles of a user. Registration always gives RoleUser; only an admin can
+// change it.
+const (
+	RoleUser  = 0
+	RoleAdmin = 1
+)
+
 type User struct {
 	Id       int    `json:"id"`
-	Name     string `json:"name"`
-	Email    string `json:"email"`
-	Gender   string `json:"gender"`
-	Password string `json:"password"`
-	Role     int    `json:"role"`
+	Name     string `json:"name" validate:"required,notblank,max=255" maxLength:"255"`
+	Email    string `json:"email" validate:"required,email,max=255" format:"email" maxLength:"255"`
+	Gender   string `json:"gender" validate:"omitempty,oneof=male female" enums:"male,female"`
+	Password string `json:"password" validate:"required,password" minLength:"8"`
+	Role     int    `json:"-"`
 	Token    string `json:"token"`
-}
\ No newline at end of file
+}
+
+// RoleChange is the request body of an admin changing a user's role.
+type RoleChange struct {
+	Email string `json:"email" validate:"required,email" format:"email"`
+	Role  *int   `json:"role" validate:"required,oneof=0 1" enums:"0,1"`
+}
+
+// Credentials is the login request body.
+type Credentials struct {
+	Email    string `json:"email" validate:"required,email" format:"email"`
+	Password string `json:"password" validate:"required"`
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"crud-product/logger"
+	"crud-product/model"
+	"database/sql"
+)
+
+type Brand struct {
+	DB       *sql.DB
+	Dialect  Dialect
+	Timeouts Timeouts
+	Replicas *ReplicaSet
+}
+
+func NewBrandRepository(db *sql.DB, opts ...Option) BrandRepository {
+	o := newOptions(opts)
+
+	return &Brand{
+		DB:       db,
+		Dialect:  MySQL,
+		Timeouts: o.timeouts,
+		Replicas: o.replicas,
+	}
+}
+
+func NewPostgresBrandRepository(db *sql.DB, opts ...Option) BrandRepository {
+	o := newOptions(opts)
+
+	return &Brand{
+		DB:       db,
+		Dialect:  Postgres,
+		Timeouts: o.timeouts,
+		Replicas: o.replicas,
+	}
+}
+
+func NewSQLiteBrandRepository(db *sql.DB, opts ...Option) BrandRepository {
+	o := newOptions(opts)
+
+	return &Brand{
+		DB:       db,
+		Dialect:  SQLite,
+		Timeouts: o.timeouts,
+		Replicas: o.replicas,
+	}
+}
+
+func (b *Brand) Find(ctx context.Context, brandID int) (*model.Brand, error) {
+	ctx, cancel := b.Timeouts.context(ctx, "brand.find")
+	defer cancel()
+
+	query := `
+			SELECT 
+				brand_id,
+				name
+			FROM 
+				brand
+			WHERE
+				brand_id = ?`
+
+	brand := model.Brand{}
+
+	err := read(ctx, b.DB, b.Replicas, func(db querier) error {
+		return db.QueryRowContext(ctx, b.Dialect.rebind(query), brandID).Scan(&brand.ID, &brand.Name)
+	})
+
+	if err == sql.ErrNoRows {
+		return nil, errBrandNotFound()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return &brand, nil
+}
+
+func (b *Brand) Fetch(ctx context.Context) (result []model.Brand, err error) {
+	ctx, cancel := b.Timeouts.context(ctx, "brand.fetch")
+	defer cancel()
+
+	query := `
+			SELECT 
+				brand_id,
+				name
+			FROM 
+				brand
+			ORDER BY
+				brand_id`
+
+	err = read(ctx, b.DB, b.Replicas, func(db querier) error {
+		rows, err := db.QueryContext(ctx, query)
+		if err != nil {
+			return err
+		}
+
+		defer func() {
+			errRow := rows.Close()
+			if errRow != nil {
+				logger.FromContext(ctx).Error(errRow)
+			}
+		}()
+
+		result = make([]model.Brand, 0)
+
+		for rows.Next() {
+			t := model.Brand{}
+			if err := rows.Scan(&t.ID, &t.Name); err != nil {
+				return err
+			}
+			result = append(result, t)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
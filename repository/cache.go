@@ -0,0 +1,401 @@
+package repository
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"sync"
+	"time"
+
+	"crud-product/logger"
+	"crud-product/model"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+)
+
+// Cache is the byte store behind CachedProduct.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// CachedProduct decorates a ProductRepository with a read-through cache of
+// single products and per-brand lists. Writes invalidate the affected keys,
+// once immediately and again after the surrounding transaction commits, and
+// concurrent misses for the same key share one repository call.
+type CachedProduct struct {
+	Next  ProductRepository
+	Cache Cache
+	TTL   time.Duration
+
+	group singleflight.Group
+}
+
+func NewCachedProductRepository(next ProductRepository, cache Cache, ttl time.Duration) ProductRepository {
+	return &CachedProduct{
+		Next:  next,
+		Cache: cache,
+		TTL:   ttl,
+	}
+}
+
+func productKey(productID int) string {
+	return fmt.Sprintf("product:%d", productID)
+}
+
+func brandProductsKey(brandID int) string {
+	return fmt.Sprintf("brand:%d:products", brandID)
+}
+
+func (c *CachedProduct) Find(ctx context.Context, productID int) (*model.Product, error) {
+	prod := &model.Product{}
+	err := c.load(ctx, productKey(productID), prod, func(ctx context.Context) (interface{}, error) {
+		return c.Next.Find(ctx, productID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return prod, nil
+}
+
+func (c *CachedProduct) Fetch(ctx context.Context, brandID int) ([]model.Product, error) {
+	result := []model.Product{}
+	err := c.load(ctx, brandProductsKey(brandID), &result, func(ctx context.Context) (interface{}, error) {
+		return c.Next.Fetch(ctx, brandID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// FetchByBrands answers from the per-brand lists that Fetch caches, and
+// fetches the brands missing from the cache with one call, caching them too.
+func (c *CachedProduct) FetchByBrands(ctx context.Context, brandIDs []int) (map[int][]model.Product, error) {
+	if inUnitOfWork(ctx) {
+		return c.Next.FetchByBrands(ctx, brandIDs)
+	}
+
+	byBrand := map[int][]model.Product{}
+	var missing []int
+	for _, id := range brandIDs {
+		key := brandProductsKey(id)
+		data, ok, err := c.Cache.Get(ctx, key)
+		if err != nil {
+			logger.FromContext(ctx).Warnf("cache get %s: %v", key, err)
+		}
+
+		products := []model.Product{}
+		if ok && decode(data, &products) == nil {
+			if len(products) > 0 {
+				byBrand[id] = products
+			}
+			continue
+		}
+		missing = append(missing, id)
+	}
+
+	if len(missing) == 0 {
+		return byBrand, nil
+	}
+
+	fetched, err := c.Next.FetchByBrands(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range missing {
+		products, ok := fetched[id]
+		if !ok {
+			products = []model.Product{}
+		}
+
+		key := brandProductsKey(id)
+		if data, err := encode(products); err == nil {
+			if err := c.Cache.Set(ctx, key, data, c.TTL); err != nil {
+				logger.FromContext(ctx).Warnf("cache set %s: %v", key, err)
+			}
+		}
+
+		if len(products) > 0 {
+			byBrand[id] = products
+		}
+	}
+	return byBrand, nil
+}
+
+// List is not cached: the filter space is too large to invalidate precisely.
+func (c *CachedProduct) List(ctx context.Context, filter model.ProductFilter) ([]model.Product, error) {
+	return c.Next.List(ctx, filter)
+}
+
+// FindByRefs is not cached; imports, its only caller, read each reference once.
+func (c *CachedProduct) FindByRefs(ctx context.Context, key string, refs []string) (map[string]model.Product, error) {
+	return c.Next.FindByRefs(ctx, key, refs)
+}
+
+// Iterate is not cached; exports read the catalogue once and may include
+// deleted products.
+func (c *CachedProduct) Iterate(ctx context.Context, filter model.ExportFilter) (ProductIterator, error) {
+	return c.Next.Iterate(ctx, filter)
+}
+
+func (c *CachedProduct) CountByBrand(ctx context.Context) (map[int]int, error) {
+	return c.Next.CountByBrand(ctx)
+}
+
+func (c *CachedProduct) Store(ctx context.Context, product model.Product) (int, error) {
+	id, err := c.Next.Store(ctx, product)
+	if err != nil {
+		return 0, err
+	}
+
+	c.invalidate(ctx, brandProductsKey(product.BrandID))
+	return id, nil
+}
+
+func (c *CachedProduct) Update(ctx context.Context, product model.Product, productID int) error {
+	keys := append(c.keysFor(ctx, productID), brandProductsKey(product.BrandID))
+
+	if err := c.Next.Update(ctx, product, productID); err != nil {
+		return err
+	}
+
+	c.invalidate(ctx, keys...)
+	return nil
+}
+
+func (c *CachedProduct) Patch(ctx context.Context, patch model.ProductPatch, productID int) error {
+	keys := c.keysFor(ctx, productID)
+	if patch.BrandID != nil {
+		keys = append(keys, brandProductsKey(*patch.BrandID))
+	}
+
+	if err := c.Next.Patch(ctx, patch, productID); err != nil {
+		return err
+	}
+
+	c.invalidate(ctx, keys...)
+	return nil
+}
+
+func (c *CachedProduct) Delete(ctx context.Context, productID int, version int) error {
+	keys := c.keysFor(ctx, productID)
+
+	if err := c.Next.Delete(ctx, productID, version); err != nil {
+		return err
+	}
+
+	c.invalidate(ctx, keys...)
+	return nil
+}
+
+// keysFor returns the keys a change to the product can make stale. The brand
+// is read from the repository, not the cache, because callers of Update do not
+// always send it.
+func (c *CachedProduct) keysFor(ctx context.Context, productID int) []string {
+	keys := []string{productKey(productID)}
+
+	if prod, err := c.Next.Find(ctx, productID); err == nil {
+		keys = append(keys, brandProductsKey(prod.BrandID))
+	}
+	return keys
+}
+
+// load decodes the cached value for key into dst, filling the cache from fetch
+// on a miss. Inside a transaction the cache is bypassed so uncommitted rows are
+// never cached.
+//
+// Concurrent misses share one fetch, which runs on a detached context so that
+// the caller who started it cannot cancel it for the others. Each caller still
+// stops waiting when its own context ends.
+func (c *CachedProduct) load(ctx context.Context, key string, dst interface{}, fetch func(context.Context) (interface{}, error)) error {
+	if inUnitOfWork(ctx) {
+		return decodeInto(ctx, fetch, dst)
+	}
+
+	data, ok, err := c.Cache.Get(ctx, key)
+	if err != nil {
+		logger.FromContext(ctx).Warnf("cache get %s: %v", key, err)
+	}
+	if ok {
+		if err := decode(data, dst); err == nil {
+			return nil
+		}
+	}
+
+	shared := c.group.DoChan(key, func() (interface{}, error) {
+		ctx, cancel := detach(ctx)
+		defer cancel()
+
+		value, err := fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := encode(value)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := c.Cache.Set(ctx, key, data, c.TTL); err != nil {
+			logger.FromContext(ctx).Warnf("cache set %s: %v", key, err)
+		}
+		return data, nil
+	})
+
+	select {
+	case res := <-shared:
+		if res.Err != nil {
+			return res.Err
+		}
+		return decode(res.Val.([]byte), dst)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sharedLoadTimeout bounds a fetch shared by concurrent misses. The
+// repository's own query timeout usually ends it sooner.
+const sharedLoadTimeout = 30 * time.Second
+
+// detach returns a context that keeps the logger, trace span and
+// read-your-writes session of ctx but not its cancellation or deadline.
+func detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	detached := logger.WithEntry(context.Background(), logger.FromContext(ctx))
+	detached = trace.ContextWithSpan(detached, trace.SpanFromContext(ctx))
+	if s := ctx.Value(sessionKey{}); s != nil {
+		detached = context.WithValue(detached, sessionKey{}, s)
+	}
+	return context.WithTimeout(detached, sharedLoadTimeout)
+}
+
+func decodeInto(ctx context.Context, fetch func(context.Context) (interface{}, error), dst interface{}) error {
+	value, err := fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	data, err := encode(value)
+	if err != nil {
+		return err
+	}
+	return decode(data, dst)
+}
+
+// encode uses gob rather than JSON so fields hidden from the API, such as the
+// image path, survive the round trip.
+func encode(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decode(data []byte, dst interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(dst)
+}
+
+func (c *CachedProduct) invalidate(ctx context.Context, keys ...string) {
+	drop := func() {
+		if err := c.Cache.Delete(context.Background(), keys...); err != nil {
+			logger.FromContext(ctx).Warnf("cache delete %v: %v", keys, err)
+		}
+	}
+
+	drop()
+	afterCommit(ctx, drop)
+}
+
+func inUnitOfWork(ctx context.Context) bool {
+	_, ok := ctx.Value(hooksKey{}).(*commitHooks)
+	return ok
+}
+
+// LRUCache is an in-process Cache that evicts the least recently used entry
+// once it holds size entries. A size of 0 means unbounded.
+type LRUCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+func NewLRUCache(size int) *LRUCache {
+	return &LRUCache{
+		size:    size,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+func (l *LRUCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	el, ok := l.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	entry := el.Value.(*lruEntry)
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		l.order.Remove(el)
+		delete(l.entries, key)
+		return nil, false, nil
+	}
+
+	l.order.MoveToFront(el)
+	return entry.value, true, nil
+}
+
+func (l *LRUCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	if el, ok := l.entries[key]; ok {
+		entry := el.Value.(*lruEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		l.order.MoveToFront(el)
+		return nil
+	}
+
+	l.entries[key] = l.order.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+
+	for l.size > 0 && l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.entries, oldest.Value.(*lruEntry).key)
+	}
+
+	return nil
+}
+
+func (l *LRUCache) Delete(ctx context.Context, keys ...string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, key := range keys {
+		if el, ok := l.entries[key]; ok {
+			l.order.Remove(el)
+			delete(l.entries, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,428 @@
+package repository
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"crud-product/model"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestCachedProduct(t *testing.T) {
+	caches := map[string]func(t *testing.T) Cache{
+		"lru":   func(t *testing.T) Cache { return NewLRUCache(0) },
+		"redis": func(t *testing.T) Cache { return newFakeRedisCache(t) },
+	}
+
+	for name, newCache := range caches {
+		t.Run(name, func(t *testing.T) {
+			t.Run("hit and miss", func(t *testing.T) { testCacheHitAndMiss(t, newCache(t)) })
+			t.Run("invalidate on write", func(t *testing.T) { testCacheInvalidate(t, newCache(t)) })
+			t.Run("unit of work bypass", func(t *testing.T) { testCacheUnitOfWork(t, newCache(t)) })
+			t.Run("cancelled leader", func(t *testing.T) { testCacheCancelledLeader(t, newCache(t)) })
+		})
+	}
+}
+
+func testCacheHitAndMiss(t *testing.T, cache Cache) {
+	repo := newCountingProduct()
+	cached := NewCachedProductRepository(repo, cache, time.Minute)
+	ctx := context.Background()
+
+	id := repo.seed(t, model.Product{Name: "Kemeja", BrandID: 1})
+
+	for i := 0; i < 3; i++ {
+		prod, err := cached.Find(ctx, id)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		if prod.Name != "Kemeja" {
+			t.Fatalf("Find = %+v, want Kemeja", prod)
+		}
+
+		list, err := cached.Fetch(ctx, 1)
+		if err != nil {
+			t.Fatalf("Fetch: %v", err)
+		}
+		if len(list) != 1 || list[0].ID != id {
+			t.Fatalf("Fetch = %+v, want product %d", list, id)
+		}
+	}
+
+	if got := repo.count("Find"); got != 1 {
+		t.Errorf("repository Find calls = %d, want 1", got)
+	}
+	if got := repo.count("Fetch"); got != 1 {
+		t.Errorf("repository Fetch calls = %d, want 1", got)
+	}
+
+	if _, err := cached.Find(ctx, id+1); !errors.Is(err, model.ErrNotFound) {
+		t.Errorf("Find of a missing product = %v, want not found", err)
+	}
+	if _, err := cached.Find(ctx, id+1); !errors.Is(err, model.ErrNotFound) {
+		t.Errorf("Find of a missing product again = %v, want not found", err)
+	}
+	if got := repo.count("Find"); got != 3 {
+		t.Errorf("repository Find calls = %d, want not-found results left uncached", got)
+	}
+}
+
+func testCacheInvalidate(t *testing.T, cache Cache) {
+	repo := newCountingProduct()
+	cached := NewCachedProductRepository(repo, cache, time.Minute)
+	ctx := context.Background()
+
+	id := repo.seed(t, model.Product{Name: "Kemeja", BrandID: 1})
+
+	warm := func() {
+		t.Helper()
+		if _, err := cached.Find(ctx, id); err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		if _, err := cached.Fetch(ctx, 1); err != nil {
+			t.Fatalf("Fetch: %v", err)
+		}
+		if _, err := cached.Fetch(ctx, 2); err != nil {
+			t.Fatalf("Fetch: %v", err)
+		}
+	}
+
+	warm()
+	if _, err := cached.Store(ctx, model.Product{Name: "Celana", BrandID: 1}); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	if list, _ := cached.Fetch(ctx, 1); len(list) != 2 {
+		t.Fatalf("Fetch after Store = %+v, want both products", list)
+	}
+
+	warm()
+	if err := cached.Update(ctx, model.Product{Name: "Kemeja Flanel", BrandID: 2}, id); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if prod, _ := cached.Find(ctx, id); prod == nil || prod.Name != "Kemeja Flanel" {
+		t.Fatalf("Find after Update = %+v, want the new name", prod)
+	}
+	if list, _ := cached.Fetch(ctx, 1); len(list) != 1 {
+		t.Fatalf("Fetch(1) after moving the product = %+v, want one product", list)
+	}
+	if list, _ := cached.Fetch(ctx, 2); len(list) != 1 || list[0].ID != id {
+		t.Fatalf("Fetch(2) after moving the product = %+v, want product %d", list, id)
+	}
+
+	warm()
+	name := "Kemeja Batik"
+	if err := cached.Patch(ctx, model.ProductPatch{Name: &name}, id); err != nil {
+		t.Fatalf("Patch: %v", err)
+	}
+	if prod, _ := cached.Find(ctx, id); prod == nil || prod.Name != name {
+		t.Fatalf("Find after Patch = %+v, want %q", prod, name)
+	}
+
+	warm()
+	prod, _ := cached.Find(ctx, id)
+	if err := cached.Delete(ctx, id, prod.Version); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := cached.Find(ctx, id); !errors.Is(err, model.ErrNotFound) {
+		t.Fatalf("Find after Delete = %v, want not found", err)
+	}
+	if list, _ := cached.Fetch(ctx, 2); len(list) != 0 {
+		t.Fatalf("Fetch after Delete = %+v, want no products", list)
+	}
+}
+
+func testCacheUnitOfWork(t *testing.T, cache Cache) {
+	repo := newCountingProduct()
+	cached := NewCachedProductRepository(repo, cache, time.Minute)
+	transactor := NewMemoryTransactor(repo.MemoryProduct)
+	ctx := context.Background()
+
+	id := repo.seed(t, model.Product{Name: "Kemeja", BrandID: 1})
+	if _, err := cached.Find(ctx, id); err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+
+	errRollback := errors.New("rollback")
+	err := transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := cached.Update(ctx, model.Product{Name: "Uncommitted", BrandID: 1}, id); err != nil {
+			return err
+		}
+
+		prod, err := cached.Find(ctx, id)
+		if err != nil {
+			return err
+		}
+		if prod.Name != "Uncommitted" {
+			t.Errorf("Find inside the unit of work = %+v, want its own write", prod)
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("WithinTransaction = %v, want %v", err, errRollback)
+	}
+
+	if _, ok, _ := cache.Get(ctx, productKey(id)); ok {
+		t.Fatal("the unit of work cached its uncommitted product")
+	}
+
+	prod, err := cached.Find(ctx, id)
+	if err != nil {
+		t.Fatalf("Find after rollback: %v", err)
+	}
+	if prod.Name != "Kemeja" {
+		t.Fatalf("Find after rollback = %+v, want the committed product", prod)
+	}
+}
+
+func testCacheCancelledLeader(t *testing.T, cache Cache) {
+	repo := newCountingProduct()
+	cached := NewCachedProductRepository(repo, cache, time.Minute)
+
+	id := repo.seed(t, model.Product{Name: "Kemeja", BrandID: 1})
+	repo.block()
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+	go func() {
+		_, err := cached.Find(leaderCtx, id)
+		leader <- err
+	}()
+	<-repo.entered
+
+	follower := make(chan error, 1)
+	go func() {
+		prod, err := cached.Find(context.Background(), id)
+		if err == nil && prod.Name != "Kemeja" {
+			err = fmt.Errorf("got %+v", prod)
+		}
+		follower <- err
+	}()
+
+	cancel()
+	if err := <-leader; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled Find = %v, want context.Canceled", err)
+	}
+
+	repo.unblock()
+	if err := <-follower; err != nil {
+		t.Fatalf("waiting Find = %v, want the product", err)
+	}
+	if err := repo.fetchErr(); err != nil {
+		t.Fatalf("shared fetch ran on a context that ended: %v", err)
+	}
+
+	if _, ok, _ := cache.Get(context.Background(), productKey(id)); !ok {
+		t.Fatal("the shared fetch was not cached")
+	}
+}
+
+// countingProduct counts the reads that reach the repository and can hold
+// Find until unblocked.
+type countingProduct struct {
+	*MemoryProduct
+
+	mu      sync.Mutex
+	calls   map[string]int
+	gate    chan struct{}
+	entered chan struct{}
+	ctxErr  error
+}
+
+func newCountingProduct() *countingProduct {
+	return &countingProduct{
+		MemoryProduct: NewMemoryProductRepository(NewMemoryBrandRepository(model.Brand{ID: 1, Name: "Eiger"}, model.Brand{ID: 2, Name: "Erigo"})).(*MemoryProduct),
+		calls:         map[string]int{},
+	}
+}
+
+func (c *countingProduct) seed(t *testing.T, product model.Product) int {
+	t.Helper()
+
+	id, err := c.MemoryProduct.Store(context.Background(), product)
+	if err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	return id
+}
+
+func (c *countingProduct) count(method string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls[method]
+}
+
+func (c *countingProduct) block() {
+	c.gate = make(chan struct{})
+	c.entered = make(chan struct{}, 1)
+}
+
+func (c *countingProduct) unblock() {
+	close(c.gate)
+}
+
+func (c *countingProduct) fetchErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ctxErr
+}
+
+func (c *countingProduct) Find(ctx context.Context, productID int) (*model.Product, error) {
+	c.mu.Lock()
+	c.calls["Find"]++
+	gate := c.gate
+	c.mu.Unlock()
+
+	if gate != nil {
+		c.entered <- struct{}{}
+		<-gate
+
+		c.mu.Lock()
+		c.ctxErr = ctx.Err()
+		c.gate = nil
+		c.mu.Unlock()
+	}
+	return c.MemoryProduct.Find(ctx, productID)
+}
+
+func (c *countingProduct) Fetch(ctx context.Context, brandID int) ([]model.Product, error) {
+	c.mu.Lock()
+	c.calls["Fetch"]++
+	c.mu.Unlock()
+
+	return c.MemoryProduct.Fetch(ctx, brandID)
+}
+
+// newFakeRedisCache returns a RedisCache talking to an in-process server that
+// speaks enough of the Redis protocol for GET, SET and DEL.
+func newFakeRedisCache(t *testing.T) *RedisCache {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	server := &fakeRedis{data: map[string]string{}}
+	go server.serve(ln)
+
+	client := redis.NewClient(&redis.Options{Addr: ln.Addr().String()})
+	t.Cleanup(func() {
+		client.Close()
+		ln.Close()
+	})
+
+	return NewRedisCache(client, "test:")
+}
+
+type fakeRedis struct {
+	mu   sync.Mutex
+	data map[string]string
+}
+
+func (f *fakeRedis) serve(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		if _, err := io.WriteString(conn, f.exec(args)); err != nil {
+			return
+		}
+	}
+}
+
+// exec ignores expiry: the tests never outlive a TTL.
+func (f *fakeRedis) exec(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "GET":
+		value, ok := f.data[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "SET":
+		f.data[args[1]] = args[2]
+		return "+OK\r\n"
+	case "DEL":
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := f.data[key]; ok {
+				delete(f.data, key)
+				deleted++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", deleted)
+	default:
+		return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+	}
+}
+
+// readCommand reads one command sent as an array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	header, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(header, "*") {
+		return nil, fmt.Errorf("unexpected %q", header)
+	}
+
+	n, err := strconv.Atoi(header[1:])
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("bad array header %q", header)
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimPrefix(line, "$"))
+		if err != nil {
+			return nil, fmt.Errorf("bad bulk header %q", line)
+		}
+
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Dialect captures the few SQL differences between the supported databases.
+// Queries are written with MySQL-style `?` placeholders and rebound per dialect.
+type Dialect int
+
+const (
+	MySQL Dialect = iota
+	Postgres
+	SQLite
+)
+
+func (d Dialect) rebind(query string) string {
+	if d != Postgres {
+		return query
+	}
+
+	var (
+		b strings.Builder
+		n int
+	)
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// InsertID runs an INSERT written with ? placeholders on db, a *sql.DB or
+// *sql.Tx, and returns the value the database generated for column. lib/pq
+// has no LastInsertId, so Postgres reads it back with RETURNING.
+func (d Dialect) InsertID(ctx context.Context, db querier, query, column string, args ...interface{}) (int64, error) {
+	var id int64
+	if d == Postgres {
+		err := db.QueryRowContext(ctx, d.rebind(query+` RETURNING `+column), args...).Scan(&id)
+		return id, err
+	}
+
+	res, err := db.ExecContext(ctx, d.rebind(query), args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// quote escapes identifiers that are reserved words, such as the user table.
+func (d Dialect) quote(ident string) string {
+	if d == Postgres || d == SQLite {
+		return `"` + ident + `"`
+	}
+	return "`" + ident + "`"
+}
+
+// SQLiteDSN builds the connection string for a SQLite database file with
+// foreign key enforcement turned on, matching the other backends.
+func SQLiteDSN(path string) string {
+	return "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+}
+
+// isUniqueViolation reports whether err is a duplicate key error from any of
+// the supported drivers.
+func isUniqueViolation(err error) bool {
+	var (
+		mysqlErr    *mysql.MySQLError
+		postgresErr *pq.Error
+		sqliteErr   *sqlite.Error
+	)
+
+	switch {
+	case errors.As(err, &mysqlErr):
+		return mysqlErr.Number == 1062
+	case errors.As(err, &postgresErr):
+		return postgresErr.Code == "23505"
+	case errors.As(err, &sqliteErr):
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	}
+	return false
+}
+
+// isForeignKeyViolation reports whether err is a missing referenced row error,
+// such as a product pointing at an unknown brand.
+func isForeignKeyViolation(err error) bool {
+	var (
+		mysqlErr    *mysql.MySQLError
+		postgresErr *pq.Error
+		sqliteErr   *sqlite.Error
+	)
+
+	switch {
+	case errors.As(err, &mysqlErr):
+		return mysqlErr.Number == 1452
+	case errors.As(err, &postgresErr):
+		return postgresErr.Code == "23503"
+	case errors.As(err, &sqliteErr):
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY
+	}
+	return false
+}
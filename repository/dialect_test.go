@@ -0,0 +1,32 @@
+package repository
+
+import "testing"
+
+func TestDialectRebind(t *testing.T) {
+	query := `SELECT name FROM product WHERE brand_id = ? AND stock > ? LIMIT ?`
+
+	for _, d := range []Dialect{MySQL, SQLite} {
+		if got := d.rebind(query); got != query {
+			t.Errorf("rebind(%d) = %q, want the query unchanged", d, got)
+		}
+	}
+
+	want := `SELECT name FROM product WHERE brand_id = $1 AND stock > $2 LIMIT $3`
+	if got := Postgres.rebind(query); got != want {
+		t.Errorf("Postgres rebind = %q, want %q", got, want)
+	}
+}
+
+func TestDialectQuote(t *testing.T) {
+	tests := map[Dialect]string{
+		MySQL:    "`user`",
+		Postgres: `"user"`,
+		SQLite:   `"user"`,
+	}
+
+	for d, want := range tests {
+		if got := d.quote("user"); got != want {
+			t.Errorf("quote(%d) = %s, want %s", d, got, want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"crud-product/model"
+)
+
+func errProductNotFound() error {
+	return model.NewNotFoundError("product_not_found", "product not found")
+}
+
+func errVersionMismatch() error {
+	return model.NewPreconditionFailedError("version_mismatch", "product has been changed since it was read")
+}
+
+func errBrandNotFound() error {
+	return model.NewNotFoundError("brand_not_found", "brand not found")
+}
+
+func errUnknownBrand() error {
+	return model.NewValidationError("unknown_brand", "brand does not exist")
+}
+
+func errImportJobNotFound() error {
+	return model.NewNotFoundError("import_job_not_found", "import job not found")
+}
+
+func errInvalidCredentials() error {
+	return model.NewUnauthorizedError("invalid_credentials", "invalid email or password")
+}
+
+func errUserNotFound() error {
+	return model.NewNotFoundError("user_not_found", "user not found")
+}
+
+func errEmailTaken() error {
+	return model.NewConflictError("email_taken", "email is already registered")
+}
+
+// errRefTaken reports which unique product reference a duplicate key error is
+// about. Every driver names the column or its index in the message.
+func errRefTaken(err error) error {
+	if strings.Contains(err.Error(), "external_id") {
+		return errExternalIDTaken()
+	}
+	return errSKUTaken()
+}
+
+func errSKUTaken() error {
+	return model.NewConflictError("sku_taken", "SKU belongs to another product")
+}
+
+func errExternalIDTaken() error {
+	return model.NewConflictError("external_id_taken", "external ID belongs to another product")
+}
+
+func errUnknownImportKey(key string) error {
+	return model.NewValidationError("invalid_import_key", fmt.Sprintf("products cannot be matched by %q", key))
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"crud-product/model"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Idempotency keeps idempotency records in the idempotency_key table. It always
+// uses the primary outside any transaction, so a stored response survives the
+// rollback of the request that produced it.
+type Idempotency struct {
+	DB       *sql.DB
+	Dialect  Dialect
+	Timeouts Timeouts
+}
+
+func NewIdempotencyRepository(db *sql.DB, opts ...Option) IdempotencyRepository {
+	o := newOptions(opts)
+
+	return &Idempotency{
+		DB:       db,
+		Dialect:  MySQL,
+		Timeouts: o.timeouts,
+	}
+}
+
+func NewPostgresIdempotencyRepository(db *sql.DB, opts ...Option) IdempotencyRepository {
+	o := newOptions(opts)
+
+	return &Idempotency{
+		DB:       db,
+		Dialect:  Postgres,
+		Timeouts: o.timeouts,
+	}
+}
+
+func NewSQLiteIdempotencyRepository(db *sql.DB, opts ...Option) IdempotencyRepository {
+	o := newOptions(opts)
+
+	return &Idempotency{
+		DB:       db,
+		Dialect:  SQLite,
+		Timeouts: o.timeouts,
+	}
+}
+
+// Reserve removes expired keys and then inserts record.Key as in progress.
+func (i *Idempotency) Reserve(ctx context.Context, record model.IdempotencyRecord) (*model.IdempotencyRecord, error) {
+	ctx, cancel := i.Timeouts.context(ctx, "idempotency.reserve")
+	defer cancel()
+
+	_, err := i.DB.ExecContext(ctx, i.Dialect.rebind(`DELETE FROM idempotency_key WHERE expires_at < ?`), time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+			INSERT INTO idempotency_key
+				(idempotency_key, fingerprint, status, headers, body, expires_at)
+			VALUES
+				(?, ?, 0, '', ?, ?)`
+
+	_, err = i.DB.ExecContext(ctx, i.Dialect.rebind(query),
+		record.Key, record.Fingerprint, []byte{}, record.ExpiresAt.Unix())
+
+	if isUniqueViolation(err) {
+		return i.find(ctx, record.Key)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (i *Idempotency) find(ctx context.Context, key string) (*model.IdempotencyRecord, error) {
+	query := `
+			SELECT 
+				idempotency_key,
+				fingerprint,
+				status,
+				headers,
+				body,
+				expires_at
+			FROM 
+				idempotency_key
+			WHERE
+				idempotency_key = ?`
+
+	var (
+		record    model.IdempotencyRecord
+		headers   string
+		expiresAt int64
+	)
+
+	err := i.DB.QueryRowContext(ctx, i.Dialect.rebind(query), key).
+		Scan(&record.Key, &record.Fingerprint, &record.Status, &headers, &record.Body, &expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if headers != "" {
+		if err := json.Unmarshal([]byte(headers), &record.Header); err != nil {
+			return nil, err
+		}
+	}
+	record.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return &record, nil
+}
+
+func (i *Idempotency) Complete(ctx context.Context, record model.IdempotencyRecord) error {
+	ctx, cancel := i.Timeouts.context(ctx, "idempotency.complete")
+	defer cancel()
+
+	headers, err := json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+
+	query := `
+				UPDATE 
+					idempotency_key
+				SET
+					status = ?,
+					headers = ?,
+					body = ?
+				WHERE
+					idempotency_key = ?`
+
+	_, err = i.DB.ExecContext(ctx, i.Dialect.rebind(query), record.Status, string(headers), record.Body, record.Key)
+	return err
+}
+
+func (i *Idempotency) Release(ctx context.Context, key string) error {
+	ctx, cancel := i.Timeouts.context(ctx, "idempotency.release")
+	defer cancel()
+
+	query := `DELETE FROM idempotency_key WHERE idempotency_key = ? AND status = 0`
+
+	_, err := i.DB.ExecContext(ctx, i.Dialect.rebind(query), key)
+	return err
+}
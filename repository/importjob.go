@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"crud-product/model"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// ImportJob keeps background import jobs in the import_job table, as JSON so
+// that the report of a finished job is stored with it. Like Idempotency it
+// always uses the primary outside any transaction.
+type ImportJob struct {
+	DB       *sql.DB
+	Dialect  Dialect
+	Timeouts Timeouts
+}
+
+func NewImportJobRepository(db *sql.DB, opts ...Option) ImportJobRepository {
+	o := newOptions(opts)
+
+	return &ImportJob{
+		DB:       db,
+		Dialect:  MySQL,
+		Timeouts: o.timeouts,
+	}
+}
+
+func NewPostgresImportJobRepository(db *sql.DB, opts ...Option) ImportJobRepository {
+	o := newOptions(opts)
+
+	return &ImportJob{
+		DB:       db,
+		Dialect:  Postgres,
+		Timeouts: o.timeouts,
+	}
+}
+
+func NewSQLiteImportJobRepository(db *sql.DB, opts ...Option) ImportJobRepository {
+	o := newOptions(opts)
+
+	return &ImportJob{
+		DB:       db,
+		Dialect:  SQLite,
+		Timeouts: o.timeouts,
+	}
+}
+
+func (i *ImportJob) Create(ctx context.Context, job model.ImportJob, expiresAt time.Time) error {
+	ctx, cancel := i.Timeouts.context(ctx, "import_job.create")
+	defer cancel()
+
+	_, err := i.DB.ExecContext(ctx, i.Dialect.rebind(`DELETE FROM import_job WHERE expires_at < ?`), time.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	query := `
+			INSERT INTO import_job
+				(id, job, expires_at, owner)
+			VALUES
+				(?, ?, ?, ?)`
+
+	_, err = i.DB.ExecContext(ctx, i.Dialect.rebind(query), job.ID, string(data), expiresAt.Unix(), job.Owner)
+	return err
+}
+
+// Update does nothing when the job has already been removed.
+func (i *ImportJob) Update(ctx context.Context, job model.ImportJob, expiresAt time.Time) error {
+	ctx, cancel := i.Timeouts.context(ctx, "import_job.update")
+	defer cancel()
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	query := `
+				UPDATE
+					import_job
+				SET
+					job = ?,
+					expires_at = ?
+				WHERE
+					id = ?`
+
+	_, err = i.DB.ExecContext(ctx, i.Dialect.rebind(query), string(data), expiresAt.Unix(), job.ID)
+	return err
+}
+
+func (i *ImportJob) Find(ctx context.Context, id string) (*model.ImportJob, error) {
+	ctx, cancel := i.Timeouts.context(ctx, "import_job.find")
+	defer cancel()
+
+	query := `SELECT job, owner FROM import_job WHERE id = ? AND expires_at >= ?`
+
+	var data, owner string
+	err := i.DB.QueryRowContext(ctx, i.Dialect.rebind(query), id, time.Now().Unix()).Scan(&data, &owner)
+	if err == sql.ErrNoRows {
+		return nil, errImportJobNotFound()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeImportJob(data, owner)
+}
+
+func (i *ImportJob) FindByOwner(ctx context.Context, owner string) ([]model.ImportJob, error) {
+	ctx, cancel := i.Timeouts.context(ctx, "import_job.find_by_owner")
+	defer cancel()
+
+	query := `SELECT job FROM import_job WHERE owner = ? AND expires_at >= ? ORDER BY id`
+
+	rows, err := i.DB.QueryContext(ctx, i.Dialect.rebind(query), owner, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []model.ImportJob{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		job, err := decodeImportJob(data, owner)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+// decodeImportJob reads a job stored as JSON. The owner is kept in a column of
+// its own, so it can be queried.
+func decodeImportJob(data, owner string) (*model.ImportJob, error) {
+	job := &model.ImportJob{}
+	if err := json.Unmarshal([]byte(data), job); err != nil {
+		return nil, err
+	}
+	job.Owner = owner
+	return job, nil
+}
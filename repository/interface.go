@@ -3,17 +3,64 @@ package repository
 import (
 	"context"
 	"crud-product/model"
+	"time"
 )
 
 type ProductRepository interface {
 	Find(context.Context, int) (*model.Product, error)
 	Fetch(context.Context, int) ([]model.Product, error)
-	Store(context.Context, model.Product) error
+	FetchByBrands(context.Context, []int) (map[int][]model.Product, error)
+	List(context.Context, model.ProductFilter) ([]model.Product, error)
+	FindByRefs(context.Context, string, []string) (map[string]model.Product, error)
+	CountByBrand(context.Context) (map[int]int, error)
+	Iterate(context.Context, model.ExportFilter) (ProductIterator, error)
+	Store(context.Context, model.Product) (int, error)
 	Update(context.Context, model.Product, int) error
-	Delete(context.Context, int) error
+	Patch(context.Context, model.ProductPatch, int) error
+	Delete(context.Context, int, int) error
+}
+
+// ProductIterator steps through products one at a time, like sql.Rows, so a
+// large result never has to fit in memory. It must be closed.
+type ProductIterator interface {
+	Next() bool
+	Product() model.Product
+	Err() error
+	Close() error
+}
+
+type BrandRepository interface {
+	Find(context.Context, int) (*model.Brand, error)
+	Fetch(context.Context) ([]model.Brand, error)
 }
 
 type UserRepository interface {
 	FindOne(context.Context, string, string) (model.User, error)
 	Store(context.Context, model.User) error
-}
\ No newline at end of file
+	SetRole(ctx context.Context, email string, role int) error
+}
+
+// IdempotencyRepository stores the responses of requests sent with an
+// Idempotency-Key so retries can be answered without repeating the work.
+type IdempotencyRepository interface {
+	// Reserve claims record.Key for a new request. When the key is already
+	// taken and not expired it returns the existing record instead.
+	Reserve(context.Context, model.IdempotencyRecord) (*model.IdempotencyRecord, error)
+	// Complete stores the response for a reserved key.
+	Complete(context.Context, model.IdempotencyRecord) error
+	// Release frees a reserved key so the request can be retried.
+	Release(context.Context, string) error
+}
+
+// ImportJobRepository keeps the state of background imports, so that every
+// replica can report on a job whichever one runs it.
+type ImportJobRepository interface {
+	// Create removes expired jobs and then stores a new one until expiresAt.
+	Create(context.Context, model.ImportJob, time.Time) error
+	// Update replaces the stored job and keeps it until expiresAt.
+	Update(context.Context, model.ImportJob, time.Time) error
+	// Find returns the job with the given ID unless it has expired.
+	Find(context.Context, string) (*model.ImportJob, error)
+	// FindByOwner returns the jobs of the given owner that have not expired.
+	FindByOwner(context.Context, string) ([]model.ImportJob, error)
+}
@@ -0,0 +1,87 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"crud-product/model"
+	"crud-product/repository"
+	"crud-product/repository/repotest"
+)
+
+// newSQLiteProducts returns a SQLite product repository holding n products.
+func newSQLiteProducts(t *testing.T, n int) (repository.ProductRepository, func(int)) {
+	t.Helper()
+
+	db := repotest.NewSQLite(t)
+	brandID := repotest.SeedBrand(t, db, repository.SQLite, "Erigo")
+	repo := repository.NewSQLiteProductRepository(db)
+
+	for i := 0; i < n; i++ {
+		if _, err := repo.Store(context.Background(), model.Product{Name: "Kemeja", Price: 1000, BrandID: brandID}); err != nil {
+			t.Fatalf("Store: %v", err)
+		}
+	}
+	return repo, db.SetMaxOpenConns
+}
+
+func TestIterateReportsCancellation(t *testing.T) {
+	repo, _ := newSQLiteProducts(t, 500)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	it, err := repo.Iterate(ctx, model.ExportFilter{})
+	if err != nil {
+		t.Fatalf("Iterate: %v", err)
+	}
+	defer it.Close()
+
+	if !it.Next() {
+		t.Fatalf("Next = false, want a first product: %v", it.Err())
+	}
+	cancel()
+
+	// database/sql closes the rows shortly after the cancellation; a stop
+	// before the last product must not look like the end of the catalogue.
+	n := 1
+	for it.Next() {
+		n++
+		time.Sleep(time.Millisecond)
+	}
+	if n == 500 {
+		t.Fatal("every product was read after the cancellation")
+	}
+	if err := it.Err(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Err after %d products = %v, want context.Canceled", n, err)
+	}
+}
+
+func TestIterateCloseReleasesConnection(t *testing.T) {
+	repo, setMaxOpenConns := newSQLiteProducts(t, 3)
+	setMaxOpenConns(1)
+
+	it, err := repo.Iterate(context.Background(), model.ExportFilter{})
+	if err != nil {
+		t.Fatalf("Iterate: %v", err)
+	}
+	if !it.Next() {
+		t.Fatalf("Next = false, want a first product: %v", it.Err())
+	}
+	first := it.Product()
+
+	// Stopping early, as an export does when the client goes away, must
+	// give the only connection back.
+	if err := it.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := repo.Find(ctx, first.ID); err != nil {
+		t.Fatalf("Find after Close = %v, want the connection free", err)
+	}
+}
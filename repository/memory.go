@@ -0,0 +1,607 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"crud-product/model"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MemoryProduct is a thread-safe, in-process ProductRepository. It behaves like
+// the SQL implementations, including soft deletes and the foreign key to the
+// brands, and is meant for tests and for running the service without a
+// database.
+type MemoryProduct struct {
+	mu       sync.RWMutex
+	lastID   int
+	products map[int]memoryProductRow
+	brands   BrandRepository
+}
+
+type memoryProductRow struct {
+	product model.Product
+	active  bool
+}
+
+// NewMemoryProductRepository stores products of the given brands; storing one
+// of any other brand fails with unknown_brand.
+func NewMemoryProductRepository(brands BrandRepository) ProductRepository {
+	return &MemoryProduct{
+		products: map[int]memoryProductRow{},
+		brands:   brands,
+	}
+}
+
+func (m *MemoryProduct) Find(ctx context.Context, productID int) (*model.Product, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	row, ok := m.products[productID]
+	if !ok || !row.active {
+		return nil, errProductNotFound()
+	}
+
+	prod := row.product
+	return &prod, nil
+}
+
+func (m *MemoryProduct) Fetch(ctx context.Context, brandID int) ([]model.Product, error) {
+	return m.list(model.ProductFilter{BrandID: brandID}), nil
+}
+
+func (m *MemoryProduct) FetchByBrands(ctx context.Context, brandIDs []int) (map[int][]model.Product, error) {
+	byBrand := map[int][]model.Product{}
+	for _, id := range brandIDs {
+		if products := m.list(model.ProductFilter{BrandID: id}); len(products) > 0 {
+			byBrand[id] = products
+		}
+	}
+	return byBrand, nil
+}
+
+func (m *MemoryProduct) List(ctx context.Context, filter model.ProductFilter) ([]model.Product, error) {
+	return m.list(filter), nil
+}
+
+func (m *MemoryProduct) list(filter model.ProductFilter) []model.Product {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]model.Product, 0)
+	for _, row := range m.products {
+		if row.active && matches(row.product, filter) {
+			result = append(result, row.product)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	if filter.Offset >= len(result) {
+		return result[:0]
+	}
+	result = result[filter.Offset:]
+
+	if filter.Limit > 0 && filter.Limit < len(result) {
+		result = result[:filter.Limit]
+	}
+	return result
+}
+
+func matches(product model.Product, filter model.ProductFilter) bool {
+	switch {
+	case filter.BrandID != 0 && product.BrandID != filter.BrandID:
+		return false
+	case filter.Name != "" && !strings.Contains(strings.ToLower(product.Name), strings.ToLower(filter.Name)):
+		return false
+	case filter.InStock && product.Stock <= 0:
+		return false
+	default:
+		return true
+	}
+}
+
+func (m *MemoryProduct) FindByRefs(ctx context.Context, key string, refs []string) (map[string]model.Product, error) {
+	if key != model.ImportKeySKU && key != model.ImportKeyExternalID {
+		return nil, errUnknownImportKey(key)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	wanted := make(map[string]bool, len(refs))
+	for _, ref := range refs {
+		wanted[ref] = true
+	}
+
+	byRef := map[string]model.Product{}
+	for _, row := range m.products {
+		if ref := row.product.Ref(key); row.active && ref != "" && wanted[ref] {
+			byRef[ref] = row.product
+		}
+	}
+	return byRef, nil
+}
+
+// checkRefs fails like a unique index when another product, active or not,
+// holds the SKU or external ID of product.
+func (m *MemoryProduct) checkRefs(product model.Product) error {
+	for id, row := range m.products {
+		switch {
+		case id == product.ID:
+		case product.SKU != "" && row.product.SKU == product.SKU:
+			return errSKUTaken()
+		case product.ExternalID != "" && row.product.ExternalID == product.ExternalID:
+			return errExternalIDTaken()
+		}
+	}
+	return nil
+}
+
+// checkBrand fails like the foreign key on the brand when brandID is not one
+// of the brands.
+func (m *MemoryProduct) checkBrand(ctx context.Context, brandID int) error {
+	_, err := m.brands.Find(ctx, brandID)
+	if errors.Is(err, model.ErrNotFound) {
+		return errUnknownBrand()
+	}
+	return err
+}
+
+// Iterate walks a snapshot of the matching products taken when it is called.
+func (m *MemoryProduct) Iterate(ctx context.Context, filter model.ExportFilter) (ProductIterator, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	products := make([]model.Product, 0)
+	for _, row := range m.products {
+		switch {
+		case filter.Status == model.StatusDeleted && row.active:
+		case filter.Status != model.StatusDeleted && filter.Status != model.StatusAll && !row.active:
+		case filter.BrandID != 0 && row.product.BrandID != filter.BrandID:
+		case filter.Stock == model.StockIn && row.product.Stock <= 0:
+		case filter.Stock == model.StockOut && row.product.Stock > 0:
+		default:
+			prod := row.product
+			prod.Deleted = !row.active
+			products = append(products, prod)
+		}
+	}
+
+	sort.Slice(products, func(i, j int) bool {
+		return products[i].ID < products[j].ID
+	})
+	return &memoryProductIterator{products: products, next: -1}, nil
+}
+
+type memoryProductIterator struct {
+	products []model.Product
+	next     int
+}
+
+func (it *memoryProductIterator) Next() bool {
+	if it.next < len(it.products) {
+		it.next++
+	}
+	return it.next < len(it.products)
+}
+
+func (it *memoryProductIterator) Product() model.Product {
+	return it.products[it.next]
+}
+
+func (it *memoryProductIterator) Err() error {
+	return nil
+}
+
+func (it *memoryProductIterator) Close() error {
+	return nil
+}
+
+// CountByBrand returns the number of active products of every brand,
+// including brands without any.
+func (m *MemoryProduct) CountByBrand(ctx context.Context) (map[int]int, error) {
+	brands, err := m.brands.Fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counts := make(map[int]int, len(brands))
+	for _, brand := range brands {
+		counts[brand.ID] = 0
+	}
+	for _, row := range m.products {
+		if row.active {
+			counts[row.product.BrandID]++
+		}
+	}
+	return counts, nil
+}
+
+func (m *MemoryProduct) Store(ctx context.Context, product model.Product) (int, error) {
+	if err := m.checkBrand(ctx, product.BrandID); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkRefs(product); err != nil {
+		return 0, err
+	}
+
+	m.lastID++
+	product.ID = m.lastID
+	product.Version = 1
+	product.UrlImage = nil
+	m.products[product.ID] = memoryProductRow{product: product, active: true}
+
+	return product.ID, nil
+}
+
+func (m *MemoryProduct) Update(ctx context.Context, product model.Product, productID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	row, ok := m.products[productID]
+	if !ok || !row.active {
+		return errProductNotFound()
+	}
+
+	if product.Version > 0 && product.Version != row.product.Version {
+		return errVersionMismatch()
+	}
+
+	if err := m.checkBrand(ctx, product.BrandID); err != nil {
+		return err
+	}
+
+	row.product.Name = product.Name
+	row.product.Path = product.Path
+	row.product.Price = product.Price
+	row.product.Stock = product.Stock
+	row.product.BrandID = product.BrandID
+	row.product.Version++
+	m.products[productID] = row
+
+	return nil
+}
+
+func (m *MemoryProduct) Patch(ctx context.Context, patch model.ProductPatch, productID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	row, ok := m.products[productID]
+	if !ok || !row.active {
+		return errProductNotFound()
+	}
+
+	if patch.Version > 0 && patch.Version != row.product.Version {
+		return errVersionMismatch()
+	}
+
+	if patch == (model.ProductPatch{Version: patch.Version}) {
+		return nil
+	}
+
+	if patch.BrandID != nil {
+		if err := m.checkBrand(ctx, *patch.BrandID); err != nil {
+			return err
+		}
+	}
+
+	patched := row.product
+	patch.Apply(&patched)
+	if err := m.checkRefs(patched); err != nil {
+		return err
+	}
+
+	row.product = patched
+	row.product.Version++
+	m.products[productID] = row
+
+	return nil
+}
+
+func (m *MemoryProduct) Delete(ctx context.Context, productID int, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	row, ok := m.products[productID]
+	if !ok || !row.active {
+		return errProductNotFound()
+	}
+
+	if version > 0 && version != row.product.Version {
+		return errVersionMismatch()
+	}
+
+	row.active = false
+	row.product.SKU = ""
+	row.product.ExternalID = ""
+	row.product.Version++
+	m.products[productID] = row
+
+	return nil
+}
+
+func (m *MemoryProduct) snapshot() func() {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	lastID := m.lastID
+	products := make(map[int]memoryProductRow, len(m.products))
+	for id, row := range m.products {
+		products[id] = row
+	}
+
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		m.lastID = lastID
+		m.products = products
+	}
+}
+
+// MemoryBrand is a read-only, in-process BrandRepository holding the brands it
+// was created with.
+type MemoryBrand struct {
+	brands []model.Brand
+}
+
+func NewMemoryBrandRepository(brands ...model.Brand) BrandRepository {
+	sorted := append([]model.Brand(nil), brands...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	return &MemoryBrand{brands: sorted}
+}
+
+func (m *MemoryBrand) Find(ctx context.Context, brandID int) (*model.Brand, error) {
+	for _, brand := range m.brands {
+		if brand.ID == brandID {
+			b := brand
+			return &b, nil
+		}
+	}
+	return nil, errBrandNotFound()
+}
+
+func (m *MemoryBrand) Fetch(ctx context.Context) ([]model.Brand, error) {
+	return append(make([]model.Brand, 0, len(m.brands)), m.brands...), nil
+}
+
+// MemoryIdempotency is a thread-safe, in-process IdempotencyRepository.
+type MemoryIdempotency struct {
+	mu      sync.Mutex
+	records map[string]model.IdempotencyRecord
+}
+
+func NewMemoryIdempotencyRepository() IdempotencyRepository {
+	return &MemoryIdempotency{
+		records: map[string]model.IdempotencyRecord{},
+	}
+}
+
+func (m *MemoryIdempotency) Reserve(ctx context.Context, record model.IdempotencyRecord) (*model.IdempotencyRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.records[record.Key]; ok && time.Now().Before(existing.ExpiresAt) {
+		return &existing, nil
+	}
+
+	record.Status = 0
+	record.Header = nil
+	record.Body = nil
+	m.records[record.Key] = record
+
+	return nil, nil
+}
+
+func (m *MemoryIdempotency) Complete(ctx context.Context, record model.IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.records[record.Key]; ok {
+		existing.Status = record.Status
+		existing.Header = record.Header
+		existing.Body = record.Body
+		m.records[record.Key] = existing
+	}
+	return nil
+}
+
+func (m *MemoryIdempotency) Release(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.records[key]; ok && !existing.Completed() {
+		delete(m.records, key)
+	}
+	return nil
+}
+
+// MemoryImportJob is a thread-safe, in-process ImportJobRepository. Jobs are
+// copied in and out, so callers never share a job with the store.
+type MemoryImportJob struct {
+	mu   sync.Mutex
+	jobs map[string]memoryImportJobRow
+}
+
+type memoryImportJobRow struct {
+	job       model.ImportJob
+	expiresAt time.Time
+}
+
+func NewMemoryImportJobRepository() ImportJobRepository {
+	return &MemoryImportJob{
+		jobs: map[string]memoryImportJobRow{},
+	}
+}
+
+func (m *MemoryImportJob) Create(ctx context.Context, job model.ImportJob, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for id, row := range m.jobs {
+		if row.expiresAt.Before(now) {
+			delete(m.jobs, id)
+		}
+	}
+
+	m.jobs[job.ID] = memoryImportJobRow{job: copyImportJob(job), expiresAt: expiresAt}
+	return nil
+}
+
+func (m *MemoryImportJob) Update(ctx context.Context, job model.ImportJob, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.jobs[job.ID]; ok {
+		m.jobs[job.ID] = memoryImportJobRow{job: copyImportJob(job), expiresAt: expiresAt}
+	}
+	return nil
+}
+
+func (m *MemoryImportJob) Find(ctx context.Context, id string) (*model.ImportJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	row, ok := m.jobs[id]
+	if !ok || row.expiresAt.Before(time.Now()) {
+		return nil, errImportJobNotFound()
+	}
+
+	job := copyImportJob(row.job)
+	return &job, nil
+}
+
+func (m *MemoryImportJob) FindByOwner(ctx context.Context, owner string) ([]model.ImportJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	jobs := []model.ImportJob{}
+	for _, row := range m.jobs {
+		if row.job.Owner == owner && !row.expiresAt.Before(now) {
+			jobs = append(jobs, copyImportJob(row.job))
+		}
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].ID < jobs[j].ID
+	})
+	return jobs, nil
+}
+
+// copyImportJob copies the finish time and report, which a job points to.
+func copyImportJob(job model.ImportJob) model.ImportJob {
+	if job.FinishedAt != nil {
+		finished := *job.FinishedAt
+		job.FinishedAt = &finished
+	}
+	if job.Report != nil {
+		report := *job.Report
+		report.Rows = append([]model.ImportRowResult(nil), report.Rows...)
+		job.Report = &report
+	}
+	return job
+}
+
+// MemoryUser is a thread-safe, in-process UserRepository. Passwords are hashed
+// and tokens signed exactly as in the SQL implementations.
+type MemoryUser struct {
+	mu     sync.RWMutex
+	lastID int
+	users  map[string]model.User
+}
+
+func NewMemoryUserRepository() UserRepository {
+	return &MemoryUser{
+		users: map[string]model.User{},
+	}
+}
+
+func (m *MemoryUser) FindOne(ctx context.Context, email, password string) (model.User, error) {
+	m.mu.RLock()
+	user, ok := m.users[email]
+	m.mu.RUnlock()
+
+	if !ok {
+		return model.User{}, errInvalidCredentials()
+	}
+
+	if err := authenticate(&user, password); err != nil {
+		return model.User{}, err
+	}
+
+	return user, nil
+}
+
+func (m *MemoryUser) Store(ctx context.Context, user model.User) error {
+	pass, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[user.Email]; ok {
+		return errEmailTaken()
+	}
+
+	m.lastID++
+	user.Id = m.lastID
+	user.Password = string(pass)
+	user.Token = ""
+	m.users[user.Email] = user
+
+	return nil
+}
+
+func (m *MemoryUser) SetRole(ctx context.Context, email string, role int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[email]
+	if !ok {
+		return errUserNotFound()
+	}
+
+	user.Role = role
+	m.users[email] = user
+	return nil
+}
+
+func (m *MemoryUser) snapshot() func() {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	lastID := m.lastID
+	users := make(map[string]model.User, len(m.users))
+	for email, user := range m.users {
+		users[email] = user
+	}
+
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		m.lastID = lastID
+		m.users = users
+	}
+}
@@ -0,0 +1,153 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"crud-product/model"
+	"crud-product/repository"
+	"crud-product/repository/repotest"
+)
+
+func TestMemoryProductRepository(t *testing.T) {
+	brands := repository.NewMemoryBrandRepository(model.Brand{ID: 1, Name: "Erigo"}, model.Brand{ID: 2, Name: "Eiger"})
+	repotest.ProductRepository(t, repository.NewMemoryProductRepository(brands), 1, 2)
+}
+
+func TestMemoryUserRepository(t *testing.T) {
+	repotest.UserRepository(t, repository.NewMemoryUserRepository())
+}
+
+func TestMemoryImportJobRepository(t *testing.T) {
+	repotest.ImportJobRepository(t, repository.NewMemoryImportJobRepository())
+}
+
+func TestMemoryUserRepositoryDuplicateEmail(t *testing.T) {
+	repo := repository.NewMemoryUserRepository()
+	ctx := context.Background()
+
+	user := model.User{Name: "Budi", Email: "budi@example.com", Password: "rahasia123"}
+	if err := repo.Store(ctx, user); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+
+	if err := repo.Store(ctx, user); !errors.Is(err, model.ErrConflict) {
+		t.Fatalf("Store with a taken email = %v, want conflict", err)
+	}
+}
+
+func TestMemoryBrandRepository(t *testing.T) {
+	repo := repository.NewMemoryBrandRepository(model.Brand{ID: 2, Name: "Erigo"}, model.Brand{ID: 1, Name: "Eiger"})
+	ctx := context.Background()
+
+	brands, err := repo.Fetch(ctx)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if len(brands) != 2 || brands[0].ID != 1 || brands[1].ID != 2 {
+		t.Fatalf("Fetch = %+v, want brands 1 and 2 in ID order", brands)
+	}
+
+	brand, err := repo.Find(ctx, 2)
+	if err != nil || brand.Name != "Erigo" {
+		t.Fatalf("Find(2) = %+v, %v, want Erigo", brand, err)
+	}
+
+	if _, err := repo.Find(ctx, 3); !errors.Is(err, model.ErrNotFound) {
+		t.Fatalf("Find(3) = %v, want not found", err)
+	}
+}
+
+func TestMemoryIdempotencyRepository(t *testing.T) {
+	repo := repository.NewMemoryIdempotencyRepository()
+	ctx := context.Background()
+
+	record := model.IdempotencyRecord{Key: "k1", Fingerprint: "f1", ExpiresAt: time.Now().Add(time.Hour)}
+	if existing, err := repo.Reserve(ctx, record); err != nil || existing != nil {
+		t.Fatalf("Reserve = %+v, %v, want a new reservation", existing, err)
+	}
+
+	existing, err := repo.Reserve(ctx, record)
+	if err != nil || existing == nil || existing.Completed() {
+		t.Fatalf("Reserve again = %+v, %v, want the running record", existing, err)
+	}
+
+	record.Status = 201
+	record.Body = []byte(`{"id":1}`)
+	if err := repo.Complete(ctx, record); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+
+	// A completed record is kept for replay, even when released.
+	if err := repo.Release(ctx, record.Key); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	existing, err = repo.Reserve(ctx, record)
+	if err != nil || existing == nil || existing.Status != 201 || string(existing.Body) != `{"id":1}` {
+		t.Fatalf("Reserve after Complete = %+v, %v, want the stored response", existing, err)
+	}
+
+	// A released running record frees the key.
+	other := model.IdempotencyRecord{Key: "k2", ExpiresAt: time.Now().Add(time.Hour)}
+	if _, err := repo.Reserve(ctx, other); err != nil {
+		t.Fatalf("Reserve(k2): %v", err)
+	}
+	if err := repo.Release(ctx, other.Key); err != nil {
+		t.Fatalf("Release(k2): %v", err)
+	}
+	if existing, err := repo.Reserve(ctx, other); err != nil || existing != nil {
+		t.Fatalf("Reserve(k2) after Release = %+v, %v, want a new reservation", existing, err)
+	}
+
+	// Expired records are replaced.
+	expired := model.IdempotencyRecord{Key: "k3", ExpiresAt: time.Now().Add(-time.Second)}
+	if _, err := repo.Reserve(ctx, expired); err != nil {
+		t.Fatalf("Reserve(k3): %v", err)
+	}
+	if existing, err := repo.Reserve(ctx, expired); err != nil || existing != nil {
+		t.Fatalf("Reserve(k3) after expiry = %+v, %v, want a new reservation", existing, err)
+	}
+}
+
+func TestMemoryTransactor(t *testing.T) {
+	products := repository.NewMemoryProductRepository(repository.NewMemoryBrandRepository(model.Brand{ID: 1, Name: "Eiger"}))
+	users := repository.NewMemoryUserRepository()
+	transactor := repository.NewMemoryTransactor(products, users)
+	ctx := context.Background()
+
+	errBoom := errors.New("boom")
+	err := transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if _, err := products.Store(ctx, model.Product{Name: "Kemeja", BrandID: 1}); err != nil {
+			return err
+		}
+		if err := users.Store(ctx, model.User{Email: "budi@example.com", Password: "rahasia123"}); err != nil {
+			return err
+		}
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("WithinTransaction = %v, want %v", err, errBoom)
+	}
+
+	if list, _ := products.Fetch(ctx, 1); len(list) != 0 {
+		t.Fatalf("Fetch after rollback = %+v, want no products", list)
+	}
+	if _, err := users.FindOne(ctx, "budi@example.com", "rahasia123"); err == nil {
+		t.Fatal("FindOne after rollback succeeded, want the user gone")
+	}
+
+	err = transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		_, err := products.Store(ctx, model.Product{Name: "Kemeja", BrandID: 1})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithinTransaction: %v", err)
+	}
+
+	list, _ := products.Fetch(ctx, 1)
+	if len(list) != 1 || list[0].ID != 1 {
+		t.Fatalf("Fetch after commit = %+v, want the product with ID 1 reused after rollback", list)
+	}
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"crud-product/metrics"
+	"crud-product/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+)
+
+// Timeouts bounds how long a single repository call may run. Operations are
+// named "<repository>.<method>", for example "product.fetch".
+type Timeouts struct {
+	Default    time.Duration
+	Operations map[string]time.Duration
+}
+
+// context derives the context for one repository call, starts timing it and
+// opens a span for it. The latency is recorded and the span ended when the
+// returned cancel func runs.
+func (t Timeouts) context(ctx context.Context, operation string) (context.Context, context.CancelFunc) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "repository."+operation, semconv.DBOperationKey.String(operation))
+
+	timeout := t.Default
+	if d, ok := t.Operations[operation]; ok {
+		timeout = d
+	}
+
+	var cancel context.CancelFunc
+	if timeout <= 0 {
+		ctx, cancel = context.WithCancel(ctx)
+	} else {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	return ctx, func() {
+		cancel()
+		span.End()
+		metrics.ObserveQuery(operation, start)
+	}
+}
+
+// Option configures the SQL repository implementations.
+type Option func(*options)
+
+type options struct {
+	timeouts Timeouts
+	replicas *ReplicaSet
+}
+
+func newOptions(opts []Option) options {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithTimeouts sets the per-query deadlines.
+func WithTimeouts(timeouts Timeouts) Option {
+	return func(o *options) {
+		o.timeouts = timeouts
+	}
+}
+
+// WithReplicas routes read-only product and brand queries through the replica set.
+func WithReplicas(replicas *ReplicaSet) Option {
+	return func(o *options) {
+		o.replicas = replicas
+	}
+}
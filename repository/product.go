@@ -2,24 +2,56 @@ package repository
 
 import (
 	"context"
+	"crud-product/logger"
 	"crud-product/model"
 	"database/sql"
-	"fmt"
-
-	log "github.com/sirupsen/logrus"
+	"strings"
 )
 
 type Product struct {
-	DB *sql.DB
+	DB       *sql.DB
+	Dialect  Dialect
+	Timeouts Timeouts
+	Replicas *ReplicaSet
+}
+
+func NewProductRepository(db *sql.DB, opts ...Option) ProductRepository {
+	o := newOptions(opts)
+
+	return &Product{
+		DB:       db,
+		Dialect:  MySQL,
+		Timeouts: o.timeouts,
+		Replicas: o.replicas,
+	}
 }
 
-func NewProductRepository(db *sql.DB) ProductRepository {
+func NewPostgresProductRepository(db *sql.DB, opts ...Option) ProductRepository {
+	o := newOptions(opts)
+
 	return &Product{
-		DB: db,
+		DB:       db,
+		Dialect:  Postgres,
+		Timeouts: o.timeouts,
+		Replicas: o.replicas,
+	}
+}
+
+func NewSQLiteProductRepository(db *sql.DB, opts ...Option) ProductRepository {
+	o := newOptions(opts)
+
+	return &Product{
+		DB:       db,
+		Dialect:  SQLite,
+		Timeouts: o.timeouts,
+		Replicas: o.replicas,
 	}
 }
 
 func (p *Product) Find(ctx context.Context, productID int) (*model.Product, error) {
+	ctx, cancel := p.Timeouts.context(ctx, "product.find")
+	defer cancel()
+
 	query := `
 			SELECT 
 				product_id,
@@ -27,7 +59,10 @@ func (p *Product) Find(ctx context.Context, productID int) (*model.Product, erro
 				path,
 				price,
 				stock,
-			    brand_id
+			    brand_id,
+				COALESCE(sku, ''),
+				COALESCE(external_id, ''),
+				version
 			FROM 
 				product
 			WHERE
@@ -35,10 +70,12 @@ func (p *Product) Find(ctx context.Context, productID int) (*model.Product, erro
 
 	prod := model.Product{}
 
-	err := p.DB.QueryRowContext(ctx, query, productID).Scan(&prod.ID, &prod.Name, &prod.Path, &prod.Price, &prod.Stock, &prod.BrandID)
+	err := p.read(ctx, func(db querier) error {
+		return db.QueryRowContext(ctx, p.Dialect.rebind(query), productID).Scan(&prod.ID, &prod.Name, &prod.Path, &prod.Price, &prod.Stock, &prod.BrandID, &prod.SKU, &prod.ExternalID, &prod.Version)
+	})
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("data not found")
+		return nil, errProductNotFound()
 	}
 
 	if err != nil {
@@ -48,19 +85,362 @@ func (p *Product) Find(ctx context.Context, productID int) (*model.Product, erro
 }
 
 func (p *Product) Fetch(ctx context.Context, brandId int) (result []model.Product, err error) {
+	ctx, cancel := p.Timeouts.context(ctx, "product.fetch")
+	defer cancel()
+
 	query := `
 			SELECT 
 				product_id,
 				name,
 				path,
 				price,
-				stock 
+				stock,
+				brand_id,
+				COALESCE(sku, ''),
+				COALESCE(external_id, ''),
+				version
 			FROM 
 				product
 			WHERE
 				flag_active = 1 AND brand_id = ?`
 
-	rows, err := p.DB.QueryContext(ctx, query, brandId)
+	err = p.read(ctx, func(db querier) error {
+		result, err = p.fetch(ctx, db, query, brandId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// FetchByBrands returns the active products of several brands with one query,
+// keyed by brand ID and ordered by product ID. Brands without products are
+// left out of the map.
+func (p *Product) FetchByBrands(ctx context.Context, brandIDs []int) (map[int][]model.Product, error) {
+	byBrand := map[int][]model.Product{}
+	if len(brandIDs) == 0 {
+		return byBrand, nil
+	}
+
+	ctx, cancel := p.Timeouts.context(ctx, "product.fetch_brands")
+	defer cancel()
+
+	query := `
+			SELECT 
+				product_id,
+				name,
+				path,
+				price,
+				stock,
+				brand_id,
+				COALESCE(sku, ''),
+				COALESCE(external_id, ''),
+				version
+			FROM 
+				product
+			WHERE
+				flag_active = 1 AND brand_id IN (?` + strings.Repeat(", ?", len(brandIDs)-1) + `)
+			ORDER BY product_id`
+
+	args := make([]interface{}, 0, len(brandIDs))
+	for _, id := range brandIDs {
+		args = append(args, id)
+	}
+
+	var result []model.Product
+	err := p.read(ctx, func(db querier) (err error) {
+		result, err = p.fetch(ctx, db, query, args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, prod := range result {
+		byBrand[prod.BrandID] = append(byBrand[prod.BrandID], prod)
+	}
+	return byBrand, nil
+}
+
+// List returns active products ordered by ID, narrowed by the filter and
+// paged with filter.Limit and filter.Offset.
+func (p *Product) List(ctx context.Context, filter model.ProductFilter) (result []model.Product, err error) {
+	ctx, cancel := p.Timeouts.context(ctx, "product.list")
+	defer cancel()
+
+	query := `
+			SELECT 
+				product_id,
+				name,
+				path,
+				price,
+				stock,
+				brand_id,
+				COALESCE(sku, ''),
+				COALESCE(external_id, ''),
+				version
+			FROM 
+				product
+			WHERE
+				flag_active = 1`
+
+	args := []interface{}{}
+	if filter.BrandID > 0 {
+		query += ` AND brand_id = ?`
+		args = append(args, filter.BrandID)
+	}
+	if filter.Name != "" {
+		query += ` AND LOWER(name) LIKE ? ESCAPE '!'`
+		args = append(args, "%"+likeEscaper.Replace(strings.ToLower(filter.Name))+"%")
+	}
+	if filter.InStock {
+		query += ` AND stock > 0`
+	}
+
+	query += ` ORDER BY product_id`
+	if filter.Limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	err = p.read(ctx, func(db querier) error {
+		result, err = p.fetch(ctx, db, query, args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// CountByBrand returns the number of active products of every brand,
+// including brands without any.
+func (p *Product) CountByBrand(ctx context.Context) (map[int]int, error) {
+	ctx, cancel := p.Timeouts.context(ctx, "product.count")
+	defer cancel()
+
+	query := `
+			SELECT 
+				b.brand_id,
+				COUNT(p.product_id)
+			FROM 
+				brand b
+				LEFT JOIN product p ON p.brand_id = b.brand_id AND p.flag_active = 1
+			GROUP BY
+				b.brand_id`
+
+	counts := map[int]int{}
+
+	err := p.read(ctx, func(db querier) error {
+		rows, err := db.QueryContext(ctx, query)
+		if err != nil {
+			return err
+		}
+
+		defer func() {
+			errRow := rows.Close()
+			if errRow != nil {
+				logger.FromContext(ctx).Error(errRow)
+			}
+		}()
+
+		for rows.Next() {
+			var brandID, n int
+			if err := rows.Scan(&brandID, &n); err != nil {
+				return err
+			}
+			counts[brandID] = n
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// FindByRefs returns the active products whose column key, model.ImportKeySKU
+// or model.ImportKeyExternalID, holds one of refs, keyed by that value.
+func (p *Product) FindByRefs(ctx context.Context, key string, refs []string) (map[string]model.Product, error) {
+	byRef := map[string]model.Product{}
+	if len(refs) == 0 {
+		return byRef, nil
+	}
+
+	if key != model.ImportKeySKU && key != model.ImportKeyExternalID {
+		return nil, errUnknownImportKey(key)
+	}
+
+	ctx, cancel := p.Timeouts.context(ctx, "product.find_refs")
+	defer cancel()
+
+	query := `
+			SELECT 
+				product_id,
+				name,
+				path,
+				price,
+				stock,
+				brand_id,
+				COALESCE(sku, ''),
+				COALESCE(external_id, ''),
+				version
+			FROM 
+				product
+			WHERE
+				flag_active = 1 AND ` + key + ` IN (?` + strings.Repeat(", ?", len(refs)-1) + `)`
+
+	args := make([]interface{}, 0, len(refs))
+	for _, ref := range refs {
+		args = append(args, ref)
+	}
+
+	var result []model.Product
+	err := p.read(ctx, func(db querier) (err error) {
+		result, err = p.fetch(ctx, db, query, args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, prod := range result {
+		byRef[prod.Ref(key)] = prod
+	}
+	return byRef, nil
+}
+
+// Iterate streams the products matching filter ordered by ID, deleted ones
+// included when filter.Status asks for them. The query holds its connection
+// until the iterator is closed.
+func (p *Product) Iterate(ctx context.Context, filter model.ExportFilter) (ProductIterator, error) {
+	ctx, cancel := p.Timeouts.context(ctx, "product.export")
+
+	query := `
+			SELECT 
+				product_id,
+				name,
+				path,
+				price,
+				stock,
+				brand_id,
+				COALESCE(sku, ''),
+				COALESCE(external_id, ''),
+				version,
+				flag_active
+			FROM 
+				product`
+
+	conds := []string{}
+	args := []interface{}{}
+	switch filter.Status {
+	case model.StatusAll:
+	case model.StatusDeleted:
+		conds = append(conds, `flag_active = 0`)
+	default:
+		conds = append(conds, `flag_active = 1`)
+	}
+	if filter.BrandID > 0 {
+		conds = append(conds, `brand_id = ?`)
+		args = append(args, filter.BrandID)
+	}
+	switch filter.Stock {
+	case model.StockIn:
+		conds = append(conds, `stock > 0`)
+	case model.StockOut:
+		conds = append(conds, `stock <= 0`)
+	}
+
+	if len(conds) > 0 {
+		query += `
+			WHERE
+				` + strings.Join(conds, " AND ")
+	}
+	query += ` ORDER BY product_id`
+
+	var rows *sql.Rows
+	err := p.read(ctx, func(db querier) (err error) {
+		rows, err = db.QueryContext(ctx, p.Dialect.rebind(query), args...)
+		return err
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return &productRows{ctx: ctx, rows: rows, cancel: cancel}, nil
+}
+
+// productRows is the ProductIterator of Iterate.
+type productRows struct {
+	ctx     context.Context
+	rows    *sql.Rows
+	cancel  context.CancelFunc
+	product model.Product
+	err     error
+}
+
+func (r *productRows) Next() bool {
+	if r.err != nil || !r.rows.Next() {
+		return false
+	}
+
+	var active int
+	t := model.Product{}
+	r.err = r.rows.Scan(
+		&t.ID,
+		&t.Name,
+		&t.Path,
+		&t.Price,
+		&t.Stock,
+		&t.BrandID,
+		&t.SKU,
+		&t.ExternalID,
+		&t.Version,
+		&active,
+	)
+	if r.err != nil {
+		logger.FromContext(r.ctx).Error(r.err)
+		return false
+	}
+
+	t.Deleted = active == 0
+	r.product = t
+	return true
+}
+
+func (r *productRows) Product() model.Product {
+	return r.product
+}
+
+func (r *productRows) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.rows.Err()
+}
+
+func (r *productRows) Close() error {
+	defer r.cancel()
+	return r.rows.Close()
+}
+
+// likeEscaper escapes the LIKE wildcards in a search term, with ! as the
+// escape character since backslashes are read differently by each database.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// nullable stores an empty reference as NULL, which unique indexes allow any
+// number of times.
+func nullable(ref string) interface{} {
+	if ref == "" {
+		return nil
+	}
+	return ref
+}
+
+func (p *Product) fetch(ctx context.Context, db querier, query string, args ...interface{}) (result []model.Product, err error) {
+	rows, err := db.QueryContext(ctx, p.Dialect.rebind(query), args...)
 	if err != nil {
 		return nil, err
 	}
@@ -68,7 +448,7 @@ func (p *Product) Fetch(ctx context.Context, brandId int) (result []model.Produc
 	defer func() {
 		errRow := rows.Close()
 		if errRow != nil {
-			log.Error(errRow)
+			logger.FromContext(ctx).Error(errRow)
 		}
 	}()
 
@@ -82,10 +462,14 @@ func (p *Product) Fetch(ctx context.Context, brandId int) (result []model.Produc
 			&t.Path,
 			&t.Price,
 			&t.Stock,
+			&t.BrandID,
+			&t.SKU,
+			&t.ExternalID,
+			&t.Version,
 		)
 
 		if err != nil {
-			log.Error(err)
+			logger.FromContext(ctx).Error(err)
 			return nil, err
 		}
 
@@ -94,59 +478,214 @@ func (p *Product) Fetch(ctx context.Context, brandId int) (result []model.Produc
 	return result, nil
 }
 
+// Update replaces the product's fields but the SKU and external ID, which only
+// Patch changes, so clients unaware of them do not clear them. A non-zero
+// product.Version makes the update conditional on the stored version.
 func (p *Product) Update(ctx context.Context, product model.Product, productId int) error {
-		query := `
+	ctx, cancel := p.Timeouts.context(ctx, "product.update")
+	defer cancel()
+
+	markWrite(ctx)
+
+	query := `
 				UPDATE 
 				    product
 				SET
 					name = ?, 
 					path = ?, 
 					price = ?, 
-					stock = ?
+					stock = ?,
+					brand_id = ?,
+					version = version + 1
 				WHERE
-					product_id = ?`
+					product_id = ? AND flag_active = 1`
 
-	_, err := p.DB.ExecContext(ctx, query,
-		product.Name, product.Path, product.Price, product.Stock, productId)
+	return p.execVersioned(ctx, query, productId, product.Version,
+		product.Name, product.Path, product.Price, product.Stock, product.BrandID)
+}
 
-	if err != nil {
-		return err
+// Patch updates only the columns whose patch field is set, conditionally on
+// patch.Version when it is non-zero.
+func (p *Product) Patch(ctx context.Context, patch model.ProductPatch, productID int) error {
+	ctx, cancel := p.Timeouts.context(ctx, "product.update")
+	defer cancel()
+
+	sets := []string{}
+	args := []interface{}{}
+	set := func(column string, value interface{}) {
+		sets = append(sets, column+" = ?")
+		args = append(args, value)
 	}
-	return nil
+
+	if patch.Name != nil {
+		set("name", *patch.Name)
+	}
+	if patch.Path != nil {
+		set("path", *patch.Path)
+	}
+	if patch.Price != nil {
+		set("price", *patch.Price)
+	}
+	if patch.Stock != nil {
+		set("stock", *patch.Stock)
+	}
+	if patch.BrandID != nil {
+		set("brand_id", *patch.BrandID)
+	}
+	if patch.SKU != nil {
+		set("sku", nullable(*patch.SKU))
+	}
+	if patch.ExternalID != nil {
+		set("external_id", nullable(*patch.ExternalID))
+	}
+
+	if len(sets) == 0 {
+		return p.checkVersion(ctx, productID, patch.Version)
+	}
+
+	markWrite(ctx)
+
+	query := `
+				UPDATE 
+				    product
+				SET
+					` + strings.Join(sets, ", ") + `,
+					version = version + 1
+				WHERE
+					product_id = ? AND flag_active = 1`
+
+	return p.execVersioned(ctx, query, productID, patch.Version, args...)
 }
 
-func (p *Product) Store(ctx context.Context, product model.Product) error {
+// Store inserts the product and returns its new ID.
+func (p *Product) Store(ctx context.Context, product model.Product) (int, error) {
+	ctx, cancel := p.Timeouts.context(ctx, "product.store")
+	defer cancel()
+
+	markWrite(ctx)
 
 	query := `
 			INSERT INTO product
-				(name, path, price, stock, brand_id)
+				(name, path, price, stock, brand_id, sku, external_id)
 			VALUES
-				(?, ?, ?, ?, ?)`
+				(?, ?, ?, ?, ?, ?, ?)`
 
-	_, err := p.DB.ExecContext(ctx, query,
-		product.Name, product.Path, product.Price, product.Stock, product.BrandID)
+	args := []interface{}{product.Name, product.Path, product.Price, product.Stock, product.BrandID, nullable(product.SKU), nullable(product.ExternalID)}
+
+	id, err := p.Dialect.InsertID(ctx, conn(ctx, p.DB), query, "product_id", args...)
+
+	if isForeignKeyViolation(err) {
+		return 0, errUnknownBrand()
+	}
+
+	if isUniqueViolation(err) {
+		return 0, errRefTaken(err)
+	}
 
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+	return int(id), nil
 }
 
-func (p *Product) Delete(ctx context.Context, productID int) error {
+// Delete soft-deletes the product, conditionally on version when it is
+// non-zero. The SKU and external ID are cleared so new products can take them.
+func (p *Product) Delete(ctx context.Context, productID int, version int) error {
+	ctx, cancel := p.Timeouts.context(ctx, "product.delete")
+	defer cancel()
+
+	markWrite(ctx)
+
 	query := `
 				UPDATE 
 					product
 				SET
-					flag_active = 0
+					flag_active = 0,
+					sku = NULL,
+					external_id = NULL,
+					version = version + 1
 				WHERE
-					product_id = ?
-			`
+					product_id = ? AND flag_active = 1`
+
+	return p.execVersioned(ctx, query, productID, version)
+}
 
-	_, err := p.DB.ExecContext(ctx, query, productID)
+// checkVersion fails with not found unless the product is active, and with a
+// version mismatch unless it is at version or version is zero.
+func (p *Product) checkVersion(ctx context.Context, productID int, version int) error {
+	query := `
+			SELECT 
+				version
+			FROM 
+				product
+			WHERE
+				product_id = ? AND flag_active = 1`
+
+	var current int
+	err := conn(ctx, p.DB).QueryRowContext(ctx, p.Dialect.rebind(query), productID).Scan(&current)
+	if err == sql.ErrNoRows {
+		return errProductNotFound()
+	}
+	if err != nil {
+		return err
+	}
+
+	if version != 0 && current != version {
+		return errVersionMismatch()
+	}
+	return nil
+}
+
+// execVersioned runs a write against one active product; query ends with the
+// product ID placeholder, which follows args. With a non-zero version the
+// write only applies while the row is still at that version. A write that
+// matches nothing is reported as not found, or as a version mismatch when the
+// product exists.
+func (p *Product) execVersioned(ctx context.Context, query string, productID int, version int, args ...interface{}) error {
+	args = append(args, productID)
+	if version > 0 {
+		query += ` AND version = ?`
+		args = append(args, version)
+	}
+
+	res, err := conn(ctx, p.DB).ExecContext(ctx, p.Dialect.rebind(query), args...)
+
+	if isForeignKeyViolation(err) {
+		return errUnknownBrand()
+	}
+
+	if isUniqueViolation(err) {
+		return errRefTaken(err)
+	}
 
 	if err != nil {
 		return err
 	}
 
+	// Every write bumps the version, so a matched row always counts as
+	// affected, even on MySQL.
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		if err := p.checkVersion(ctx, productID, 0); err != nil {
+			return err
+		}
+		return errVersionMismatch()
+	}
 	return nil
-}
\ No newline at end of file
+}
+
+func (p *Product) read(ctx context.Context, fn func(querier) error) error {
+	return read(ctx, p.DB, p.Replicas, fn)
+}
+
+// read runs a read-only query on a replica when replicas are configured and
+// the call is not part of a transaction.
+func read(ctx context.Context, db *sql.DB, replicas *ReplicaSet, fn func(querier) error) error {
+	if replicas == nil || inTransaction(ctx) {
+		return fn(conn(ctx, db))
+	}
+	return replicas.read(ctx, fn)
+}
@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"crud-product/model"
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimitStore keeps the token buckets and daily counters behind rate
+// limiting.
+type RateLimitStore interface {
+	// Take removes a token from the bucket at key, which refills as limit
+	// describes and starts full. It reports whether a token was available and
+	// how many are left.
+	Take(ctx context.Context, key string, limit model.RateLimit) (bool, float64, error)
+	// Incr adds one to the counter at key and returns the new count. The
+	// counter is dropped at expiresAt.
+	Incr(ctx context.Context, key string, expiresAt time.Time) (int64, error)
+}
+
+// refill returns the tokens in a bucket that held tokens elapsed ago.
+func refill(tokens float64, elapsed time.Duration, limit model.RateLimit) float64 {
+	if elapsed <= 0 {
+		return tokens
+	}
+	tokens += elapsed.Seconds() * float64(limit.Rate) / time.Duration(limit.Period).Seconds()
+	return math.Min(tokens, float64(limit.Burst))
+}
+
+// sweepInterval is how often MemoryRateLimit drops full buckets and expired
+// counters.
+const sweepInterval = time.Minute
+
+// MemoryRateLimit is a RateLimitStore for a single process.
+type MemoryRateLimit struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	counters  map[string]*dailyCounter
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	// fullAt is when the bucket is back to its burst, after which it can be
+	// forgotten: a new bucket starts full.
+	fullAt time.Time
+}
+
+type dailyCounter struct {
+	count     int64
+	expiresAt time.Time
+}
+
+func NewMemoryRateLimit() *MemoryRateLimit {
+	return &MemoryRateLimit{
+		buckets:   map[string]*tokenBucket{},
+		counters:  map[string]*dailyCounter{},
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *MemoryRateLimit) Take(ctx context.Context, key string, limit model.RateLimit) (bool, float64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(limit.Burst), updated: now}
+		m.buckets[key] = b
+	}
+
+	b.tokens = refill(b.tokens, now.Sub(b.updated), limit)
+	b.updated = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	missing := float64(limit.Burst) - b.tokens
+	b.fullAt = now.Add(time.Duration(missing / float64(limit.Rate) * float64(limit.Period)))
+	return allowed, b.tokens, nil
+}
+
+func (m *MemoryRateLimit) Incr(ctx context.Context, key string, expiresAt time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.sweep(now)
+
+	c, ok := m.counters[key]
+	if !ok || !now.Before(c.expiresAt) {
+		c = &dailyCounter{expiresAt: expiresAt}
+		m.counters[key] = c
+	}
+
+	c.count++
+	return c.count, nil
+}
+
+// sweep keeps memory bounded by the number of recently active clients. The
+// caller holds m.mu.
+func (m *MemoryRateLimit) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+
+	for key, b := range m.buckets {
+		if !now.Before(b.fullAt) {
+			delete(m.buckets, key)
+		}
+	}
+	for key, c := range m.counters {
+		if !now.Before(c.expiresAt) {
+			delete(m.counters, key)
+		}
+	}
+}
+
+// takeScript is Take as one atomic step, so replicas sharing a bucket cannot
+// both spend its last token. The server clock is used so replicas agree on
+// the time. Tokens are returned as a string because Redis truncates Lua
+// numbers to integers.
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = t[1] * 1000 + math.floor(t[2] / 1000)
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(bucket[1]) or burst
+local updated = tonumber(bucket[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - updated) * rate)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// RedisRateLimit is a RateLimitStore shared by every replica through Redis or
+// any server speaking its protocol. Keys are namespaced with Prefix.
+type RedisRateLimit struct {
+	Client *redis.Client
+	Prefix string
+}
+
+func NewRedisRateLimit(client *redis.Client, prefix string) *RedisRateLimit {
+	return &RedisRateLimit{
+		Client: client,
+		Prefix: prefix,
+	}
+}
+
+func (r *RedisRateLimit) Take(ctx context.Context, key string, limit model.RateLimit) (bool, float64, error) {
+	perMilli := float64(limit.Rate) / float64(time.Duration(limit.Period).Milliseconds())
+
+	res, err := takeScript.Run(ctx, r.Client, []string{r.Prefix + key},
+		strconv.FormatFloat(perMilli, 'g', -1, 64), limit.Burst).Slice()
+	if err != nil {
+		return false, 0, err
+	}
+
+	allowed, _ := res[0].(int64)
+	tokens, err := strconv.ParseFloat(res[1].(string), 64)
+	if err != nil {
+		return false, 0, err
+	}
+	return allowed == 1, tokens, nil
+}
+
+func (r *RedisRateLimit) Incr(ctx context.Context, key string, expiresAt time.Time) (int64, error) {
+	pipe := r.Client.TxPipeline()
+	incr := pipe.Incr(ctx, r.Prefix+key)
+	pipe.ExpireAt(ctx, r.Prefix+key, expiresAt)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"crud-product/model"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMemoryRateLimit(t *testing.T) {
+	m := NewMemoryRateLimit()
+
+	testRateLimitStore(t, m, time.Now, func(d time.Duration) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		for _, b := range m.buckets {
+			b.updated = b.updated.Add(-d)
+			b.fullAt = b.fullAt.Add(-d)
+		}
+		for _, c := range m.counters {
+			c.expiresAt = c.expiresAt.Add(-d)
+		}
+	})
+}
+
+func TestMemoryRateLimitSweep(t *testing.T) {
+	m := NewMemoryRateLimit()
+	ctx := context.Background()
+	limit := model.RateLimit{Rate: 1, Period: model.Duration(time.Second), Burst: 2}
+
+	m.Take(ctx, "full", limit)
+	m.Take(ctx, "empty", limit)
+	m.Take(ctx, "empty", limit)
+	m.Incr(ctx, "expired", time.Now().Add(time.Second))
+	m.Incr(ctx, "current", time.Now().Add(time.Hour))
+
+	// A second later "full" is back to its burst, "empty" is not, and the
+	// counter of "expired" is over.
+	m.mu.Lock()
+	for _, b := range m.buckets {
+		b.fullAt = b.fullAt.Add(-time.Second)
+	}
+	m.counters["expired"].expiresAt = time.Now()
+	m.lastSweep = time.Now().Add(-sweepInterval)
+	m.mu.Unlock()
+
+	m.Take(ctx, "other", limit)
+
+	if _, ok := m.buckets["full"]; ok {
+		t.Fatal("full bucket kept after the sweep")
+	}
+	if _, ok := m.buckets["empty"]; !ok {
+		t.Fatal("bucket that is still refilling dropped by the sweep")
+	}
+	if _, ok := m.counters["expired"]; ok {
+		t.Fatal("expired counter kept after the sweep")
+	}
+	if _, ok := m.counters["current"]; !ok {
+		t.Fatal("current counter dropped by the sweep")
+	}
+}
+
+func TestRedisRateLimit(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	// The script reads the time from the server, so the test moves the
+	// server's clock.
+	now := time.Now()
+	server.SetTime(now)
+
+	store := NewRedisRateLimit(client, "test:")
+	testRateLimitStore(t, store, func() time.Time { return now }, func(d time.Duration) {
+		now = now.Add(d)
+		server.SetTime(now)
+		server.FastForward(d)
+	})
+
+	// Buckets expire once they would be full again, so idle clients cost
+	// nothing.
+	limit := model.RateLimit{Rate: 2, Period: model.Duration(time.Second), Burst: 4}
+	if _, _, err := store.Take(context.Background(), "idle", limit); err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	if ttl := server.TTL("test:idle"); ttl <= 0 || ttl > 2*time.Second {
+		t.Fatalf("bucket TTL = %v, want the refill time of one token plus a second", ttl)
+	}
+}
+
+// testRateLimitStore checks the behaviour every RateLimitStore shares. now
+// reads the store's clock and advance moves it forward by d.
+func testRateLimitStore(t *testing.T, store RateLimitStore, now func() time.Time, advance func(d time.Duration)) {
+	ctx := context.Background()
+	limit := model.RateLimit{Rate: 2, Period: model.Duration(time.Minute), Burst: 3}
+
+	t.Run("burst", func(t *testing.T) {
+		for i := 0; i < limit.Burst; i++ {
+			allowed, tokens, err := store.Take(ctx, "burst", limit)
+			if err != nil || !allowed || int(tokens+0.5) != limit.Burst-i-1 {
+				t.Fatalf("Take %d = %v, %v, %v, want allowed with %d left", i, allowed, tokens, err, limit.Burst-i-1)
+			}
+		}
+
+		allowed, tokens, err := store.Take(ctx, "burst", limit)
+		if err != nil || allowed || tokens >= 1 {
+			t.Fatalf("Take past the burst = %v, %v, %v, want refused", allowed, tokens, err)
+		}
+
+		// Other keys have buckets of their own.
+		if allowed, _, err := store.Take(ctx, "burst-other", limit); err != nil || !allowed {
+			t.Fatalf("Take of another key = %v, %v, want allowed", allowed, err)
+		}
+	})
+
+	t.Run("refill", func(t *testing.T) {
+		for i := 0; i < limit.Burst; i++ {
+			store.Take(ctx, "refill", limit)
+		}
+
+		// Half a period adds one of the two tokens.
+		advance(time.Duration(limit.Period) / 2)
+		if allowed, _, err := store.Take(ctx, "refill", limit); err != nil || !allowed {
+			t.Fatalf("Take after half a period = %v, %v, want allowed", allowed, err)
+		}
+		if allowed, _, err := store.Take(ctx, "refill", limit); err != nil || allowed {
+			t.Fatalf("second Take after half a period = %v, %v, want refused", allowed, err)
+		}
+
+		// A long pause refills no further than the burst.
+		advance(time.Hour)
+		for i := 0; i < limit.Burst; i++ {
+			if allowed, _, err := store.Take(ctx, "refill", limit); err != nil || !allowed {
+				t.Fatalf("Take %d after an hour = %v, %v, want allowed", i, allowed, err)
+			}
+		}
+		if allowed, _, err := store.Take(ctx, "refill", limit); err != nil || allowed {
+			t.Fatalf("Take past the burst after an hour = %v, %v, want refused", allowed, err)
+		}
+	})
+
+	t.Run("counter", func(t *testing.T) {
+		expiresAt := now().Add(time.Hour)
+		for want := int64(1); want <= 3; want++ {
+			if got, err := store.Incr(ctx, "counter", expiresAt); err != nil || got != want {
+				t.Fatalf("Incr = %d, %v, want %d", got, err, want)
+			}
+		}
+
+		// The counter starts over once it expires, as daily quotas do at
+		// midnight.
+		advance(time.Hour + time.Second)
+		if got, err := store.Incr(ctx, "counter", now().Add(2*time.Hour)); err != nil || got != 1 {
+			t.Fatalf("Incr after expiry = %d, %v, want 1", got, err)
+		}
+	})
+}
@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"crud-product/logger"
+	"github.com/go-sql-driver/mysql"
+)
+
+// ReplicaSet routes read-only queries to healthy read replicas. Replicas are
+// pinged in the background; when none is healthy, or the request has already
+// written through this repository layer, reads go to the primary.
+type ReplicaSet struct {
+	primary  *sql.DB
+	replicas []*replica
+	next     uint32
+
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+type replica struct {
+	db      *sql.DB
+	healthy int32
+}
+
+// NewReplicaSet checks every replica once and then keeps checking them every
+// interval until Close is called.
+func NewReplicaSet(primary *sql.DB, replicas []*sql.DB, interval time.Duration) *ReplicaSet {
+	r := &ReplicaSet{
+		primary: primary,
+		stop:    make(chan struct{}),
+	}
+
+	for _, db := range replicas {
+		r.replicas = append(r.replicas, &replica{db: db})
+	}
+
+	r.checkHealth(context.Background())
+
+	if interval > 0 && len(r.replicas) > 0 {
+		r.done.Add(1)
+		go r.healthLoop(interval)
+	}
+
+	return r
+}
+
+// Close stops the health checks and closes the replica pools.
+func (r *ReplicaSet) Close() error {
+	close(r.stop)
+	r.done.Wait()
+
+	var firstErr error
+	for _, rep := range r.replicas {
+		if err := rep.db.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (r *ReplicaSet) healthLoop(interval time.Duration) {
+	defer r.done.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.checkHealth(context.Background())
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// checkHealth pings every replica, each with a timeout derived from ctx, and
+// logs with ctx when one changes state.
+func (r *ReplicaSet) checkHealth(ctx context.Context) {
+	for i, rep := range r.replicas {
+		pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		err := rep.db.PingContext(pingCtx)
+		cancel()
+
+		if err != nil {
+			if atomic.SwapInt32(&rep.healthy, 0) == 1 {
+				logger.FromContext(ctx).WithError(err).WithField("replica", i).Warn("read replica is unhealthy")
+			}
+			continue
+		}
+
+		if atomic.SwapInt32(&rep.healthy, 1) == 0 {
+			logger.FromContext(ctx).WithField("replica", i).Info("read replica is healthy")
+		}
+	}
+}
+
+// pick returns the next healthy replica in round-robin order, or nil.
+func (r *ReplicaSet) pick() *replica {
+	n := len(r.replicas)
+	start := int(atomic.AddUint32(&r.next, 1))
+
+	for i := 0; i < n; i++ {
+		rep := r.replicas[(start+i)%n]
+		if atomic.LoadInt32(&rep.healthy) == 1 {
+			return rep
+		}
+	}
+	return nil
+}
+
+// read runs fn against a replica when one may be used, and retries it on the
+// primary if the replica cannot be reached. Errors of the query itself are
+// returned as they are: the primary would fail the same way.
+func (r *ReplicaSet) read(ctx context.Context, fn func(querier) error) error {
+	if len(r.replicas) == 0 || wroteIn(ctx) {
+		return fn(r.primary)
+	}
+
+	rep := r.pick()
+	if rep == nil {
+		return fn(r.primary)
+	}
+
+	err := fn(rep.db)
+	if !connectionFailed(err) || ctx.Err() != nil {
+		return err
+	}
+
+	atomic.StoreInt32(&rep.healthy, 0)
+	logger.FromContext(ctx).WithError(err).Warn("read replica failed, falling back to primary")
+
+	return fn(r.primary)
+}
+
+// connectionFailed reports whether err means the database could not be
+// reached, rather than that it refused the query.
+func connectionFailed(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) || errors.As(err, &netErr)
+}
+
+type sessionKey struct{}
+
+type session struct {
+	wrote int32
+}
+
+// WithSession marks ctx as one request. Once a write has gone through the
+// repositories with this context, later reads on it are served by the primary
+// so the request sees its own writes.
+func WithSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionKey{}, &session{})
+}
+
+func markWrite(ctx context.Context) {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok {
+		atomic.StoreInt32(&s.wrote, 1)
+	}
+}
+
+func wroteIn(ctx context.Context) bool {
+	s, ok := ctx.Value(sessionKey{}).(*session)
+	return ok && atomic.LoadInt32(&s.wrote) == 1
+}
@@ -0,0 +1,87 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"crud-product/logger"
+	"crud-product/repository"
+	"crud-product/repository/repotest"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+// unreachableDriver opens connections that answer pings but fail every query
+// as if the connection had dropped.
+type unreachableDriver struct{}
+
+type unreachableConn struct{}
+
+func (unreachableDriver) Open(string) (driver.Conn, error) { return unreachableConn{}, nil }
+
+func (unreachableConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrBadConn }
+func (unreachableConn) Close() error                        { return nil }
+func (unreachableConn) Begin() (driver.Tx, error)           { return nil, driver.ErrBadConn }
+func (unreachableConn) Ping(context.Context) error          { return nil }
+
+func init() {
+	sql.Register("unreachable", unreachableDriver{})
+}
+
+func TestReplicaFallbackLogsWithRequestFields(t *testing.T) {
+	primary := repotest.NewSQLite(t)
+	brandID := repotest.SeedBrand(t, primary, repository.SQLite, "Erigo")
+
+	replica, err := sql.Open("unreachable", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replica.Close()
+
+	replicas := repository.NewReplicaSet(primary, []*sql.DB{replica}, time.Hour)
+	defer replicas.Close()
+
+	log, hook := test.NewNullLogger()
+	ctx := logger.WithEntry(context.Background(), log.WithField("request_id", "req-1"))
+
+	repo := repository.NewSQLiteBrandRepository(primary, repository.WithReplicas(replicas))
+	if _, err := repo.Find(ctx, brandID); err != nil {
+		t.Fatalf("Find through an unreachable replica: %v", err)
+	}
+
+	entry := hook.LastEntry()
+	if entry == nil || entry.Level != logrus.WarnLevel || entry.Data["request_id"] != "req-1" {
+		t.Fatalf("last log entry = %+v, want a warning carrying the request ID", entry)
+	}
+}
+
+func TestReplicaQueryErrorsAreReturned(t *testing.T) {
+	primary := repotest.NewSQLite(t)
+	brandID := repotest.SeedBrand(t, primary, repository.SQLite, "Erigo")
+
+	// The replica is reachable but has no schema, so the query itself fails.
+	// That is the query's fault, not the replica's, and is not retried.
+	replica, err := sql.Open("sqlite", repository.SQLiteDSN(filepath.Join(t.TempDir(), "replica.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replica.Close()
+
+	replicas := repository.NewReplicaSet(primary, []*sql.DB{replica}, time.Hour)
+	defer replicas.Close()
+
+	log, hook := test.NewNullLogger()
+	ctx := logger.WithEntry(context.Background(), log.WithField("request_id", "req-1"))
+
+	repo := repository.NewSQLiteBrandRepository(primary, repository.WithReplicas(replicas))
+	if _, err := repo.Find(ctx, brandID); err == nil {
+		t.Fatal("Find with a failing query succeeded on the primary, want the replica's error")
+	}
+	if len(hook.AllEntries()) != 0 {
+		t.Fatalf("logged %v, want no fallback", hook.AllEntries())
+	}
+}
@@ -0,0 +1,449 @@
+// Package repotest is the conformance suite shared by every implementation of
+// repository.ProductRepository, repository.UserRepository and
+// repository.ImportJobRepository. Backend tests call these functions with a
+// freshly migrated, empty database.
+package repotest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"crud-product/model"
+	"crud-product/repository"
+)
+
+// ProductRepository exercises the full product lifecycle. brandID and
+// emptyBrandID must refer to two existing brands that have no products yet;
+// emptyBrandID is left without any.
+func ProductRepository(t *testing.T, repo repository.ProductRepository, brandID, emptyBrandID int) {
+	t.Helper()
+	ctx := context.Background()
+
+	for _, p := range []model.Product{
+		{Name: "Kemeja", Path: "upload/kemeja", Price: 150000, Stock: 10, BrandID: brandID},
+		{Name: "Celana", Path: "upload/celana", Price: 200000, Stock: 5, BrandID: brandID},
+	} {
+		id, err := repo.Store(ctx, p)
+		if err != nil {
+			t.Fatalf("Store(%s): %v", p.Name, err)
+		}
+		if id == 0 {
+			t.Fatalf("Store(%s) returned no ID", p.Name)
+		}
+	}
+
+	list, err := repo.Fetch(ctx, brandID)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("Fetch returned %d products, want 2", len(list))
+	}
+
+	other, err := repo.Fetch(ctx, brandID+1000)
+	if err != nil {
+		t.Fatalf("Fetch other brand: %v", err)
+	}
+	if len(other) != 0 {
+		t.Fatalf("Fetch other brand returned %d products, want 0", len(other))
+	}
+
+	page, err := repo.List(ctx, model.ProductFilter{BrandID: brandID, Limit: 1, Offset: 1})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(page) != 1 || page[0].ID != list[1].ID {
+		t.Fatalf("List second page = %+v, want [%+v]", page, list[1])
+	}
+
+	byBrand, err := repo.FetchByBrands(ctx, []int{brandID, brandID + 1000})
+	if err != nil {
+		t.Fatalf("FetchByBrands: %v", err)
+	}
+	if len(byBrand) != 1 || len(byBrand[brandID]) != 2 {
+		t.Fatalf("FetchByBrands = %+v, want the 2 products of brand %d only", byBrand, brandID)
+	}
+
+	found, err := repo.List(ctx, model.ProductFilter{Name: "KEMEJA", InStock: true})
+	if err != nil {
+		t.Fatalf("List by name: %v", err)
+	}
+	if len(found) != 1 || found[0].Name != "Kemeja" {
+		t.Fatalf("List by name = %+v, want only Kemeja", found)
+	}
+
+	id := list[0].ID
+	got, err := repo.Find(ctx, id)
+	if err != nil {
+		t.Fatalf("Find(%d): %v", id, err)
+	}
+	if got.Name != list[0].Name || got.Price != list[0].Price || got.BrandID != brandID || got.Version != 1 {
+		t.Fatalf("Find(%d) = %+v, want %+v", id, got, list[0])
+	}
+
+	update := model.Product{Name: "Kemeja Flanel", Path: "upload/flanel", Price: 175000, Stock: 7, BrandID: brandID}
+	if err := repo.Update(ctx, update, id); err != nil {
+		t.Fatalf("Update(%d): %v", id, err)
+	}
+
+	got, err = repo.Find(ctx, id)
+	if err != nil {
+		t.Fatalf("Find(%d) after update: %v", id, err)
+	}
+	if got.Name != update.Name || got.Path != update.Path || got.Price != update.Price || got.Stock != update.Stock {
+		t.Fatalf("Find(%d) after update = %+v, want %+v", id, got, update)
+	}
+
+	price := 160000
+	if err := repo.Patch(ctx, model.ProductPatch{Price: &price}, id); err != nil {
+		t.Fatalf("Patch(%d): %v", id, err)
+	}
+
+	got, err = repo.Find(ctx, id)
+	if err != nil {
+		t.Fatalf("Find(%d) after patch: %v", id, err)
+	}
+	if got.Price != price || got.Name != update.Name || got.Path != update.Path || got.Stock != update.Stock || got.Version != 3 {
+		t.Fatalf("Find(%d) after patch = %+v, want price %d and other fields unchanged", id, got, price)
+	}
+
+	stale := model.ProductPatch{Price: &price, Version: got.Version - 1}
+	if err := repo.Patch(ctx, stale, id); !errors.Is(err, model.ErrPreconditionFailed) {
+		t.Fatalf("Patch(%d) with stale version = %v, want precondition failed", id, err)
+	}
+
+	if err := repo.Delete(ctx, id, got.Version-1); !errors.Is(err, model.ErrPreconditionFailed) {
+		t.Fatalf("Delete(%d) with stale version = %v, want precondition failed", id, err)
+	}
+
+	if err := repo.Delete(ctx, id, got.Version); err != nil {
+		t.Fatalf("Delete(%d): %v", id, err)
+	}
+
+	if _, err := repo.Find(ctx, id); err == nil {
+		t.Fatalf("Find(%d) after delete succeeded, want error", id)
+	}
+
+	list, err = repo.Fetch(ctx, brandID)
+	if err != nil {
+		t.Fatalf("Fetch after delete: %v", err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("Fetch after delete returned %d products, want 1", len(list))
+	}
+
+	productMissing(t, repo, id, got.Version+1)
+	productMissing(t, repo, id+1000, 1)
+
+	productRefs(t, repo, brandID, list[0].ID)
+	productIterate(t, repo, brandID, id)
+	productBrands(t, repo, brandID, emptyBrandID)
+}
+
+// productBrands checks that products only belong to existing brands and that
+// CountByBrand counts every brand, emptyBrandID with none.
+func productBrands(t *testing.T, repo repository.ProductRepository, brandID, emptyBrandID int) {
+	t.Helper()
+	ctx := context.Background()
+
+	unknown := brandID + emptyBrandID + 1000
+	var domainErr *model.Error
+	if _, err := repo.Store(ctx, model.Product{Name: "Topi", Price: 1, BrandID: unknown}); !errors.As(err, &domainErr) || domainErr.Code != "unknown_brand" {
+		t.Fatalf("Store with unknown brand %d = %v, want unknown_brand", unknown, err)
+	}
+
+	list, err := repo.Fetch(ctx, brandID)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if err := repo.Patch(ctx, model.ProductPatch{BrandID: &unknown}, list[0].ID); !errors.As(err, &domainErr) || domainErr.Code != "unknown_brand" {
+		t.Fatalf("Patch(%d) to unknown brand %d = %v, want unknown_brand", list[0].ID, unknown, err)
+	}
+
+	counts, err := repo.CountByBrand(ctx)
+	if err != nil {
+		t.Fatalf("CountByBrand: %v", err)
+	}
+	if n, ok := counts[emptyBrandID]; !ok || n != 0 || counts[brandID] != len(list) {
+		t.Fatalf("CountByBrand = %v, want %d for brand %d and 0 for brand %d", counts, len(list), brandID, emptyBrandID)
+	}
+}
+
+// productMissing checks that writes to a deleted or unknown product fail with
+// not found, with or without its version.
+func productMissing(t *testing.T, repo repository.ProductRepository, id, version int) {
+	t.Helper()
+	ctx := context.Background()
+
+	stock := 1
+	for _, v := range []int{0, version} {
+		if err := repo.Update(ctx, model.Product{Name: "Topi", Price: 1, BrandID: 1, Version: v}, id); !errors.Is(err, model.ErrNotFound) {
+			t.Errorf("Update(%d) at version %d = %v, want not found", id, v, err)
+		}
+		if err := repo.Patch(ctx, model.ProductPatch{Stock: &stock, Version: v}, id); !errors.Is(err, model.ErrNotFound) {
+			t.Errorf("Patch(%d) at version %d = %v, want not found", id, v, err)
+		}
+		if err := repo.Patch(ctx, model.ProductPatch{Version: v}, id); !errors.Is(err, model.ErrNotFound) {
+			t.Errorf("empty Patch(%d) at version %d = %v, want not found", id, v, err)
+		}
+		if err := repo.Delete(ctx, id, v); !errors.Is(err, model.ErrNotFound) {
+			t.Errorf("Delete(%d) at version %d = %v, want not found", id, v, err)
+		}
+	}
+}
+
+// productRefs checks that SKUs and external IDs are unique, found by
+// FindByRefs and freed by Delete. otherID is an active product without either.
+func productRefs(t *testing.T, repo repository.ProductRepository, brandID, otherID int) {
+	t.Helper()
+	ctx := context.Background()
+
+	hat := model.Product{Name: "Topi", Price: 50000, Stock: 3, BrandID: brandID, SKU: "TOPI-1", ExternalID: "ext-1"}
+	id, err := repo.Store(ctx, hat)
+	if err != nil {
+		t.Fatalf("Store(%s): %v", hat.Name, err)
+	}
+
+	if _, err := repo.Store(ctx, model.Product{Name: "Topi 2", BrandID: brandID, SKU: hat.SKU}); !errors.Is(err, model.ErrConflict) {
+		t.Fatalf("Store with a taken SKU = %v, want conflict", err)
+	}
+
+	if err := repo.Patch(ctx, model.ProductPatch{ExternalID: &hat.ExternalID}, otherID); !errors.Is(err, model.ErrConflict) {
+		t.Fatalf("Patch(%d) with a taken external ID = %v, want conflict", otherID, err)
+	}
+
+	bySKU, err := repo.FindByRefs(ctx, model.ImportKeySKU, []string{hat.SKU, "TOPI-404"})
+	if err != nil {
+		t.Fatalf("FindByRefs(sku): %v", err)
+	}
+	if got, ok := bySKU[hat.SKU]; len(bySKU) != 1 || !ok || got.ID != id || got.ExternalID != hat.ExternalID {
+		t.Fatalf("FindByRefs(sku) = %+v, want only product %d", bySKU, id)
+	}
+
+	byExternalID, err := repo.FindByRefs(ctx, model.ImportKeyExternalID, []string{hat.ExternalID})
+	if err != nil {
+		t.Fatalf("FindByRefs(external_id): %v", err)
+	}
+	if got, ok := byExternalID[hat.ExternalID]; len(byExternalID) != 1 || !ok || got.ID != id {
+		t.Fatalf("FindByRefs(external_id) = %+v, want only product %d", byExternalID, id)
+	}
+
+	if _, err := repo.FindByRefs(ctx, "name", []string{hat.Name}); !errors.Is(err, model.ErrValidation) {
+		t.Fatalf("FindByRefs(name) = %v, want validation error", err)
+	}
+
+	if err := repo.Delete(ctx, id, 0); err != nil {
+		t.Fatalf("Delete(%d): %v", id, err)
+	}
+
+	if _, err := repo.Store(ctx, hat); err != nil {
+		t.Fatalf("Store with the SKU of a deleted product: %v", err)
+	}
+}
+
+// productIterate checks the filters of Iterate. deletedID is a deleted product
+// of the brand.
+func productIterate(t *testing.T, repo repository.ProductRepository, brandID, deletedID int) {
+	t.Helper()
+	ctx := context.Background()
+
+	active, err := repo.Fetch(ctx, brandID)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+
+	got := iterate(t, repo, model.ExportFilter{BrandID: brandID})
+	if len(got) != len(active) {
+		t.Fatalf("Iterate(active) returned %d products, want %d", len(got), len(active))
+	}
+	for i, prod := range got {
+		if prod.Deleted || (i > 0 && prod.ID <= got[i-1].ID) {
+			t.Fatalf("Iterate(active) = %+v, want active products ordered by ID", got)
+		}
+	}
+
+	deleted := iterate(t, repo, model.ExportFilter{BrandID: brandID, Status: model.StatusDeleted})
+	found := false
+	for _, prod := range deleted {
+		if !prod.Deleted {
+			t.Fatalf("Iterate(deleted) returned active product %d", prod.ID)
+		}
+		found = found || prod.ID == deletedID
+	}
+	if !found {
+		t.Fatalf("Iterate(deleted) = %+v, want product %d among them", deleted, deletedID)
+	}
+
+	all := iterate(t, repo, model.ExportFilter{BrandID: brandID, Status: model.StatusAll})
+	if len(all) != len(active)+len(deleted) {
+		t.Fatalf("Iterate(all) returned %d products, want %d", len(all), len(active)+len(deleted))
+	}
+
+	if out := iterate(t, repo, model.ExportFilter{BrandID: brandID, Stock: model.StockOut}); len(out) != 0 {
+		t.Fatalf("Iterate(out of stock) = %+v, want none", out)
+	}
+
+	if other := iterate(t, repo, model.ExportFilter{BrandID: brandID + 1000, Status: model.StatusAll}); len(other) != 0 {
+		t.Fatalf("Iterate(other brand) = %+v, want none", other)
+	}
+}
+
+func iterate(t *testing.T, repo repository.ProductRepository, filter model.ExportFilter) []model.Product {
+	t.Helper()
+
+	it, err := repo.Iterate(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("Iterate(%+v): %v", filter, err)
+	}
+	defer it.Close()
+
+	var products []model.Product
+	for it.Next() {
+		products = append(products, it.Product())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Iterate(%+v): %v", filter, err)
+	}
+	return products
+}
+
+// UserRepository checks registration, password verification and role changes.
+func UserRepository(t *testing.T, repo repository.UserRepository) {
+	t.Helper()
+	ctx := context.Background()
+
+	user := model.User{Name: "Budi", Email: "budi@example.com", Gender: "male", Password: "rahasia123", Role: model.RoleAdmin}
+	if err := repo.Store(ctx, user); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+
+	got, err := repo.FindOne(ctx, user.Email, user.Password)
+	if err != nil {
+		t.Fatalf("FindOne: %v", err)
+	}
+	if got.Email != user.Email || got.Role != user.Role || got.Token == "" {
+		t.Fatalf("FindOne = %+v, want matching user with a token", got)
+	}
+
+	// A failed login hands back nothing, least of all the password hash.
+	if got, err := repo.FindOne(ctx, user.Email, "wrong-password"); err == nil || got != (model.User{}) {
+		t.Fatalf("FindOne with wrong password = %+v, %v, want an error and no user", got, err)
+	}
+
+	if _, err := repo.FindOne(ctx, "nobody@example.com", user.Password); err == nil {
+		t.Fatal("FindOne with unknown email succeeded, want error")
+	}
+
+	// Setting the current role again is no error.
+	for _, role := range []int{model.RoleUser, model.RoleUser, model.RoleAdmin} {
+		if err := repo.SetRole(ctx, user.Email, role); err != nil {
+			t.Fatalf("SetRole(%d): %v", role, err)
+		}
+		if got, err := repo.FindOne(ctx, user.Email, user.Password); err != nil || got.Role != role {
+			t.Fatalf("FindOne after SetRole(%d) = %+v, %v, want the new role", role, got, err)
+		}
+	}
+
+	if err := repo.SetRole(ctx, "nobody@example.com", model.RoleAdmin); !errors.Is(err, model.ErrNotFound) {
+		t.Fatalf("SetRole of an unknown email = %v, want not found", err)
+	}
+}
+
+// ImportJobRepository stores a job, follows it to completion, checks that
+// expired jobs are gone and lists jobs by owner.
+func ImportJobRepository(t *testing.T, repo repository.ImportJobRepository) {
+	t.Helper()
+	ctx := context.Background()
+
+	// Stored times lose their monotonic reading and, in SQL, their zone.
+	created := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	job := model.ImportJob{ID: "job-1", Status: model.ImportJobQueued, Total: 2, CreatedAt: created}
+	if err := repo.Create(ctx, job, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	got, err := repo.Find(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	if got.Status != model.ImportJobQueued || got.Total != 2 || !got.CreatedAt.Equal(created) || got.Report != nil {
+		t.Fatalf("Find = %+v, want the queued job", got)
+	}
+
+	finished := created.Add(time.Minute)
+	job.Status = model.ImportJobSucceeded
+	job.Processed = 2
+	job.FinishedAt = &finished
+	job.Report = &model.ImportReport{Key: model.ImportKeySKU, Total: 2, Created: 1, Failed: 1, Rows: []model.ImportRowResult{
+		{Line: 2, Status: model.ImportRowCreated, ProductID: 7, SKU: "KMJ-1"},
+		{Line: 3, Status: model.ImportRowFailed, SKU: "CLN-1", Code: "unknown_brand", Message: "brand does not exist"},
+	}}
+	if err := repo.Update(ctx, job, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	got, err = repo.Find(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Find after Update: %v", err)
+	}
+	if got.Status != model.ImportJobSucceeded || got.Processed != 2 || got.FinishedAt == nil || !got.FinishedAt.Equal(finished) {
+		t.Fatalf("Find after Update = %+v, want the finished job", got)
+	}
+	if got.Report == nil || len(got.Report.Rows) != 2 || got.Report.Rows[1].Code != "unknown_brand" {
+		t.Fatalf("report after Update = %+v, want both rows", got.Report)
+	}
+
+	if _, err := repo.Find(ctx, "job-2"); !errors.Is(err, model.ErrNotFound) {
+		t.Fatalf("Find of an unknown job = %v, want not found", err)
+	}
+
+	// An expired job cannot be found, and the next Create removes it.
+	if err := repo.Update(ctx, job, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("Update to expire: %v", err)
+	}
+	if _, err := repo.Find(ctx, job.ID); !errors.Is(err, model.ErrNotFound) {
+		t.Fatalf("Find of an expired job = %v, want not found", err)
+	}
+
+	if err := repo.Create(ctx, model.ImportJob{ID: "job-2", Status: model.ImportJobQueued, CreatedAt: created}, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Create after expiry: %v", err)
+	}
+	if err := repo.Update(ctx, job, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Update of a removed job: %v", err)
+	}
+	if _, err := repo.Find(ctx, job.ID); !errors.Is(err, model.ErrNotFound) {
+		t.Fatalf("Find of a removed job = %v, want not found", err)
+	}
+
+	// Jobs are listed by the server that owns them, expired ones left out.
+	for _, owned := range []struct {
+		id, owner string
+		expiresAt time.Time
+	}{
+		{"job-3", "api-1", time.Now().Add(time.Hour)},
+		{"job-4", "api-2", time.Now().Add(time.Hour)},
+		{"job-5", "api-1", time.Now().Add(-time.Minute)},
+		{"job-6", "api-1", time.Now().Add(time.Hour)},
+	} {
+		job := model.ImportJob{ID: owned.id, Status: model.ImportJobRunning, CreatedAt: created, Owner: owned.owner}
+		if err := repo.Create(ctx, job, owned.expiresAt); err != nil {
+			t.Fatalf("Create %s: %v", owned.id, err)
+		}
+	}
+
+	jobs, err := repo.FindByOwner(ctx, "api-1")
+	if err != nil {
+		t.Fatalf("FindByOwner: %v", err)
+	}
+	if len(jobs) != 2 || jobs[0].ID != "job-3" || jobs[1].ID != "job-6" || jobs[0].Owner != "api-1" || jobs[0].Status != model.ImportJobRunning {
+		t.Fatalf("FindByOwner = %+v, want job-3 and job-6", jobs)
+	}
+	if got, err := repo.Find(ctx, "job-4"); err != nil || got.Owner != "api-2" {
+		t.Fatalf("Find = %+v, %v, want the owner kept", got, err)
+	}
+	if jobs, err := repo.FindByOwner(ctx, "api-3"); err != nil || len(jobs) != 0 {
+		t.Fatalf("FindByOwner of an owner without jobs = %+v, %v, want none", jobs, err)
+	}
+}
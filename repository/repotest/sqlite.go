@@ -0,0 +1,50 @@
+package repotest
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"crud-product/constant"
+	"crud-product/migration"
+	"crud-product/repository"
+	_ "modernc.org/sqlite"
+)
+
+// NewSQLite opens an isolated, fully migrated SQLite database that lives in the
+// test's temporary directory and is closed when the test finishes.
+func NewSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open("sqlite", repository.SQLiteDSN(path))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migration.NewMigrator(db, constant.DriverSQLite)
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+
+	if err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("migrate sqlite: %v", err)
+	}
+
+	return db
+}
+
+// SeedBrand inserts a brand into a database of the given dialect and returns
+// its ID.
+func SeedBrand(t *testing.T, db *sql.DB, dialect repository.Dialect, name string) int {
+	t.Helper()
+
+	id, err := dialect.InsertID(context.Background(), db, `INSERT INTO brand (name) VALUES (?)`, "brand_id", name)
+	if err != nil {
+		t.Fatalf("seed brand: %v", err)
+	}
+
+	return int(id)
+}
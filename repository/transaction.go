@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"crud-product/logger"
+)
+
+// Transactor runs fn as one unit of work. Repository calls made with the
+// context handed to fn enlist in the same transaction, which is committed when
+// fn returns nil and rolled back when it returns an error or panics. Nested
+// calls join the outer transaction.
+type Transactor interface {
+	WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// querier is the part of *sql.DB and *sql.Tx the repositories use.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type txKey struct{}
+
+type SQLTransactor struct {
+	DB *sql.DB
+}
+
+func NewTransactor(db *sql.DB) Transactor {
+	return &SQLTransactor{
+		DB: db,
+	}
+}
+
+func (t *SQLTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	markWrite(ctx)
+
+	defer func() {
+		if p := recover(); p != nil {
+			rollback(ctx, tx)
+			panic(p)
+		}
+	}()
+
+	txCtx, hooks := withCommitHooks(context.WithValue(ctx, txKey{}, tx))
+	if err = fn(txCtx); err != nil {
+		rollback(ctx, tx)
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	hooks.run()
+	return nil
+}
+
+func rollback(ctx context.Context, tx *sql.Tx) {
+	if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+		logger.FromContext(ctx).Error(err)
+	}
+}
+
+// MemoryTransactor gives the in-memory repositories transaction semantics:
+// their state is snapshotted before fn runs and restored if it fails.
+// Transactions are serialized, and writes made outside a transaction while one
+// is rolling back are lost, which is acceptable for tests.
+type MemoryTransactor struct {
+	mu     sync.Mutex
+	stores []memoryStore
+}
+
+type memoryStore interface {
+	snapshot() func()
+}
+
+type memoryTxKey struct{}
+
+// NewMemoryTransactor covers the given repositories; anything that is not an
+// in-memory repository is ignored.
+func NewMemoryTransactor(repos ...interface{}) Transactor {
+	t := &MemoryTransactor{}
+	for _, repo := range repos {
+		if store, ok := repo.(memoryStore); ok {
+			t.stores = append(t.stores, store)
+		}
+	}
+	return t
+}
+
+func (t *MemoryTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	if ctx.Value(memoryTxKey{}) != nil {
+		return fn(ctx)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	restores := make([]func(), 0, len(t.stores))
+	for _, store := range t.stores {
+		restores = append(restores, store.snapshot())
+	}
+
+	rollback := func() {
+		for _, restore := range restores {
+			restore()
+		}
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			rollback()
+			panic(p)
+		}
+	}()
+
+	txCtx, hooks := withCommitHooks(context.WithValue(ctx, memoryTxKey{}, t))
+	if err = fn(txCtx); err != nil {
+		rollback()
+		return err
+	}
+
+	hooks.run()
+	return nil
+}
+
+// conn returns the transaction carried by ctx, or db when there is none.
+func conn(ctx context.Context, db *sql.DB) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return db
+}
+
+func inTransaction(ctx context.Context) bool {
+	_, ok := ctx.Value(txKey{}).(*sql.Tx)
+	return ok
+}
+
+type hooksKey struct{}
+
+type commitHooks struct {
+	mu  sync.Mutex
+	fns []func()
+}
+
+func withCommitHooks(ctx context.Context) (context.Context, *commitHooks) {
+	hooks := &commitHooks{}
+	return context.WithValue(ctx, hooksKey{}, hooks), hooks
+}
+
+func (h *commitHooks) run() {
+	h.mu.Lock()
+	fns := h.fns
+	h.fns = nil
+	h.mu.Unlock()
+
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+// afterCommit runs fn once the transaction carried by ctx commits, or right
+// away when ctx carries no transaction. fn is dropped on rollback.
+func afterCommit(ctx context.Context, fn func()) {
+	hooks, ok := ctx.Value(hooksKey{}).(*commitHooks)
+	if !ok {
+		fn()
+		return
+	}
+
+	hooks.mu.Lock()
+	hooks.fns = append(hooks.fns, fn)
+	hooks.mu.Unlock()
+}
@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+// newTxDB opens a scratch SQLite database with a single table of values.
+func newTxDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", SQLiteDSN(filepath.Join(t.TempDir(), "tx.db")))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(`CREATE TABLE item (v INTEGER NOT NULL)`); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	return db
+}
+
+func insertItem(ctx context.Context, db *sql.DB, v int) error {
+	_, err := conn(ctx, db).ExecContext(ctx, `INSERT INTO item (v) VALUES (?)`, v)
+	return err
+}
+
+func countItems(t *testing.T, db *sql.DB) int {
+	t.Helper()
+
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM item`).Scan(&n); err != nil {
+		t.Fatalf("count items: %v", err)
+	}
+	return n
+}
+
+func TestSQLTransactorCommit(t *testing.T) {
+	db := newTxDB(t)
+	transactor := NewTransactor(db)
+
+	err := transactor.WithinTransaction(context.Background(), func(ctx context.Context) error {
+		if !inTransaction(ctx) {
+			t.Fatal("context handed to fn carries no transaction")
+		}
+		return insertItem(ctx, db, 1)
+	})
+	if err != nil {
+		t.Fatalf("WithinTransaction: %v", err)
+	}
+	if n := countItems(t, db); n != 1 {
+		t.Fatalf("items after commit = %d, want 1", n)
+	}
+}
+
+func TestSQLTransactorRollbackOnError(t *testing.T) {
+	db := newTxDB(t)
+	transactor := NewTransactor(db)
+
+	errBoom := errors.New("boom")
+	err := transactor.WithinTransaction(context.Background(), func(ctx context.Context) error {
+		if err := insertItem(ctx, db, 1); err != nil {
+			return err
+		}
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("WithinTransaction = %v, want %v", err, errBoom)
+	}
+	if n := countItems(t, db); n != 0 {
+		t.Fatalf("items after rollback = %d, want 0", n)
+	}
+}
+
+func TestSQLTransactorRollbackOnPanic(t *testing.T) {
+	db := newTxDB(t)
+	transactor := NewTransactor(db)
+
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Fatalf("recovered %v, want the panic to propagate", p)
+			}
+		}()
+
+		transactor.WithinTransaction(context.Background(), func(ctx context.Context) error {
+			if err := insertItem(ctx, db, 1); err != nil {
+				t.Fatalf("insert: %v", err)
+			}
+			panic("boom")
+		})
+	}()
+
+	if n := countItems(t, db); n != 0 {
+		t.Fatalf("items after a panic = %d, want 0", n)
+	}
+
+	// The connection went back to the pool rolled back, not stuck in the
+	// transaction.
+	if err := transactor.WithinTransaction(context.Background(), func(ctx context.Context) error {
+		return insertItem(ctx, db, 2)
+	}); err != nil {
+		t.Fatalf("WithinTransaction after a panic: %v", err)
+	}
+	if n := countItems(t, db); n != 1 {
+		t.Fatalf("items after the next commit = %d, want 1", n)
+	}
+}
+
+func TestSQLTransactorNested(t *testing.T) {
+	db := newTxDB(t)
+	transactor := NewTransactor(db)
+	errBoom := errors.New("boom")
+
+	// The inner call joins the outer transaction, so its failure rolls back
+	// the outer writes too.
+	err := transactor.WithinTransaction(context.Background(), func(outer context.Context) error {
+		if err := insertItem(outer, db, 1); err != nil {
+			return err
+		}
+		return transactor.WithinTransaction(outer, func(inner context.Context) error {
+			if conn(inner, db) != conn(outer, db) {
+				t.Fatal("nested call opened a transaction of its own")
+			}
+			if err := insertItem(inner, db, 2); err != nil {
+				return err
+			}
+			return errBoom
+		})
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("WithinTransaction = %v, want %v", err, errBoom)
+	}
+	if n := countItems(t, db); n != 0 {
+		t.Fatalf("items after the nested failure = %d, want 0", n)
+	}
+
+	// Nothing commits before the outer call does.
+	err = transactor.WithinTransaction(context.Background(), func(outer context.Context) error {
+		if err := transactor.WithinTransaction(outer, func(inner context.Context) error {
+			return insertItem(inner, db, 1)
+		}); err != nil {
+			return err
+		}
+		if err := insertItem(outer, db, 2); err != nil {
+			return err
+		}
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("WithinTransaction = %v, want %v", err, errBoom)
+	}
+	if n := countItems(t, db); n != 0 {
+		t.Fatalf("items after the outer failure = %d, want the nested write rolled back too", n)
+	}
+}
+
+func TestSQLTransactorCommitHooks(t *testing.T) {
+	db := newTxDB(t)
+	transactor := NewTransactor(db)
+
+	var ran []string
+	hook := func(name string) func() {
+		return func() { ran = append(ran, name) }
+	}
+
+	// Outside a transaction the hook runs right away.
+	afterCommit(context.Background(), hook("direct"))
+	if len(ran) != 1 {
+		t.Fatalf("hooks run = %v, want the direct one", ran)
+	}
+
+	ran = nil
+	err := transactor.WithinTransaction(context.Background(), func(outer context.Context) error {
+		afterCommit(outer, hook("outer"))
+		if err := transactor.WithinTransaction(outer, func(inner context.Context) error {
+			afterCommit(inner, hook("inner"))
+			return insertItem(inner, db, 1)
+		}); err != nil {
+			return err
+		}
+
+		if len(ran) != 0 {
+			t.Fatalf("hooks run before commit: %v", ran)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithinTransaction: %v", err)
+	}
+	if len(ran) != 2 || ran[0] != "outer" || ran[1] != "inner" {
+		t.Fatalf("hooks run after commit = %v, want outer then inner", ran)
+	}
+
+	// Rolled back work drops its hooks.
+	ran = nil
+	transactor.WithinTransaction(context.Background(), func(ctx context.Context) error {
+		afterCommit(ctx, hook("rolled back"))
+		return errors.New("boom")
+	})
+	if len(ran) != 0 {
+		t.Fatalf("hooks run after rollback: %v", ran)
+	}
+}
@@ -3,8 +3,6 @@ package repository
 import (
 	"context"
 	"database/sql"
-	"errors"
-	"fmt"
 	"time"
 
 	"crud-product/model"
@@ -13,20 +11,49 @@ import (
 )
 
 type User struct {
-	DB *sql.DB
+	DB       *sql.DB
+	Dialect  Dialect
+	Timeouts Timeouts
 }
 
 type ErrorResponse struct {
 	Err string
 }
 
-func NewUserRepository(db *sql.DB) UserRepository {
+func NewUserRepository(db *sql.DB, opts ...Option) UserRepository {
+	o := newOptions(opts)
+
+	return &User{
+		DB:       db,
+		Dialect:  MySQL,
+		Timeouts: o.timeouts,
+	}
+}
+
+func NewPostgresUserRepository(db *sql.DB, opts ...Option) UserRepository {
+	o := newOptions(opts)
+
+	return &User{
+		DB:       db,
+		Dialect:  Postgres,
+		Timeouts: o.timeouts,
+	}
+}
+
+func NewSQLiteUserRepository(db *sql.DB, opts ...Option) UserRepository {
+	o := newOptions(opts)
+
 	return &User{
-		DB: db,
+		DB:       db,
+		Dialect:  SQLite,
+		Timeouts: o.timeouts,
 	}
 }
 
 func (u *User) FindOne(ctx context.Context, email, password string) (model.User, error) {
+	ctx, cancel := u.Timeouts.context(ctx, "user.find_one")
+	defer cancel()
+
 	query := `
 			SELECT 
 				user_id,
@@ -35,28 +62,40 @@ func (u *User) FindOne(ctx context.Context, email, password string) (model.User,
 				password,
 			    role
 			FROM 
-				user
+				` + u.Dialect.quote("user") + `
 			WHERE
 				email = ?`
 
 	user := model.User{}
-	err := u.DB.QueryRowContext(ctx, query, email).Scan(
+	err := conn(ctx, u.DB).QueryRowContext(ctx, u.Dialect.rebind(query), email).Scan(
 		&user.Id, &user.Name, &user.Email,
 		&user.Password, &user.Role,
 	)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return user, fmt.Errorf("data not found %s", err.Error())
+			return model.User{}, errInvalidCredentials()
 		}
-		return user, err
+		return model.User{}, err
+	}
+
+	if err := authenticate(&user, password); err != nil {
+		return model.User{}, err
 	}
 
+	return user, nil
+}
+
+// authenticate checks password against the stored hash and, when it matches,
+// signs a session token for the user.
+func authenticate(user *model.User, password string) error {
 	expiresAt := time.Now().Add(time.Minute * 100000).Unix()
 
+	// Any failure, not only a mismatch, rejects the login: a stored hash that
+	// bcrypt cannot read must never yield a token.
 	errf := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
-	if errf != nil && errf == bcrypt.ErrMismatchedHashAndPassword { //Password does not match!
-		return user, errors.New("invalid password")
+	if errf != nil {
+		return errInvalidCredentials()
 	}
 
 	tk := &model.Token{
@@ -71,14 +110,14 @@ func (u *User) FindOne(ctx context.Context, email, password string) (model.User,
 
 	token := jwt.NewWithClaims(jwt.GetSigningMethod("HS256"), tk)
 
-	tokenString, error := token.SignedString([]byte("secret"))
-	if error != nil {
-		return user, err
+	tokenString, err := token.SignedString([]byte("secret"))
+	if err != nil {
+		return err
 	}
 
 	user.Token = tokenString
 
-	return user, err
+	return nil
 }
 
 func (u *User) Store(ctx context.Context, user model.User) error {
@@ -89,19 +128,54 @@ func (u *User) Store(ctx context.Context, user model.User) error {
 
 	user.Password = string(pass)
 
+	ctx, cancel := u.Timeouts.context(ctx, "user.store")
+	defer cancel()
+
 	query := `
-				INSERT INTO user 
+				INSERT INTO ` + u.Dialect.quote("user") + `
 					(name, email, password, gender, role)
 				VALUES
 					(?, ?, ?, ?, ?)
 			`
 
-	_, err = u.DB.ExecContext(ctx, query,
+	_, err = conn(ctx, u.DB).ExecContext(ctx, u.Dialect.rebind(query),
 		user.Name, user.Email, user.Password, user.Gender, user.Role)
 
+	if isUniqueViolation(err) {
+		return errEmailTaken()
+	}
+
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+func (u *User) SetRole(ctx context.Context, email string, role int) error {
+	ctx, cancel := u.Timeouts.context(ctx, "user.set_role")
+	defer cancel()
+
+	table := u.Dialect.quote("user")
+	res, err := conn(ctx, u.DB).ExecContext(ctx, u.Dialect.rebind(`UPDATE `+table+` SET role = ? WHERE email = ?`), role, email)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+
+	// MySQL does not count rows left unchanged, so tell them apart from a
+	// missing user.
+	var one int
+	err = conn(ctx, u.DB).QueryRowContext(ctx, u.Dialect.rebind(`SELECT 1 FROM `+table+` WHERE email = ?`), email).Scan(&one)
+	if err == sql.ErrNoRows {
+		return errUserNotFound()
+	}
+	return err
+}
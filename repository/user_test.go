@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"crud-product/model"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthenticate(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("rahasia123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		stored   string
+		password string
+		ok       bool
+	}{
+		{name: "match", stored: string(hash), password: "rahasia123", ok: true},
+		{name: "mismatch", stored: string(hash), password: "wrong-password"},
+		{name: "malformed hash", stored: "$2a$10$short", password: "rahasia123"},
+		{name: "plaintext stored", stored: "rahasia123", password: "rahasia123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := model.User{Id: 1, Email: "budi@example.com", Password: tt.stored}
+			err := authenticate(&user, tt.password)
+
+			if tt.ok {
+				if err != nil || user.Token == "" {
+					t.Fatalf("authenticate = %v with token %q, want a token", err, user.Token)
+				}
+				return
+			}
+
+			if !errors.Is(err, model.ErrUnauthorized) || user.Token != "" {
+				t.Fatalf("authenticate = %v with token %q, want unauthorized and no token", err, user.Token)
+			}
+		})
+	}
+}
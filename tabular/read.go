@@ -0,0 +1,288 @@
+package tabular
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"crud-product/model"
+	"github.com/xuri/excelize/v2"
+)
+
+// Validator validates a parsed product, see validate.Validator.
+type Validator interface {
+	Validate(i interface{}) error
+}
+
+// importColumns are the columns of an import file, in the JSON names of the
+// product fields. The first row of the file names the columns, in any order.
+var importColumns = map[string]bool{
+	"sku":         true,
+	"external_id": true,
+	"name":        true,
+	"price":       true,
+	"stock":       true,
+	"brand_id":    true,
+}
+
+var requiredColumns = []string{"name", "price", "stock", "brand_id"}
+
+// ReadProducts reads the rows of an import file. A file that cannot be read,
+// or whose header lacks a required column or names an unknown one, fails as a
+// whole. Invalid rows do not: their ImportRow carries the error. Blank rows are
+// skipped.
+func ReadProducts(r io.Reader, format string, v Validator) ([]model.ImportRow, error) {
+	var records recordReader
+	switch format {
+	case FormatCSV:
+		records = newCSVReader(r)
+	case FormatXLSX:
+		xr, err := newXLSXReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer xr.Close()
+		records = xr
+	default:
+		return nil, model.NewValidationError("unsupported_format", fmt.Sprintf("format %q is not supported", format))
+	}
+
+	_, header, err := records.Next()
+	if err == io.EOF {
+		return nil, model.NewValidationError("invalid_file", "file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := parseHeader(header)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []model.ImportRow{}
+	for {
+		line, record, err := records.Next()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if blank(record) {
+			continue
+		}
+		rows = append(rows, parseRow(line, columns, record, v))
+	}
+}
+
+func parseHeader(header []string) ([]string, error) {
+	columns := make([]string, len(header))
+	seen := map[string]bool{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		switch {
+		case name == "":
+		case !importColumns[name]:
+			return nil, model.NewValidationError("invalid_file", fmt.Sprintf("column %q is not a product field", name))
+		case seen[name]:
+			return nil, model.NewValidationError("invalid_file", fmt.Sprintf("column %q appears twice", name))
+		}
+		columns[i] = name
+		seen[name] = true
+	}
+
+	var missing []string
+	for _, name := range requiredColumns {
+		if !seen[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, model.NewValidationError("invalid_file", "missing columns: "+strings.Join(missing, ", "))
+	}
+	return columns, nil
+}
+
+func parseRow(line int, columns []string, record []string, v Validator) model.ImportRow {
+	row := model.ImportRow{Line: line}
+	p := &row.Product
+
+	var fields []model.FieldError
+	number := func(column, value string) int {
+		n, err := parseInt(value)
+		if err != nil {
+			fields = append(fields, model.FieldError{Field: column, Rule: "integer", Message: column + " must be an integer"})
+		}
+		return n
+	}
+
+	for i, column := range columns {
+		if column == "" || i >= len(record) {
+			continue
+		}
+
+		value := strings.TrimSpace(record[i])
+		switch column {
+		case "sku":
+			p.SKU = value
+		case "external_id":
+			p.ExternalID = value
+		case "name":
+			p.Name = value
+		case "price":
+			p.Price = number(column, value)
+		case "stock":
+			p.Stock = number(column, value)
+		case "brand_id":
+			p.BrandID = number(column, value)
+		}
+	}
+
+	err := v.Validate(*p)
+	if len(fields) == 0 {
+		row.Err = err
+		return row
+	}
+
+	// Report the other invalid fields too, but not the unparsed numbers again.
+	var verr *model.Error
+	if errors.As(err, &verr) {
+		for _, fe := range verr.Fields {
+			if !hasField(fields, fe.Field) {
+				fields = append(fields, fe)
+			}
+		}
+	}
+
+	verr = model.NewValidationError("validation_failed", "row has invalid fields")
+	verr.Fields = fields
+	row.Err = verr
+	return row
+}
+
+func hasField(fields []model.FieldError, name string) bool {
+	for _, fe := range fields {
+		if fe.Field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseInt reads an integer, also when a spreadsheet stored it as a whole
+// float such as "150000.0". An empty cell is 0.
+func parseInt(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	if n, err := strconv.Atoi(value); err == nil {
+		return n, nil
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f != math.Trunc(f) || math.Abs(f) > math.MaxInt32 {
+		return 0, errors.New("not an integer")
+	}
+	return int(f), nil
+}
+
+func blank(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// recordReader yields the rows of a file with their line or row number, and
+// io.EOF after the last.
+type recordReader interface {
+	Next() (int, []string, error)
+}
+
+type csvReader struct {
+	r *csv.Reader
+}
+
+func newCSVReader(r io.Reader) *csvReader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	return &csvReader{r: cr}
+}
+
+func (c *csvReader) Next() (int, []string, error) {
+	record, err := c.r.Read()
+	if err == io.EOF {
+		return 0, nil, err
+	}
+
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return 0, nil, model.NewValidationError("invalid_file", fmt.Sprintf("line %d is not valid CSV: %v", parseErr.StartLine, parseErr.Err))
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	line, _ := c.r.FieldPos(0)
+	return line, record, nil
+}
+
+// xlsxReader reads the first sheet of a workbook row by row.
+type xlsxReader struct {
+	file *excelize.File
+	rows *excelize.Rows
+	row  int
+}
+
+func newXLSXReader(r io.Reader) (*xlsxReader, error) {
+	file, err := excelize.OpenReader(r, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, model.NewValidationError("invalid_file", "file is not a valid XLSX workbook")
+	}
+
+	sheets := file.GetSheetList()
+	if len(sheets) == 0 {
+		file.Close()
+		return nil, model.NewValidationError("invalid_file", "workbook has no sheets")
+	}
+
+	rows, err := file.Rows(sheets[0])
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &xlsxReader{file: file, rows: rows}, nil
+}
+
+func (x *xlsxReader) Next() (int, []string, error) {
+	if !x.rows.Next() {
+		if err := x.rows.Error(); err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, io.EOF
+	}
+	x.row++
+
+	record, err := x.rows.Columns(excelize.Options{RawCellValue: true})
+	if err != nil {
+		return 0, nil, err
+	}
+	return x.row, record, nil
+}
+
+func (x *xlsxReader) Close() error {
+	if err := x.rows.Close(); err != nil {
+		return err
+	}
+	return x.file.Close()
+}
@@ -0,0 +1,28 @@
+// Package tabular reads products from CSV and XLSX import files and writes
+// them as CSV, XLSX or JSON Lines exports.
+package tabular
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"crud-product/model"
+)
+
+// The file formats of imports and exports. NDJSON is only written.
+const (
+	FormatCSV    = "csv"
+	FormatXLSX   = "xlsx"
+	FormatNDJSON = "ndjson"
+)
+
+// FormatOf returns the format of an import file by its extension.
+func FormatOf(name string) (string, error) {
+	switch ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), ".")); ext {
+	case FormatCSV, FormatXLSX:
+		return ext, nil
+	default:
+		return "", model.NewValidationError("unsupported_format", fmt.Sprintf("%s is not a .csv or .xlsx file", name))
+	}
+}
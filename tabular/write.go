@@ -0,0 +1,259 @@
+package tabular
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"crud-product/model"
+	"github.com/xuri/excelize/v2"
+)
+
+// exportColumns are the columns an export can hold, in the JSON names of the
+// product fields plus status, "active" or "deleted".
+var exportColumns = map[string]func(model.Product) interface{}{
+	"id":          func(p model.Product) interface{} { return p.ID },
+	"sku":         func(p model.Product) interface{} { return p.SKU },
+	"external_id": func(p model.Product) interface{} { return p.ExternalID },
+	"name":        func(p model.Product) interface{} { return p.Name },
+	"price":       func(p model.Product) interface{} { return p.Price },
+	"stock":       func(p model.Product) interface{} { return p.Stock },
+	"brand_id":    func(p model.Product) interface{} { return p.BrandID },
+	"version":     func(p model.Product) interface{} { return p.Version },
+	"status":      status,
+}
+
+// DefaultColumns are the columns of an import file, so that a CSV or XLSX
+// export can be edited and imported again.
+var DefaultColumns = []string{"sku", "external_id", "name", "price", "stock", "brand_id"}
+
+func status(p model.Product) interface{} {
+	if p.Deleted {
+		return model.StatusDeleted
+	}
+	return model.StatusActive
+}
+
+// Columns checks the column names of an export and returns them normalized,
+// or DefaultColumns when there are none.
+func Columns(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return DefaultColumns, nil
+	}
+
+	columns := make([]string, 0, len(names))
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch {
+		case exportColumns[name] == nil:
+			return nil, model.NewValidationError("invalid_columns", fmt.Sprintf("column %q is not a product field", name))
+		case seen[name]:
+			return nil, model.NewValidationError("invalid_columns", fmt.Sprintf("column %q appears twice", name))
+		}
+		columns = append(columns, name)
+		seen[name] = true
+	}
+	return columns, nil
+}
+
+// ContentType returns the media type of an export format.
+func ContentType(format string) string {
+	switch format {
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	default:
+		return "text/csv; charset=utf-8"
+	}
+}
+
+// Writer writes products as the rows of an export, in the columns it was
+// created with.
+type Writer interface {
+	Write(model.Product) error
+	// Flush writes out what is still buffered. The export is incomplete
+	// until it returns without error.
+	Flush() error
+	// Close releases what the writer holds, flushed or not.
+	Close() error
+}
+
+// NewWriter returns a Writer of format that writes to w. CSV and XLSX exports
+// start with a header row naming the columns; NDJSON exports write one JSON
+// object per product.
+func NewWriter(w io.Writer, format string, columns []string) (Writer, error) {
+	values := make([]func(model.Product) interface{}, len(columns))
+	for i, name := range columns {
+		values[i] = exportColumns[name]
+		if values[i] == nil {
+			return nil, model.NewValidationError("invalid_columns", fmt.Sprintf("column %q is not a product field", name))
+		}
+	}
+
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, columns, values)
+	case FormatXLSX:
+		return newXLSXWriter(w, columns, values)
+	case FormatNDJSON:
+		return newNDJSONWriter(w, columns, values), nil
+	default:
+		return nil, model.NewValidationError("unsupported_format", fmt.Sprintf("format %q is not supported", format))
+	}
+}
+
+type csvWriter struct {
+	w      *csv.Writer
+	values []func(model.Product) interface{}
+	record []string
+}
+
+func newCSVWriter(w io.Writer, columns []string, values []func(model.Product) interface{}) (*csvWriter, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return nil, err
+	}
+	return &csvWriter{w: cw, values: values, record: make([]string, len(values))}, nil
+}
+
+func (c *csvWriter) Write(p model.Product) error {
+	for i, value := range c.values {
+		switch v := value(p).(type) {
+		case int:
+			c.record[i] = strconv.Itoa(v)
+		default:
+			c.record[i] = fmt.Sprint(v)
+		}
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+	return nil
+}
+
+// xlsxWriter streams rows into the single sheet of a workbook. excelize keeps
+// them in a temporary file once they outgrow its buffer; the workbook itself
+// is only written to w on Flush.
+type xlsxWriter struct {
+	w      io.Writer
+	file   *excelize.File
+	sheet  *excelize.StreamWriter
+	values []func(model.Product) interface{}
+	row    int
+}
+
+func newXLSXWriter(w io.Writer, columns []string, values []func(model.Product) interface{}) (*xlsxWriter, error) {
+	file := excelize.NewFile()
+	file.SetSheetName(file.GetSheetName(0), "Products")
+
+	sheet, err := file.NewStreamWriter("Products")
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	x := &xlsxWriter{w: w, file: file, sheet: sheet, values: values}
+
+	header := make([]interface{}, len(columns))
+	for i, name := range columns {
+		header[i] = name
+	}
+	if err := x.writeRow(header); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return x, nil
+}
+
+func (x *xlsxWriter) Write(p model.Product) error {
+	row := make([]interface{}, len(x.values))
+	for i, value := range x.values {
+		row[i] = value(p)
+	}
+	return x.writeRow(row)
+}
+
+func (x *xlsxWriter) writeRow(row []interface{}) error {
+	x.row++
+	if x.row > excelize.TotalRows {
+		return model.NewUnprocessableError("too_many_rows", fmt.Sprintf("an XLSX sheet holds at most %d rows; export as CSV or NDJSON instead", excelize.TotalRows))
+	}
+
+	cell, err := excelize.CoordinatesToCellName(1, x.row)
+	if err != nil {
+		return err
+	}
+	return x.sheet.SetRow(cell, row)
+}
+
+func (x *xlsxWriter) Flush() error {
+	if err := x.sheet.Flush(); err != nil {
+		return err
+	}
+	return x.file.Write(x.w)
+}
+
+// Close removes the temporary files of the workbook.
+func (x *xlsxWriter) Close() error {
+	return x.file.Close()
+}
+
+type ndjsonWriter struct {
+	w       *bufio.Writer
+	columns []string
+	values  []func(model.Product) interface{}
+}
+
+func newNDJSONWriter(w io.Writer, columns []string, values []func(model.Product) interface{}) *ndjsonWriter {
+	keys := make([]string, len(columns))
+	for i, name := range columns {
+		key, _ := json.Marshal(name)
+		keys[i] = string(key)
+	}
+	return &ndjsonWriter{w: bufio.NewWriter(w), columns: keys, values: values}
+}
+
+// Write writes the product as one JSON object with its members in column
+// order, which encoding a map would not keep.
+func (n *ndjsonWriter) Write(p model.Product) error {
+	n.w.WriteByte('{')
+	for i, value := range n.values {
+		if i > 0 {
+			n.w.WriteByte(',')
+		}
+
+		b, err := json.Marshal(value(p))
+		if err != nil {
+			return err
+		}
+		n.w.WriteString(n.columns[i])
+		n.w.WriteByte(':')
+		n.w.Write(b)
+	}
+	n.w.WriteString("}\n")
+
+	// bufio.Writer keeps the first error, so checking once covers every
+	// write above.
+	_, err := n.w.Write(nil)
+	return err
+}
+
+func (n *ndjsonWriter) Flush() error {
+	return n.w.Flush()
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
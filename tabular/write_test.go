@@ -0,0 +1,203 @@
+package tabular
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"crud-product/model"
+	"github.com/xuri/excelize/v2"
+)
+
+var exportProducts = []model.Product{
+	{ID: 1, SKU: "KMJ-1", Name: "Kemeja, Flanel", Price: 150000, Stock: 5, BrandID: 1, Version: 2},
+	{ID: 2, ExternalID: "EXT-2", Name: `Celana "Chino"`, Price: 200000, BrandID: 2, Version: 1, Deleted: true},
+}
+
+type acceptAll struct{}
+
+func (acceptAll) Validate(interface{}) error { return nil }
+
+// export writes exportProducts with a new Writer and flushes it.
+func export(t *testing.T, format string, columns []string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, format, columns)
+	if err != nil {
+		t.Fatalf("NewWriter(%s): %v", format, err)
+	}
+	defer w.Close()
+
+	for _, p := range exportProducts {
+		if err := w.Write(p); err != nil {
+			t.Fatalf("Write(%d): %v", p.ID, err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestColumns(t *testing.T) {
+	columns, err := Columns(nil)
+	if err != nil || strings.Join(columns, ",") != strings.Join(DefaultColumns, ",") {
+		t.Fatalf("Columns(nil) = %v, %v, want the default columns", columns, err)
+	}
+
+	columns, err = Columns([]string{" ID", "Status "})
+	if err != nil || strings.Join(columns, ",") != "id,status" {
+		t.Fatalf("Columns = %v, %v, want id and status", columns, err)
+	}
+
+	for _, names := range [][]string{{"id", "path"}, {"id", "ID"}} {
+		var domainErr *model.Error
+		if _, err := Columns(names); !errors.As(err, &domainErr) || domainErr.Code != "invalid_columns" {
+			t.Fatalf("Columns(%v) = %v, want invalid_columns", names, err)
+		}
+	}
+
+	if _, err := NewWriter(&bytes.Buffer{}, "pdf", DefaultColumns); !errors.Is(err, model.ErrValidation) {
+		t.Fatalf("NewWriter(pdf) = %v, want a validation error", err)
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	got := string(export(t, FormatCSV, []string{"id", "name", "price", "status"}))
+
+	want := "id,name,price,status\n" +
+		"1,\"Kemeja, Flanel\",150000,active\n" +
+		"2,\"Celana \"\"Chino\"\"\",200000,deleted\n"
+	if got != want {
+		t.Fatalf("CSV export = %q, want %q", got, want)
+	}
+}
+
+func TestXLSXWriter(t *testing.T) {
+	data := export(t, FormatXLSX, []string{"id", "name", "status"})
+
+	file, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("open workbook: %v", err)
+	}
+	defer file.Close()
+
+	rows, err := file.GetRows("Products")
+	if err != nil {
+		t.Fatalf("read sheet: %v", err)
+	}
+
+	want := [][]string{
+		{"id", "name", "status"},
+		{"1", "Kemeja, Flanel", "active"},
+		{"2", `Celana "Chino"`, "deleted"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("sheet = %q, want %q", rows, want)
+	}
+	for i := range want {
+		if strings.Join(rows[i], "|") != strings.Join(want[i], "|") {
+			t.Fatalf("row %d = %q, want %q", i+1, rows[i], want[i])
+		}
+	}
+}
+
+// Exports in the default columns can be imported again.
+func TestExportReadsBack(t *testing.T) {
+	for _, format := range []string{FormatCSV, FormatXLSX} {
+		t.Run(format, func(t *testing.T) {
+			rows, err := ReadProducts(bytes.NewReader(export(t, format, DefaultColumns)), format, acceptAll{})
+			if err != nil {
+				t.Fatalf("ReadProducts: %v", err)
+			}
+			if len(rows) != len(exportProducts) {
+				t.Fatalf("read %d rows, want %d", len(rows), len(exportProducts))
+			}
+
+			for i, row := range rows {
+				want := exportProducts[i]
+				got := row.Product
+				if row.Err != nil || got.SKU != want.SKU || got.ExternalID != want.ExternalID || got.Name != want.Name ||
+					got.Price != want.Price || got.Stock != want.Stock || got.BrandID != want.BrandID {
+					t.Fatalf("row %d = %+v, %v, want %+v", i, got, row.Err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNDJSONWriter(t *testing.T) {
+	got := string(export(t, FormatNDJSON, []string{"name", "id", "sku", "status"}))
+
+	// Members keep the column order and numbers stay numbers.
+	want := `{"name":"Kemeja, Flanel","id":1,"sku":"KMJ-1","status":"active"}` + "\n" +
+		`{"name":"Celana \"Chino\"","id":2,"sku":"","status":"deleted"}` + "\n"
+	if got != want {
+		t.Fatalf("NDJSON export = %q, want %q", got, want)
+	}
+}
+
+// failingWriter accepts n bytes and then fails.
+type failingWriter struct {
+	n int
+}
+
+var errDisconnected = errors.New("client disconnected")
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > f.n {
+		written := f.n
+		f.n = 0
+		return written, errDisconnected
+	}
+	f.n -= len(p)
+	return len(p), nil
+}
+
+func TestWriterErrors(t *testing.T) {
+	product := exportProducts[0]
+
+	for _, format := range []string{FormatCSV, FormatXLSX, FormatNDJSON} {
+		t.Run(format, func(t *testing.T) {
+			w, err := NewWriter(&failingWriter{n: 10}, format, DefaultColumns)
+			if err != nil {
+				t.Fatalf("NewWriter: %v", err)
+			}
+			defer w.Close()
+
+			// Rows are buffered, so the failure shows up by Flush at the
+			// latest and is never lost.
+			for i := 0; i < 1000 && err == nil; i++ {
+				err = w.Write(product)
+			}
+			if err == nil {
+				err = w.Flush()
+			}
+			if !errors.Is(err, errDisconnected) {
+				t.Fatalf("export to a failing writer = %v, want %v", err, errDisconnected)
+			}
+		})
+	}
+}
+
+func TestXLSXWriterRowLimit(t *testing.T) {
+	w, err := NewWriter(&bytes.Buffer{}, FormatXLSX, DefaultColumns)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	defer w.Close()
+
+	// Skip ahead to the last row a sheet holds.
+	w.(*xlsxWriter).row = excelize.TotalRows - 1
+
+	if err := w.Write(exportProducts[0]); err != nil {
+		t.Fatalf("Write of the last row: %v", err)
+	}
+
+	var domainErr *model.Error
+	if err := w.Write(exportProducts[1]); !errors.As(err, &domainErr) || domainErr.Code != "too_many_rows" {
+		t.Fatalf("Write past the last row = %v, want too_many_rows", err)
+	}
+}
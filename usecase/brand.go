@@ -0,0 +1,100 @@
+package usecase
+
+import (
+	"context"
+	"crud-product/logger"
+	"crud-product/model"
+	"crud-product/repository"
+	"crud-product/tracing"
+)
+
+type Brand struct {
+	BrandRepo   repository.BrandRepository
+	ProductRepo repository.ProductRepository
+}
+
+func NewBrand(brandRepo repository.BrandRepository, productRepo repository.ProductRepository) BrandUsecase {
+	return &Brand{
+		BrandRepo:   brandRepo,
+		ProductRepo: productRepo,
+	}
+}
+
+func (b *Brand) GetBrands(ctx context.Context) ([]model.Brand, error) {
+	ctx, span := tracing.Start(ctx, "usecase.Brand.GetBrands")
+	defer span.End()
+
+	brands, err := b.BrandRepo.Fetch(ctx)
+	if err != nil {
+		tracing.Fail(span, err)
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	return brands, nil
+}
+
+func (b *Brand) GetBrand(ctx context.Context, brandID int) (*model.Brand, error) {
+	ctx, span := tracing.Start(ctx, "usecase.Brand.GetBrand")
+	defer span.End()
+
+	brand, err := b.BrandRepo.Find(ctx, brandID)
+	if err != nil {
+		tracing.Fail(span, err)
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	return brand, nil
+}
+
+// GetBrandsByIDs returns the brands with the given IDs, keyed by ID. Unknown
+// IDs are left out. There are few brands, so they are read in one query and
+// picked out here.
+func (b *Brand) GetBrandsByIDs(ctx context.Context, brandIDs []int) (map[int]model.Brand, error) {
+	ctx, span := tracing.Start(ctx, "usecase.Brand.GetBrandsByIDs")
+	defer span.End()
+
+	brands, err := b.BrandRepo.Fetch(ctx)
+	if err != nil {
+		tracing.Fail(span, err)
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	wanted := make(map[int]bool, len(brandIDs))
+	for _, id := range brandIDs {
+		wanted[id] = true
+	}
+
+	byID := map[int]model.Brand{}
+	for _, brand := range brands {
+		if wanted[brand.ID] {
+			byID[brand.ID] = brand
+		}
+	}
+	return byID, nil
+}
+
+// GetBrandProducts lists the brand's products, failing with not found when the
+// brand itself does not exist rather than returning an empty list.
+func (b *Brand) GetBrandProducts(ctx context.Context, brandID int, filter model.ProductFilter) ([]model.Product, error) {
+	ctx, span := tracing.Start(ctx, "usecase.Brand.GetBrandProducts")
+	defer span.End()
+
+	if _, err := b.BrandRepo.Find(ctx, brandID); err != nil {
+		tracing.Fail(span, err)
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	filter.BrandID = brandID
+	prod, err := b.ProductRepo.List(ctx, filter)
+	if err != nil {
+		tracing.Fail(span, err)
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	return prod, nil
+}
@@ -0,0 +1,64 @@
+package usecase
+
+import (
+	"context"
+
+	"crud-product/logger"
+	"crud-product/model"
+	"crud-product/repository"
+	"crud-product/tracing"
+)
+
+// Export streams products out of the catalogue one at a time, so that an
+// export never holds more than one product in memory.
+type Export struct {
+	ProductRepo repository.ProductRepository
+	BrandRepo   repository.BrandRepository
+}
+
+func NewExport(productRepo repository.ProductRepository, brandRepo repository.BrandRepository) ExportUsecase {
+	return &Export{
+		ProductRepo: productRepo,
+		BrandRepo:   brandRepo,
+	}
+}
+
+// Export passes every product matching filter to write, in ID order, and
+// returns how many it passed. It fails with not found for an unknown brand
+// before write is first called, and stops at the first error write returns.
+func (e *Export) Export(ctx context.Context, filter model.ExportFilter, write func(model.Product) error) (n int, err error) {
+	ctx, span := tracing.Start(ctx, "usecase.Export.Export")
+	defer span.End()
+
+	defer func() {
+		if err != nil {
+			tracing.Fail(span, err)
+			logger.Error(ctx, err)
+		}
+	}()
+
+	if filter.BrandID > 0 {
+		if _, err := e.BrandRepo.Find(ctx, filter.BrandID); err != nil {
+			return 0, err
+		}
+	}
+
+	it, err := e.ProductRepo.Iterate(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		if errClose := it.Close(); errClose != nil && err == nil {
+			err = errClose
+		}
+	}()
+
+	for it.Next() {
+		if err := write(it.Product()); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, it.Err()
+}
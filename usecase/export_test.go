@@ -0,0 +1,152 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"crud-product/model"
+	"crud-product/repository"
+	"crud-product/usecase"
+)
+
+// fakeIterator steps through products, then reports err, and records Close.
+type fakeIterator struct {
+	products []model.Product
+	product  model.Product
+	err      error
+	closeErr error
+	closed   bool
+}
+
+func (f *fakeIterator) Next() bool {
+	if f.closed || len(f.products) == 0 {
+		return false
+	}
+	f.product, f.products = f.products[0], f.products[1:]
+	return true
+}
+
+func (f *fakeIterator) Product() model.Product { return f.product }
+
+func (f *fakeIterator) Err() error {
+	if len(f.products) > 0 {
+		return nil
+	}
+	return f.err
+}
+
+func (f *fakeIterator) Close() error {
+	f.closed = true
+	return f.closeErr
+}
+
+// iteratingProducts hands out its iterator instead of the memory products.
+type iteratingProducts struct {
+	repository.ProductRepository
+	it    *fakeIterator
+	calls int
+}
+
+func (i *iteratingProducts) Iterate(context.Context, model.ExportFilter) (repository.ProductIterator, error) {
+	i.calls++
+	return i.it, nil
+}
+
+func newExport(it *fakeIterator) (usecase.ExportUsecase, *iteratingProducts) {
+	brands := repository.NewMemoryBrandRepository(model.Brand{ID: 1, Name: "Eiger"})
+	products := &iteratingProducts{ProductRepository: repository.NewMemoryProductRepository(brands), it: it}
+	return usecase.NewExport(products, brands), products
+}
+
+func exportProducts() []model.Product {
+	return []model.Product{{ID: 1, Name: "Kemeja"}, {ID: 2, Name: "Celana"}, {ID: 3, Name: "Jaket"}}
+}
+
+func TestExport(t *testing.T) {
+	it := &fakeIterator{products: exportProducts()}
+	export, _ := newExport(it)
+
+	var ids []int
+	n, err := export.Export(context.Background(), model.ExportFilter{BrandID: 1}, func(p model.Product) error {
+		ids = append(ids, p.ID)
+		return nil
+	})
+	if err != nil || n != 3 || len(ids) != 3 || ids[0] != 1 || ids[2] != 3 {
+		t.Fatalf("Export = %d, %v, wrote %v, want all three products", n, err, ids)
+	}
+	if !it.closed {
+		t.Fatal("iterator left open")
+	}
+}
+
+func TestExportErrors(t *testing.T) {
+	errWrite := errors.New("client disconnected")
+	errRows := errors.New("connection reset")
+	errClose := errors.New("close failed")
+
+	tests := []struct {
+		name    string
+		it      *fakeIterator
+		failAt  int
+		wantN   int
+		wantErr error
+	}{
+		{
+			// The export stops at the failed write and still gives the
+			// connection back.
+			name:    "write fails",
+			it:      &fakeIterator{products: exportProducts(), closeErr: errClose},
+			failAt:  2,
+			wantN:   1,
+			wantErr: errWrite,
+		},
+		{
+			// A query that dies halfway must not pass for a short catalogue.
+			name:    "rows fail",
+			it:      &fakeIterator{products: exportProducts(), err: errRows},
+			wantN:   3,
+			wantErr: errRows,
+		},
+		{
+			name:    "close fails",
+			it:      &fakeIterator{products: exportProducts(), closeErr: errClose},
+			wantN:   3,
+			wantErr: errClose,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			export, _ := newExport(tt.it)
+
+			n, err := export.Export(context.Background(), model.ExportFilter{}, func(p model.Product) error {
+				if p.ID == tt.failAt {
+					return errWrite
+				}
+				return nil
+			})
+			if n != tt.wantN || !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Export = %d, %v, want %d, %v", n, err, tt.wantN, tt.wantErr)
+			}
+			if !tt.it.closed {
+				t.Fatal("iterator left open")
+			}
+		})
+	}
+}
+
+func TestExportUnknownBrand(t *testing.T) {
+	export, products := newExport(&fakeIterator{products: exportProducts()})
+
+	n, err := export.Export(context.Background(), model.ExportFilter{BrandID: 9}, func(model.Product) error {
+		t.Fatal("write called for an unknown brand")
+		return nil
+	})
+	if n != 0 || !errors.Is(err, model.ErrNotFound) {
+		t.Fatalf("Export = %d, %v, want not found", n, err)
+	}
+	if products.calls != 0 {
+		t.Fatalf("Iterate called %d times, want none", products.calls)
+	}
+}
@@ -0,0 +1,489 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"crud-product/logger"
+	"crud-product/metrics"
+	"crud-product/model"
+	"crud-product/repository"
+	"crud-product/tracing"
+	log "github.com/sirupsen/logrus"
+)
+
+// errDryRun rolls back the transaction of a dry run.
+var errDryRun = errors.New("dry run")
+
+// Import upserts products from import files. Rows are written in chunks of
+// ChunkSize, each in one transaction. When a row of a chunk fails, the chunk is
+// rolled back and its rows are retried one by one, so that only the failing
+// rows are left out.
+//
+// Background jobs are stored in JobRepo, so any replica can report on them,
+// but run on the replica that started them, one at a time. At most QueueSize
+// jobs wait or run there; further ones are refused. A job is kept until JobTTL
+// after it last changed.
+//
+// Jobs are owned by the replica named Instance. Shutdown cancels and waits for
+// them, and a replica restarting fails those a crash left unfinished with
+// FailInterrupted.
+type Import struct {
+	ProductRepo repository.ProductRepository
+	BrandRepo   repository.BrandRepository
+	JobRepo     repository.ImportJobRepository
+	Transactor  repository.Transactor
+	ChunkSize   int
+	JobTTL      time.Duration
+	Instance    string
+
+	queue   chan struct{}
+	running chan struct{}
+
+	// ctx is the parent of every job and is cancelled by Shutdown.
+	ctx    context.Context
+	cancel context.CancelFunc
+	jobs   sync.WaitGroup
+	mu     sync.Mutex
+	closed bool
+}
+
+func NewImport(productRepo repository.ProductRepository, brandRepo repository.BrandRepository, jobRepo repository.ImportJobRepository, transactor repository.Transactor, cfg model.ImportConfig) ImportUsecase {
+	i := &Import{
+		ProductRepo: productRepo,
+		BrandRepo:   brandRepo,
+		JobRepo:     jobRepo,
+		Transactor:  transactor,
+		ChunkSize:   cfg.ChunkSize,
+		JobTTL:      time.Duration(cfg.JobTTL),
+		Instance:    cfg.Instance,
+		queue:       make(chan struct{}, cfg.QueueSize),
+		running:     make(chan struct{}, 1),
+	}
+	i.ctx, i.cancel = context.WithCancel(context.Background())
+	return i
+}
+
+// Import imports rows and reports the outcome of each. It only fails when the
+// import could not run, e.g. because the database is down; rows written by
+// then stay written.
+func (i *Import) Import(ctx context.Context, rows []model.ImportRow, opts model.ImportOptions) (*model.ImportReport, error) {
+	ctx, span := tracing.Start(ctx, "usecase.Import.Import")
+	defer span.End()
+
+	report, err := i.run(ctx, rows, opts, func(int) {})
+	if err != nil {
+		tracing.Fail(span, err)
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// StartImport queues rows for import in the background and returns the job to
+// poll with GetImportJob. It fails with a too many requests error when the
+// queue is full or the server is shutting down.
+func (i *Import) StartImport(ctx context.Context, rows []model.ImportRow, opts model.ImportOptions) (*model.ImportJob, error) {
+	// Holding the lock until the job is started keeps Shutdown from waiting
+	// before it is counted.
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.closed {
+		return nil, model.NewTooManyRequestsError("import_shutting_down", "the server is shutting down, retry later")
+	}
+
+	select {
+	case i.queue <- struct{}{}:
+	default:
+		return nil, model.NewTooManyRequestsError("import_queue_full", "too many imports are waiting, retry later")
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		<-i.queue
+		return nil, err
+	}
+
+	job := model.ImportJob{
+		ID:        id,
+		Status:    model.ImportJobQueued,
+		Total:     len(rows),
+		CreatedAt: time.Now().UTC(),
+		Owner:     i.Instance,
+	}
+
+	if err := i.JobRepo.Create(ctx, job, time.Now().Add(i.JobTTL)); err != nil {
+		<-i.queue
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	// The job outlives the request, so it gets a context of its own that
+	// only keeps the request's log fields.
+	jobCtx := logger.WithEntry(i.ctx, logger.FromContext(ctx).WithField("import_job", id))
+	i.jobs.Add(1)
+	go i.runJob(jobCtx, job, rows, opts)
+
+	return &job, nil
+}
+
+// Shutdown refuses new jobs, cancels the queued and running ones and waits
+// until they are marked failed, or until ctx is done.
+func (i *Import) Shutdown(ctx context.Context) error {
+	i.mu.Lock()
+	i.closed = true
+	i.mu.Unlock()
+	i.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		i.jobs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// FailInterrupted marks the jobs this instance left queued or running, having
+// stopped without Shutdown, as failed. It is meant to run before any job is
+// started.
+func (i *Import) FailInterrupted(ctx context.Context) error {
+	if i.Instance == "" {
+		return nil
+	}
+
+	jobs, err := i.JobRepo.FindByOwner(ctx, i.Instance)
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	failed := 0
+	for _, job := range jobs {
+		if job.Status != model.ImportJobQueued && job.Status != model.ImportJobRunning {
+			continue
+		}
+
+		finished := time.Now().UTC()
+		job.Status = model.ImportJobFailed
+		job.Error = "import interrupted: the server restarted"
+		job.FinishedAt = &finished
+		if err := i.JobRepo.Update(ctx, job, time.Now().Add(i.JobTTL)); err != nil {
+			logger.Error(ctx, err)
+			return err
+		}
+		failed++
+	}
+
+	if failed > 0 {
+		logger.FromContext(ctx).WithField("jobs", failed).Warn("failed interrupted import jobs")
+	}
+	return nil
+}
+
+// GetImportJob returns the job with the given ID.
+func (i *Import) GetImportJob(ctx context.Context, id string) (*model.ImportJob, error) {
+	job, err := i.JobRepo.Find(ctx, id)
+	if err != nil {
+		if !errors.Is(err, model.ErrNotFound) {
+			logger.Error(ctx, err)
+		}
+		return nil, err
+	}
+	return job, nil
+}
+
+func (i *Import) runJob(ctx context.Context, job model.ImportJob, rows []model.ImportRow, opts model.ImportOptions) {
+	defer i.jobs.Done()
+	defer func() { <-i.queue }()
+
+	ctx, span := tracing.Start(ctx, "usecase.Import.Job")
+	defer span.End()
+
+	// Once the job is cancelled its last update still has to be stored.
+	saveCtx := logger.WithEntry(context.Background(), logger.FromContext(ctx))
+
+	var report *model.ImportReport
+	var err error
+	select {
+	case i.running <- struct{}{}:
+		defer func() { <-i.running }()
+
+		job.Status = model.ImportJobRunning
+		i.save(ctx, job)
+		logger.FromContext(ctx).WithField("rows", len(rows)).Info("import started")
+
+		report, err = i.run(ctx, rows, opts, func(n int) {
+			job.Processed += n
+			i.save(ctx, job)
+		})
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	finished := time.Now().UTC()
+	job.FinishedAt = &finished
+	switch {
+	case ctx.Err() != nil:
+		job.Status = model.ImportJobFailed
+		job.Error = "import interrupted: the server shut down"
+	case err != nil:
+		job.Status = model.ImportJobFailed
+		job.Error = "import stopped: internal error"
+	default:
+		job.Status = model.ImportJobSucceeded
+		job.Processed = job.Total
+		job.Report = report
+	}
+	i.save(saveCtx, job)
+
+	if ctx.Err() != nil {
+		tracing.Fail(span, ctx.Err())
+		logger.FromContext(ctx).WithField("processed", job.Processed).Warn("import interrupted")
+		return
+	}
+	if err != nil {
+		tracing.Fail(span, err)
+		logger.Error(ctx, err)
+		return
+	}
+
+	logger.FromContext(ctx).WithFields(log.Fields{
+		"created": report.Created,
+		"updated": report.Updated,
+		"failed":  report.Failed,
+	}).Info("import finished")
+}
+
+// save stores the job's progress. A failure only leaves pollers with older
+// progress, so the import carries on.
+func (i *Import) save(ctx context.Context, job model.ImportJob) {
+	if err := i.JobRepo.Update(ctx, job, time.Now().Add(i.JobTTL)); err != nil {
+		logger.FromContext(ctx).WithError(err).Warn("save import job")
+	}
+}
+
+// run imports rows and calls progress with the number of rows done after each
+// chunk.
+func (i *Import) run(ctx context.Context, rows []model.ImportRow, opts model.ImportOptions, progress func(int)) (*model.ImportReport, error) {
+	if opts.Key == "" {
+		opts.Key = model.ImportKeySKU
+	}
+	if opts.Key != model.ImportKeySKU && opts.Key != model.ImportKeyExternalID {
+		return nil, model.NewValidationError("invalid_import_key", fmt.Sprintf("products cannot be matched by %q", opts.Key))
+	}
+
+	brands, err := i.BrandRepo.Fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	knownBrands := make(map[int]bool, len(brands))
+	for _, b := range brands {
+		knownBrands[b.ID] = true
+	}
+
+	// Rows are checked up front against the file itself, so that dry runs,
+	// whose chunks do not see each other's writes, catch duplicates too.
+	results := make([]model.ImportRowResult, len(rows))
+	pending := make([]int, 0, len(rows))
+	seen := map[string]map[string]int{
+		model.ImportKeySKU:        {},
+		model.ImportKeyExternalID: {},
+	}
+	for n, row := range rows {
+		res := &results[n]
+		res.Line = row.Line
+		res.SKU = row.Product.SKU
+		res.ExternalID = row.Product.ExternalID
+
+		switch dupKey, dupLine := duplicate(seen, row.Product); {
+		case row.Err != nil:
+			fail(res, row.Err)
+		case row.Product.Ref(opts.Key) == "":
+			fail(res, model.NewValidationError("missing_key", fmt.Sprintf("%s is required to match products", opts.Key)))
+		case dupLine > 0:
+			fail(res, model.NewValidationError("duplicate_row", fmt.Sprintf("%s %q is already on line %d", dupKey, row.Product.Ref(dupKey), dupLine)))
+		case !knownBrands[row.Product.BrandID]:
+			fail(res, model.NewValidationError("unknown_brand", "brand does not exist"))
+		default:
+			for key, lines := range seen {
+				if ref := row.Product.Ref(key); ref != "" {
+					lines[ref] = row.Line
+				}
+			}
+			pending = append(pending, n)
+		}
+	}
+	progress(len(rows) - len(pending))
+
+	chunkSize := i.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = len(pending)
+	}
+
+	for start := 0; start < len(pending); start += chunkSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		end := start + chunkSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+
+		chunk := pending[start:end]
+		err := i.writeChunk(ctx, rows, results, chunk, opts)
+
+		var rowErr *model.Error
+		if errors.As(err, &rowErr) {
+			for _, n := range chunk {
+				err := i.writeChunk(ctx, rows, results, []int{n}, opts)
+				if errors.As(err, &rowErr) {
+					fail(&results[n], err)
+				} else if err != nil {
+					return nil, err
+				}
+			}
+		} else if err != nil {
+			return nil, err
+		}
+
+		progress(len(chunk))
+	}
+
+	report := &model.ImportReport{Key: opts.Key, DryRun: opts.DryRun, Total: len(rows), Rows: results}
+	for _, res := range results {
+		switch res.Status {
+		case model.ImportRowCreated:
+			report.Created++
+		case model.ImportRowUpdated:
+			report.Updated++
+		default:
+			report.Failed++
+		}
+
+		if !opts.DryRun {
+			metrics.ImportedRows.WithLabelValues(res.Status).Inc()
+		}
+	}
+	return report, nil
+}
+
+// duplicate returns the key and line of an earlier row with the same SKU or
+// external ID as product, or a zero line.
+func duplicate(seen map[string]map[string]int, product model.Product) (string, int) {
+	for _, key := range []string{model.ImportKeySKU, model.ImportKeyExternalID} {
+		if ref := product.Ref(key); ref != "" && seen[key][ref] > 0 {
+			return key, seen[key][ref]
+		}
+	}
+	return "", 0
+}
+
+// writeChunk upserts the rows at the given indexes in one transaction and
+// records their outcome in results. A dry run rolls the transaction back.
+func (i *Import) writeChunk(ctx context.Context, rows []model.ImportRow, results []model.ImportRowResult, chunk []int, opts model.ImportOptions) error {
+	err := i.Transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		refs := make([]string, 0, len(chunk))
+		for _, n := range chunk {
+			refs = append(refs, rows[n].Product.Ref(opts.Key))
+		}
+
+		existing, err := i.ProductRepo.FindByRefs(ctx, opts.Key, refs)
+		if err != nil {
+			return err
+		}
+
+		for _, n := range chunk {
+			product := rows[n].Product
+			res := &results[n]
+
+			current, ok := existing[product.Ref(opts.Key)]
+			if !ok {
+				id, err := i.ProductRepo.Store(ctx, product)
+				if err != nil {
+					return err
+				}
+
+				res.Status = model.ImportRowCreated
+				res.ProductID = id
+				if opts.DryRun {
+					res.ProductID = 0
+				}
+				continue
+			}
+
+			if err := i.ProductRepo.Patch(ctx, importPatch(product), current.ID); err != nil {
+				return err
+			}
+
+			res.Status = model.ImportRowUpdated
+			res.ProductID = current.ID
+		}
+
+		if opts.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err == errDryRun {
+		return nil
+	}
+	return err
+}
+
+// importPatch sets every field of an import row. A reference left empty in
+// the file keeps the stored one.
+func importPatch(product model.Product) model.ProductPatch {
+	patch := model.ProductPatch{
+		Name:    &product.Name,
+		Price:   &product.Price,
+		Stock:   &product.Stock,
+		BrandID: &product.BrandID,
+	}
+	if product.SKU != "" {
+		patch.SKU = &product.SKU
+	}
+	if product.ExternalID != "" {
+		patch.ExternalID = &product.ExternalID
+	}
+	return patch
+}
+
+// fail records err as the outcome of a row. Errors that are not domain errors
+// are hidden like in API responses.
+func fail(res *model.ImportRowResult, err error) {
+	res.Status = model.ImportRowFailed
+	res.ProductID = 0
+
+	var domainErr *model.Error
+	if !errors.As(err, &domainErr) {
+		res.Code = "internal_error"
+		res.Message = "internal error"
+		return
+	}
+
+	res.Code = domainErr.Code
+	res.Message = domainErr.Message
+	res.Errors = domainErr.Fields
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,418 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"crud-product/model"
+	"crud-product/repository"
+	"crud-product/usecase"
+)
+
+type importFixture struct {
+	products repository.ProductRepository
+	brands   repository.BrandRepository
+	jobs     repository.ImportJobRepository
+	imports  usecase.ImportUsecase
+}
+
+// newImportFixture imports into memory repositories with brands 1 and 2.
+func newImportFixture(cfg model.ImportConfig) *importFixture {
+	brands := repository.NewMemoryBrandRepository(model.Brand{ID: 1, Name: "Eiger"}, model.Brand{ID: 2, Name: "Erigo"})
+	f := &importFixture{
+		products: repository.NewMemoryProductRepository(brands),
+		brands:   brands,
+		jobs:     repository.NewMemoryImportJobRepository(),
+	}
+	f.imports = f.importer(f.products, cfg)
+	return f
+}
+
+// importer returns another Import over the fixture's brands and jobs, as a
+// second replica would have.
+func (f *importFixture) importer(products repository.ProductRepository, cfg model.ImportConfig) usecase.ImportUsecase {
+	return usecase.NewImport(products, f.brands, f.jobs, repository.NewMemoryTransactor(products), cfg)
+}
+
+func (f *importFixture) store(t *testing.T, product model.Product) int {
+	t.Helper()
+
+	id, err := f.products.Store(context.Background(), product)
+	if err != nil {
+		t.Fatalf("store %s: %v", product.Name, err)
+	}
+	return id
+}
+
+func (f *importFixture) all(t *testing.T) []model.Product {
+	t.Helper()
+
+	products, err := f.products.List(context.Background(), model.ProductFilter{Limit: 100})
+	if err != nil {
+		t.Fatalf("list products: %v", err)
+	}
+	return products
+}
+
+func row(line int, sku, externalID, name string, brandID int) model.ImportRow {
+	return model.ImportRow{Line: line, Product: model.Product{SKU: sku, ExternalID: externalID, Name: name, Price: 1000, Stock: 1, BrandID: brandID}}
+}
+
+func expectRows(t *testing.T, report *model.ImportReport, want ...model.ImportRowResult) {
+	t.Helper()
+
+	if len(report.Rows) != len(want) {
+		t.Fatalf("report has %d rows, want %d: %+v", len(report.Rows), len(want), report.Rows)
+	}
+	for n, w := range want {
+		got := report.Rows[n]
+		if got.Line != w.Line || got.Status != w.Status || got.Code != w.Code || (w.ProductID != 0 && got.ProductID != w.ProductID) {
+			t.Fatalf("row %d = %+v, want %+v", n, got, w)
+		}
+	}
+}
+
+func TestImportChunkFallback(t *testing.T) {
+	f := newImportFixture(model.ImportConfig{ChunkSize: 2})
+	f.store(t, model.Product{SKU: "OLD-1", ExternalID: "EXT-1", Name: "Topi", BrandID: 1})
+
+	// The second row collides with the stored product's external ID only
+	// when it is written, failing the first chunk.
+	rows := []model.ImportRow{
+		row(2, "KMJ-1", "", "Kemeja", 1),
+		row(3, "CLN-1", "EXT-1", "Celana", 1),
+		row(4, "JKT-1", "", "Jaket", 2),
+	}
+
+	report, err := f.imports.Import(context.Background(), rows, model.ImportOptions{})
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if report.Key != model.ImportKeySKU || report.Created != 2 || report.Failed != 1 {
+		t.Fatalf("report = %+v, want two rows created and one failed", report)
+	}
+	expectRows(t, report,
+		model.ImportRowResult{Line: 2, Status: model.ImportRowCreated},
+		model.ImportRowResult{Line: 3, Status: model.ImportRowFailed, Code: "external_id_taken"},
+		model.ImportRowResult{Line: 4, Status: model.ImportRowCreated},
+	)
+	if report.Rows[1].ProductID != 0 {
+		t.Fatalf("failed row = %+v, want no product ID", report.Rows[1])
+	}
+
+	// The rolled back chunk left nothing behind: each product exists once.
+	skus := map[string]int{}
+	for _, p := range f.all(t) {
+		skus[p.SKU]++
+	}
+	if len(skus) != 3 || skus["KMJ-1"] != 1 || skus["JKT-1"] != 1 || skus["CLN-1"] != 0 {
+		t.Fatalf("products by SKU = %v, want OLD-1, KMJ-1 and JKT-1 once each", skus)
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+	f := newImportFixture(model.ImportConfig{ChunkSize: 1})
+	id := f.store(t, model.Product{SKU: "KMJ-1", Name: "Kemeja", Price: 150000, BrandID: 1})
+
+	rows := []model.ImportRow{
+		row(2, "KMJ-1", "", "Kemeja Flanel", 2),
+		row(3, "CLN-1", "", "Celana", 1),
+	}
+
+	report, err := f.imports.Import(context.Background(), rows, model.ImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if !report.DryRun || report.Updated != 1 || report.Created != 1 || report.Failed != 0 {
+		t.Fatalf("report = %+v, want one update and one create", report)
+	}
+	expectRows(t, report,
+		model.ImportRowResult{Line: 2, Status: model.ImportRowUpdated, ProductID: id},
+		model.ImportRowResult{Line: 3, Status: model.ImportRowCreated},
+	)
+	if report.Rows[1].ProductID != 0 {
+		t.Fatalf("dry run create = %+v, want no product ID", report.Rows[1])
+	}
+
+	products := f.all(t)
+	if len(products) != 1 {
+		t.Fatalf("products = %+v, want only the stored one", products)
+	}
+	if p := products[0]; p.Name != "Kemeja" || p.BrandID != 1 || p.Price != 150000 || p.Version != 1 {
+		t.Fatalf("stored product = %+v, want it unchanged", p)
+	}
+}
+
+func TestImportDuplicateKeys(t *testing.T) {
+	rows := []model.ImportRow{
+		row(2, "KMJ-1", "EXT-1", "Kemeja", 1),
+		row(3, "KMJ-1", "", "Kemeja Lagi", 1),
+		row(4, "CLN-1", "EXT-1", "Celana", 1),
+		row(5, "", "EXT-2", "Jaket", 1),
+		row(6, "TOP-1", "", "Topi", 9),
+		{Line: 7, Err: model.NewValidationError("validation_failed", "price must be a number")},
+		row(8, "JKT-1", "", "Jaket", 2),
+	}
+
+	tests := []struct {
+		desc   string
+		dryRun bool
+		stored int
+	}{
+		{desc: "import", stored: 2},
+		{desc: "dry run", dryRun: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			f := newImportFixture(model.ImportConfig{ChunkSize: 100})
+
+			report, err := f.imports.Import(context.Background(), rows, model.ImportOptions{DryRun: tt.dryRun})
+			if err != nil {
+				t.Fatalf("Import: %v", err)
+			}
+			expectRows(t, report,
+				model.ImportRowResult{Line: 2, Status: model.ImportRowCreated},
+				model.ImportRowResult{Line: 3, Status: model.ImportRowFailed, Code: "duplicate_row"},
+				model.ImportRowResult{Line: 4, Status: model.ImportRowFailed, Code: "duplicate_row"},
+				model.ImportRowResult{Line: 5, Status: model.ImportRowFailed, Code: "missing_key"},
+				model.ImportRowResult{Line: 6, Status: model.ImportRowFailed, Code: "unknown_brand"},
+				model.ImportRowResult{Line: 7, Status: model.ImportRowFailed, Code: "validation_failed"},
+				model.ImportRowResult{Line: 8, Status: model.ImportRowCreated},
+			)
+			if msg := report.Rows[1].Message; msg != `sku "KMJ-1" is already on line 2` {
+				t.Fatalf("duplicate SKU message = %q", msg)
+			}
+			if msg := report.Rows[2].Message; msg != `external_id "EXT-1" is already on line 2` {
+				t.Fatalf("duplicate external ID message = %q", msg)
+			}
+
+			if n := len(f.all(t)); n != tt.stored {
+				t.Fatalf("%d products stored, want %d", n, tt.stored)
+			}
+		})
+	}
+}
+
+func TestImportByExternalID(t *testing.T) {
+	f := newImportFixture(model.ImportConfig{})
+	id := f.store(t, model.Product{SKU: "KMJ-1", ExternalID: "EXT-1", Name: "Kemeja", BrandID: 1})
+
+	// A row without a SKU keeps the stored one.
+	report, err := f.imports.Import(context.Background(), []model.ImportRow{row(2, "", "EXT-1", "Kemeja Flanel", 1)},
+		model.ImportOptions{Key: model.ImportKeyExternalID})
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	expectRows(t, report, model.ImportRowResult{Line: 2, Status: model.ImportRowUpdated, ProductID: id})
+
+	if p := f.all(t)[0]; p.Name != "Kemeja Flanel" || p.SKU != "KMJ-1" {
+		t.Fatalf("updated product = %+v, want the new name and the stored SKU", p)
+	}
+
+	_, err = f.imports.Import(context.Background(), nil, model.ImportOptions{Key: "name"})
+	if !errors.Is(err, model.ErrValidation) {
+		t.Fatalf("Import by name = %v, want a validation error", err)
+	}
+}
+
+// gatedProducts holds imports at their first write until the gate opens.
+type gatedProducts struct {
+	repository.ProductRepository
+	gate chan struct{}
+}
+
+func (g *gatedProducts) FindByRefs(ctx context.Context, key string, refs []string) (map[string]model.Product, error) {
+	<-g.gate
+	return g.ProductRepository.FindByRefs(ctx, key, refs)
+}
+
+func waitForJob(t *testing.T, imports usecase.ImportUsecase, id string) *model.ImportJob {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := imports.GetImportJob(context.Background(), id)
+		if err != nil {
+			t.Fatalf("GetImportJob: %v", err)
+		}
+		if job.Status == model.ImportJobSucceeded || job.Status == model.ImportJobFailed {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job = %+v, want it to finish", job)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStartImport(t *testing.T) {
+	cfg := model.ImportConfig{ChunkSize: 100, JobTTL: model.Duration(time.Hour), QueueSize: 2}
+	f := newImportFixture(cfg)
+	gated := &gatedProducts{ProductRepository: f.products, gate: make(chan struct{})}
+	imports := f.importer(gated, cfg)
+	ctx := context.Background()
+
+	rows := []model.ImportRow{row(2, "KMJ-1", "", "Kemeja", 1)}
+
+	first, err := imports.StartImport(ctx, rows, model.ImportOptions{})
+	if err != nil {
+		t.Fatalf("StartImport: %v", err)
+	}
+	if first.Status != model.ImportJobQueued || first.Total != 1 {
+		t.Fatalf("job = %+v, want it queued", first)
+	}
+
+	second, err := imports.StartImport(ctx, rows, model.ImportOptions{})
+	if err != nil {
+		t.Fatalf("StartImport second: %v", err)
+	}
+
+	// Both places in the queue are taken until the first job finishes.
+	_, err = imports.StartImport(ctx, rows, model.ImportOptions{})
+	var domainErr *model.Error
+	if !errors.Is(err, model.ErrTooManyRequests) || !errors.As(err, &domainErr) || domainErr.Code != "import_queue_full" {
+		t.Fatalf("StartImport on a full queue = %v, want import_queue_full", err)
+	}
+
+	// Another replica shares the job store and reports the job as well.
+	replica := f.importer(repository.NewMemoryProductRepository(f.brands), cfg)
+	if job, err := replica.GetImportJob(ctx, first.ID); err != nil || job.ID != first.ID {
+		t.Fatalf("GetImportJob on another replica = %+v, %v, want the job", job, err)
+	}
+
+	close(gated.gate)
+
+	// The jobs run one after the other, in either order, so one of them
+	// creates the product and the other updates it.
+	var created, updated int
+	for _, id := range []string{first.ID, second.ID} {
+		job := waitForJob(t, replica, id)
+		if job.Status != model.ImportJobSucceeded || job.Processed != 1 || job.FinishedAt == nil || job.Report == nil {
+			t.Fatalf("job = %+v, want it succeeded with a report", job)
+		}
+		created += job.Report.Created
+		updated += job.Report.Updated
+	}
+	if created != 1 || updated != 1 {
+		t.Fatalf("jobs created %d and updated %d products, want one each", created, updated)
+	}
+
+	if _, err := imports.StartImport(ctx, rows, model.ImportOptions{}); err != nil {
+		t.Fatalf("StartImport after the queue drained: %v", err)
+	}
+
+	if _, err := imports.GetImportJob(ctx, "unknown"); !errors.Is(err, model.ErrNotFound) {
+		t.Fatalf("GetImportJob of an unknown job = %v, want not found", err)
+	}
+}
+
+func TestImportShutdown(t *testing.T) {
+	cfg := model.ImportConfig{ChunkSize: 100, JobTTL: model.Duration(time.Hour), QueueSize: 2, Instance: "api-1"}
+	f := newImportFixture(cfg)
+	gated := &gatedProducts{ProductRepository: f.products, gate: make(chan struct{})}
+	imports := f.importer(gated, cfg)
+	ctx := context.Background()
+
+	rows := []model.ImportRow{row(2, "KMJ-1", "", "Kemeja", 1)}
+	var ids []string
+	for n := 0; n < 2; n++ {
+		job, err := imports.StartImport(ctx, rows, model.ImportOptions{})
+		if err != nil {
+			t.Fatalf("StartImport: %v", err)
+		}
+		if job.Owner != "api-1" {
+			t.Fatalf("job owner = %q, want the instance", job.Owner)
+		}
+		ids = append(ids, job.ID)
+	}
+
+	// Wait for one job to run, holding the other in the queue.
+	deadline := time.Now().Add(5 * time.Second)
+	for running := false; !running; {
+		for _, id := range ids {
+			if job, _ := f.jobs.Find(ctx, id); job != nil && job.Status == model.ImportJobRunning {
+				running = true
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no job started running")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// The running job is stuck at its write, so waiting for it times out.
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := imports.Shutdown(timeout); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown with a job stuck = %v, want the deadline exceeded", err)
+	}
+
+	_, err := imports.StartImport(ctx, rows, model.ImportOptions{})
+	var domainErr *model.Error
+	if !errors.Is(err, model.ErrTooManyRequests) || !errors.As(err, &domainErr) || domainErr.Code != "import_shutting_down" {
+		t.Fatalf("StartImport while shutting down = %v, want import_shutting_down", err)
+	}
+
+	close(gated.gate)
+	if err := imports.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	// Both the running and the queued job are failed by the time Shutdown
+	// returns.
+	for _, id := range ids {
+		job, err := f.jobs.Find(ctx, id)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		if job.Status != model.ImportJobFailed || job.FinishedAt == nil || job.Error != "import interrupted: the server shut down" {
+			t.Fatalf("job = %+v, want it failed by the shutdown", job)
+		}
+	}
+}
+
+func TestImportFailInterrupted(t *testing.T) {
+	cfg := model.ImportConfig{ChunkSize: 100, JobTTL: model.Duration(time.Hour), QueueSize: 2, Instance: "api-1"}
+	f := newImportFixture(cfg)
+	ctx := context.Background()
+
+	created := time.Now().UTC()
+	for _, job := range []model.ImportJob{
+		{ID: "running", Status: model.ImportJobRunning, Owner: "api-1"},
+		{ID: "queued", Status: model.ImportJobQueued, Owner: "api-1"},
+		{ID: "done", Status: model.ImportJobSucceeded, Owner: "api-1", FinishedAt: &created},
+		{ID: "other", Status: model.ImportJobRunning, Owner: "api-2"},
+	} {
+		job.CreatedAt = created
+		if err := f.jobs.Create(ctx, job, time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("Create %s: %v", job.ID, err)
+		}
+	}
+
+	// A restarted server fails the unfinished jobs it owned, and leaves those
+	// of other replicas to them.
+	if err := f.imports.FailInterrupted(ctx); err != nil {
+		t.Fatalf("FailInterrupted: %v", err)
+	}
+
+	for id, want := range map[string]string{
+		"running": model.ImportJobFailed,
+		"queued":  model.ImportJobFailed,
+		"done":    model.ImportJobSucceeded,
+		"other":   model.ImportJobRunning,
+	} {
+		job, err := f.imports.GetImportJob(ctx, id)
+		if err != nil {
+			t.Fatalf("GetImportJob %s: %v", id, err)
+		}
+		if job.Status != want {
+			t.Fatalf("job %s status = %s, want %s", id, job.Status, want)
+		}
+		if want == model.ImportJobFailed && (job.FinishedAt == nil || job.Error != "import interrupted: the server restarted") {
+			t.Fatalf("job %s = %+v, want it failed by the restart", id, job)
+		}
+	}
+}
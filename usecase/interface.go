@@ -8,12 +8,35 @@ import (
 type ProductUsecase interface {
 	GetProduct(context.Context, int) (*model.Product, error)
 	GetProductAll(context.Context, int) ([]model.Product, error)
+	ListProducts(context.Context, model.ProductFilter) ([]model.Product, error)
+	GetProductsByBrands(context.Context, []int) (map[int][]model.Product, error)
 	SendProduct(context.Context, model.Product) (*model.Product, error)
 	UpdateProduct(context.Context, model.Product, int) (*model.Product, error)
-	DeleteProduct(context.Context, int) error
+	PatchProduct(context.Context, model.ProductPatch, int) (*model.Product, error)
+	DeleteProduct(context.Context, int, int) error
+}
+
+type BrandUsecase interface {
+	GetBrands(context.Context) ([]model.Brand, error)
+	GetBrand(context.Context, int) (*model.Brand, error)
+	GetBrandsByIDs(context.Context, []int) (map[int]model.Brand, error)
+	GetBrandProducts(context.Context, int, model.ProductFilter) ([]model.Product, error)
 }
 
 type UserUsecase interface {
 	Login(context.Context, model.User) (model.User, error)
 	CreateUser(context.Context, model.User) error
-}
\ No newline at end of file
+	SetUserRole(context.Context, string, int) error
+}
+
+type ImportUsecase interface {
+	Import(context.Context, []model.ImportRow, model.ImportOptions) (*model.ImportReport, error)
+	StartImport(context.Context, []model.ImportRow, model.ImportOptions) (*model.ImportJob, error)
+	GetImportJob(context.Context, string) (*model.ImportJob, error)
+	Shutdown(context.Context) error
+	FailInterrupted(context.Context) error
+}
+
+type ExportUsecase interface {
+	Export(context.Context, model.ExportFilter, func(model.Product) error) (int, error)
+}
@@ -2,26 +2,32 @@ package usecase
 
 import (
 	"context"
+	"crud-product/logger"
 	"crud-product/model"
 	"crud-product/repository"
-	log "github.com/sirupsen/logrus"
+	"crud-product/tracing"
 )
 
 type Product struct {
 	ProductRepo repository.ProductRepository
+	Transactor  repository.Transactor
 }
 
-func NewProduct(productRepo repository.ProductRepository) ProductUsecase {
+func NewProduct(productRepo repository.ProductRepository, transactor repository.Transactor) ProductUsecase {
 	return &Product{
 		ProductRepo: productRepo,
+		Transactor:  transactor,
 	}
 }
 
 func (p *Product) GetProduct(ctx context.Context, productID int) (*model.Product, error) {
+	ctx, span := tracing.Start(ctx, "usecase.Product.GetProduct")
+	defer span.End()
 
 	prod, err := p.ProductRepo.Find(ctx, productID)
 	if err != nil {
-		log.Error(err)
+		tracing.Fail(span, err)
+		logger.Error(ctx, err)
 		return nil, err
 	}
 
@@ -29,10 +35,13 @@ func (p *Product) GetProduct(ctx context.Context, productID int) (*model.Product
 }
 
 func (p *Product) GetProductAll(ctx context.Context, brandID int) ([]model.Product, error) {
+	ctx, span := tracing.Start(ctx, "usecase.Product.GetProductAll")
+	defer span.End()
 
 	prod, err := p.ProductRepo.Fetch(ctx, brandID)
 	if err != nil {
-		log.Error(err)
+		tracing.Fail(span, err)
+		logger.Error(ctx, err)
 		return nil, err
 	}
 
@@ -46,6 +55,10 @@ func (p *Product) GetProductAll(ctx context.Context, brandID int) ([]model.Produ
 		product.Path = v.Path
 		product.Price = v.Price
 		product.Stock = v.Stock
+		product.BrandID = v.BrandID
+		product.SKU = v.SKU
+		product.ExternalID = v.ExternalID
+		product.Version = v.Version
 
 		productList = append(productList, product)
 	}
@@ -53,35 +66,140 @@ func (p *Product) GetProductAll(ctx context.Context, brandID int) ([]model.Produ
 	return productList, nil
 }
 
+func (p *Product) ListProducts(ctx context.Context, filter model.ProductFilter) ([]model.Product, error) {
+	ctx, span := tracing.Start(ctx, "usecase.Product.ListProducts")
+	defer span.End()
+
+	prod, err := p.ProductRepo.List(ctx, filter)
+	if err != nil {
+		tracing.Fail(span, err)
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	return prod, nil
+}
+
+// GetProductsByBrands returns the active products of several brands at once,
+// keyed by brand ID, for callers that would otherwise ask brand by brand.
+func (p *Product) GetProductsByBrands(ctx context.Context, brandIDs []int) (map[int][]model.Product, error) {
+	ctx, span := tracing.Start(ctx, "usecase.Product.GetProductsByBrands")
+	defer span.End()
+
+	prod, err := p.ProductRepo.FetchByBrands(ctx, brandIDs)
+	if err != nil {
+		tracing.Fail(span, err)
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	return prod, nil
+}
+
 func (p *Product) SendProduct(ctx context.Context, product model.Product) (*model.Product, error) {
+	ctx, span := tracing.Start(ctx, "usecase.Product.SendProduct")
+	defer span.End()
 
-	err := p.ProductRepo.Store(ctx, product)
+	id, err := p.ProductRepo.Store(ctx, product)
 	if err != nil {
-		log.Error(err)
+		tracing.Fail(span, err)
+		logger.Error(ctx, err)
 		return nil, err
 	}
 
+	product.ID = id
+	product.Version = 1
 	return &product, nil
 }
 
+// UpdateProduct replaces the product. An empty Path or a zero BrandID keeps the
+// stored value, since not every caller uploads an image or sends the brand. A
+// non-zero Version must match the stored one. It returns the product as stored
+// afterwards.
 func (p *Product) UpdateProduct(ctx context.Context, product model.Product, productID int) (*model.Product, error) {
+	ctx, span := tracing.Start(ctx, "usecase.Product.UpdateProduct")
+	defer span.End()
+
+	var updated *model.Product
+
+	err := p.Transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		current, err := p.ProductRepo.Find(ctx, productID)
+		if err != nil {
+			return err
+		}
+
+		if product.Path == "" {
+			product.Path = current.Path
+		}
+		if product.BrandID == 0 {
+			product.BrandID = current.BrandID
+		}
+		product.ID = productID
+
+		if err := p.ProductRepo.Update(ctx, product, productID); err != nil {
+			return err
+		}
+
+		updated, err = p.ProductRepo.Find(ctx, productID)
+		return err
+	})
+	if err != nil {
+		tracing.Fail(span, err)
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// PatchProduct changes only the fields set in the patch and returns the
+// product as stored afterwards.
+func (p *Product) PatchProduct(ctx context.Context, patch model.ProductPatch, productID int) (*model.Product, error) {
+	ctx, span := tracing.Start(ctx, "usecase.Product.PatchProduct")
+	defer span.End()
 
-	err := p.ProductRepo.Update(ctx, product, productID)
+	var product *model.Product
+
+	err := p.Transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if _, err := p.ProductRepo.Find(ctx, productID); err != nil {
+			return err
+		}
+
+		if err := p.ProductRepo.Patch(ctx, patch, productID); err != nil {
+			return err
+		}
+
+		var err error
+		product, err = p.ProductRepo.Find(ctx, productID)
+		return err
+	})
 	if err != nil {
-		log.Error(err)
+		tracing.Fail(span, err)
+		logger.Error(ctx, err)
 		return nil, err
 	}
 
-	return &product, nil
+	return product, nil
 }
 
-func (p *Product) DeleteProduct(ctx context.Context, productID int) error {
+// DeleteProduct deletes the product; a non-zero version must match the stored
+// one.
+func (p *Product) DeleteProduct(ctx context.Context, productID int, version int) error {
+	ctx, span := tracing.Start(ctx, "usecase.Product.DeleteProduct")
+	defer span.End()
+
+	err := p.Transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if _, err := p.ProductRepo.Find(ctx, productID); err != nil {
+			return err
+		}
 
-	err := p.ProductRepo.Delete(ctx, productID)
+		return p.ProductRepo.Delete(ctx, productID, version)
+	})
 	if err != nil {
-		log.Error(err)
+		tracing.Fail(span, err)
+		logger.Error(ctx, err)
 		return err
 	}
 
 	return nil
-}
\ No newline at end of file
+}
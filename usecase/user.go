@@ -3,9 +3,11 @@ package usecase
 import (
 	"context"
 
+	"crud-product/logger"
+	"crud-product/metrics"
 	"crud-product/model"
 	"crud-product/repository"
-	log "github.com/sirupsen/logrus"
+	"crud-product/tracing"
 )
 
 type User struct {
@@ -19,20 +21,49 @@ func NewUser(userRepo repository.UserRepository) UserUsecase {
 }
 
 func (u *User) Login(ctx context.Context, user model.User) (model.User, error) {
+	ctx, span := tracing.Start(ctx, "usecase.User.Login")
+	defer span.End()
 
 	user, err := u.UserRepo.FindOne(ctx, user.Email, user.Password)
 	if err != nil {
-		log.Error(err)
+		metrics.Logins.WithLabelValues("failure").Inc()
+		tracing.Fail(span, err)
+		logger.Error(ctx, err)
 		return user, err
 	}
 
+	metrics.Logins.WithLabelValues("success").Inc()
 	return user, nil
 }
 
+// CreateUser registers a user with the default role, whatever the input says:
+// registration is public, so only SetUserRole may grant admin rights.
 func (u *User) CreateUser(ctx context.Context, user model.User) error {
+	ctx, span := tracing.Start(ctx, "usecase.User.CreateUser")
+	defer span.End()
+
+	user.Role = model.RoleUser
+
 	err := u.UserRepo.Store(ctx, user)
 	if err != nil {
-		log.Error(err)
+		tracing.Fail(span, err)
+		logger.Error(ctx, err)
+		return err
+	}
+
+	return nil
+}
+
+// SetUserRole changes the role of a user. Callers must check that the request
+// comes from an admin.
+func (u *User) SetUserRole(ctx context.Context, email string, role int) error {
+	ctx, span := tracing.Start(ctx, "usecase.User.SetUserRole")
+	defer span.End()
+
+	err := u.UserRepo.SetRole(ctx, email, role)
+	if err != nil {
+		tracing.Fail(span, err)
+		logger.Error(ctx, err)
 		return err
 	}
 